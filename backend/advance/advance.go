@@ -0,0 +1,230 @@
+// Package advance settles cash advances against the claims filed for them
+// and works out what each employee is owed or owes back.
+package advance
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// linkableStatuses are those of the advances claims can be filed against.
+var linkableStatuses = []models.AdvanceStatus{models.AdvanceApproved, models.AdvanceDisbursed}
+
+// owedStatuses are those of the claims that are approved but not yet paid,
+// so their reimbursable amount is still owed to the claimant.
+var owedStatuses = []models.ClaimStatus{models.StatusApproved, models.StatusPaymentInProgress}
+
+// Link checks that a claim can be filed against an advance: one of the
+// claimant's, approved or disbursed, in the claim's currency.
+func Link(advance *models.CashAdvance, claim *models.Claim) error {
+	if advance.UserID != claim.UserID {
+		return errors.New("Cash advance not found")
+	}
+	linkable := false
+	for _, s := range linkableStatuses {
+		if s == advance.Status {
+			linkable = true
+		}
+	}
+	if !linkable {
+		return errors.New("Claims can only settle approved or disbursed cash advances")
+	}
+	if advance.Currency != claim.Currency {
+		return errors.New("The claim must be in the currency of the cash advance it settles")
+	}
+	return nil
+}
+
+// Settle offsets a claim being approved against the advance it was filed
+// for, up to what is outstanding, and takes the offset off what the claim
+// reimburses. Advances that haven't been disbursed, or are already
+// settled, leave the claim as it is.
+func Settle(tx *gorm.DB, claim *models.Claim) error {
+	if claim.AdvanceID == nil {
+		return nil
+	}
+
+	var advance models.CashAdvance
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&advance, *claim.AdvanceID).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if advance.Status != models.AdvanceDisbursed || advance.Currency != claim.Currency {
+		return nil
+	}
+
+	offset := claim.ReimbursableAmount
+	if advance.Outstanding.LessThan(offset) {
+		offset = advance.Outstanding
+	}
+	if offset.Sign() <= 0 {
+		return nil
+	}
+
+	settlement := models.AdvanceSettlement{
+		AdvanceID: advance.ID,
+		Kind:      models.SettlementClaim,
+		ClaimID:   &claim.ID,
+		Amount:    offset,
+	}
+	if err := tx.Omit(clause.Associations).Create(&settlement).Error; err != nil {
+		return err
+	}
+	if err := reduce(tx, &advance, offset); err != nil {
+		return err
+	}
+
+	claim.AdvanceOffset = offset
+	claim.ReimbursableAmount = claim.ReimbursableAmount.Sub(offset)
+	return nil
+}
+
+// Repay records cash an employee paid back against a disbursed advance,
+// which must have been loaded and locked for update in tx.
+func Repay(tx *gorm.DB, advance *models.CashAdvance, amount money.Decimal, recordedBy *models.User, comments string) (*models.AdvanceSettlement, error) {
+	if advance.Status != models.AdvanceDisbursed {
+		return nil, errors.New("Only disbursed cash advances can be repaid")
+	}
+	amount = amount.RoundTo(advance.Currency)
+	if amount.Sign() <= 0 {
+		return nil, errors.New("Repayment amount must be greater than zero")
+	}
+	if amount.GreaterThan(advance.Outstanding) {
+		return nil, fmt.Errorf("Repayment cannot exceed the %s %s outstanding", advance.Outstanding.StringFixed(money.MinorUnits(advance.Currency)), advance.Currency)
+	}
+
+	settlement := &models.AdvanceSettlement{
+		AdvanceID:    advance.ID,
+		Kind:         models.SettlementRepayment,
+		Amount:       amount,
+		RecordedByID: &recordedBy.ID,
+		Comments:     comments,
+	}
+	if err := tx.Omit(clause.Associations).Create(settlement).Error; err != nil {
+		return nil, err
+	}
+	return settlement, reduce(tx, advance, amount)
+}
+
+// reduce takes a settlement off what is outstanding on an advance,
+// settling it once nothing is left.
+func reduce(tx *gorm.DB, advance *models.CashAdvance, amount money.Decimal) error {
+	advance.Outstanding = advance.Outstanding.Sub(amount)
+	if advance.Outstanding.Sign() <= 0 {
+		now := time.Now()
+		advance.Outstanding = money.Zero
+		advance.Status = models.AdvanceSettled
+		advance.SettledAt = &now
+	}
+	return tx.Model(advance).Updates(map[string]interface{}{
+		"outstanding": advance.Outstanding,
+		"status":      advance.Status,
+		"settled_at":  advance.SettledAt,
+	}).Error
+}
+
+// Balance is where an employee stands in one currency: what their
+// approved claims still owe them against what their disbursed advances
+// still owe the company.
+type Balance struct {
+	UserID   uint         `json:"user_id"`
+	User     *models.User `json:"user,omitempty"`
+	Currency string       `json:"currency"`
+	// Reimbursable is owed on approved claims not yet paid
+	Reimbursable money.Decimal `json:"reimbursable"`
+	// Outstanding is left on disbursed advances
+	Outstanding money.Decimal `json:"outstanding"`
+	// Net is Reimbursable less Outstanding: positive when the employee is
+	// to be reimbursed, negative when it is to be recovered from them
+	Net money.Decimal `json:"net"`
+}
+
+// Balances works out the balance of each employee in each currency they
+// have anything owing in, or only those of one user when userID isn't 0.
+func Balances(db *gorm.DB, userID uint) ([]Balance, error) {
+	type row struct {
+		UserID   uint
+		Currency string
+		Amount   money.Decimal
+	}
+
+	claims := db.Model(&models.Claim{}).
+		Select("user_id, currency, COALESCE(SUM(reimbursable_amount), 0) AS amount").
+		Where("status IN ?", owedStatuses)
+	advances := db.Model(&models.CashAdvance{}).
+		Select("user_id, currency, COALESCE(SUM(outstanding), 0) AS amount").
+		Where("status = ?", models.AdvanceDisbursed)
+	if userID != 0 {
+		claims = claims.Where("user_id = ?", userID)
+		advances = advances.Where("user_id = ?", userID)
+	}
+
+	var owed, outstanding []row
+	if err := claims.Group("user_id, currency").Scan(&owed).Error; err != nil {
+		return nil, err
+	}
+	if err := advances.Group("user_id, currency").Scan(&outstanding).Error; err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		userID   uint
+		currency string
+	}
+	balances := []Balance{}
+	index := map[key]int{}
+	at := func(r row) *Balance {
+		k := key{r.UserID, r.Currency}
+		if i, ok := index[k]; ok {
+			return &balances[i]
+		}
+		index[k] = len(balances)
+		balances = append(balances, Balance{UserID: r.UserID, Currency: r.Currency})
+		return &balances[len(balances)-1]
+	}
+	for _, r := range owed {
+		at(r).Reimbursable = r.Amount
+	}
+	for _, r := range outstanding {
+		at(r).Outstanding = r.Amount
+	}
+
+	// Claims paid entirely by card or advance leave nothing owing
+	all := balances
+	balances = []Balance{}
+	ids := []uint{}
+	for _, b := range all {
+		if b.Reimbursable.IsZero() && b.Outstanding.IsZero() {
+			continue
+		}
+		b.Net = b.Reimbursable.Sub(b.Outstanding)
+		balances = append(balances, b)
+		ids = append(ids, b.UserID)
+	}
+	if len(ids) == 0 {
+		return balances, nil
+	}
+
+	var users []models.User
+	if err := db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for i := range balances {
+		for j := range users {
+			if users[j].ID == balances[i].UserID {
+				balances[i].User = &users[j]
+			}
+		}
+	}
+	return balances, nil
+}
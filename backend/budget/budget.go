@@ -0,0 +1,222 @@
+// Package budget tracks spend against the budgets set per user group or
+// cost center and fiscal period, and holds approvals to them.
+package budget
+
+import (
+	"fmt"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// ClaimItems lists every expense line as (claim_id, line_item_id,
+// claim_type_id, date, amount) in the base currency: the lines of itemized
+// claims, and claims without lines as a single line without an ID, dated
+// the day they were created.
+const ClaimItems = `
+	SELECT claim_id, id AS line_item_id, claim_type_id, date, base_amount AS amount FROM claim_line_items WHERE deleted_at IS NULL
+	UNION ALL
+	SELECT id, NULL, claim_type_id, CAST(created_at AS date), base_amount FROM claims
+	WHERE deleted_at IS NULL AND NOT EXISTS (
+		SELECT 1 FROM claim_line_items
+		WHERE claim_line_items.claim_id = claims.id AND claim_line_items.deleted_at IS NULL
+	)`
+
+// AllocatedItems splits the expense lines of ClaimItems by the allocations
+// covering them, their own or else their claim's, as (claim_id,
+// claim_type_id, date, amount, cost_center_id, project_id). Lines nothing
+// covers are kept whole without a cost center.
+const AllocatedItems = `
+	SELECT items.claim_id, items.claim_type_id, items.date, items.amount * COALESCE(allocations.percent, 100) / 100 AS amount, allocations.cost_center_id, allocations.project_id
+	FROM (` + ClaimItems + `) AS items
+	LEFT JOIN allocations ON allocations.claim_id = items.claim_id AND (
+		allocations.line_item_id = items.line_item_id OR (allocations.line_item_id IS NULL AND NOT EXISTS (
+			SELECT 1 FROM allocations own WHERE own.line_item_id = items.line_item_id
+		))
+	)`
+
+// spend lists what counts towards each budget as (budget_id, claim_id,
+// status, amount): the expense lines of the budget's claim type dated
+// within its period, of claims filed by its group or, split by
+// allocation, charged to its cost center.
+const spend = `
+	SELECT budgets.id AS budget_id, items.claim_id, claims.status, items.amount
+	FROM (` + AllocatedItems + `) AS items
+	JOIN claims ON claims.id = items.claim_id AND claims.deleted_at IS NULL
+	JOIN users ON users.id = claims.user_id
+	JOIN budgets ON budgets.deleted_at IS NULL
+		AND (budgets.user_group_id IS NULL OR budgets.user_group_id = users.user_group_id)
+		AND (budgets.cost_center_id IS NULL OR budgets.cost_center_id = items.cost_center_id)
+		AND (budgets.claim_type_id IS NULL OR budgets.claim_type_id = items.claim_type_id)
+	JOIN fiscal_periods ON fiscal_periods.id = budgets.fiscal_period_id
+		AND items.date BETWEEN fiscal_periods.start_date AND fiscal_periods.end_date`
+
+// Claims still with approvers commit spend; approved ones, including those
+// being paid, consume the budget, as do paid ones.
+var (
+	committedStatuses = []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview}
+	approvedStatuses  = []models.ClaimStatus{models.StatusApproved, models.StatusPaymentInProgress}
+)
+
+// Tracker works out budget spend from the claims in the database.
+type Tracker struct {
+	DB *gorm.DB
+}
+
+func NewTracker(db *gorm.DB) *Tracker {
+	return &Tracker{DB: db}
+}
+
+// Actual is a budget against its spend, in the base currency.
+type Actual struct {
+	Budget models.Budget `json:"budget"`
+	// Committed is claimed and awaiting approval
+	Committed money.Decimal `json:"committed"`
+	// Approved is approved and not yet paid
+	Approved money.Decimal `json:"approved"`
+	Paid     money.Decimal `json:"paid"`
+	// Remaining is the amount less approved and paid spend
+	Remaining money.Decimal `json:"remaining"`
+}
+
+// Actuals works out the spend against each budget.
+func (t *Tracker) Actuals(budgets []models.Budget) ([]Actual, error) {
+	actuals := make([]Actual, 0, len(budgets))
+	if len(budgets) == 0 {
+		return actuals, nil
+	}
+
+	ids := make([]uint, len(budgets))
+	for i, b := range budgets {
+		ids[i] = b.ID
+	}
+	var rows []struct {
+		BudgetID uint
+		Status   models.ClaimStatus
+		Amount   money.Decimal
+	}
+	if err := t.DB.Table("("+spend+") AS spend").
+		Select("budget_id, status, COALESCE(SUM(amount), 0) AS amount").
+		Where("budget_id IN ?", ids).
+		Group("budget_id, status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byBudget := map[uint]*Actual{}
+	for _, b := range budgets {
+		actuals = append(actuals, Actual{Budget: b})
+	}
+	for i := range actuals {
+		byBudget[actuals[i].Budget.ID] = &actuals[i]
+	}
+	for _, row := range rows {
+		actual := byBudget[row.BudgetID]
+		switch {
+		case hasStatus(committedStatuses, row.Status):
+			actual.Committed = actual.Committed.Add(row.Amount)
+		case hasStatus(approvedStatuses, row.Status):
+			actual.Approved = actual.Approved.Add(row.Amount)
+		case row.Status == models.StatusPaid:
+			actual.Paid = actual.Paid.Add(row.Amount)
+		}
+	}
+	for i := range actuals {
+		actual := &actuals[i]
+		actual.Remaining = actual.Budget.Amount.Sub(actual.Approved).Sub(actual.Paid)
+	}
+	return actuals, nil
+}
+
+// Overrun is a budget that approving a claim would take past its amount.
+type Overrun struct {
+	BudgetID    uint                     `json:"budget_id"`
+	Budget      string                   `json:"budget"`
+	Enforcement models.BudgetEnforcement `json:"enforcement"`
+	// Remaining is what was left of the budget, and Claimed the claim's
+	// share of it
+	Remaining money.Decimal `json:"remaining"`
+	Claimed   money.Decimal `json:"claimed"`
+	Message   string        `json:"message"`
+}
+
+// BudgetError is returned when approving a claim would overrun a budget
+// that blocks approvals.
+type BudgetError struct {
+	Overruns []Overrun `json:"overruns"`
+}
+
+func (e *BudgetError) Error() string {
+	if len(e.Overruns) == 1 {
+		return e.Overruns[0].Message
+	}
+	return fmt.Sprintf("Approving this claim exceeds %d budgets", len(e.Overruns))
+}
+
+// Check works out which enforced budgets approving a claim would take past
+// their amount. Only approved and paid claims consume budgets, so the
+// claim's own share is set against what remains.
+func (t *Tracker) Check(claim *models.Claim) ([]Overrun, error) {
+	var shares []struct {
+		BudgetID uint
+		Amount   money.Decimal
+	}
+	if err := t.DB.Table("("+spend+") AS spend").
+		Select("budget_id, COALESCE(SUM(amount), 0) AS amount").
+		Where("claim_id = ?", claim.ID).
+		Group("budget_id").
+		Scan(&shares).Error; err != nil {
+		return nil, err
+	}
+	if len(shares) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(shares))
+	claimed := map[uint]money.Decimal{}
+	for i, share := range shares {
+		ids[i] = share.BudgetID
+		claimed[share.BudgetID] = share.Amount
+	}
+	var budgets []models.Budget
+	if err := t.DB.Preload("FiscalPeriod").Preload("UserGroup").Preload("CostCenter").Preload("ClaimType").
+		Where("id IN ? AND enforcement <> ?", ids, models.EnforceNone).Order("id").
+		Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	actuals, err := t.Actuals(budgets)
+	if err != nil {
+		return nil, err
+	}
+
+	places := money.MinorUnits(claim.BaseCurrency)
+	overruns := []Overrun{}
+	for _, actual := range actuals {
+		share := claimed[actual.Budget.ID]
+		if !share.GreaterThan(actual.Remaining) {
+			continue
+		}
+		over := share.Sub(actual.Remaining).RoundTo(claim.BaseCurrency)
+		overruns = append(overruns, Overrun{
+			BudgetID:    actual.Budget.ID,
+			Budget:      actual.Budget.Label(),
+			Enforcement: actual.Budget.Enforcement,
+			Remaining:   actual.Remaining,
+			Claimed:     share,
+			Message: fmt.Sprintf("Approving this claim takes the %s over by %s %s", actual.Budget.Label(),
+				over.StringFixed(places), claim.BaseCurrency),
+		})
+	}
+	return overruns, nil
+}
+
+func hasStatus(statuses []models.ClaimStatus, status models.ClaimStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
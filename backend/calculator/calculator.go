@@ -0,0 +1,191 @@
+// Package calculator works out the amounts of mileage and per-diem
+// expenses from the rate tables admins manage, so claimants enter what
+// they did rather than what it is worth.
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// maxTripDays caps how long a single per diem can run.
+const maxTripDays = 366
+
+// AnyDestination is the destination of the per-diem rate used where no
+// rate names the destination itself.
+const AnyDestination = "*"
+
+// Calculator looks up the rate in effect for an expense and applies it.
+type Calculator struct {
+	DB *gorm.DB
+}
+
+func NewCalculator(db *gorm.DB) *Calculator {
+	return &Calculator{DB: db}
+}
+
+// RateError is returned when no rate covers an expense: no mileage rate
+// for the vehicle class, or no per-diem rate for the destination, in
+// effect on the day.
+type RateError struct {
+	Kind models.ClaimKind `json:"kind"`
+	// Key is the vehicle class or destination
+	Key  string    `json:"key"`
+	Date time.Time `json:"date"`
+}
+
+func (e *RateError) Error() string {
+	kind := "mileage"
+	if e.Kind == models.KindPerDiem {
+		kind = "per-diem"
+	}
+	return fmt.Sprintf("No %s rate for %s in effect on %s", kind, e.Key, e.Date.Format("2006-01-02"))
+}
+
+// Calculate works out an expense of a calculated kind from its inputs,
+// using the rate version in effect on the day of the expense: the given
+// day for mileage, the trip's first day for a per diem. Input mistakes
+// come back as plain errors and a missing rate as a *RateError.
+func (c *Calculator) Calculate(kind models.ClaimKind, input models.CalculationInput, on time.Time) (*models.Calculation, error) {
+	calculation := &models.Calculation{Kind: kind, Input: input}
+	var err error
+	switch kind {
+	case models.KindMileage:
+		calculation.MileageRate, err = c.mileageRate(&calculation.Input, on)
+	case models.KindPerDiem:
+		calculation.PerDiemRate, err = c.perDiemRate(&calculation.Input)
+	default:
+		return nil, fmt.Errorf("%s amounts are not calculated", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := Compute(calculation); err != nil {
+		return nil, err
+	}
+	return calculation, nil
+}
+
+func (c *Calculator) mileageRate(input *models.CalculationInput, on time.Time) (*models.MileageRate, error) {
+	input.VehicleClass = strings.ToLower(strings.TrimSpace(input.VehicleClass))
+	if input.VehicleClass == "" {
+		return nil, errors.New("Vehicle class is required")
+	}
+
+	day := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, time.UTC)
+	var rate models.MileageRate
+	err := c.DB.Where("vehicle_class = ? AND effective_from <= ?", input.VehicleClass, day).
+		Order("effective_from DESC").First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &RateError{Kind: models.KindMileage, Key: input.VehicleClass, Date: day}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (c *Calculator) perDiemRate(input *models.CalculationInput) (*models.PerDiemRate, error) {
+	input.Destination = strings.ToUpper(strings.TrimSpace(input.Destination))
+	if input.Destination == "" {
+		return nil, errors.New("Destination is required")
+	}
+	start, _, err := tripDays(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// A rate for the destination itself wins over the catch-all rate
+	for _, destination := range []string{input.Destination, AnyDestination} {
+		var rate models.PerDiemRate
+		err := c.DB.Where("destination = ? AND effective_from <= ?", destination, start).
+			Order("effective_from DESC").First(&rate).Error
+		if err == nil {
+			return &rate, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return nil, &RateError{Kind: models.KindPerDiem, Key: input.Destination, Date: start}
+}
+
+// Compute works out a calculation's amount from its inputs and the rate
+// version it holds, without looking anything up, so a stored calculation
+// can be checked by computing it again.
+func Compute(calculation *models.Calculation) error {
+	input := calculation.Input
+	switch {
+	case calculation.Kind == models.KindMileage && calculation.MileageRate != nil:
+		if input.Distance == nil || input.Distance.Sign() <= 0 {
+			return errors.New("Distance must be greater than zero")
+		}
+		rate := calculation.MileageRate
+		calculation.Currency = rate.Currency
+		calculation.Amount = input.Distance.Mul(rate.Rate).RoundTo(rate.Currency)
+
+	case calculation.Kind == models.KindPerDiem && calculation.PerDiemRate != nil:
+		_, days, err := tripDays(&input)
+		if err != nil {
+			return err
+		}
+		rate := calculation.PerDiemRate
+		meals := []struct {
+			name      string
+			count     int
+			deduction money.Decimal
+		}{
+			{"breakfasts", input.Breakfasts, rate.BreakfastDeduction},
+			{"lunches", input.Lunches, rate.LunchDeduction},
+			{"dinners", input.Dinners, rate.DinnerDeduction},
+		}
+		amount := rate.DailyRate.MulInt(int64(days))
+		for _, meal := range meals {
+			if meal.count < 0 || meal.count > days {
+				return fmt.Errorf("Provided %s must be between 0 and %d", meal.name, days)
+			}
+			amount = amount.Sub(meal.deduction.MulInt(int64(meal.count)))
+		}
+		if amount.Sign() < 0 {
+			amount = money.Zero
+		}
+		calculation.Days = days
+		calculation.Currency = rate.Currency
+		calculation.Amount = amount.RoundTo(rate.Currency)
+
+	default:
+		return fmt.Errorf("A %s calculation needs its %s rate", calculation.Kind, calculation.Kind)
+	}
+	if !calculation.Amount.InRange() {
+		return errors.New("Calculated amount is too large")
+	}
+	return nil
+}
+
+// tripDays parses a per diem's dates, returning its first day and how many
+// days it covers, both ends included.
+func tripDays(input *models.CalculationInput) (time.Time, int, error) {
+	start, err := time.Parse("2006-01-02", input.StartDate)
+	if err != nil {
+		return time.Time{}, 0, errors.New("Invalid start date, expected YYYY-MM-DD")
+	}
+	end, err := time.Parse("2006-01-02", input.EndDate)
+	if err != nil {
+		return time.Time{}, 0, errors.New("Invalid end date, expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return time.Time{}, 0, errors.New("End date cannot be before the start date")
+	}
+	days := int(end.Sub(start).Hours()/24) + 1
+	if days > maxTripDays {
+		return time.Time{}, 0, fmt.Errorf("A per diem can cover at most %d days", maxTripDays)
+	}
+	return start, days, nil
+}
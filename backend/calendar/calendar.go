@@ -0,0 +1,213 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+)
+
+const dateLayout = "2006-01-02"
+
+// DefaultWeekend is used by calendars that don't define their own.
+const DefaultWeekend = "saturday,sunday"
+
+// Calendar answers business-day questions for one working week and set
+// of public holidays.
+type Calendar struct {
+	Weekend  map[time.Weekday]bool
+	Holidays map[string]string // date (YYYY-MM-DD) to holiday name
+}
+
+// Standard is a Monday to Friday week without holidays, used when nothing
+// is configured.
+func Standard() *Calendar {
+	weekend, _ := ParseWeekend(DefaultWeekend)
+	return &Calendar{Weekend: weekend, Holidays: map[string]string{}}
+}
+
+// New builds a calendar from its stored definition.
+func New(def *models.BusinessCalendar) (*Calendar, error) {
+	weekend, err := ParseWeekend(def.Weekend)
+	if err != nil {
+		return nil, err
+	}
+
+	holidays := map[string]string{}
+	for _, holiday := range def.Holidays {
+		holidays[holiday.Date.Format(dateLayout)] = holiday.Name
+	}
+	return &Calendar{Weekend: weekend, Holidays: holidays}, nil
+}
+
+// ParseWeekend reads a comma-separated list of weekday names such as
+// "friday,saturday". An empty list means every day is a working day.
+func ParseWeekend(days string) (map[time.Weekday]bool, error) {
+	weekend := map[time.Weekday]bool{}
+	for _, name := range strings.Split(days, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		day, ok := weekdays[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown weekday: %s", name)
+		}
+		weekend[day] = true
+	}
+	if len(weekend) == 7 {
+		return nil, fmt.Errorf("A week needs at least one working day")
+	}
+	return weekend, nil
+}
+
+// FormatWeekend is the inverse of ParseWeekend, listing days from Sunday.
+func FormatWeekend(weekend map[time.Weekday]bool) string {
+	names := []string{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if weekend[day] {
+			names = append(names, strings.ToLower(day.String()))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// IsBusinessDay reports whether t falls on a working day that is not a
+// holiday.
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if c.Weekend[t.Weekday()] {
+		return false
+	}
+	_, holiday := c.Holidays[t.Format(dateLayout)]
+	return !holiday
+}
+
+// AddBusinessDays moves t forward by n business days, or back when n is
+// negative, keeping the time of day. Whole weeks are skipped at once, so
+// only the days left over and the holidays are stepped through.
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	perWeek := c.workingDays()
+	if n == 0 || perWeek == 0 {
+		return t
+	}
+
+	start := civil(t)
+	holidays := c.holidayDays()
+	days := 0 // calendar days moved, in the direction of step
+	for n > perWeek {
+		weeks := (n - 1) / perWeek
+		span := weeks * 7
+		n -= weeks*perWeek - c.holidaysWithin(holidays, start, days, days+span, step)
+		days += span
+	}
+	for n > 0 {
+		days++
+		if c.isBusinessDay(start+int64(step*days), holidays) {
+			n--
+		}
+	}
+	return t.AddDate(0, 0, step*days)
+}
+
+// BusinessDaysBetween counts the business days after from up to and
+// including to, i.e. how many whole business days have elapsed. It is
+// negative when to is before from.
+func (c *Calendar) BusinessDaysBetween(from, to time.Time) int {
+	if to.Before(from) {
+		return -c.BusinessDaysBetween(to, from)
+	}
+
+	// The days after from that don't go past to, keeping from's time of day
+	days := int(civil(to) - civil(from))
+	if days > 0 && from.AddDate(0, 0, days).After(to) {
+		days--
+	}
+	if days <= 0 {
+		return 0
+	}
+
+	start := civil(from)
+	count := days / 7 * c.workingDays()
+	for i := days / 7 * 7; i < days; i++ {
+		if !c.Weekend[weekday(start+int64(i)+1)] {
+			count++
+		}
+	}
+	return count - c.holidaysWithin(c.holidayDays(), start, 0, days, 1)
+}
+
+// workingDays is the number of days of the week that aren't weekend days.
+func (c *Calendar) workingDays() int {
+	count := 0
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if !c.Weekend[day] {
+			count++
+		}
+	}
+	return count
+}
+
+// holidayDays lists the holidays as days since the Unix epoch.
+func (c *Calendar) holidayDays() []int64 {
+	days := make([]int64, 0, len(c.Holidays))
+	for date := range c.Holidays {
+		if t, err := time.Parse(dateLayout, date); err == nil {
+			days = append(days, civil(t))
+		}
+	}
+	return days
+}
+
+// holidaysWithin counts the holidays that fall on working days between
+// from and to days away from start in the direction of step, excluding
+// from and including to. Holidays on weekend days cost no business day.
+func (c *Calendar) holidaysWithin(holidays []int64, start int64, from, to, step int) int {
+	count := 0
+	for _, day := range holidays {
+		offset := int((day - start) * int64(step))
+		if offset > from && offset <= to && !c.Weekend[weekday(day)] {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *Calendar) isBusinessDay(day int64, holidays []int64) bool {
+	if c.Weekend[weekday(day)] {
+		return false
+	}
+	for _, holiday := range holidays {
+		if holiday == day {
+			return false
+		}
+	}
+	return true
+}
+
+// civil returns the date of t, in its own location, as days since the
+// Unix epoch.
+func civil(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
+
+// weekday returns the weekday of a day since the Unix epoch, a Thursday.
+func weekday(day int64) time.Weekday {
+	return time.Weekday(((day+4)%7 + 7) % 7)
+}
@@ -0,0 +1,233 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"hrcs/backend/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// build makes a calendar from a weekend list and holiday dates.
+func build(t *testing.T, weekend string, holidays ...string) *Calendar {
+	t.Helper()
+	def := &models.BusinessCalendar{Weekend: weekend}
+	for _, day := range holidays {
+		def.Holidays = append(def.Holidays, models.Holiday{Date: date(day), Name: "Holiday"})
+	}
+	cal, err := New(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func TestAddBusinessDays(t *testing.T) {
+	standard := build(t, DefaultWeekend)
+	gulf := build(t, "friday,saturday")
+	// 2026-12-25 is a Friday, 2026-12-26 a Saturday and 2026-12-27 a Sunday
+	christmas := build(t, DefaultWeekend, "2026-12-25", "2026-12-26", "2026-12-28")
+	noWeekend := build(t, "")
+
+	tests := []struct {
+		name string
+		cal  *Calendar
+		from string
+		n    int
+		want string
+	}{
+		{"zero", standard, "2026-03-07", 0, "2026-03-07"},
+		{"within the week", standard, "2026-03-09", 3, "2026-03-12"},
+		{"over a weekend", standard, "2026-03-12", 2, "2026-03-16"},
+		{"from a Saturday", standard, "2026-03-07", 1, "2026-03-09"},
+		{"whole weeks", standard, "2026-03-09", 10, "2026-03-23"},
+		{"a year", standard, "2025-12-31", 261, "2026-12-31"},
+		{"backwards", standard, "2026-03-16", -1, "2026-03-13"},
+		{"backwards whole weeks", standard, "2026-03-23", -10, "2026-03-09"},
+		{"backwards from a Sunday", standard, "2026-03-08", -1, "2026-03-06"},
+		{"Friday and Saturday weekend", gulf, "2026-03-12", 1, "2026-03-15"},
+		{"Friday and Saturday weekend backwards", gulf, "2026-03-15", -1, "2026-03-12"},
+		{"holidays", christmas, "2026-12-24", 1, "2026-12-29"},
+		{"holidays backwards", christmas, "2026-12-29", -1, "2026-12-24"},
+		// The Saturday holiday falls on the weekend and costs nothing extra
+		{"holiday on a weekend", christmas, "2026-12-21", 5, "2026-12-30"},
+		{"no weekend", noWeekend, "2026-03-06", 2, "2026-03-08"},
+	}
+	for _, tt := range tests {
+		got := tt.cal.AddBusinessDays(date(tt.from), tt.n).Format(dateLayout)
+		if got != tt.want {
+			t.Errorf("%s: AddBusinessDays(%s, %d) = %s, want %s", tt.name, tt.from, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAddBusinessDaysKeepsTimeOfDay(t *testing.T) {
+	from := time.Date(2026, 3, 13, 16, 45, 0, 0, time.UTC)
+	got := Standard().AddBusinessDays(from, 1)
+	if want := time.Date(2026, 3, 16, 16, 45, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("AddBusinessDays = %s, want %s", got, want)
+	}
+}
+
+func TestBusinessDaysBetween(t *testing.T) {
+	standard := build(t, DefaultWeekend)
+	gulf := build(t, "friday,saturday")
+	christmas := build(t, DefaultWeekend, "2026-12-25", "2026-12-26", "2026-12-28")
+
+	tests := []struct {
+		name     string
+		cal      *Calendar
+		from, to string
+		want     int
+	}{
+		{"same day", standard, "2026-03-09", "2026-03-09", 0},
+		{"next day", standard, "2026-03-09", "2026-03-10", 1},
+		{"Friday to Monday", standard, "2026-03-13", "2026-03-16", 1},
+		{"over a weekend only", standard, "2026-03-13", "2026-03-15", 0},
+		{"whole weeks", standard, "2026-03-09", "2026-03-23", 10},
+		{"a year", standard, "2025-12-31", "2026-12-31", 261},
+		{"to before from", standard, "2026-03-16", "2026-03-13", -1},
+		{"to weeks before from", standard, "2026-03-23", "2026-03-09", -10},
+		{"Friday and Saturday weekend", gulf, "2026-03-12", "2026-03-15", 1},
+		{"holidays", christmas, "2026-12-24", "2026-12-31", 3},
+		{"holidays backwards", christmas, "2026-12-31", "2026-12-24", -3},
+		{"holiday on a weekend", christmas, "2026-12-25", "2026-12-27", 0},
+	}
+	for _, tt := range tests {
+		if got := tt.cal.BusinessDaysBetween(date(tt.from), date(tt.to)); got != tt.want {
+			t.Errorf("%s: BusinessDaysBetween(%s, %s) = %d, want %d", tt.name, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestBusinessDaysBetweenPartialDay(t *testing.T) {
+	from := time.Date(2026, 3, 9, 17, 0, 0, 0, time.UTC)
+	// Not yet a whole day after from
+	if got := Standard().BusinessDaysBetween(from, time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)); got != 0 {
+		t.Errorf("BusinessDaysBetween = %d, want 0", got)
+	}
+	if got := Standard().BusinessDaysBetween(from, time.Date(2026, 3, 10, 17, 0, 0, 0, time.UTC)); got != 1 {
+		t.Errorf("BusinessDaysBetween = %d, want 1", got)
+	}
+}
+
+// TestAgainstDayByDay checks the week arithmetic against stepping through
+// every day.
+func TestAgainstDayByDay(t *testing.T) {
+	cals := map[string]*Calendar{
+		"standard":   build(t, DefaultWeekend, "2026-01-01", "2026-04-03", "2026-05-25", "2026-07-04", "2026-12-25"),
+		"gulf":       build(t, "friday,saturday", "2026-03-20", "2026-03-21", "2026-03-22", "2026-03-23"),
+		"one day":    build(t, "sunday", "2026-02-02", "2026-02-03", "2026-02-04", "2026-02-05", "2026-02-06", "2026-02-07", "2026-02-09"),
+		"no weekend": build(t, "", "2026-06-01"),
+	}
+	start := date("2025-12-01")
+	for name, cal := range cals {
+		for offset := 0; offset < 21; offset++ {
+			from := start.AddDate(0, 0, offset*3)
+			for n := -90; n <= 90; n++ {
+				if got, want := cal.AddBusinessDays(from, n), addDayByDay(cal, from, n); !got.Equal(want) {
+					t.Errorf("%s: AddBusinessDays(%s, %d) = %s, want %s", name, from.Format(dateLayout), n, got.Format(dateLayout), want.Format(dateLayout))
+				}
+				to := from.AddDate(0, 0, n*5)
+				if got, want := cal.BusinessDaysBetween(from, to), betweenDayByDay(cal, from, to); got != want {
+					t.Errorf("%s: BusinessDaysBetween(%s, %s) = %d, want %d", name, from.Format(dateLayout), to.Format(dateLayout), got, want)
+				}
+			}
+		}
+	}
+}
+
+func addDayByDay(c *Calendar, t time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if c.IsBusinessDay(t) {
+			n--
+		}
+	}
+	return t
+}
+
+func betweenDayByDay(c *Calendar, from, to time.Time) int {
+	if to.Before(from) {
+		return -betweenDayByDay(c, to, from)
+	}
+	count := 0
+	for day := from.AddDate(0, 0, 1); !day.After(to); day = day.AddDate(0, 0, 1) {
+		if c.IsBusinessDay(day) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestParseWeekend(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"saturday,sunday", "sunday,saturday", false},
+		{" Friday , SATURDAY ", "friday,saturday", false},
+		{"", "", false},
+		{"funday", "", true},
+		{"sunday,monday,tuesday,wednesday,thursday,friday,saturday", "", true},
+	}
+	for _, tt := range tests {
+		weekend, err := ParseWeekend(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWeekend(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && FormatWeekend(weekend) != tt.want {
+			t.Errorf("ParseWeekend(%q) = %s, want %s", tt.in, FormatWeekend(weekend), tt.want)
+		}
+	}
+}
+
+func TestChoose(t *testing.T) {
+	id := func(n uint) *uint { return &n }
+	defs := []models.BusinessCalendar{
+		{ID: 1, Location: ""},
+		{ID: 2, Location: "Dubai"},
+		{ID: 3, UserGroupID: id(7)},
+		{ID: 4, Location: "London"},
+		{ID: 5, UserGroupID: id(8), Location: "Dubai"},
+	}
+	tests := []struct {
+		name     string
+		defs     []models.BusinessCalendar
+		groupID  *uint
+		location string
+		want     uint // 0 for none
+	}{
+		{"group's own", defs, id(7), "Dubai", 3},
+		{"group's own over its location", defs, id(8), "London", 5},
+		{"location", defs, id(9), "dubai", 2},
+		{"unknown location", defs, id(9), "Paris", 1},
+		{"group without location", defs, id(9), "", 1},
+		{"no group", defs, nil, "", 1},
+		{"another group's calendar", defs[2:3], id(9), "", 0},
+		{"nothing configured", nil, id(7), "Dubai", 0},
+		{"location without default", defs[1:2], nil, "", 0},
+	}
+	for _, tt := range tests {
+		got := choose(tt.defs, tt.groupID, tt.location)
+		switch {
+		case got == nil && tt.want != 0:
+			t.Errorf("%s: chose none, want calendar %d", tt.name, tt.want)
+		case got != nil && got.ID != tt.want:
+			t.Errorf("%s: chose calendar %d, want %d", tt.name, got.ID, tt.want)
+		}
+	}
+}
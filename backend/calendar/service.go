@@ -0,0 +1,107 @@
+package calendar
+
+import (
+	"strings"
+
+	"hrcs/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// Service loads the business calendar that applies to a user group. It
+// caches what it loads, so create one per request or scan.
+type Service struct {
+	DB *gorm.DB
+	// cache holds calendars already loaded, keyed by user group ID (0 for
+	// users outside any group)
+	cache map[uint]*Calendar
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{DB: db, cache: map[uint]*Calendar{}}
+}
+
+// ForGroup returns the group's own calendar, else the calendar of the
+// group's location, else the company default, else a standard Monday to
+// Friday week.
+func (s *Service) ForGroup(groupID *uint) (*Calendar, error) {
+	key := uint(0)
+	if groupID != nil {
+		key = *groupID
+	}
+	if cal, ok := s.cache[key]; ok {
+		return cal, nil
+	}
+
+	def, err := s.find(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := Standard()
+	if def != nil {
+		if cal, err = New(def); err != nil {
+			return nil, err
+		}
+	}
+	s.cache[key] = cal
+	return cal, nil
+}
+
+// ForUser returns the calendar of the user's group.
+func (s *Service) ForUser(user *models.User) (*Calendar, error) {
+	return s.ForGroup(user.UserGroupID)
+}
+
+func (s *Service) find(groupID *uint) (*models.BusinessCalendar, error) {
+	location := ""
+	candidates := s.DB.Where("user_group_id IS NULL")
+	if groupID != nil {
+		var group models.UserGroup
+		if err := s.DB.First(&group, *groupID).Error; err != nil && err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		location = group.Location
+		candidates = candidates.Or("user_group_id = ?", *groupID)
+	}
+
+	var defs []models.BusinessCalendar
+	if err := candidates.Find(&defs).Error; err != nil {
+		return nil, err
+	}
+	def := choose(defs, groupID, location)
+	if def == nil {
+		return nil, nil
+	}
+	if err := s.DB.Model(def).Association("Holidays").Find(&def.Holidays); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+// choose picks the calendar that applies to a group at a location: its
+// own, else the location's, else the company default, else nil.
+func choose(defs []models.BusinessCalendar, groupID *uint, location string) *models.BusinessCalendar {
+	var byLocation, byDefault *models.BusinessCalendar
+	for i := range defs {
+		def := &defs[i]
+		switch {
+		case def.UserGroupID != nil:
+			if groupID != nil && *def.UserGroupID == *groupID {
+				return def
+			}
+		case def.Location == "":
+			if byDefault == nil {
+				byDefault = def
+			}
+		case location != "" && strings.EqualFold(def.Location, location):
+			if byLocation == nil {
+				byLocation = def
+			}
+		}
+	}
+	if byLocation != nil {
+		return byLocation
+	}
+	return byDefault
+}
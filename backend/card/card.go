@@ -0,0 +1,263 @@
+// Package card imports corporate card statements and reconciles their
+// transactions with the expenses claimed for them.
+package card
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"hrcs/backend/duplicate"
+	"hrcs/backend/models"
+
+	"gorm.io/gorm"
+)
+
+// DefaultDateTolerance is how many days a card transaction may post after,
+// or before, the expense it pays for and still be matched to it.
+const DefaultDateTolerance = 3
+
+// ErrAttached is returned for a card transaction that is already attached
+// to a claim, possibly by a match running at the same time.
+var ErrAttached = errors.New("Card transaction is already attached to a claim")
+
+// openStatuses are those of the claims card transactions can be attached
+// to and detached from: the ones the claimant can still change.
+var openStatuses = []models.ClaimStatus{models.StatusDraft, models.StatusReturned}
+
+// Open reports whether card transactions can be attached to or detached
+// from a claim in status.
+func Open(status models.ClaimStatus) bool {
+	for _, s := range openStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Matcher pairs the unreconciled card transactions of a user with the
+// expenses on their open claims.
+type Matcher struct {
+	DB            *gorm.DB
+	DateTolerance int
+}
+
+func NewMatcher(db *gorm.DB) *Matcher {
+	return &Matcher{DB: db, DateTolerance: DefaultDateTolerance}
+}
+
+// expense is a line of a claim, or a claim that isn't itemized, a card
+// transaction can be matched to.
+type expense struct {
+	claim *models.Claim
+	line  *models.ClaimLineItem // nil for the whole claim
+}
+
+// Match attaches each of the user's unreconciled card transactions to the
+// one expense on their open claims it matches: the same amount and
+// currency, dated within the tolerance, and at the same merchant. An
+// expense without a merchant must be dated the same day. Transactions that
+// match several expenses are left for the user to attach. It returns the
+// transactions attached.
+func (m *Matcher) Match(userID uint) ([]models.CardTransaction, error) {
+	var transactions []models.CardTransaction
+	if err := m.DB.Where("user_id = ? AND claim_id IS NULL", userID).Order("date, id").Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return []models.CardTransaction{}, nil
+	}
+
+	var claims []models.Claim
+	if err := m.DB.Preload("Lines").Where("user_id = ? AND status IN ?", userID, openStatuses).Find(&claims).Error; err != nil {
+		return nil, err
+	}
+
+	expenses := []expense{}
+	for i := range claims {
+		claim := &claims[i]
+		if claim.PaidByCard {
+			continue
+		}
+		if len(claim.Lines) == 0 {
+			expenses = append(expenses, expense{claim: claim})
+			continue
+		}
+		for j := range claim.Lines {
+			if line := &claim.Lines[j]; !line.PaidByCard {
+				expenses = append(expenses, expense{claim: claim, line: line})
+			}
+		}
+	}
+
+	matched := []models.CardTransaction{}
+	taken := map[int]bool{}
+	for i := range transactions {
+		transaction := &transactions[i]
+		found := -1
+		for j := range expenses {
+			if taken[j] || !m.matches(transaction, &expenses[j]) {
+				continue
+			}
+			if found >= 0 {
+				found = -1
+				break
+			}
+			found = j
+		}
+		if found < 0 {
+			continue
+		}
+		taken[found] = true
+
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			return Attach(tx, transaction, expenses[found].claim, expenses[found].line, models.CardMatchAuto)
+		})
+		// Another match or the user attached it since it was loaded
+		if errors.Is(err, ErrAttached) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, *transaction)
+	}
+	return matched, nil
+}
+
+func (m *Matcher) matches(transaction *models.CardTransaction, e *expense) bool {
+	amount, currency, date, merchant := e.claim.Amount, e.claim.Currency, e.claim.CreatedAt, ""
+	if e.line != nil {
+		amount, currency, date, merchant = e.line.Amount, e.line.Currency, e.line.Date, e.line.Merchant
+	}
+	if currency != transaction.Currency || amount.Cmp(transaction.Amount) != 0 {
+		return false
+	}
+
+	days := day(transaction.Date).Sub(day(date)).Hours() / 24
+	if days < 0 {
+		days = -days
+	}
+	if days > float64(m.DateTolerance) {
+		return false
+	}
+
+	// Card statements carry the merchant's billing name, e.g. "UBER *TRIP"
+	// for "Uber", so either may contain the other
+	claimed, charged := duplicate.NormalizeMerchant(merchant), duplicate.NormalizeMerchant(transaction.Merchant)
+	if claimed == "" {
+		return days == 0
+	}
+	return charged != "" && (strings.Contains(charged, claimed) || strings.Contains(claimed, charged))
+}
+
+// Attach reconciles a card transaction with a claim, or one of its lines,
+// marking the expense as paid by card and working out what is left to
+// reimburse. The claim's lines must be loaded. It returns ErrAttached if
+// the transaction is attached already, even if only since it was loaded.
+func Attach(tx *gorm.DB, transaction *models.CardTransaction, claim *models.Claim, line *models.ClaimLineItem, matchedBy models.CardMatch) error {
+	if transaction.ClaimID != nil {
+		return ErrAttached
+	}
+	if transaction.UserID != claim.UserID {
+		return errors.New("Card transaction belongs to another user")
+	}
+	if !Open(claim.Status) {
+		return errors.New("Card transactions can only be attached to draft or returned claims")
+	}
+
+	if line == nil {
+		if len(claim.Lines) > 0 {
+			return errors.New("Attach the card transaction to one of the claim's lines")
+		}
+		if claim.PaidByCard {
+			return errors.New("A card transaction is already attached to this claim")
+		}
+		claim.PaidByCard = true
+	} else {
+		var taken int64
+		if err := tx.Model(&models.CardTransaction{}).Where("line_item_id = ?", line.ID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 || line.PaidByCard {
+			return errors.New("A card transaction is already attached to this line")
+		}
+		line.PaidByCard = true
+		if err := tx.Model(line).Update("paid_by_card", true).Error; err != nil {
+			return err
+		}
+		transaction.LineItemID = &line.ID
+	}
+
+	// Only a transaction that is still unattached is updated, so that of
+	// two attaches running at once the second finds nothing to update
+	now := time.Now()
+	result := tx.Model(&models.CardTransaction{}).Where("id = ? AND claim_id IS NULL", transaction.ID).Updates(map[string]interface{}{
+		"claim_id":      claim.ID,
+		"line_item_id":  transaction.LineItemID,
+		"matched_by":    matchedBy,
+		"reconciled_at": now,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAttached
+	}
+	transaction.ClaimID = &claim.ID
+	transaction.MatchedBy = matchedBy
+	transaction.ReconciledAt = &now
+	return reimburse(tx, claim)
+}
+
+// Detach undoes Attach, so the expense is reimbursed again. The claim's
+// lines must be loaded.
+func Detach(tx *gorm.DB, transaction *models.CardTransaction, claim *models.Claim) error {
+	if !Open(claim.Status) {
+		return errors.New("Card transactions can only be detached from draft or returned claims")
+	}
+
+	if transaction.LineItemID == nil {
+		claim.PaidByCard = false
+	}
+	for i := range claim.Lines {
+		if line := &claim.Lines[i]; transaction.LineItemID != nil && line.ID == *transaction.LineItemID {
+			line.PaidByCard = false
+			if err := tx.Model(line).Update("paid_by_card", false).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := Release(tx, "id = ?", transaction.ID); err != nil {
+		return err
+	}
+	transaction.ClaimID, transaction.LineItemID, transaction.MatchedBy, transaction.ReconciledAt = nil, nil, "", nil
+	return reimburse(tx, claim)
+}
+
+// Release detaches the card transactions matching a condition without
+// touching their claims, e.g. when the lines they were attached to are
+// replaced or the claim is cancelled.
+func Release(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	return tx.Model(&models.CardTransaction{}).Where(query, args...).Updates(map[string]interface{}{
+		"claim_id":      nil,
+		"line_item_id":  nil,
+		"matched_by":    "",
+		"reconciled_at": nil,
+	}).Error
+}
+
+// reimburse stores what is left to reimburse on a claim.
+func reimburse(tx *gorm.DB, claim *models.Claim) error {
+	claim.ReimbursableAmount = claim.ReimbursableTotal()
+	return tx.Model(claim).Updates(map[string]interface{}{
+		"paid_by_card":        claim.PaidByCard,
+		"reimbursable_amount": claim.ReimbursableAmount,
+	}).Error
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,271 @@
+package card
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"hrcs/backend/currency"
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// Entry is a transaction read from a statement, with the email of the
+// cardholder when the statement names one.
+type Entry struct {
+	Email       string
+	Transaction models.CardTransaction
+}
+
+// csvColumns maps the header names card issuers use onto the columns
+// ParseCSV reads.
+var csvColumns = map[string]string{
+	"date":             "date",
+	"transaction date": "date",
+	"posted date":      "date",
+	"amount":           "amount",
+	"currency":         "currency",
+	"merchant":         "merchant",
+	"payee":            "merchant",
+	"name":             "merchant",
+	"description":      "description",
+	"memo":             "description",
+	"reference":        "reference",
+	"id":               "reference",
+	"transaction id":   "reference",
+	"card":             "card",
+	"card number":      "card",
+	"email":            "email",
+}
+
+// csvDateLayouts are the date formats accepted in CSV statements.
+var csvDateLayouts = []string{"2006-01-02", "01/02/2006", "2006/01/02"}
+
+// ParseCSV reads a card statement from a CSV file with a header row, e.g.
+//
+//	date,amount,merchant,description,reference,email
+//	2025-06-02,42.50,Uber,Airport transfer,TX-1001,jane@example.com
+//
+// Charges are positive and refunds negative. Rows without a currency are
+// in curr; rows without a reference get one from their contents, so
+// reimporting the same file doesn't duplicate them.
+func ParseCSV(r io.Reader, curr string) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if column, ok := csvColumns[name]; ok {
+			if _, seen := columns[column]; !seen {
+				columns[column] = i
+			}
+		}
+	}
+	for _, name := range []string{"date", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	_, hasMerchant := columns["merchant"]
+	_, hasDescription := columns["description"]
+	if !hasMerchant && !hasDescription {
+		return nil, errors.New("missing merchant column")
+	}
+
+	entries := []Entry{}
+	seen := map[string]int{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		date, err := parseDate(field("date"), csvDateLayouts)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		amount, err := money.Parse(strings.NewReplacer(",", "", "$", "").Replace(field("amount")))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid amount %q", row, field("amount"))
+		}
+		rowCurrency := field("currency")
+		if rowCurrency == "" {
+			rowCurrency = curr
+		}
+		if rowCurrency, err = currency.Normalize(rowCurrency); err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+
+		transaction := models.CardTransaction{
+			ExternalID:  field("reference"),
+			CardNumber:  lastFour(field("card")),
+			Date:        date,
+			Amount:      amount.RoundTo(rowCurrency),
+			Currency:    rowCurrency,
+			Merchant:    field("merchant"),
+			Description: field("description"),
+			Source:      "csv",
+		}
+		if transaction.Merchant == "" {
+			transaction.Merchant = transaction.Description
+		}
+		if transaction.ExternalID == "" {
+			// Identical rows are told apart by how many came before
+			key := strings.Join([]string{field("email"), transaction.CardNumber, date.Format("2006-01-02"), transaction.Amount.String(), rowCurrency, transaction.Merchant, transaction.Description}, "|")
+			seen[key]++
+			transaction.ExternalID = fmt.Sprintf("csv-%x", sha256.Sum256([]byte(fmt.Sprintf("%s|%d", key, seen[key]))))[:36]
+		}
+		entries = append(entries, Entry{Email: strings.ToLower(field("email")), Transaction: transaction})
+	}
+	return entries, nil
+}
+
+// ofxTag matches an OFX element: an opening tag with the value that
+// follows it, if any, or a closing tag. It reads both the SGML of OFX 1.x,
+// where values aren't closed, and the XML of OFX 2.x.
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// ParseOFX reads the transactions of an OFX credit card or bank statement.
+// OFX records charges as negative amounts; they are flipped so charges are
+// positive as in CSV statements.
+func ParseOFX(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(strings.ToUpper(string(data)), "<OFX>") {
+		return nil, errors.New("not an OFX file")
+	}
+
+	entries := []Entry{}
+	var statementCurrency, cardNumber string
+	var current map[string]string
+	for _, match := range ofxTag.FindAllStringSubmatch(string(data), -1) {
+		closing, tag, value := match[1] == "/", strings.ToUpper(match[2]), strings.TrimSpace(match[3])
+		switch {
+		case tag == "STMTTRN" && !closing:
+			current = map[string]string{}
+		case tag == "STMTTRN" && closing:
+			if current == nil {
+				continue
+			}
+			entry, err := ofxEntry(current, statementCurrency, cardNumber)
+			if err != nil {
+				return nil, fmt.Errorf("transaction %d: %v", len(entries)+1, err)
+			}
+			entries = append(entries, entry)
+			current = nil
+		case closing || value == "":
+		case current != nil:
+			current[tag] = value
+		case tag == "CURDEF":
+			statementCurrency = value
+		case tag == "ACCTID":
+			cardNumber = lastFour(value)
+		}
+	}
+	// SGML files may leave the last transaction unclosed
+	if current != nil {
+		entry, err := ofxEntry(current, statementCurrency, cardNumber)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no transactions found in the OFX file")
+	}
+	return entries, nil
+}
+
+func ofxEntry(fields map[string]string, statementCurrency, cardNumber string) (Entry, error) {
+	// Dates look like 20250602 or 20250602120000.000[-5:EST]
+	value := fields["DTPOSTED"]
+	if len(value) < 8 {
+		return Entry{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid date %q", value)
+	}
+	amount, err := money.Parse(fields["TRNAMT"])
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid amount %q", fields["TRNAMT"])
+	}
+	curr := statementCurrency
+	if fields["CURSYM"] != "" {
+		curr = fields["CURSYM"]
+	}
+	if curr, err = currency.Normalize(curr); err != nil {
+		return Entry{}, err
+	}
+	if fields["FITID"] == "" {
+		return Entry{}, errors.New("missing FITID")
+	}
+
+	transaction := models.CardTransaction{
+		ExternalID:  fields["FITID"],
+		CardNumber:  cardNumber,
+		Date:        date,
+		Amount:      amount.Neg().RoundTo(curr),
+		Currency:    curr,
+		Merchant:    fields["NAME"],
+		Description: fields["MEMO"],
+		Source:      "ofx",
+	}
+	if transaction.Merchant == "" {
+		transaction.Merchant = transaction.Description
+	}
+	return Entry{Transaction: transaction}, nil
+}
+
+func parseDate(value string, layouts []string) (time.Time, error) {
+	for _, layout := range layouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+}
+
+// lastFour keeps only the last four digits of a card number.
+func lastFour(number string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+	if len(digits) > 4 {
+		digits = digits[len(digits)-4:]
+	}
+	return digits
+}
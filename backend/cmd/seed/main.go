@@ -30,7 +30,7 @@ func main() {
 	}
 
 	// Run migrations first
-	if err := database.Migrate(db); err != nil {
+	if err := database.Migrate(db, cfg.BaseCurrency); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
@@ -72,8 +72,7 @@ This will create:
 - Various claim types (Travel, Medical, Office Supplies, etc.)
 - User groups (Engineering, Sales, Marketing, etc.)
 - Approval levels for each user group
-- Sample claims in different statuses
-`)
+- Sample claims in different statuses`)
 }
 
 func printSeedingInfo() {
@@ -110,6 +109,5 @@ Created Data:
 - 16 Approval Levels (2 levels per group)
 - 8 Sample Claims
 
-You can now start the application and log in with any of the above credentials!
-`)
+You can now start the application and log in with any of the above credentials!`)
 }
@@ -0,0 +1,34 @@
+// Package currency converts claim amounts between currencies using the
+// exchange rates admins load, and reads rate files to load them from.
+package currency
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var code = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Normalize upper-cases a currency code and checks it looks like an ISO
+// 4217 code.
+func Normalize(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if !code.MatchString(currency) {
+		return "", fmt.Errorf("invalid currency code %q", currency)
+	}
+	return currency, nil
+}
+
+// RateError is returned when no loaded rate connects two currencies on or
+// before a day.
+type RateError struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Date time.Time `json:"date"`
+}
+
+func (e *RateError) Error() string {
+	return fmt.Sprintf("No exchange rate from %s to %s on or before %s", e.From, e.To, e.Date.Format("2006-01-02"))
+}
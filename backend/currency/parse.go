@@ -0,0 +1,145 @@
+package currency
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+)
+
+// ParseCSV reads exchange rates from a CSV file with a header row naming
+// its date, base, quote and rate columns, e.g.
+//
+//	date,base,quote,rate
+//	2024-01-02,USD,SGD,1.3245
+//
+// Each row reads as 1 base = rate quote. The base column may be left out,
+// in which case every row is quoted against base; currency is accepted in
+// place of quote.
+func ParseCSV(r io.Reader, base string) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if name == "currency" {
+			name = "quote"
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"date", "quote", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	_, hasBase := columns["base"]
+	if !hasBase {
+		if base, err = Normalize(base); err != nil {
+			return nil, err
+		}
+	}
+
+	rates := []models.ExchangeRate{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		rowBase := base
+		if hasBase {
+			rowBase = field("base")
+		}
+		rate, err := NewRate(field("date"), rowBase, field("quote"), field("rate"), "csv")
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// ecbEnvelope is the layout of the European Central Bank's reference
+// rate files, daily or historical: a cube per day holding a cube per
+// currency, quoted against the euro.
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// ParseECB reads the exchange rates of an ECB euro reference rate file,
+// such as eurofxref-daily.xml.
+func ParseECB(r io.Reader) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("invalid ECB rate file: %v", err)
+	}
+
+	rates := []models.ExchangeRate{}
+	for _, day := range envelope.Cube.Days {
+		for _, quote := range day.Rates {
+			rate, err := NewRate(day.Time, "EUR", quote.Currency, quote.Rate, "ecb")
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", day.Time, quote.Currency, err)
+			}
+			rates = append(rates, rate)
+		}
+	}
+	if len(rates) == 0 {
+		return nil, errors.New("no rates found in the ECB rate file")
+	}
+	return rates, nil
+}
+
+// NewRate validates an exchange rate given as text.
+func NewRate(date, base, quote, rate, source string) (models.ExchangeRate, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	if base, err = Normalize(base); err != nil {
+		return models.ExchangeRate{}, err
+	}
+	if quote, err = Normalize(quote); err != nil {
+		return models.ExchangeRate{}, err
+	}
+	if base == quote {
+		return models.ExchangeRate{}, fmt.Errorf("%s can't be quoted against itself", base)
+	}
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("invalid rate %q", rate)
+	}
+	return models.ExchangeRate{Base: base, Quote: quote, Rate: value, Date: day, Source: source}, nil
+}
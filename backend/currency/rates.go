@@ -0,0 +1,190 @@
+package currency
+
+import (
+	"sort"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// lookback caps how many rates a lookup walks back through before it
+// gives up on connecting two currencies.
+const lookback = 1000
+
+// Rates converts between currencies using the exchange rates in the
+// database.
+type Rates struct {
+	DB *gorm.DB
+}
+
+func NewRates(db *gorm.DB) *Rates {
+	return &Rates{DB: db}
+}
+
+// Lookup returns how much one unit of from is worth in to, using the
+// latest rates published on or before the given day, together with the
+// day of those rates. A rate can be used as quoted, inverted, or crossed
+// through a currency both are quoted against, such as the euro for ECB
+// rates. Converting a currency into itself needs no rate and returns a
+// zero date.
+func (r *Rates) Lookup(from, to string, on time.Time) (float64, time.Time, error) {
+	if from == to {
+		return 1, time.Time{}, nil
+	}
+
+	day := time.Date(on.Year(), on.Month(), on.Day(), 0, 0, 0, 0, time.UTC)
+	pair := []string{from, to}
+	var rates []models.ExchangeRate
+	if err := r.DB.Where("date <= ? AND (base IN ? OR quote IN ?)", day, pair, pair).
+		Order("date DESC").Limit(lookback).Find(&rates).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+
+	for start := 0; start < len(rates); {
+		end := start
+		for end < len(rates) && rates[end].Date.Equal(rates[start].Date) {
+			end++
+		}
+		if rate, ok := cross(rates[start:end], from, to); ok {
+			return rate, rates[start].Date, nil
+		}
+		start = end
+	}
+	return 0, time.Time{}, &RateError{From: from, To: to, Date: day}
+}
+
+// cross works out the rate from one currency to another out of the rates
+// of a single day. Each rate tells what one unit of from, or of to, is
+// worth in some currency; any currency both can be valued in connects
+// them.
+func cross(rates []models.ExchangeRate, from, to string) (float64, bool) {
+	fromIn := map[string]float64{from: 1}
+	toIn := map[string]float64{to: 1}
+	for _, rate := range rates {
+		if rate.Rate <= 0 {
+			continue
+		}
+		switch {
+		case rate.Base == from:
+			fromIn[rate.Quote] = rate.Rate
+		case rate.Quote == from:
+			fromIn[rate.Base] = 1 / rate.Rate
+		}
+		switch {
+		case rate.Base == to:
+			toIn[rate.Quote] = rate.Rate
+		case rate.Quote == to:
+			toIn[rate.Base] = 1 / rate.Rate
+		}
+	}
+
+	// A rate quoted directly between the two wins over a cross rate
+	via := []string{to, from}
+	others := []string{}
+	for currency := range fromIn {
+		if currency != from && currency != to {
+			others = append(others, currency)
+		}
+	}
+	sort.Strings(others)
+	for _, currency := range append(via, others...) {
+		a, okFrom := fromIn[currency]
+		b, okTo := toIn[currency]
+		if okFrom && okTo {
+			return a / b, true
+		}
+	}
+	return 0, false
+}
+
+// Price converts a claim as of the given day. Each line is converted into
+// the claim's currency, which an itemized claim's amount totals, and into
+// the base currency. The claim's base amount is the total of its lines'
+// base amounts, or its amount converted when it isn't itemized. Every
+// amount is rounded to the minor unit of its currency, and what is
+// reimbursable is worked out again. The claim's Currency and BaseCurrency
+// must be set; lines without a currency take the claim's. Amounts too
+// large to convert give money.ErrRange.
+func (r *Rates) Price(claim *models.Claim, on time.Time) error {
+	type key struct{ from, to string }
+	cache := map[key]float64{}
+	lookup := func(from, to string) (float64, error) {
+		if rate, ok := cache[key{from, to}]; ok {
+			return rate, nil
+		}
+		rate, _, err := r.Lookup(from, to, on)
+		if err != nil {
+			return 0, err
+		}
+		cache[key{from, to}] = rate
+		return rate, nil
+	}
+
+	baseAmount := money.Zero
+	for i := range claim.Lines {
+		line := &claim.Lines[i]
+		if line.Currency == "" {
+			line.Currency = claim.Currency
+		}
+
+		rate, err := lookup(line.Currency, claim.Currency)
+		if err != nil {
+			return err
+		}
+		line.ExchangeRate = rate
+
+		toBase, err := lookup(line.Currency, claim.BaseCurrency)
+		if err != nil {
+			return err
+		}
+		line.Amount = line.Amount.RoundTo(line.Currency)
+		line.BaseAmount = line.Amount.MulRate(toBase).RoundTo(claim.BaseCurrency)
+		baseAmount = baseAmount.Add(line.BaseAmount)
+	}
+
+	rate, date, err := r.Lookup(claim.Currency, claim.BaseCurrency, on)
+	if err != nil {
+		return err
+	}
+	claim.ExchangeRate = rate
+	claim.RateDate = nil
+	if !date.IsZero() {
+		claim.RateDate = &date
+	}
+
+	if len(claim.Lines) > 0 {
+		claim.Amount = claim.LinesTotal()
+		claim.BaseAmount = baseAmount
+	} else {
+		claim.Amount = claim.Amount.RoundTo(claim.Currency)
+		claim.BaseAmount = claim.Amount.MulRate(rate).RoundTo(claim.BaseCurrency)
+	}
+	claim.ReimbursableAmount = claim.ReimbursableTotal()
+
+	for _, line := range claim.Lines {
+		if !line.BaseAmount.InRange() {
+			return money.ErrRange
+		}
+	}
+	if !claim.Amount.InRange() || !claim.BaseAmount.InRange() || !claim.ReimbursableAmount.InRange() {
+		return money.ErrRange
+	}
+	return nil
+}
+
+// SaveLines stores the conversion Price worked out for a claim's lines.
+func SaveLines(tx *gorm.DB, lines []models.ClaimLineItem) error {
+	for _, line := range lines {
+		if err := tx.Model(&models.ClaimLineItem{}).Where("id = ?", line.ID).Updates(map[string]interface{}{
+			"currency":      line.Currency,
+			"exchange_rate": line.ExchangeRate,
+			"base_amount":   line.BaseAmount,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
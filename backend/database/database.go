@@ -1,7 +1,10 @@
 package database
 
 import (
+	"fmt"
+
 	"hrcs/backend/models"
+	"hrcs/backend/money"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -16,13 +19,185 @@ func Connect(databaseURL string) (*gorm.DB, error) {
 	return db, nil
 }
 
-func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+// Migrate brings the schema up to date. baseCurrency is the company
+// currency claims filed before multi-currency support were in.
+func Migrate(db *gorm.DB, baseCurrency string) error {
+	if err := convertMoneyColumns(db); err != nil {
+		return err
+	}
+	if err := dropFullUniqueIndexes(db); err != nil {
+		return err
+	}
+	// Claims from before card reconciliation are owed in full
+	backfillReimbursable := db.Migrator().HasTable(&models.Claim{}) && !db.Migrator().HasColumn(&models.Claim{}, "ReimbursableAmount")
+	backfillBase := db.Migrator().HasTable(&models.Claim{}) && !db.Migrator().HasColumn(&models.Claim{}, "BaseCurrency")
+	// Approvals from before approval chains have no action or round
+	backfillRounds := db.Migrator().HasTable(&models.ClaimApproval{}) && !db.Migrator().HasColumn(&models.ClaimApproval{}, "Round")
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.UserGroup{},
+		&models.PayoutAccount{},
+		&models.PayoutAccountChange{},
 		&models.ClaimType{},
+		&models.CashAdvance{},
+		&models.PaymentBatch{},
 		&models.Claim{},
+		&models.ClaimLineItem{},
+		&models.CostCenter{},
+		&models.Project{},
+		&models.Allocation{},
+		&models.FiscalPeriod{},
+		&models.Budget{},
+		&models.JournalExport{},
+		&models.ExchangeRate{},
+		&models.MileageRate{},
+		&models.PerDiemRate{},
+		&models.Attachment{},
 		&models.ApprovalLevel{},
+		&models.ApprovalLevelApprover{},
+		&models.ReasonCode{},
+		&models.PolicyRule{},
+		&models.PolicyViolation{},
+		&models.DuplicateMatch{},
+		&models.CardTransaction{},
 		&models.ClaimApproval{},
-	)
-}
\ No newline at end of file
+		&models.AdvanceApproval{},
+		&models.AdvanceSettlement{},
+		&models.ApproverDelegation{},
+		&models.BusinessCalendar{},
+		&models.Holiday{},
+	); err != nil {
+		return err
+	}
+
+	if backfillReimbursable {
+		if err := db.Exec("UPDATE claims SET reimbursable_amount = amount").Error; err != nil {
+			return err
+		}
+	}
+	if backfillRounds {
+		if err := backfillApprovalRounds(db); err != nil {
+			return err
+		}
+	}
+	if backfillBase {
+		return backfillBaseAmounts(db, baseCurrency)
+	}
+	return nil
+}
+
+// backfillApprovalRounds puts claims from before approval chains in their
+// first submission round. Their approvals get the action their status was
+// set by, and claims still pending get the submit record their round's
+// progress and age are counted from, dated by the claim's last update.
+func backfillApprovalRounds(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE claims SET round = 1 WHERE status <> ?", models.StatusDraft).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE claim_approvals SET approval_level_id = NULL WHERE approval_level_id = 0").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE claim_approvals SET
+			action = CASE status WHEN ? THEN ? WHEN ? THEN ? WHEN ? THEN ? WHEN ? THEN ? WHEN ? THEN ? ELSE ? END,
+			round = (SELECT round FROM claims WHERE claims.id = claim_approvals.claim_id)
+			WHERE action IS NULL OR action = ''`,
+			models.StatusSubmitted, models.ActionSubmit,
+			models.StatusApproved, models.ActionApprove,
+			models.StatusRejected, models.ActionReject,
+			models.StatusPaymentInProgress, models.ActionStartPayment,
+			models.StatusPaid, models.ActionMarkPaid,
+			models.ActionWithdraw).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO claim_approvals (claim_id, approver_id, status, action, round, comments, created_at, updated_at)
+			SELECT id, user_id, status, ?, round, '', updated_at, updated_at FROM claims
+			WHERE status = ? AND deleted_at IS NULL AND NOT EXISTS (
+				SELECT 1 FROM claim_approvals WHERE claim_approvals.claim_id = claims.id AND claim_approvals.action = ?)`,
+			models.ActionSubmit, models.StatusSubmitted, models.ActionSubmit).Error
+	})
+}
+
+// backfillBaseAmounts converts claims from before multi-currency support,
+// which were all filed in the base currency but have just been given the
+// currency columns' default. It runs once, when those columns are added.
+func backfillBaseAmounts(db *gorm.DB, baseCurrency string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		legacy := "base_currency IS NULL OR base_currency = ''"
+		if err := tx.Exec("UPDATE claim_line_items SET currency = ?, exchange_rate = 1, base_amount = amount WHERE claim_id IN (SELECT id FROM claims WHERE "+legacy+")", baseCurrency).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE claims SET currency = ?, base_currency = ?, base_amount = amount, exchange_rate = 1 WHERE "+legacy, baseCurrency, baseCurrency).Error
+	})
+}
+
+// liveUniqueIndexes are the unique indexes of soft-deleted models, which
+// only cover the rows that haven't been deleted.
+var liveUniqueIndexes = []struct{ table, index string }{
+	{"reason_codes", "idx_reason_codes_code"},
+	{"cost_centers", "idx_cost_centers_code"},
+	{"projects", "idx_projects_code"},
+}
+
+// dropFullUniqueIndexes drops those indexes where they were created over
+// every row, deleted or not, for AutoMigrate to create them again.
+func dropFullUniqueIndexes(db *gorm.DB) error {
+	for _, i := range liveUniqueIndexes {
+		var full int64
+		if err := db.Raw("SELECT COUNT(*) FROM pg_indexes WHERE schemaname = CURRENT_SCHEMA() AND tablename = ? AND indexname = ? AND indexdef NOT LIKE '% WHERE %'", i.table, i.index).Scan(&full).Error; err != nil {
+			return err
+		}
+		if full == 0 {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("DROP INDEX %s", i.index)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moneyColumns are the amount columns that used to be float-backed numerics
+// and are now exact money.Decimal columns.
+var moneyColumns = []struct{ table, column string }{
+	{"claims", "amount"},
+	{"claims", "base_amount"},
+	{"claim_line_items", "amount"},
+	{"claim_line_items", "base_amount"},
+	{"claim_types", "max_amount"},
+	{"approval_levels", "min_amount"},
+	{"approval_levels", "max_amount"},
+}
+
+// convertMoneyColumns turns the amount columns of an existing database into
+// fixed-point numerics with money.Scale places. AutoMigrate doesn't change
+// the scale of a numeric column, so this runs first. Amounts were written
+// from floats by their shortest decimal form and fit the new scale; if one
+// doesn't, the migration stops rather than round it.
+func convertMoneyColumns(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range moneyColumns {
+			var scale []int
+			if err := tx.Raw("SELECT COALESCE(numeric_scale, -1) FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?", c.table, c.column).Scan(&scale).Error; err != nil {
+				return err
+			}
+			if len(scale) == 0 || scale[0] == money.Scale {
+				continue
+			}
+
+			var inexact int64
+			if err := tx.Raw(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s::numeric <> ROUND(%s::numeric, %d)", c.table, c.column, c.column, money.Scale)).Scan(&inexact).Error; err != nil {
+				return err
+			}
+			if inexact > 0 {
+				return fmt.Errorf("%d %s.%s values have more than %d decimal places; round them before migrating", inexact, c.table, c.column, money.Scale)
+			}
+
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::numeric", c.table, c.column, money.Decimal{}.GormDataType(), c.column)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
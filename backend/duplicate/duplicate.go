@@ -0,0 +1,282 @@
+// Package duplicate looks for claims that repeat an expense already
+// claimed: the same receipt filed twice, or the same receipt split across
+// two claims.
+package duplicate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// DefaultWindowDays is how many days apart two expenses can be and still
+// be compared, when not configured.
+const DefaultWindowDays = 30
+
+// What two expenses can have in common.
+const (
+	OnAmount   = "amount"
+	OnDate     = "date"
+	OnMerchant = "merchant"
+	OnReceipt  = "receipt"
+)
+
+// Detector compares a claim being submitted with the claimant's other
+// claims.
+type Detector struct {
+	DB *gorm.DB
+	// WindowDays is how many days apart two expenses can be and still be
+	// compared
+	WindowDays int
+	// BlockExact refuses submissions with exact duplicates instead of only
+	// flagging them
+	BlockExact bool
+}
+
+func NewDetector(db *gorm.DB, windowDays int, blockExact bool) *Detector {
+	if windowDays <= 0 {
+		windowDays = DefaultWindowDays
+	}
+	return &Detector{DB: db, WindowDays: windowDays, BlockExact: blockExact}
+}
+
+// DuplicateError is returned when a claim exactly duplicates another and
+// the detector blocks exact duplicates.
+type DuplicateError struct {
+	Matches []models.DuplicateMatch `json:"matches"`
+}
+
+func (e *DuplicateError) Error() string {
+	if len(e.Matches) == 1 {
+		return e.Matches[0].Message
+	}
+	return fmt.Sprintf("Claim duplicates %d expenses already claimed", len(e.Matches))
+}
+
+// expense is a line of a claim, or a claim without lines as a whole, as
+// far as matching goes.
+type expense struct {
+	claim    *models.Claim
+	line     int
+	lineID   *uint
+	date     time.Time
+	merchant string
+	amount   money.Decimal
+	currency string
+	// receipts are the checksums of the files attached to the line, and
+	// shared those of the files attached to the claim as a whole
+	receipts []string
+	shared   []string
+}
+
+// expenses splits a claim into what it claims. A claim without lines has
+// no expense date, so the day it was created stands in for one.
+func expenses(claim *models.Claim) []expense {
+	var shared []string
+	linked := map[uint][]string{}
+	for _, attachment := range claim.Attachments {
+		if attachment.Checksum == "" {
+			continue
+		}
+		if attachment.LineItemID == nil {
+			shared = append(shared, attachment.Checksum)
+		} else {
+			linked[*attachment.LineItemID] = append(linked[*attachment.LineItemID], attachment.Checksum)
+		}
+	}
+
+	if len(claim.Lines) == 0 {
+		return []expense{{
+			claim:    claim,
+			date:     day(claim.CreatedAt),
+			amount:   claim.Amount,
+			currency: claim.Currency,
+			shared:   shared,
+		}}
+	}
+
+	list := make([]expense, 0, len(claim.Lines))
+	for i := range claim.Lines {
+		line := &claim.Lines[i]
+		list = append(list, expense{
+			claim:    claim,
+			line:     i + 1,
+			lineID:   &line.ID,
+			date:     day(line.Date),
+			merchant: NormalizeMerchant(line.Merchant),
+			amount:   line.Amount,
+			currency: line.Currency,
+			receipts: linked[line.ID],
+			shared:   shared,
+		})
+	}
+	return list
+}
+
+// Detect compares the expenses of a claim being submitted, which must have
+// its lines and attachments loaded, with each other and with the
+// claimant's other claims that are in the approval chain or through it.
+// It returns the likely duplicates to keep on the claim; exact ones come
+// back as a *DuplicateError instead when the detector blocks them.
+func (d *Detector) Detect(claim *models.Claim) ([]models.DuplicateMatch, error) {
+	own := expenses(claim)
+	if len(own) == 0 {
+		return nil, nil
+	}
+
+	window := time.Duration(d.WindowDays) * 24 * time.Hour
+	earliest := own[0].date
+	for _, e := range own[1:] {
+		if e.date.Before(earliest) {
+			earliest = e.date
+		}
+	}
+
+	// A claim is filed after its expenses, so claims created before the
+	// window opens can't hold an expense inside it
+	var others []models.Claim
+	if err := d.DB.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date, id")
+	}).Preload("Attachments").
+		Where("user_id = ? AND id <> ? AND status NOT IN ?", claim.UserID, claim.ID, []models.ClaimStatus{models.StatusDraft, models.StatusRejected}).
+		Where("created_at >= ?", earliest.Add(-window)).
+		Order("id").Find(&others).Error; err != nil {
+		return nil, err
+	}
+
+	var matches, exact []models.DuplicateMatch
+	compare := func(e, other expense) {
+		on := d.compare(e, other, window)
+		if on == nil {
+			return
+		}
+		match := models.DuplicateMatch{
+			ClaimID:           claim.ID,
+			Line:              e.line,
+			LineItemID:        e.lineID,
+			MatchedClaimID:    other.claim.ID,
+			MatchedLine:       other.line,
+			MatchedLineItemID: other.lineID,
+			MatchedOn:         on,
+			Exact:             isExact(on),
+		}
+		match.Message = message(match, other.claim)
+		matches = append(matches, match)
+		if match.Exact {
+			exact = append(exact, match)
+		}
+	}
+
+	for i, e := range own {
+		// The same expense twice on one claim
+		for _, other := range own[i+1:] {
+			compare(e, other)
+		}
+		for j := range others {
+			for _, other := range expenses(&others[j]) {
+				compare(e, other)
+			}
+		}
+	}
+
+	if d.BlockExact && len(exact) > 0 {
+		return nil, &DuplicateError{Matches: exact}
+	}
+	return matches, nil
+}
+
+// compare returns what two expenses have in common when it's enough to
+// make them likely duplicates: the same receipt, or the same amount either
+// on the same day or at the same merchant within the window. It returns
+// nil otherwise.
+func (d *Detector) compare(e, other expense, window time.Duration) []string {
+	on := []string{}
+	gap := e.date.Sub(other.date)
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap <= window && e.currency == other.currency && e.amount.Cmp(other.amount) == 0 && e.amount.Sign() > 0 {
+		on = append(on, OnAmount)
+		if gap == 0 {
+			on = append(on, OnDate)
+		}
+		if e.merchant != "" && e.merchant == other.merchant {
+			on = append(on, OnMerchant)
+		}
+	}
+	// Files attached to a claim as a whole could belong to any of its
+	// lines, so they only count against other claims
+	receipts := shares(e.receipts, other.receipts)
+	if e.claim != other.claim {
+		receipts = receipts || shares(e.shared, other.receipts) || shares(e.receipts, other.shared) || shares(e.shared, other.shared)
+	}
+	if receipts {
+		on = append(on, OnReceipt)
+	}
+
+	if len(on) == 0 || (len(on) == 1 && on[0] == OnAmount) {
+		return nil
+	}
+	return on
+}
+
+// isExact reports whether what two expenses share leaves no doubt that
+// they are the same one.
+func isExact(on []string) bool {
+	has := map[string]bool{}
+	for _, field := range on {
+		has[field] = true
+	}
+	return has[OnReceipt] || (has[OnAmount] && has[OnDate] && has[OnMerchant])
+}
+
+func message(match models.DuplicateMatch, other *models.Claim) string {
+	subject := "Claim"
+	if match.Line > 0 {
+		subject = fmt.Sprintf("Line %d", match.Line)
+	}
+	target := fmt.Sprintf("claim #%d %q", other.ID, other.Title)
+	if other.ID == match.ClaimID {
+		target = "this claim"
+	}
+	if match.MatchedLine > 0 {
+		target = fmt.Sprintf("line %d of %s", match.MatchedLine, target)
+	}
+	kind := "may duplicate"
+	if match.Exact {
+		kind = "duplicates"
+	}
+	return fmt.Sprintf("%s %s %s (same %s)", subject, kind, target, strings.Join(match.MatchedOn, ", "))
+}
+
+func shares(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeMerchant reduces a merchant name to its lower-case letters and digits,
+// so "Grab Taxi" and "GRAB-TAXI" match.
+func NormalizeMerchant(merchant string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, merchant)
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
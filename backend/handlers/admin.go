@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"hrcs/backend/models"
+	"hrcs/backend/money"
 	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
 
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
@@ -24,18 +28,24 @@ type CreateClaimTypeRequest struct {
 type CreateUserGroupRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Location    string `json:"location"`
+	// ResubmitPolicy is "restart" (default) or "resume"
+	ResubmitPolicy string `json:"resubmit_policy"`
 }
 
 type CreateApprovalLevelRequest struct {
-	Level                   int  `json:"level"`
-	UserGroupID             uint `json:"user_group_id"`
-	ApproverID              uint `json:"approver_id"`
-	CanDraft                bool `json:"can_draft"`
-	CanSubmit               bool `json:"can_submit"`
-	CanApprove              bool `json:"can_approve"`
-	CanReject               bool `json:"can_reject"`
-	CanSetPaymentInProgress bool `json:"can_set_payment_in_progress"`
-	CanSetPaid              bool `json:"can_set_paid"`
+	Level                   int            `json:"level"`
+	UserGroupID             uint           `json:"user_group_id"`
+	ApproverID              uint           `json:"approver_id"`
+	MinAmount               money.Decimal  `json:"min_amount"`
+	MaxAmount               *money.Decimal `json:"max_amount"`
+	ClaimTypeIDs            []uint         `json:"claim_type_ids"`
+	CanDraft                bool           `json:"can_draft"`
+	CanSubmit               bool           `json:"can_submit"`
+	CanApprove              bool           `json:"can_approve"`
+	CanReject               bool           `json:"can_reject"`
+	CanSetPaymentInProgress bool           `json:"can_set_payment_in_progress"`
+	CanSetPaid              bool           `json:"can_set_paid"`
 }
 
 func NewAdminHandler(db *gorm.DB) *AdminHandler {
@@ -52,6 +62,11 @@ func (h *AdminHandler) CreateClaimType(w http.ResponseWriter, r *http.Request) {
 	claimType := models.ClaimType{
 		Name:        req.Name,
 		Description: req.Description,
+		Active:      true,
+	}
+	if err := validateClaimType(h.DB, &claimType); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	if err := h.DB.Create(&claimType).Error; err != nil {
@@ -93,6 +108,10 @@ func (h *AdminHandler) UpdateClaimType(w http.ResponseWriter, r *http.Request) {
 
 	claimType.Name = req.Name
 	claimType.Description = req.Description
+	if err := validateClaimType(h.DB, &claimType); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	if err := h.DB.Save(&claimType).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update claim type")
@@ -124,9 +143,17 @@ func (h *AdminHandler) CreateUserGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	policy, err := parseResubmitPolicy(req.ResubmitPolicy)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	userGroup := models.UserGroup{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:           req.Name,
+		Description:    req.Description,
+		Location:       req.Location,
+		ResubmitPolicy: policy,
 	}
 
 	if err := h.DB.Create(&userGroup).Error; err != nil {
@@ -166,8 +193,16 @@ func (h *AdminHandler) UpdateUserGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	policy, err := parseResubmitPolicy(req.ResubmitPolicy)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	userGroup.Name = req.Name
 	userGroup.Description = req.Description
+	userGroup.Location = req.Location
+	userGroup.ResubmitPolicy = policy
 
 	if err := h.DB.Save(&userGroup).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update user group")
@@ -199,10 +234,26 @@ func (h *AdminHandler) CreateApprovalLevel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err := workflow.ValidateAmountBand(req.MinAmount, req.MaxAmount); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var claimTypes []models.ClaimType
+	if len(req.ClaimTypeIDs) > 0 {
+		if err := h.DB.Find(&claimTypes, req.ClaimTypeIDs).Error; err != nil || len(claimTypes) != len(req.ClaimTypeIDs) {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid claim types")
+			return
+		}
+	}
+
 	approvalLevel := models.ApprovalLevel{
 		Level:                   req.Level,
 		UserGroupID:             req.UserGroupID,
-		ApproverID:              req.ApproverID,
+		ApproverID:              optionalID(req.ApproverID),
+		MinAmount:               req.MinAmount,
+		MaxAmount:               req.MaxAmount,
+		ClaimTypes:              claimTypes,
 		CanDraft:                req.CanDraft,
 		CanSubmit:               req.CanSubmit,
 		CanApprove:              req.CanApprove,
@@ -216,7 +267,7 @@ func (h *AdminHandler) CreateApprovalLevel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := h.DB.Preload("UserGroup").Preload("Approver").First(&approvalLevel, approvalLevel.ID).Error; err != nil {
+	if err := h.DB.Preload("UserGroup").Preload("Approver").Preload("ClaimTypes").First(&approvalLevel, approvalLevel.ID).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve approval level")
 		return
 	}
@@ -226,7 +277,7 @@ func (h *AdminHandler) CreateApprovalLevel(w http.ResponseWriter, r *http.Reques
 
 func (h *AdminHandler) GetApprovalLevels(w http.ResponseWriter, r *http.Request) {
 	var approvalLevels []models.ApprovalLevel
-	if err := h.DB.Preload("UserGroup").Preload("Approver").Find(&approvalLevels).Error; err != nil {
+	if err := h.DB.Preload("UserGroup").Preload("Approver").Preload("ClaimTypes").Find(&approvalLevels).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve approval levels")
 		return
 	}
@@ -253,9 +304,16 @@ func (h *AdminHandler) UpdateApprovalLevel(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err := workflow.ValidateAmountBand(req.MinAmount, req.MaxAmount); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	approvalLevel.Level = req.Level
 	approvalLevel.UserGroupID = req.UserGroupID
-	approvalLevel.ApproverID = req.ApproverID
+	approvalLevel.ApproverID = optionalID(req.ApproverID)
+	approvalLevel.MinAmount = req.MinAmount
+	approvalLevel.MaxAmount = req.MaxAmount
 	approvalLevel.CanDraft = req.CanDraft
 	approvalLevel.CanSubmit = req.CanSubmit
 	approvalLevel.CanApprove = req.CanApprove
@@ -263,12 +321,25 @@ func (h *AdminHandler) UpdateApprovalLevel(w http.ResponseWriter, r *http.Reques
 	approvalLevel.CanSetPaymentInProgress = req.CanSetPaymentInProgress
 	approvalLevel.CanSetPaid = req.CanSetPaid
 
+	var claimTypes []models.ClaimType
+	if len(req.ClaimTypeIDs) > 0 {
+		if err := h.DB.Find(&claimTypes, req.ClaimTypeIDs).Error; err != nil || len(claimTypes) != len(req.ClaimTypeIDs) {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid claim types")
+			return
+		}
+	}
+
 	if err := h.DB.Save(&approvalLevel).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update approval level")
 		return
 	}
 
-	if err := h.DB.Preload("UserGroup").Preload("Approver").First(&approvalLevel, approvalLevel.ID).Error; err != nil {
+	if err := h.DB.Model(&approvalLevel).Association("ClaimTypes").Replace(claimTypes); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update approval level claim types")
+		return
+	}
+
+	if err := h.DB.Preload("UserGroup").Preload("Approver").Preload("ClaimTypes").First(&approvalLevel, approvalLevel.ID).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve updated approval level")
 		return
 	}
@@ -289,4 +360,83 @@ func (h *AdminHandler) DeleteApprovalLevel(w http.ResponseWriter, r *http.Reques
 	}
 
 	utils.WriteSuccess(w, nil, "Approval level deleted successfully")
-}
\ No newline at end of file
+}
+
+// parseResubmitPolicy validates a group's resubmit policy, defaulting to
+// restarting the chain.
+func parseResubmitPolicy(policy string) (models.ResubmitPolicy, error) {
+	switch models.ResubmitPolicy(policy) {
+	case "", models.ResubmitRestart:
+		return models.ResubmitRestart, nil
+	case models.ResubmitResume:
+		return models.ResubmitResume, nil
+	}
+	return "", fmt.Errorf("Invalid resubmit policy: %s", policy)
+}
+
+// validateClaimType normalizes and checks a claim type before it is saved.
+// A missing code is derived from the name, e.g. "Office Supplies" becomes
+// OFFICE_SUPPLIES.
+func validateClaimType(db *gorm.DB, claimType *models.ClaimType) error {
+	claimType.Name = strings.TrimSpace(claimType.Name)
+	if claimType.Name == "" {
+		return fmt.Errorf("Claim type name is required")
+	}
+
+	code := strings.TrimSpace(claimType.Code)
+	if code == "" {
+		code = claimType.Name
+	}
+	code = strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, code), "_")
+	for strings.Contains(code, "__") {
+		code = strings.ReplaceAll(code, "__", "_")
+	}
+	if code == "" {
+		return fmt.Errorf("Claim type code must contain letters or digits")
+	}
+
+	var clashes int64
+	if err := db.Model(&models.ClaimType{}).Where("code = ? AND id <> ?", code, claimType.ID).Count(&clashes).Error; err != nil {
+		return err
+	}
+	if clashes > 0 {
+		return fmt.Errorf("Claim type code %s already exists", code)
+	}
+	claimType.Code = code
+
+	if claimType.Category == "" {
+		claimType.Category = models.CategoryOther
+	}
+	if !claimType.Category.Valid() {
+		return fmt.Errorf("Invalid claim type category: %s", claimType.Category)
+	}
+	if claimType.Kind == "" {
+		claimType.Kind = models.KindStandard
+	}
+	if !claimType.Kind.Valid() {
+		return fmt.Errorf("Invalid claim type kind: %s", claimType.Kind)
+	}
+	if claimType.MaxAmount != nil && claimType.MaxAmount.Sign() <= 0 {
+		return fmt.Errorf("Maximum amount must be greater than zero")
+	}
+	if claimType.ValidityPeriod < 0 {
+		return fmt.Errorf("Validity period cannot be negative")
+	}
+	return nil
+}
+
+// optionalID maps a zero ID from a request onto a nil foreign key.
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
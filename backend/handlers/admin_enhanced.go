@@ -10,14 +10,17 @@ import (
 
 	"hrcs/backend/middleware"
 	"hrcs/backend/models"
+	"hrcs/backend/money"
 	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
 
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
 )
 
 type AdminEnhancedHandler struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Engine *workflow.Engine
 }
 
 type ApprovalStep struct {
@@ -29,10 +32,14 @@ type ApprovalStep struct {
 	ApproverEmail string              `json:"approverEmail"`
 	UserGroupID   uint                `json:"userGroupId"`
 	UserGroupName string              `json:"userGroupName"`
-	Status        string              `json:"status"` // "pending", "approved", "rejected", "skipped"
+	Status        string              `json:"status"` // "pending", "approved", "rejected", "skipped", "escalated", "returned"
 	CompletedAt   *string             `json:"completedAt"`
 	Comments      string              `json:"comments"`
 	Permissions   ApprovalPermissions `json:"permissions"`
+	// All approvers assigned to the level and how many must approve
+	Approvers            []Approver `json:"approvers"`
+	RequiresAllApprovers bool       `json:"requiresAllApprovers"`
+	ApprovalsReceived    int        `json:"approvalsReceived"`
 }
 
 type ApprovalPermissions struct {
@@ -45,7 +52,7 @@ type ApprovalPermissions struct {
 }
 
 func NewAdminEnhancedHandler(db *gorm.DB) *AdminEnhancedHandler {
-	return &AdminEnhancedHandler{DB: db}
+	return &AdminEnhancedHandler{DB: db, Engine: workflow.NewEngine(db)}
 }
 
 // Admin Claims Management
@@ -53,7 +60,7 @@ func (h *AdminEnhancedHandler) GetAllClaims(w http.ResponseWriter, r *http.Reque
 	user := middleware.GetUserFromContext(r.Context())
 	
 	var claims []models.Claim
-	query := h.DB.Preload("User").Preload("ClaimType").Order("created_at DESC")
+	query := h.DB.Preload("User").Preload("ClaimType").Preload("Violations").Preload("Duplicates").Order("created_at DESC")
 
 	// Add filters if needed
 	status := r.URL.Query().Get("status")
@@ -66,10 +73,6 @@ func (h *AdminEnhancedHandler) GetAllClaims(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Get approver permissions for current user
-	var approverLevels []models.ApprovalLevel
-	h.DB.Where("approver_id = ?", user.ID).Find(&approverLevels)
-
 	// Enhanced claim response with additional fields
 	type EnhancedClaim struct {
 		models.Claim
@@ -80,102 +83,132 @@ func (h *AdminEnhancedHandler) GetAllClaims(w http.ResponseWriter, r *http.Reque
 		ApprovalsRequired int               `json:"approvalsRequired"`
 		SubmittedDate     string            `json:"submittedDate"`
 		CanApprove        bool              `json:"canApprove"`
+		OnBehalfOf        *models.User      `json:"onBehalfOf,omitempty"`
 		AllowedStatuses   []string          `json:"allowedStatuses"`
 		ApprovalWorkflow  []ApprovalStep    `json:"approvalWorkflow"`
 		CurrentStep       *ApprovalStep     `json:"currentStep"`
 		NextSteps         []ApprovalStep    `json:"nextSteps"`
 	}
 
+	// Approvers the current user is standing in for while they are away
+	delegators, err := h.Engine.Delegators(user)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve delegations")
+		return
+	}
+
+	// The engine's view of each claimant's chain and the claim's current
+	// submission round, loaded for the whole list at once
+	progresses, err := h.Engine.Progresses(claims)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to build approval workflow")
+		return
+	}
+
 	var enhancedClaims []EnhancedClaim
 	for _, claim := range claims {
-		// Get the claim user's group to determine workflow
-		var claimUser models.User
-		h.DB.Preload("UserGroup").First(&claimUser, claim.UserID)
-		
 		// Build approval workflow for this claim
+		progress := progresses[claim.ID]
+
 		approvalWorkflow := []ApprovalStep{}
 		currentStep := (*ApprovalStep)(nil)
 		nextSteps := []ApprovalStep{}
 		canApprove := false
+		var onBehalfOf *models.User
 		allowedStatuses := []string{}
-		
-		if claimUser.UserGroupID != nil {
-			// Get all approval levels for this user group
-			var allLevels []models.ApprovalLevel
-			h.DB.Preload("Approver").Preload("UserGroup").
-				Where("user_group_id = ?", *claimUser.UserGroupID).
-				Order("level").Find(&allLevels)
-			
-			// Build workflow steps
-			for _, level := range allLevels {
-				step := ApprovalStep{
-					ID:            level.ID,
-					Level:         level.Level,
-					Name:          fmt.Sprintf("Level %d Approval", level.Level),
-					ApproverID:    level.ApproverID,
-					ApproverName:  level.Approver.FirstName + " " + level.Approver.LastName,
-					ApproverEmail: level.Approver.Email,
-					UserGroupID:   level.UserGroupID,
-					UserGroupName: level.UserGroup.Name,
-					Status:        "pending",
-					CompletedAt:   nil,
-					Comments:      "",
-					Permissions: ApprovalPermissions{
-						CanDraft:                level.CanDraft,
-						CanSubmit:               level.CanSubmit,
-						CanApprove:              level.CanApprove,
-						CanReject:               level.CanReject,
-						CanSetPaymentInProgress: level.CanSetPaymentInProgress,
-						CanSetPaid:              level.CanSetPaid,
-					},
-				}
-				
-				// Check if this step has been completed
-				var approval models.ClaimApproval
-				err := h.DB.Where("claim_id = ? AND approval_level_id = ?", claim.ID, level.ID).First(&approval).Error
-				if err == nil {
-					step.Status = string(approval.Status)
-					if !approval.CreatedAt.IsZero() {
-						completedAt := approval.CreatedAt.Format(time.RFC3339)
-						step.CompletedAt = &completedAt
-					}
-					step.Comments = approval.Comments
-				}
-				
-				approvalWorkflow = append(approvalWorkflow, step)
-				
-				// Determine current step and next steps based on claim status
-				if step.Status == "pending" && currentStep == nil {
-					currentStep = &step
-					nextSteps = append(nextSteps, step)
-				}
-				
-				// Check if current user can approve this step
-				if claim.UserID != user.ID && level.ApproverID == user.ID && step.Status == "pending" {
+		pending := claim.Status == models.StatusSubmitted || claim.Status == models.StatusInReview
+
+		for i := range progress.Levels {
+			level := &progress.Levels[i]
+			step := newApprovalStep(level)
+
+			// Levels outside the claim's amount route are skipped; otherwise
+			// check if this step has been completed
+			if !progress.InChain(level.ID) {
+				step.Status = "skipped"
+			} else if progress.Carried[level.ID] {
+				// Approved before the claim was returned and resubmitted
+				step.Status = "approved"
+			} else if returned := progress.Return; returned != nil && returned.ApprovalLevelID != nil && *returned.ApprovalLevelID == level.ID {
+				step.Status = "returned"
+				completedAt := returned.CreatedAt.Format(time.RFC3339)
+				step.CompletedAt = &completedAt
+				step.Comments = returned.Comments
+			} else if approvals := progress.Approvals[level.ID]; progress.IsComplete(level.ID) && len(approvals) > 0 {
+				approval := approvals[len(approvals)-1]
+				step.Status = "approved"
+				completedAt := approval.CreatedAt.Format(time.RFC3339)
+				step.CompletedAt = &completedAt
+				step.Comments = approval.Comments
+			} else if escalation := progress.Escalations[level.ID]; escalation != nil && progress.IsComplete(level.ID) {
+				// Overdue and passed on to the next level by the scheduler
+				step.Status = "escalated"
+				completedAt := escalation.CreatedAt.Format(time.RFC3339)
+				step.CompletedAt = &completedAt
+				step.Comments = escalation.Comments
+			} else if rejection := progress.Rejection; rejection != nil && rejection.ApprovalLevelID != nil && *rejection.ApprovalLevelID == level.ID {
+				step.Status = "rejected"
+				completedAt := rejection.CreatedAt.Format(time.RFC3339)
+				step.CompletedAt = &completedAt
+				step.Comments = rejection.Comments
+			}
+
+			step.ApprovalsReceived = len(progress.Approvals[level.ID])
+			approvalWorkflow = append(approvalWorkflow, step)
+
+			isCurrent := pending && progress.Current != nil && progress.Current.ID == level.ID
+			if isCurrent {
+				currentStep = &approvalWorkflow[len(approvalWorkflow)-1]
+			}
+			if pending && step.Status == "pending" {
+				nextSteps = append(nextSteps, step)
+			}
+
+			// Check what the current user can do at this level. Approve and
+			// reject are only offered on the level that is up next, where a
+			// delegate may also act for an absent approver.
+			if claim.UserID == user.ID {
+				continue
+			}
+			if isCurrent {
+				if delegator, ok := h.Engine.ActingFor(level, user, delegators); ok && (delegator == nil || delegator.ID != claim.UserID) {
 					canApprove = true
-					
-					// Add allowed statuses based on permissions
-					if level.CanDraft {
-						allowedStatuses = append(allowedStatuses, string(models.StatusDraft))
-					}
-					if level.CanSubmit {
-						allowedStatuses = append(allowedStatuses, string(models.StatusSubmitted))
-					}
+					onBehalfOf = delegator
 					if level.CanApprove {
 						allowedStatuses = append(allowedStatuses, string(models.StatusApproved))
 					}
 					if level.CanReject {
-						allowedStatuses = append(allowedStatuses, string(models.StatusRejected))
-					}
-					if level.CanSetPaymentInProgress {
-						allowedStatuses = append(allowedStatuses, string(models.StatusPaymentInProgress))
-					}
-					if level.CanSetPaid {
-						allowedStatuses = append(allowedStatuses, string(models.StatusPaid))
+						allowedStatuses = append(allowedStatuses, string(models.StatusRejected), string(models.StatusReturned))
 					}
 				}
 			}
+			if !h.Engine.CanAct(level, user) {
+				continue
+			}
+			if level.CanDraft {
+				allowedStatuses = append(allowedStatuses, string(models.StatusDraft))
+			}
+			if level.CanSubmit {
+				allowedStatuses = append(allowedStatuses, string(models.StatusSubmitted))
+			}
+			if level.CanSetPaymentInProgress {
+				allowedStatuses = append(allowedStatuses, string(models.StatusPaymentInProgress))
+			}
+			if level.CanSetPaid {
+				allowedStatuses = append(allowedStatuses, string(models.StatusPaid))
+			}
+		}
+
+		// Only offer statuses the claim can legally move to from where it is
+		legalStatuses := []string{}
+		seen := map[string]bool{}
+		for _, status := range allowedStatuses {
+			if !seen[status] && workflow.CanTransition(claim.Status, models.ClaimStatus(status)) {
+				legalStatuses = append(legalStatuses, status)
+			}
+			seen[status] = true
 		}
+		allowedStatuses = legalStatuses
 
 		// Calculate approvals received/required
 		approvalsReceived := 0
@@ -191,9 +224,10 @@ func (h *AdminEnhancedHandler) GetAllClaims(w http.ResponseWriter, r *http.Reque
 			Department:        "IT", // TODO: Add department field to User model
 			Type:              claim.ClaimType.Name,
 			ApprovalsReceived: approvalsReceived,
-			ApprovalsRequired: len(approvalWorkflow),
+			ApprovalsRequired: len(progress.Chain),
 			SubmittedDate:     claim.CreatedAt.Format("2006-01-02"),
 			CanApprove:        canApprove,
+			OnBehalfOf:        onBehalfOf,
 			AllowedStatuses:   allowedStatuses,
 			ApprovalWorkflow:  approvalWorkflow,
 			CurrentStep:       currentStep,
@@ -205,7 +239,123 @@ func (h *AdminEnhancedHandler) GetAllClaims(w http.ResponseWriter, r *http.Reque
 	utils.WriteSuccess(w, enhancedClaims)
 }
 
+func newApprovalStep(level *models.ApprovalLevel) ApprovalStep {
+	step := ApprovalStep{
+		ID:            level.ID,
+		Level:         level.Level,
+		Name:          fmt.Sprintf("Level %d Approval", level.Level),
+		UserGroupID:   level.UserGroupID,
+		UserGroupName: level.UserGroup.Name,
+		Status:        "pending",
+		CompletedAt:   nil,
+		Comments:      "",
+		Permissions: ApprovalPermissions{
+			CanDraft:                level.CanDraft,
+			CanSubmit:               level.CanSubmit,
+			CanApprove:              level.CanApprove,
+			CanReject:               level.CanReject,
+			CanSetPaymentInProgress: level.CanSetPaymentInProgress,
+			CanSetPaid:              level.CanSetPaid,
+		},
+		Approvers:            approversFor(level),
+		RequiresAllApprovers: level.RequiresAllApprovers,
+	}
+
+	if level.Approver != nil {
+		step.ApproverID = level.Approver.ID
+		step.ApproverName = level.Approver.FirstName + " " + level.Approver.LastName
+		step.ApproverEmail = level.Approver.Email
+	}
+
+	return step
+}
+
+// approversFor lists everyone assigned to a level in the admin API shape.
+func approversFor(level *models.ApprovalLevel) []Approver {
+	approvers := []Approver{}
+	for _, a := range workflow.Assignments(level) {
+		approver := Approver{Type: string(a.Type)}
+		switch a.Type {
+		case models.ApproverTypeUser:
+			if a.UserID != nil {
+				approver.ID = *a.UserID
+			}
+			if a.User != nil {
+				approver.Name = a.User.FirstName + " " + a.User.LastName
+			}
+		case models.ApproverTypeGroup:
+			if a.UserGroupID != nil {
+				approver.ID = *a.UserGroupID
+			}
+			if a.UserGroup != nil {
+				approver.Name = a.UserGroup.Name
+			}
+		case models.ApproverTypeRole:
+			approver.Value = string(a.Role)
+			approver.Name = string(a.Role)
+		}
+		approvers = append(approvers, approver)
+	}
+	return approvers
+}
+
+// buildApprovers validates approver assignments from the admin API.
+func (h *AdminEnhancedHandler) buildApprovers(approvers []Approver) ([]models.ApprovalLevelApprover, error) {
+	assignments := []models.ApprovalLevelApprover{}
+	for _, a := range approvers {
+		id := a.ID
+		switch models.ApproverType(a.Type) {
+		case models.ApproverTypeUser:
+			var user models.User
+			if err := h.DB.First(&user, id).Error; err != nil {
+				return nil, fmt.Errorf("Invalid approver user: %d", id)
+			}
+			assignments = append(assignments, models.ApprovalLevelApprover{Type: models.ApproverTypeUser, UserID: &id})
+		case models.ApproverTypeGroup:
+			var group models.UserGroup
+			if err := h.DB.First(&group, id).Error; err != nil {
+				return nil, fmt.Errorf("Invalid approver group: %d", id)
+			}
+			assignments = append(assignments, models.ApprovalLevelApprover{Type: models.ApproverTypeGroup, UserGroupID: &id})
+		case models.ApproverTypeRole:
+			role := models.UserRole(a.Value)
+			if role != models.RoleAdmin && role != models.RoleNormal {
+				return nil, fmt.Errorf("Invalid approver role: %s", a.Value)
+			}
+			assignments = append(assignments, models.ApprovalLevelApprover{Type: models.ApproverTypeRole, Role: role})
+		default:
+			return nil, fmt.Errorf("Invalid approver type: %s", a.Type)
+		}
+	}
+	return assignments, nil
+}
+
+// primaryApprover picks the first named user among the assignments.
+func primaryApprover(assignments []models.ApprovalLevelApprover) *uint {
+	for _, a := range assignments {
+		if a.Type == models.ApproverTypeUser {
+			return a.UserID
+		}
+	}
+	return nil
+}
+
+// validateTimeouts checks a level's reminder and escalation settings.
+func (h *AdminEnhancedHandler) validateTimeouts(reminderDays, escalationDays *int, fallbackApproverID *uint) error {
+	if (reminderDays != nil && *reminderDays < 0) || (escalationDays != nil && *escalationDays < 0) {
+		return fmt.Errorf("Reminder and escalation days cannot be negative")
+	}
+	if fallbackApproverID != nil {
+		var fallback models.User
+		if err := h.DB.First(&fallback, *fallbackApproverID).Error; err != nil {
+			return fmt.Errorf("Invalid fallback approver")
+		}
+	}
+	return nil
+}
+
 func (h *AdminEnhancedHandler) AdminApproveClaim(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
 	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
@@ -226,16 +376,17 @@ func (h *AdminEnhancedHandler) AdminApproveClaim(w http.ResponseWriter, r *http.
 		return
 	}
 
-	claim.Status = models.StatusApproved
-	if err := h.DB.Save(&claim).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to approve claim")
+	approval, err := h.Engine.Transition(&claim, models.ActionApprove, user, workflow.Note{Comments: req.Comments})
+	if err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
-	utils.WriteSuccess(w, claim, "Claim approved successfully")
+	utils.WriteSuccess(w, claim, withWarnings("Claim approved successfully", approval))
 }
 
 func (h *AdminEnhancedHandler) AdminRejectClaim(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
 	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
@@ -243,7 +394,8 @@ func (h *AdminEnhancedHandler) AdminRejectClaim(w http.ResponseWriter, r *http.R
 	}
 
 	var req struct {
-		Comments string `json:"comments"`
+		ReasonCode string `json:"reasonCode"`
+		Comments   string `json:"comments"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
@@ -256,16 +408,15 @@ func (h *AdminEnhancedHandler) AdminRejectClaim(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	claim.Status = models.StatusRejected
-	if err := h.DB.Save(&claim).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to reject claim")
+	if _, err := h.Engine.Transition(&claim, models.ActionReject, user, workflow.Note{Comments: req.Comments, ReasonCode: req.ReasonCode}); err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
 	utils.WriteSuccess(w, claim, "Claim rejected successfully")
 }
 
-func (h *AdminEnhancedHandler) UpdateClaimStatus(w http.ResponseWriter, r *http.Request) {
+func (h *AdminEnhancedHandler) AdminReturnClaim(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUserFromContext(r.Context())
 	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -274,8 +425,8 @@ func (h *AdminEnhancedHandler) UpdateClaimStatus(w http.ResponseWriter, r *http.
 	}
 
 	var req struct {
-		Status   models.ClaimStatus `json:"status"`
-		Comments string             `json:"comments"`
+		ReasonCode string `json:"reasonCode"`
+		Comments   string `json:"comments"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
@@ -283,88 +434,58 @@ func (h *AdminEnhancedHandler) UpdateClaimStatus(w http.ResponseWriter, r *http.
 	}
 
 	var claim models.Claim
-	if err := h.DB.Preload("User").First(&claim, claimID).Error; err != nil {
+	if err := h.DB.First(&claim, claimID).Error; err != nil {
 		utils.WriteError(w, http.StatusNotFound, "Claim not found")
 		return
 	}
 
-	// Check if user can approve this claim
-	if claim.UserID == user.ID {
-		utils.WriteError(w, http.StatusForbidden, "Cannot approve your own claim")
+	if _, err := h.Engine.Transition(&claim, models.ActionReturn, user, workflow.Note{Comments: req.Comments, ReasonCode: req.ReasonCode}); err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
-	// Get user's approval levels and check permissions
-	var approverLevels []models.ApprovalLevel
-	h.DB.Where("approver_id = ?", user.ID).Find(&approverLevels)
-
-	hasPermission := false
-	for _, level := range approverLevels {
-		// Check if the claim user is in the same group as this approval level
-		var claimUser models.User
-		h.DB.Preload("UserGroup").First(&claimUser, claim.UserID)
-		
-		if claimUser.UserGroupID != nil && *claimUser.UserGroupID == level.UserGroupID {
-			// Check if user has permission for this status
-			switch req.Status {
-			case models.StatusDraft:
-				hasPermission = level.CanDraft
-			case models.StatusSubmitted:
-				hasPermission = level.CanSubmit
-			case models.StatusApproved:
-				hasPermission = level.CanApprove
-			case models.StatusRejected:
-				hasPermission = level.CanReject
-			case models.StatusPaymentInProgress:
-				hasPermission = level.CanSetPaymentInProgress
-			case models.StatusPaid:
-				hasPermission = level.CanSetPaid
-			}
-			if hasPermission {
-				break
-			}
-		}
-	}
+	utils.WriteSuccess(w, claim, "Claim returned for revision")
+}
 
-	if !hasPermission {
-		utils.WriteError(w, http.StatusForbidden, "You don't have permission to set this status")
+func (h *AdminEnhancedHandler) UpdateClaimStatus(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
 		return
 	}
 
-	// Update claim status
-	claim.Status = req.Status
-	if err := h.DB.Save(&claim).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to update claim status")
+	var req struct {
+		Status   models.ClaimStatus `json:"status"`
+		ReasonCode string             `json:"reasonCode"`
+		Comments   string             `json:"comments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Find the approval level ID for this user and claim user group
-	var approvalLevelID uint
-	for _, level := range approverLevels {
-		var claimUser models.User
-		h.DB.Preload("UserGroup").First(&claimUser, claim.UserID)
-		
-		if claimUser.UserGroupID != nil && *claimUser.UserGroupID == level.UserGroupID && level.ApproverID == user.ID {
-			approvalLevelID = level.ID
-			break
-		}
+	var claim models.Claim
+	if err := h.DB.Preload("User").First(&claim, claimID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		return
 	}
 
-	// Create approval record
-	approval := models.ClaimApproval{
-		ClaimID:         claim.ID,
-		ApprovalLevelID: approvalLevelID,
-		ApproverID:      user.ID,
-		Status:          req.Status,
-		Comments:        req.Comments,
+	// Resolve the requested status to a lifecycle action; the engine then
+	// checks the approver's level and permissions
+	action, err := workflow.ActionFor(claim.Status, req.Status)
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
 	}
 
-	if err := h.DB.Create(&approval).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to create approval record")
+	approval, err := h.Engine.Transition(&claim, action, user, workflow.Note{Comments: req.Comments, ReasonCode: req.ReasonCode})
+	if err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
-	utils.WriteSuccess(w, claim, "Claim status updated successfully")
+	utils.WriteSuccess(w, claim, withWarnings("Claim status updated successfully", approval))
 }
 
 // Admin Users Management
@@ -532,19 +653,24 @@ func (h *AdminEnhancedHandler) DeleteAdminUser(w http.ResponseWriter, r *http.Re
 
 // Enhanced Claim Types
 type EnhancedClaimTypeRequest struct {
-	Name                  string  `json:"name"`
-	Code                  string  `json:"code"`
-	Description           string  `json:"description"`
-	Category              string  `json:"category"`
-	MaxAmount             float64 `json:"maxAmount"`
-	Icon                  string  `json:"icon"`
-	Color                 string  `json:"color"`
-	RequiresReceipt       bool    `json:"requiresReceipt"`
-	RequiresApproval      bool    `json:"requiresApproval"`
-	RequiresJustification bool    `json:"requiresJustification"`
-	ApprovalLevels        int     `json:"approvalLevels"`
+	Name                  string        `json:"name"`
+	Code                  string        `json:"code"`
+	Description           string        `json:"description"`
+	Category              string        `json:"category"`
+	Kind                  string        `json:"kind"` // "standard", "mileage" or "per-diem"
+	MaxAmount             money.Decimal `json:"maxAmount"`
+	Icon                  string        `json:"icon"`
+	Color                 string        `json:"color"`
+	RequiresReceipt       bool          `json:"requiresReceipt"`
+	RequiresApproval      bool          `json:"requiresApproval"`
+	RequiresJustification bool          `json:"requiresJustification"`
+	ApprovalLevels        int           `json:"approvalLevels"`
+	// ValidityPeriod and MaxAmount of 0 mean no limit
 	ValidityPeriod        int     `json:"validityPeriod"`
-	Active                bool    `json:"active"`
+	// GLAccount is the ledger expense account for journal exports
+	GLAccount             string  `json:"glAccount"`
+	// Active defaults to true; omit it to leave the type as it is
+	Active                *bool   `json:"active"`
 }
 
 func (h *AdminEnhancedHandler) GetEnhancedClaimTypes(w http.ResponseWriter, r *http.Request) {
@@ -557,34 +683,40 @@ func (h *AdminEnhancedHandler) GetEnhancedClaimTypes(w http.ResponseWriter, r *h
 	// Convert to enhanced response
 	type EnhancedClaimType struct {
 		models.ClaimType
-		Code                  string  `json:"code"`
-		Category              string  `json:"category"`
-		MaxAmount             float64 `json:"maxAmount"`
-		Icon                  string  `json:"icon"`
-		Color                 string  `json:"color"`
-		RequiresReceipt       bool    `json:"requiresReceipt"`
-		RequiresApproval      bool    `json:"requiresApproval"`
-		RequiresJustification bool    `json:"requiresJustification"`
-		ApprovalLevels        int     `json:"approvalLevels"`
-		ValidityPeriod        int     `json:"validityPeriod"`
-		Active                bool    `json:"active"`
+		Code                  string        `json:"code"`
+		Category              string        `json:"category"`
+		MaxAmount             money.Decimal `json:"maxAmount"`
+		Icon                  string        `json:"icon"`
+		Color                 string        `json:"color"`
+		RequiresReceipt       bool          `json:"requiresReceipt"`
+		RequiresApproval      bool          `json:"requiresApproval"`
+		RequiresJustification bool          `json:"requiresJustification"`
+		ApprovalLevels        int           `json:"approvalLevels"`
+		ValidityPeriod        int           `json:"validityPeriod"`
+		GLAccount             string        `json:"glAccount"`
+		Active                bool          `json:"active"`
 	}
 
 	var enhanced []EnhancedClaimType
 	for _, ct := range claimTypes {
+		maxAmount := money.Zero
+		if ct.MaxAmount != nil {
+			maxAmount = *ct.MaxAmount
+		}
 		enhanced = append(enhanced, EnhancedClaimType{
 			ClaimType:             ct,
-			Code:                  ct.Name, // TODO: Add code field to model
-			Category:              "other",  // TODO: Add category field
-			MaxAmount:             10000,    // TODO: Add max amount field
+			Code:                  ct.Code,
+			Category:              string(ct.Category),
+			MaxAmount:             maxAmount,
 			Icon:                  "pi pi-tag",
 			Color:                 "#3b82f6",
-			RequiresReceipt:       true,
+			RequiresReceipt:       ct.RequiresReceipt,
 			RequiresApproval:      true,
-			RequiresJustification: false,
+			RequiresJustification: ct.RequiresJustification,
 			ApprovalLevels:        1,
-			ValidityPeriod:        30,
-			Active:                true,
+			ValidityPeriod:        ct.ValidityPeriod,
+			GLAccount:             ct.GLAccount,
+			Active:                ct.Active,
 		})
 	}
 
@@ -598,16 +730,25 @@ func (h *AdminEnhancedHandler) CreateEnhancedClaimType(w http.ResponseWriter, r
 		return
 	}
 
-	claimType := models.ClaimType{
-		Name:        req.Name,
-		Description: req.Description,
-		// TODO: Add additional fields to ClaimType model
+	claimType := models.ClaimType{Active: true}
+	if err := h.applyClaimType(&claimType, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
+	active := claimType.Active
 	if err := h.DB.Create(&claimType).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to create claim type")
 		return
 	}
+	// Active has a database default of true, which a false value doesn't
+	// override on insert
+	if !active {
+		if err := h.DB.Model(&claimType).Update("active", false).Error; err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to create claim type")
+			return
+		}
+	}
 
 	utils.WriteSuccess(w, claimType, "Claim type created successfully")
 }
@@ -631,9 +772,10 @@ func (h *AdminEnhancedHandler) UpdateEnhancedClaimType(w http.ResponseWriter, r
 		return
 	}
 
-	claimType.Name = req.Name
-	claimType.Description = req.Description
-	// TODO: Update additional fields
+	if err := h.applyClaimType(&claimType, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	if err := h.DB.Save(&claimType).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update claim type")
@@ -643,10 +785,38 @@ func (h *AdminEnhancedHandler) UpdateEnhancedClaimType(w http.ResponseWriter, r
 	utils.WriteSuccess(w, claimType, "Claim type updated successfully")
 }
 
+// applyClaimType validates a claim type request onto the stored type.
+func (h *AdminEnhancedHandler) applyClaimType(claimType *models.ClaimType, req *EnhancedClaimTypeRequest) error {
+	if req.MaxAmount.Sign() < 0 {
+		return fmt.Errorf("Maximum amount cannot be negative")
+	}
+	claimType.Name = req.Name
+	claimType.Code = req.Code
+	claimType.Description = req.Description
+	claimType.Category = models.ClaimCategory(req.Category)
+	claimType.Kind = models.ClaimKind(req.Kind)
+	claimType.MaxAmount = nil
+	if req.MaxAmount.Sign() > 0 {
+		maxAmount := req.MaxAmount
+		claimType.MaxAmount = &maxAmount
+	}
+	claimType.RequiresReceipt = req.RequiresReceipt
+	claimType.RequiresJustification = req.RequiresJustification
+	claimType.ValidityPeriod = req.ValidityPeriod
+	claimType.GLAccount = strings.TrimSpace(req.GLAccount)
+	if req.Active != nil {
+		claimType.Active = *req.Active
+	}
+	return validateClaimType(h.DB, claimType)
+}
+
 // Enhanced Groups
 type EnhancedGroupRequest struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
+	Location    string   `json:"location"`
+	// ResubmitPolicy is "restart" (default) or "resume"
+	ResubmitPolicy string `json:"resubmitPolicy"`
 	Department  string   `json:"department"`
 	Permissions []string `json:"permissions"`
 	Members     []uint   `json:"members"`
@@ -691,9 +861,17 @@ func (h *AdminEnhancedHandler) CreateEnhancedGroup(w http.ResponseWriter, r *htt
 		return
 	}
 
+	policy, err := parseResubmitPolicy(req.ResubmitPolicy)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	group := models.UserGroup{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:           req.Name,
+		Description:    req.Description,
+		Location:       req.Location,
+		ResubmitPolicy: policy,
 	}
 
 	if err := h.DB.Create(&group).Error; err != nil {
@@ -733,8 +911,16 @@ func (h *AdminEnhancedHandler) UpdateEnhancedGroup(w http.ResponseWriter, r *htt
 		return
 	}
 
+	policy, err := parseResubmitPolicy(req.ResubmitPolicy)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	group.Name = req.Name
 	group.Description = req.Description
+	group.Location = req.Location
+	group.ResubmitPolicy = policy
 
 	if err := h.DB.Save(&group).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update group")
@@ -778,17 +964,18 @@ func (h *AdminEnhancedHandler) DeleteEnhancedGroup(w http.ResponseWriter, r *htt
 
 // Enhanced Approval Levels
 type EnhancedApprovalLevelRequest struct {
-	Name                 string      `json:"name"`
-	Description          string      `json:"description"`
-	MinAmount            float64     `json:"minAmount"`
-	MaxAmount            *float64    `json:"maxAmount"`
-	ClaimTypes           []string    `json:"claimTypes"`
-	Approvers            []Approver  `json:"approvers"`
-	RequiresAllApprovers bool        `json:"requiresAllApprovers"`
-	AutoApprove          bool        `json:"autoApprove"`
-	NotifyApprovers      bool        `json:"notifyApprovers"`
-	EscalationDays       *int        `json:"escalationDays"`
-	ReminderDays         *int        `json:"reminderDays"`
+	Name                 string         `json:"name"`
+	Description          string         `json:"description"`
+	MinAmount            money.Decimal  `json:"minAmount"`
+	MaxAmount            *money.Decimal `json:"maxAmount"`
+	ClaimTypes           []string       `json:"claimTypes"`
+	Approvers            []Approver     `json:"approvers"`
+	RequiresAllApprovers bool           `json:"requiresAllApprovers"`
+	AutoApprove          bool           `json:"autoApprove"`
+	NotifyApprovers      bool           `json:"notifyApprovers"`
+	EscalationDays       *int           `json:"escalationDays"`
+	ReminderDays         *int           `json:"reminderDays"`
+	FallbackApproverID   *uint          `json:"fallbackApproverId"`
 	// Status permissions
 	CanDraft                bool        `json:"canDraft"`
 	CanSubmit               bool        `json:"canSubmit"`
@@ -805,9 +992,40 @@ type Approver struct {
 	Name  string `json:"name"`  // Display name
 }
 
+// resolveClaimTypes looks up claim types referenced by ID or by name.
+func (h *AdminEnhancedHandler) resolveClaimTypes(refs []string) ([]models.ClaimType, error) {
+	claimTypes := []models.ClaimType{}
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+
+		var claimType models.ClaimType
+		query := h.DB.Where("LOWER(name) = LOWER(?)", ref)
+		if id, err := strconv.Atoi(ref); err == nil {
+			query = h.DB.Where("id = ?", id)
+		}
+		if err := query.First(&claimType).Error; err != nil {
+			return nil, fmt.Errorf("Unknown claim type: %s", ref)
+		}
+		claimTypes = append(claimTypes, claimType)
+	}
+	return claimTypes, nil
+}
+
+func claimTypeNames(claimTypes []models.ClaimType) []string {
+	names := []string{}
+	for _, ct := range claimTypes {
+		names = append(names, ct.Name)
+	}
+	return names
+}
+
 func (h *AdminEnhancedHandler) GetEnhancedApprovalLevels(w http.ResponseWriter, r *http.Request) {
 	var levels []models.ApprovalLevel
-	query := h.DB.Preload("UserGroup").Preload("Approver").Order("user_group_id, level")
+	query := h.DB.Preload("UserGroup").Preload("Approver").Preload("ClaimTypes").
+		Preload("Approvers.User").Preload("Approvers.UserGroup").Order("user_group_id, level")
 	
 	// Filter by user group if specified
 	groupID := r.URL.Query().Get("groupId")
@@ -822,21 +1040,22 @@ func (h *AdminEnhancedHandler) GetEnhancedApprovalLevels(w http.ResponseWriter,
 
 	// Enhanced response
 	type EnhancedApprovalLevel struct {
-		ID                   uint       `json:"id"`
-		Level                int        `json:"level"`
-		UserGroupID          uint       `json:"userGroupId"`
+		ID                   uint           `json:"id"`
+		Level                int            `json:"level"`
+		UserGroupID          uint           `json:"userGroupId"`
 		UserGroup            *models.UserGroup `json:"userGroup,omitempty"`
-		Name                 string     `json:"name"`
-		Description          string     `json:"description"`
-		MinAmount            float64    `json:"minAmount"`
-		MaxAmount            *float64   `json:"maxAmount"`
-		ClaimTypes           []string   `json:"claimTypes"`
-		Approvers            []Approver `json:"approvers"`
-		RequiresAllApprovers bool       `json:"requiresAllApprovers"`
-		AutoApprove          bool       `json:"autoApprove"`
-		NotifyApprovers      bool       `json:"notifyApprovers"`
-		EscalationDays       *int       `json:"escalationDays"`
-		ReminderDays         *int       `json:"reminderDays"`
+		Name                 string         `json:"name"`
+		Description          string         `json:"description"`
+		MinAmount            money.Decimal  `json:"minAmount"`
+		MaxAmount            *money.Decimal `json:"maxAmount"`
+		ClaimTypes           []string       `json:"claimTypes"`
+		Approvers            []Approver     `json:"approvers"`
+		RequiresAllApprovers bool           `json:"requiresAllApprovers"`
+		AutoApprove          bool           `json:"autoApprove"`
+		NotifyApprovers      bool           `json:"notifyApprovers"`
+		EscalationDays       *int           `json:"escalationDays"`
+		ReminderDays         *int           `json:"reminderDays"`
+		FallbackApproverID   *uint          `json:"fallbackApproverId"`
 		// Status permissions
 		CanDraft                bool       `json:"canDraft"`
 		CanSubmit               bool       `json:"canSubmit"`
@@ -848,15 +1067,6 @@ func (h *AdminEnhancedHandler) GetEnhancedApprovalLevels(w http.ResponseWriter,
 
 	var enhanced []EnhancedApprovalLevel
 	for _, level := range levels {
-		approvers := []Approver{}
-		if level.ApproverID > 0 && level.Approver.ID > 0 {
-			approvers = append(approvers, Approver{
-				Type: "user",
-				ID:   level.Approver.ID,
-				Name: level.Approver.FirstName + " " + level.Approver.LastName,
-			})
-		}
-
 		levelName := "Level " + strconv.Itoa(level.Level)
 		if level.UserGroup.Name != "" {
 			levelName += " - " + level.UserGroup.Name
@@ -869,15 +1079,16 @@ func (h *AdminEnhancedHandler) GetEnhancedApprovalLevels(w http.ResponseWriter,
 			UserGroup:            &level.UserGroup,
 			Name:                 levelName,
 			Description:          "Approval level " + strconv.Itoa(level.Level) + " for " + level.UserGroup.Name,
-			MinAmount:            0,
-			MaxAmount:            nil,
-			ClaimTypes:           []string{}, // All types
-			Approvers:            approvers,
-			RequiresAllApprovers: false,
+			MinAmount:            level.MinAmount,
+			MaxAmount:            level.MaxAmount,
+			ClaimTypes:           claimTypeNames(level.ClaimTypes), // Empty means all types
+			Approvers:            approversFor(&level),
+			RequiresAllApprovers: level.RequiresAllApprovers,
 			AutoApprove:          false,
 			NotifyApprovers:      true,
-			EscalationDays:       nil,
-			ReminderDays:         nil,
+			EscalationDays:       level.EscalationDays,
+			ReminderDays:         level.ReminderDays,
+			FallbackApproverID:   level.FallbackApproverID,
 			// Status permissions from database
 			CanDraft:                level.CanDraft,
 			CanSubmit:               level.CanSubmit,
@@ -893,8 +1104,18 @@ func (h *AdminEnhancedHandler) GetEnhancedApprovalLevels(w http.ResponseWriter,
 
 func (h *AdminEnhancedHandler) CreateEnhancedApprovalLevel(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		UserGroupID uint `json:"userGroupId"`
-		ApproverID  uint `json:"approverId"`
+		UserGroupID uint           `json:"userGroupId"`
+		ApproverID  uint           `json:"approverId"`
+		MinAmount   money.Decimal  `json:"minAmount"`
+		MaxAmount   *money.Decimal `json:"maxAmount"`
+		ClaimTypes  []string       `json:"claimTypes"`
+		// Additional approvers and whether all of them must approve
+		Approvers            []Approver `json:"approvers"`
+		RequiresAllApprovers bool       `json:"requiresAllApprovers"`
+		// Timeouts before the scheduler reminds approvers and escalates
+		EscalationDays     *int  `json:"escalationDays"`
+		ReminderDays       *int  `json:"reminderDays"`
+		FallbackApproverID *uint `json:"fallbackApproverId"`
 		// Status permissions
 		CanDraft                bool `json:"canDraft"`
 		CanSubmit               bool `json:"canSubmit"`
@@ -909,6 +1130,11 @@ func (h *AdminEnhancedHandler) CreateEnhancedApprovalLevel(w http.ResponseWriter
 		return
 	}
 
+	if err := workflow.ValidateAmountBand(req.MinAmount, req.MaxAmount); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Validate user group exists
 	var userGroup models.UserGroup
 	if err := h.DB.First(&userGroup, req.UserGroupID).Error; err != nil {
@@ -916,10 +1142,38 @@ func (h *AdminEnhancedHandler) CreateEnhancedApprovalLevel(w http.ResponseWriter
 		return
 	}
 
-	// Validate approver exists
-	var approver models.User
-	if err := h.DB.First(&approver, req.ApproverID).Error; err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid approver")
+	// Validate approvers exist; a level needs at least one
+	var approverID *uint
+	if req.ApproverID > 0 {
+		var approver models.User
+		if err := h.DB.First(&approver, req.ApproverID).Error; err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid approver")
+			return
+		}
+		approverID = &req.ApproverID
+	}
+
+	assignments, err := h.buildApprovers(req.Approvers)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if approverID == nil {
+		approverID = primaryApprover(assignments)
+	}
+	if approverID == nil && len(assignments) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "At least one approver is required")
+		return
+	}
+
+	claimTypes, err := h.resolveClaimTypes(req.ClaimTypes)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.validateTimeouts(req.ReminderDays, req.EscalationDays, req.FallbackApproverID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -933,7 +1187,15 @@ func (h *AdminEnhancedHandler) CreateEnhancedApprovalLevel(w http.ResponseWriter
 	level := models.ApprovalLevel{
 		Level:                   maxLevel + 1,
 		UserGroupID:             req.UserGroupID,
-		ApproverID:              req.ApproverID,
+		ApproverID:              approverID,
+		Approvers:               assignments,
+		RequiresAllApprovers:    req.RequiresAllApprovers,
+		MinAmount:               req.MinAmount,
+		MaxAmount:               req.MaxAmount,
+		ClaimTypes:              claimTypes,
+		ReminderDays:            req.ReminderDays,
+		EscalationDays:          req.EscalationDays,
+		FallbackApproverID:      req.FallbackApproverID,
 		CanDraft:                req.CanDraft,
 		CanSubmit:               req.CanSubmit,
 		CanApprove:              req.CanApprove,
@@ -948,7 +1210,7 @@ func (h *AdminEnhancedHandler) CreateEnhancedApprovalLevel(w http.ResponseWriter
 	}
 
 	// Load associations for response
-	h.DB.Preload("UserGroup").Preload("Approver").First(&level, level.ID)
+	h.DB.Preload("UserGroup").Preload("Approver").Preload("ClaimTypes").Preload("Approvers").First(&level, level.ID)
 
 	utils.WriteSuccess(w, level, "Approval level created successfully")
 }
@@ -972,6 +1234,37 @@ func (h *AdminEnhancedHandler) UpdateEnhancedApprovalLevel(w http.ResponseWriter
 		return
 	}
 
+	if err := workflow.ValidateAmountBand(req.MinAmount, req.MaxAmount); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	claimTypes, err := h.resolveClaimTypes(req.ClaimTypes)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	assignments, err := h.buildApprovers(req.Approvers)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.validateTimeouts(req.ReminderDays, req.EscalationDays, req.FallbackApproverID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Update amount band used for routing
+	level.MinAmount = req.MinAmount
+	level.MaxAmount = req.MaxAmount
+
+	// Update timeouts used by the scheduler
+	level.ReminderDays = req.ReminderDays
+	level.EscalationDays = req.EscalationDays
+	level.FallbackApproverID = req.FallbackApproverID
+
 	// Update status permissions
 	level.CanDraft = req.CanDraft
 	level.CanSubmit = req.CanSubmit
@@ -980,16 +1273,39 @@ func (h *AdminEnhancedHandler) UpdateEnhancedApprovalLevel(w http.ResponseWriter
 	level.CanSetPaymentInProgress = req.CanSetPaymentInProgress
 	level.CanSetPaid = req.CanSetPaid
 
-	// Update approver if provided
-	if len(req.Approvers) > 0 && req.Approvers[0].Type == "user" {
-		level.ApproverID = req.Approvers[0].ID
+	// Replace the approvers if provided; the first named user becomes the
+	// primary approver
+	level.RequiresAllApprovers = req.RequiresAllApprovers
+	if len(assignments) > 0 {
+		level.ApproverID = primaryApprover(assignments)
 	}
 
-	if err := h.DB.Save(&level).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Approvers", "ClaimTypes").Save(&level).Error; err != nil {
+			return err
+		}
+		if len(assignments) == 0 {
+			return nil
+		}
+		if err := tx.Where("approval_level_id = ?", level.ID).Delete(&models.ApprovalLevelApprover{}).Error; err != nil {
+			return err
+		}
+		for i := range assignments {
+			assignments[i].ApprovalLevelID = level.ID
+		}
+		return tx.Create(&assignments).Error
+	})
+	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update approval level")
 		return
 	}
 
+	// Update the claim types the level is limited to
+	if err := h.DB.Model(&level).Association("ClaimTypes").Replace(claimTypes); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update approval level claim types")
+		return
+	}
+
 	utils.WriteSuccess(w, level, "Approval level updated successfully")
 }
 
@@ -1151,10 +1467,10 @@ func (h *AdminEnhancedHandler) GetApprovalLevelsByGroup(w http.ResponseWriter, r
 			}{
 				ID:         level.ID,
 				Level:      level.Level,
-				ApproverID: level.ApproverID,
 			}
 
-			if level.Approver.ID > 0 {
+			if level.Approver != nil {
+				levelData.ApproverID = level.Approver.ID
 				levelData.Approver.ID = level.Approver.ID
 				levelData.Approver.Name = level.Approver.FirstName + " " + level.Approver.LastName
 				levelData.Approver.Email = level.Approver.Email
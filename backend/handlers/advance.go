@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/advance"
+	"hrcs/backend/currency"
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AdvanceHandler handles cash advances: requesting them, taking them
+// through the approval chain, paying them out and settling them, and the
+// balance each employee is left with.
+type AdvanceHandler struct {
+	DB     *gorm.DB
+	Engine *workflow.Engine
+	// BaseCurrency is what advances are routed on
+	BaseCurrency string
+}
+
+type CreateAdvanceRequest struct {
+	Purpose string        `json:"purpose"`
+	Amount  money.Decimal `json:"amount"`
+	// Currency defaults to the base currency
+	Currency string `json:"currency"`
+	NeededBy string `json:"needed_by"` // YYYY-MM-DD, optional
+}
+
+// AdvanceActionRequest is optional for approvals and cancellations;
+// rejections need a ReasonCode.
+type AdvanceActionRequest struct {
+	Comments   string `json:"comments"`
+	ReasonCode string `json:"reason_code"`
+}
+
+// RepayAdvanceRequest records cash the employee paid back.
+type RepayAdvanceRequest struct {
+	Amount   money.Decimal `json:"amount"`
+	Comments string        `json:"comments"`
+}
+
+// PendingAdvance is a cash advance waiting on a level the current user can
+// act on, either directly or on behalf of an approver who delegated to them.
+type PendingAdvance struct {
+	Advance    models.CashAdvance   `json:"advance"`
+	Level      models.ApprovalLevel `json:"level"`
+	OnBehalfOf *models.User         `json:"on_behalf_of,omitempty"`
+}
+
+func NewAdvanceHandler(db *gorm.DB, baseCurrency string) *AdvanceHandler {
+	return &AdvanceHandler{DB: db, Engine: workflow.NewEngine(db), BaseCurrency: baseCurrency}
+}
+
+// GetAdvances lists the user's cash advances, newest first, optionally in
+// one ?status.
+func (h *AdvanceHandler) GetAdvances(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	query := h.DB.Where("user_id = ?", user.ID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var advances []models.CashAdvance
+	if err := query.Order("created_at DESC").Find(&advances).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cash advances")
+		return
+	}
+
+	utils.WriteSuccess(w, advances)
+}
+
+// GetAllAdvances lists every cash advance for admins, optionally in one
+// ?status or of one ?user_id.
+func (h *AdvanceHandler) GetAllAdvances(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Preload("User")
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var advances []models.CashAdvance
+	if err := query.Order("created_at DESC").Find(&advances).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cash advances")
+		return
+	}
+
+	utils.WriteSuccess(w, advances)
+}
+
+// CreateAdvance requests a cash advance, converted into the base currency
+// at today's rate for routing.
+func (h *AdvanceHandler) CreateAdvance(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var req CreateAdvanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if strings.TrimSpace(req.Purpose) == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Purpose is required")
+		return
+	}
+	advanceCurrency := h.BaseCurrency
+	if req.Currency != "" {
+		var err error
+		if advanceCurrency, err = currency.Normalize(req.Currency); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid currency code")
+			return
+		}
+	}
+	amount := req.Amount.RoundTo(advanceCurrency)
+	if amount.Sign() <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Amount must be greater than zero")
+		return
+	}
+
+	cashAdvance := models.CashAdvance{
+		UserID:       user.ID,
+		Purpose:      strings.TrimSpace(req.Purpose),
+		Amount:       amount,
+		Currency:     advanceCurrency,
+		BaseCurrency: h.BaseCurrency,
+		Status:       models.AdvanceRequested,
+	}
+	if req.NeededBy != "" {
+		neededBy, err := time.Parse("2006-01-02", req.NeededBy)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid needed_by date, expected YYYY-MM-DD")
+			return
+		}
+		cashAdvance.NeededBy = &neededBy
+	}
+
+	rate, _, err := h.Engine.Rates.Lookup(advanceCurrency, h.BaseCurrency, time.Now())
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	cashAdvance.ExchangeRate = rate
+	cashAdvance.BaseAmount = amount.MulRate(rate).RoundTo(h.BaseCurrency)
+	if !cashAdvance.BaseAmount.InRange() {
+		utils.WriteError(w, http.StatusBadRequest, "Amount is too large")
+		return
+	}
+
+	if err := h.DB.Create(&cashAdvance).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create cash advance")
+		return
+	}
+
+	utils.WriteSuccess(w, cashAdvance, "Cash advance requested successfully")
+}
+
+// GetAdvance returns a cash advance with its audit trail and settlements
+// to the employee, admins and its approvers.
+func (h *AdvanceHandler) GetAdvance(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	advanceID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cash advance ID")
+		return
+	}
+
+	var cashAdvance models.CashAdvance
+	if err := h.DB.Preload("User").Preload("Approvals.Approver").Preload("Approvals.OnBehalfOf").
+		Preload("Approvals.ApprovalLevel").Preload("Approvals.ReasonCode").Preload("Settlements.Claim").
+		First(&cashAdvance, advanceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.WriteError(w, http.StatusNotFound, "Cash advance not found")
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cash advance")
+		}
+		return
+	}
+
+	if user.Role != models.RoleAdmin && cashAdvance.UserID != user.ID {
+		involved, err := h.Engine.AdvanceInvolved(&cashAdvance, user)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cash advance")
+			return
+		}
+		if !involved {
+			utils.WriteError(w, http.StatusNotFound, "Cash advance not found")
+			return
+		}
+	}
+
+	utils.WriteSuccess(w, cashAdvance)
+}
+
+// GetPendingAdvances lists the cash advances whose current approval step
+// the user can act on, including steps of approvers who have delegated to
+// them.
+func (h *AdvanceHandler) GetPendingAdvances(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	delegators, err := h.Engine.Delegators(user)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve delegations")
+		return
+	}
+
+	var advances []models.CashAdvance
+	if err := h.DB.Preload("User").
+		Where("status IN ? AND user_id <> ?", []models.AdvanceStatus{models.AdvanceRequested, models.AdvanceInReview}, user.ID).
+		Order("created_at ASC").
+		Find(&advances).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cash advances")
+		return
+	}
+
+	pending := []PendingAdvance{}
+	for i := range advances {
+		progress, err := h.Engine.AdvanceProgress(&advances[i])
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to build approval workflow")
+			return
+		}
+		if progress.Current == nil {
+			continue
+		}
+
+		onBehalfOf, ok := h.Engine.ActingFor(progress.Current, user, delegators)
+		if !ok || (onBehalfOf != nil && onBehalfOf.ID == advances[i].UserID) {
+			continue
+		}
+
+		pending = append(pending, PendingAdvance{
+			Advance:    advances[i],
+			Level:      *progress.Current,
+			OnBehalfOf: onBehalfOf,
+		})
+	}
+
+	utils.WriteSuccess(w, pending)
+}
+
+func (h *AdvanceHandler) ApproveAdvance(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ActionApprove, "Cash advance approved successfully")
+}
+
+func (h *AdvanceHandler) RejectAdvance(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ActionReject, "Cash advance rejected successfully")
+}
+
+func (h *AdvanceHandler) CancelAdvance(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ActionCancel, "Cash advance cancelled successfully")
+}
+
+// DisburseAdvance records that an approved advance was paid out, making
+// all of it outstanding.
+func (h *AdvanceHandler) DisburseAdvance(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ActionDisburse, "Cash advance disbursed successfully")
+}
+
+// RepayAdvance records cash the employee paid back against a disbursed
+// advance.
+func (h *AdvanceHandler) RepayAdvance(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	advanceID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cash advance ID")
+		return
+	}
+
+	var req RepayAdvanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var cashAdvance models.CashAdvance
+	var settlement *models.AdvanceSettlement
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Locked like advance.Settle does, so a repayment and a claim
+		// settling the advance at once each see the other's reduction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&cashAdvance, advanceID).Error; err != nil {
+			return err
+		}
+		var err error
+		settlement, err = advance.Repay(tx, &cashAdvance, req.Amount, user, req.Comments)
+		return err
+	})
+	if err == gorm.ErrRecordNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Cash advance not found")
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, settlement, "Repayment recorded successfully")
+}
+
+// GetBalance returns the user's balance in each currency: what they are
+// still owed on approved claims less what is outstanding on their
+// disbursed advances.
+func (h *AdvanceHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	balances, err := advance.Balances(h.DB, user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve balance")
+		return
+	}
+
+	utils.WriteSuccess(w, balances)
+}
+
+// GetBalances returns every employee's balance, or one ?user_id's, as a
+// net amount to reimburse (positive) or to recover (negative).
+func (h *AdvanceHandler) GetBalances(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		var err error
+		if userID, err = strconv.Atoi(value); err != nil || userID <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+	}
+
+	balances, err := advance.Balances(h.DB, uint(userID))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve balances")
+		return
+	}
+
+	utils.WriteSuccess(w, balances)
+}
+
+// transition applies an action to the advance in the URL.
+func (h *AdvanceHandler) transition(w http.ResponseWriter, r *http.Request, action models.ClaimAction, message string) {
+	user := middleware.GetUserFromContext(r.Context())
+	advanceID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cash advance ID")
+		return
+	}
+
+	var cashAdvance models.CashAdvance
+	if err := h.DB.First(&cashAdvance, advanceID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Cash advance not found")
+		return
+	}
+
+	var req AdvanceActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, err := h.Engine.TransitionAdvance(&cashAdvance, action, user, workflow.Note{Comments: req.Comments, ReasonCode: req.ReasonCode}); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, cashAdvance, message)
+}
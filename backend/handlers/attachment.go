@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/storage"
+	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// allowedAttachmentTypes are the file types accepted as receipts, judged
+// from the file's contents rather than the type the client declares.
+var allowedAttachmentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+}
+
+type AttachmentHandler struct {
+	DB            *gorm.DB
+	Engine        *workflow.Engine
+	Store         storage.Store
+	MaxUploadSize int64
+}
+
+func NewAttachmentHandler(db *gorm.DB, store storage.Store, maxUploadSize int64) *AttachmentHandler {
+	return &AttachmentHandler{DB: db, Engine: workflow.NewEngine(db), Store: store, MaxUploadSize: maxUploadSize}
+}
+
+func (h *AttachmentHandler) GetAttachments(w http.ResponseWriter, r *http.Request) {
+	claim, ok := h.viewableClaim(w, r)
+	if !ok {
+		return
+	}
+
+	var attachments []models.Attachment
+	if err := h.DB.Preload("UploadedBy").Where("claim_id = ?", claim.ID).Order("created_at").Find(&attachments).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve attachments")
+		return
+	}
+
+	utils.WriteSuccess(w, attachments)
+}
+
+// UploadAttachment stores the multipart "file" field against the claim,
+// optionally tied to one of its lines with "line_id". Claimants can add
+// files while the claim is a draft or returned to them; admins at any time.
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	claim, ok := h.editableClaim(w, r)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(h.MaxUploadSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the %d MB upload limit", h.MaxUploadSize>>20))
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "A file is required")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > h.MaxUploadSize {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the %d MB upload limit", h.MaxUploadSize>>20))
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	if len(data) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "File is empty")
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedAttachmentTypes[contentType] {
+		utils.WriteError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported file type %s; upload a PDF or an image", contentType))
+		return
+	}
+
+	var lineItemID *uint
+	if raw := r.FormValue("line_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid line ID")
+			return
+		}
+		var line models.ClaimLineItem
+		if err := h.DB.Where("claim_id = ?", claim.ID).First(&line, id).Error; err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Line does not belong to this claim")
+			return
+		}
+		lineItemID = &line.ID
+	}
+
+	key, err := attachmentKey(claim.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := models.Attachment{
+		ClaimID:      claim.ID,
+		LineItemID:   lineItemID,
+		UploadedByID: user.ID,
+		FileName:     attachmentName(header.Filename),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Checksum:     hex.EncodeToString(sum[:]),
+		StorageKey:   key,
+	}
+
+	if err := h.Store.Put(r.Context(), key, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+		log.Printf("attachments: storing claim %d file: %v", claim.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+
+	if err := h.DB.Create(&attachment).Error; err != nil {
+		h.Store.Delete(r.Context(), key)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to save attachment")
+		return
+	}
+
+	utils.WriteSuccess(w, attachment, "Attachment uploaded successfully")
+}
+
+// DownloadAttachment streams a file to the claimant, the claim's approvers
+// and admins.
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	claim, ok := h.viewableClaim(w, r)
+	if !ok {
+		return
+	}
+
+	attachment, ok := h.attachment(w, r, claim)
+	if !ok {
+		return
+	}
+
+	body, err := h.Store.Get(r.Context(), attachment.StorageKey)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			utils.WriteError(w, http.StatusNotFound, "File not found in storage")
+		} else {
+			log.Printf("attachments: reading attachment %d: %v", attachment.ID, err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve file")
+		}
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Checksum-Sha256", attachment.Checksum)
+	w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("attachments: sending attachment %d: %v", attachment.ID, err)
+	}
+}
+
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	claim, ok := h.editableClaim(w, r)
+	if !ok {
+		return
+	}
+
+	attachment, ok := h.attachment(w, r, claim)
+	if !ok {
+		return
+	}
+
+	if err := h.DB.Delete(attachment).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete attachment")
+		return
+	}
+	if err := h.Store.Delete(r.Context(), attachment.StorageKey); err != nil {
+		log.Printf("attachments: removing attachment %d from storage: %v", attachment.ID, err)
+	}
+
+	utils.WriteSuccess(w, nil, "Attachment deleted successfully")
+}
+
+// viewableClaim loads the claim in the URL if the current user may see its
+// files: the claimant, anyone approving it, or an admin.
+func (h *AttachmentHandler) viewableClaim(w http.ResponseWriter, r *http.Request) (*models.Claim, bool) {
+	user := middleware.GetUserFromContext(r.Context())
+	claim, ok := h.claim(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if user.Role == models.RoleAdmin || claim.UserID == user.ID {
+		return claim, true
+	}
+
+	involved, err := h.Engine.Involved(claim, user)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to check access")
+		return nil, false
+	}
+	if !involved {
+		// Don't reveal the claim to users with no part in it
+		utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		return nil, false
+	}
+	return claim, true
+}
+
+// editableClaim loads the claim in the URL if the current user may add or
+// remove its files.
+func (h *AttachmentHandler) editableClaim(w http.ResponseWriter, r *http.Request) (*models.Claim, bool) {
+	user := middleware.GetUserFromContext(r.Context())
+	claim, ok := h.claim(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if user.Role == models.RoleAdmin {
+		return claim, true
+	}
+	if claim.UserID != user.ID {
+		utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		return nil, false
+	}
+	if claim.Status != models.StatusDraft && claim.Status != models.StatusReturned {
+		utils.WriteError(w, http.StatusBadRequest, "Attachments can only be changed on draft or returned claims")
+		return nil, false
+	}
+	return claim, true
+}
+
+func (h *AttachmentHandler) claim(w http.ResponseWriter, r *http.Request) (*models.Claim, bool) {
+	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
+		return nil, false
+	}
+
+	var claim models.Claim
+	if err := h.DB.First(&claim, claimID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim")
+		}
+		return nil, false
+	}
+	return &claim, true
+}
+
+func (h *AttachmentHandler) attachment(w http.ResponseWriter, r *http.Request, claim *models.Claim) (*models.Attachment, bool) {
+	attachmentID, err := strconv.Atoi(chi.URLParam(r, "attachmentId"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return nil, false
+	}
+
+	var attachment models.Attachment
+	if err := h.DB.Where("claim_id = ?", claim.ID).First(&attachment, attachmentID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Attachment not found")
+		return nil, false
+	}
+	return &attachment, true
+}
+
+// attachmentKey picks a fresh storage key under the claim, so uploads never
+// overwrite each other whatever their names.
+func attachmentKey(claimID uint) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("claims/%d/%s", claimID, hex.EncodeToString(random)), nil
+}
+
+// attachmentName keeps the base name of an uploaded file for display.
+func attachmentName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
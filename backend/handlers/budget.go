@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/budget"
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// BudgetHandler manages fiscal periods and the budgets set for them, and
+// reports spend against those budgets.
+type BudgetHandler struct {
+	DB      *gorm.DB
+	Tracker *budget.Tracker
+}
+
+// FiscalPeriodRequest creates or updates a fiscal period.
+type FiscalPeriodRequest struct {
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`   // YYYY-MM-DD, inclusive
+}
+
+// BudgetRequest creates or updates a budget, which belongs to either a
+// user group or a cost center.
+type BudgetRequest struct {
+	FiscalPeriodID uint                     `json:"fiscal_period_id"`
+	UserGroupID    *uint                    `json:"user_group_id"`
+	CostCenterID   *uint                    `json:"cost_center_id"`
+	ClaimTypeID    *uint                    `json:"claim_type_id"` // nil covers all claim types
+	Amount         money.Decimal            `json:"amount"`
+	Enforcement    models.BudgetEnforcement `json:"enforcement"` // defaults to warn
+}
+
+func NewBudgetHandler(db *gorm.DB) *BudgetHandler {
+	return &BudgetHandler{DB: db, Tracker: budget.NewTracker(db)}
+}
+
+func (h *BudgetHandler) GetFiscalPeriods(w http.ResponseWriter, r *http.Request) {
+	var periods []models.FiscalPeriod
+	if err := h.DB.Order("start_date DESC, name").Find(&periods).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve fiscal periods")
+		return
+	}
+
+	utils.WriteSuccess(w, periods)
+}
+
+func (h *BudgetHandler) CreateFiscalPeriod(w http.ResponseWriter, r *http.Request) {
+	var req FiscalPeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var period models.FiscalPeriod
+	if err := h.applyPeriod(&period, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Create(&period).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create fiscal period")
+		return
+	}
+
+	utils.WriteSuccess(w, period, "Fiscal period created successfully")
+}
+
+func (h *BudgetHandler) UpdateFiscalPeriod(w http.ResponseWriter, r *http.Request) {
+	periodID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid fiscal period ID")
+		return
+	}
+
+	var period models.FiscalPeriod
+	if err := h.DB.First(&period, periodID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Fiscal period not found")
+		return
+	}
+
+	var req FiscalPeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.applyPeriod(&period, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Save(&period).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update fiscal period")
+		return
+	}
+
+	utils.WriteSuccess(w, period, "Fiscal period updated successfully")
+}
+
+// DeleteFiscalPeriod removes a period no budgets are set for.
+func (h *BudgetHandler) DeleteFiscalPeriod(w http.ResponseWriter, r *http.Request) {
+	periodID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid fiscal period ID")
+		return
+	}
+
+	var period models.FiscalPeriod
+	if err := h.DB.First(&period, periodID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Fiscal period not found")
+		return
+	}
+
+	var budgets int64
+	h.DB.Model(&models.Budget{}).Where("fiscal_period_id = ?", period.ID).Count(&budgets)
+	if budgets > 0 {
+		utils.WriteError(w, http.StatusConflict, "Fiscal period has budgets; delete them first")
+		return
+	}
+
+	var exports int64
+	h.DB.Model(&models.JournalExport{}).Where("fiscal_period_id = ?", period.ID).Count(&exports)
+	if exports > 0 {
+		utils.WriteError(w, http.StatusConflict, "Fiscal period has journal exports and can't be deleted")
+		return
+	}
+
+	// Removed outright so the name can be reused
+	if err := h.DB.Unscoped().Delete(&period).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete fiscal period")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Fiscal period deleted successfully")
+}
+
+// GetBudgets lists budgets, optionally for one fiscal period, user group
+// or cost center.
+func (h *BudgetHandler) GetBudgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := h.findBudgets(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, budgets)
+}
+
+// GetBudgetActuals reports budgets against their committed, approved and
+// paid spend, with the same filters as GetBudgets.
+func (h *BudgetHandler) GetBudgetActuals(w http.ResponseWriter, r *http.Request) {
+	budgets, err := h.findBudgets(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	actuals, err := h.Tracker.Actuals(budgets)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve budget actuals")
+		return
+	}
+
+	utils.WriteSuccess(w, actuals)
+}
+
+func (h *BudgetHandler) CreateBudget(w http.ResponseWriter, r *http.Request) {
+	var req BudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var b models.Budget
+	if status, err := h.applyBudget(&b, &req); err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	if err := h.DB.Create(&b).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create budget")
+		return
+	}
+
+	h.DB.Preload("FiscalPeriod").Preload("UserGroup").Preload("CostCenter").Preload("ClaimType").First(&b, b.ID)
+	utils.WriteSuccess(w, b, "Budget created successfully")
+}
+
+func (h *BudgetHandler) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	budgetID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid budget ID")
+		return
+	}
+
+	var b models.Budget
+	if err := h.DB.First(&b, budgetID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Budget not found")
+		return
+	}
+
+	var req BudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if status, err := h.applyBudget(&b, &req); err != nil {
+		utils.WriteError(w, status, err.Error())
+		return
+	}
+
+	if err := h.DB.Save(&b).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update budget")
+		return
+	}
+
+	h.DB.Preload("FiscalPeriod").Preload("UserGroup").Preload("CostCenter").Preload("ClaimType").First(&b, b.ID)
+	utils.WriteSuccess(w, b, "Budget updated successfully")
+}
+
+func (h *BudgetHandler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	budgetID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid budget ID")
+		return
+	}
+
+	if err := h.DB.Delete(&models.Budget{}, budgetID).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete budget")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Budget deleted successfully")
+}
+
+// findBudgets loads the budgets matching the request's fiscal_period_id,
+// user_group_id and cost_center_id filters.
+func (h *BudgetHandler) findBudgets(r *http.Request) ([]models.Budget, error) {
+	query := h.DB.Preload("FiscalPeriod").Preload("UserGroup").Preload("CostCenter").Preload("ClaimType")
+	for _, column := range []string{"fiscal_period_id", "user_group_id", "cost_center_id"} {
+		value := r.URL.Query().Get(column)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s", column)
+		}
+		query = query.Where(column+" = ?", id)
+	}
+
+	var budgets []models.Budget
+	if err := query.Order("fiscal_period_id DESC, id").Find(&budgets).Error; err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+// applyPeriod validates a fiscal period request onto period.
+func (h *BudgetHandler) applyPeriod(period *models.FiscalPeriod, req *FiscalPeriodRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return errors.New("Name is required")
+	}
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return errors.New("Invalid start date, expected YYYY-MM-DD")
+	}
+	end, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		return errors.New("Invalid end date, expected YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return errors.New("End date must not be before the start date")
+	}
+
+	var clashes int64
+	h.DB.Model(&models.FiscalPeriod{}).Where("name = ? AND id <> ?", name, period.ID).Count(&clashes)
+	if clashes > 0 {
+		return fmt.Errorf("Fiscal period %s already exists", name)
+	}
+
+	period.Name = name
+	period.StartDate = start
+	period.EndDate = end
+	return nil
+}
+
+// applyBudget validates a budget request onto b, returning the status to
+// answer with when it is refused.
+func (h *BudgetHandler) applyBudget(b *models.Budget, req *BudgetRequest) (int, error) {
+	if (req.UserGroupID == nil) == (req.CostCenterID == nil) {
+		return http.StatusBadRequest, errors.New("Set either a user group or a cost center")
+	}
+	if req.Amount.Sign() <= 0 {
+		return http.StatusBadRequest, errors.New("Amount must be greater than zero")
+	}
+	if req.Enforcement == "" {
+		req.Enforcement = models.EnforceWarn
+	}
+	switch req.Enforcement {
+	case models.EnforceNone, models.EnforceWarn, models.EnforceBlock:
+	default:
+		return http.StatusBadRequest, errors.New("Enforcement must be none, warn or block")
+	}
+
+	if err := h.DB.First(&models.FiscalPeriod{}, req.FiscalPeriodID).Error; err != nil {
+		return http.StatusBadRequest, errors.New("Invalid fiscal period")
+	}
+	if req.UserGroupID != nil {
+		if err := h.DB.First(&models.UserGroup{}, *req.UserGroupID).Error; err != nil {
+			return http.StatusBadRequest, errors.New("Invalid user group")
+		}
+	}
+	if req.CostCenterID != nil {
+		if err := h.DB.First(&models.CostCenter{}, *req.CostCenterID).Error; err != nil {
+			return http.StatusBadRequest, errors.New("Invalid cost center")
+		}
+	}
+	if req.ClaimTypeID != nil {
+		if err := h.DB.First(&models.ClaimType{}, *req.ClaimTypeID).Error; err != nil {
+			return http.StatusBadRequest, errors.New("Invalid claim type")
+		}
+	}
+
+	// One budget per owner and claim type in a period
+	clashes := h.DB.Model(&models.Budget{}).Where("fiscal_period_id = ? AND id <> ?", req.FiscalPeriodID, b.ID)
+	for column, id := range map[string]*uint{"user_group_id": req.UserGroupID, "cost_center_id": req.CostCenterID, "claim_type_id": req.ClaimTypeID} {
+		if id == nil {
+			clashes = clashes.Where(column + " IS NULL")
+		} else {
+			clashes = clashes.Where(column+" = ?", *id)
+		}
+	}
+	var count int64
+	clashes.Count(&count)
+	if count > 0 {
+		return http.StatusConflict, errors.New("A budget is already set for this owner and claim type in the fiscal period")
+	}
+
+	b.FiscalPeriodID = req.FiscalPeriodID
+	b.UserGroupID = req.UserGroupID
+	b.CostCenterID = req.CostCenterID
+	b.ClaimTypeID = req.ClaimTypeID
+	b.Amount = req.Amount
+	b.Enforcement = req.Enforcement
+	return 0, nil
+}
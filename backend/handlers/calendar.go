@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/calendar"
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type CalendarHandler struct {
+	DB *gorm.DB
+}
+
+// CalendarRequest defines a business calendar for a user group or an office
+// location; leave both empty for the company default.
+type CalendarRequest struct {
+	Name        string   `json:"name"`
+	UserGroupID *uint    `json:"userGroupId"`
+	Location    string   `json:"location"`
+	Weekend     []string `json:"weekend"`
+}
+
+type HolidayRequest struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+func NewCalendarHandler(db *gorm.DB) *CalendarHandler {
+	return &CalendarHandler{DB: db}
+}
+
+func (h *CalendarHandler) GetCalendars(w http.ResponseWriter, r *http.Request) {
+	var calendars []models.BusinessCalendar
+	if err := h.DB.Preload("UserGroup").Preload("Holidays", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date")
+	}).Order("id").Find(&calendars).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve calendars")
+		return
+	}
+
+	utils.WriteSuccess(w, calendars)
+}
+
+func (h *CalendarHandler) CreateCalendar(w http.ResponseWriter, r *http.Request) {
+	var req CalendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var cal models.BusinessCalendar
+	if err := h.apply(&cal, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Create(&cal).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create calendar")
+		return
+	}
+
+	utils.WriteSuccess(w, cal, "Calendar created successfully")
+}
+
+func (h *CalendarHandler) UpdateCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid calendar ID")
+		return
+	}
+
+	var cal models.BusinessCalendar
+	if err := h.DB.First(&cal, calendarID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Calendar not found")
+		return
+	}
+
+	var req CalendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.apply(&cal, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Omit("UserGroup", "Holidays").Save(&cal).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update calendar")
+		return
+	}
+
+	utils.WriteSuccess(w, cal, "Calendar updated successfully")
+}
+
+func (h *CalendarHandler) DeleteCalendar(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid calendar ID")
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("calendar_id = ?", calendarID).Delete(&models.Holiday{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.BusinessCalendar{}, calendarID).Error
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete calendar")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Calendar deleted successfully")
+}
+
+func (h *CalendarHandler) CreateHoliday(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid calendar ID")
+		return
+	}
+
+	var cal models.BusinessCalendar
+	if err := h.DB.First(&cal, calendarID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Calendar not found")
+		return
+	}
+
+	var req HolidayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Holiday name is required")
+		return
+	}
+
+	var existing int64
+	h.DB.Model(&models.Holiday{}).Where("calendar_id = ? AND date = ?", cal.ID, date).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, "A holiday already exists on this date")
+		return
+	}
+
+	holiday := models.Holiday{
+		CalendarID: cal.ID,
+		Date:       date,
+		Name:       strings.TrimSpace(req.Name),
+	}
+
+	if err := h.DB.Create(&holiday).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create holiday")
+		return
+	}
+
+	utils.WriteSuccess(w, holiday, "Holiday created successfully")
+}
+
+func (h *CalendarHandler) DeleteHoliday(w http.ResponseWriter, r *http.Request) {
+	calendarID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid calendar ID")
+		return
+	}
+	holidayID, err := strconv.Atoi(chi.URLParam(r, "holidayId"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid holiday ID")
+		return
+	}
+
+	result := h.DB.Where("calendar_id = ?", calendarID).Delete(&models.Holiday{}, holidayID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete holiday")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Holiday not found")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Holiday deleted successfully")
+}
+
+// maxBusinessDaysSpan bounds the days and date ranges GetBusinessDays
+// answers for, about ten years.
+const maxBusinessDaysSpan = 3660
+
+// GetBusinessDays answers business-day questions against the calendar that
+// applies to a group: the business days between from and to, or the date
+// a number of business days after from.
+func (h *CalendarHandler) GetBusinessDays(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var groupID *uint
+	if raw := query.Get("groupId"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid group ID")
+			return
+		}
+		groupID = optionalID(uint(id))
+	}
+
+	from, err := time.Parse("2006-01-02", query.Get("from"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+		return
+	}
+
+	cal, err := calendar.NewService(h.DB).ForGroup(groupID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to load calendar")
+		return
+	}
+
+	result := map[string]interface{}{"from": from.Format("2006-01-02")}
+	if raw := query.Get("days"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid number of days")
+			return
+		}
+		if days > maxBusinessDaysSpan || days < -maxBusinessDaysSpan {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Number of days must be between -%d and %d", maxBusinessDaysSpan, maxBusinessDaysSpan))
+			return
+		}
+		result["days"] = days
+		result["date"] = cal.AddBusinessDays(from, days).Format("2006-01-02")
+	} else {
+		to, err := time.Parse("2006-01-02", query.Get("to"))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+		if span := to.Sub(from); span > maxBusinessDaysSpan*24*time.Hour || span < -maxBusinessDaysSpan*24*time.Hour {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("from and to must be at most %d days apart", maxBusinessDaysSpan))
+			return
+		}
+		result["to"] = to.Format("2006-01-02")
+		result["businessDays"] = cal.BusinessDaysBetween(from, to)
+	}
+
+	utils.WriteSuccess(w, result)
+}
+
+// apply validates a calendar request onto the stored calendar.
+func (h *CalendarHandler) apply(cal *models.BusinessCalendar, req *CalendarRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("Calendar name is required")
+	}
+
+	weekend := calendar.DefaultWeekend
+	if req.Weekend != nil {
+		weekend = strings.Join(req.Weekend, ",")
+	}
+	days, err := calendar.ParseWeekend(weekend)
+	if err != nil {
+		return err
+	}
+
+	if req.UserGroupID != nil {
+		var group models.UserGroup
+		if err := h.DB.First(&group, *req.UserGroupID).Error; err != nil {
+			return fmt.Errorf("Invalid user group")
+		}
+	}
+
+	// One calendar per group, location or company default
+	query := h.DB.Model(&models.BusinessCalendar{}).Where("id <> ?", cal.ID)
+	if req.UserGroupID != nil {
+		query = query.Where("user_group_id = ?", *req.UserGroupID)
+	} else {
+		query = query.Where("user_group_id IS NULL AND LOWER(location) = LOWER(?)", strings.TrimSpace(req.Location))
+	}
+	var clashes int64
+	query.Count(&clashes)
+	if clashes > 0 {
+		return fmt.Errorf("A calendar already exists for this group or location")
+	}
+
+	cal.Name = strings.TrimSpace(req.Name)
+	cal.UserGroupID = req.UserGroupID
+	cal.Location = strings.TrimSpace(req.Location)
+	cal.Weekend = calendar.FormatWeekend(days)
+	return nil
+}
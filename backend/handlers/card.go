@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/card"
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxStatementSize is large enough for a year of card statements.
+const maxStatementSize = 16 << 20
+
+// defaultUnreconciledDays is how old an unreconciled card transaction must
+// be to be listed when no age is given.
+const defaultUnreconciledDays = 30
+
+// CardHandler imports corporate card statements and lets cardholders
+// reconcile the transactions with their claims.
+type CardHandler struct {
+	DB      *gorm.DB
+	Matcher *card.Matcher
+	// BaseCurrency is what statements without a currency are in
+	BaseCurrency string
+}
+
+// AttachCardTransactionRequest attaches a card transaction to a claim
+// that isn't itemized, or to a line of an itemized one.
+type AttachCardTransactionRequest struct {
+	ClaimID    uint  `json:"claim_id"`
+	LineItemID *uint `json:"line_item_id"`
+}
+
+type CardImportResult struct {
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"` // already imported
+	Matched  int    `json:"matched"`
+	Format   string `json:"format"`
+}
+
+func NewCardHandler(db *gorm.DB, baseCurrency string) *CardHandler {
+	return &CardHandler{DB: db, Matcher: card.NewMatcher(db), BaseCurrency: baseCurrency}
+}
+
+// GetCardTransactions lists the user's card transactions, newest first,
+// optionally only the reconciled or unreconciled ones.
+func (h *CardHandler) GetCardTransactions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	query := h.DB.Where("user_id = ?", user.ID)
+	switch r.URL.Query().Get("status") {
+	case "":
+	case "unreconciled":
+		query = query.Where("claim_id IS NULL")
+	case "reconciled":
+		query = query.Where("claim_id IS NOT NULL")
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Status must be reconciled or unreconciled")
+		return
+	}
+
+	var transactions []models.CardTransaction
+	if err := query.Order("date DESC, id DESC").Find(&transactions).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve card transactions")
+		return
+	}
+
+	utils.WriteSuccess(w, transactions)
+}
+
+// MatchCardTransactions attaches the user's unreconciled card transactions
+// to the expenses on their draft and returned claims they clearly match.
+func (h *CardHandler) MatchCardTransactions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	matched, err := h.Matcher.Match(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to match card transactions")
+		return
+	}
+
+	utils.WriteSuccess(w, matched, fmt.Sprintf("Matched %d card transactions", len(matched)))
+}
+
+func (h *CardHandler) AttachCardTransaction(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	transaction, ok := h.ownTransaction(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req AttachCardTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var claim models.Claim
+	if err := h.DB.Preload("Lines").Where("user_id = ? AND id = ?", user.ID, req.ClaimID).First(&claim).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		return
+	}
+	var line *models.ClaimLineItem
+	if req.LineItemID != nil {
+		for i := range claim.Lines {
+			if claim.Lines[i].ID == *req.LineItemID {
+				line = &claim.Lines[i]
+			}
+		}
+		if line == nil {
+			utils.WriteError(w, http.StatusNotFound, "Claim line not found")
+			return
+		}
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return card.Attach(tx, transaction, &claim, line, models.CardMatchManual)
+	})
+	switch {
+	case errors.Is(err, card.ErrAttached):
+		utils.WriteError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, transaction, "Card transaction attached successfully")
+}
+
+func (h *CardHandler) DetachCardTransaction(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	transaction, ok := h.ownTransaction(w, r, user)
+	if !ok {
+		return
+	}
+	if transaction.ClaimID == nil {
+		utils.WriteError(w, http.StatusBadRequest, "Card transaction isn't attached to a claim")
+		return
+	}
+
+	var claim models.Claim
+	if err := h.DB.Preload("Lines").First(&claim, *transaction.ClaimID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		return
+	}
+
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		return card.Detach(tx, transaction, &claim)
+	}); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.WriteSuccess(w, transaction, "Card transaction detached successfully")
+}
+
+// ImportCardStatement loads a CSV or OFX card statement, uploaded in the
+// file field of a form or sent as the request body, then matches the new
+// transactions to their cardholders' claims. The format is detected from
+// the contents unless given as ?format=csv or ?format=ofx. Transactions
+// belong to ?user_id, or in CSV files to the user named in an email column;
+// CSV rows without a currency are in ?currency, which defaults to the base
+// currency.
+func (h *CardHandler) ImportCardStatement(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxStatementSize)
+
+	var holder *models.User
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		var user models.User
+		if err := h.DB.First(&user, value).Error; err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid user")
+			return
+		}
+		holder = &user
+	}
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				utils.WriteError(w, http.StatusRequestEntityTooLarge, "Statement file is too large")
+				return
+			}
+			utils.WriteError(w, http.StatusBadRequest, "A statement file is required in the file field")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	reader := bufio.NewReader(body)
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+		if start, _ := reader.Peek(512); strings.Contains(strings.ToUpper(string(start)), "OFX") {
+			format = "ofx"
+		}
+	}
+
+	var entries []card.Entry
+	var err error
+	switch format {
+	case "csv":
+		curr := r.URL.Query().Get("currency")
+		if curr == "" {
+			curr = h.BaseCurrency
+		}
+		entries, err = card.ParseCSV(reader, curr)
+	case "ofx":
+		entries, err = card.ParseOFX(reader)
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Format must be csv or ofx")
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, "Statement file is too large")
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid statement file: %v", err))
+		return
+	}
+	if len(entries) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "The statement holds no transactions")
+		return
+	}
+
+	transactions, err := h.assign(entries, holder)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result := CardImportResult{Format: format}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		// Transactions imported before are left as they are
+		created := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "external_id"}},
+			DoNothing: true,
+		}).Create(&transactions)
+		result.Imported = int(created.RowsAffected)
+		return created.Error
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to import card statement")
+		return
+	}
+	result.Skipped = len(transactions) - result.Imported
+
+	holders := map[uint]bool{}
+	for _, transaction := range transactions {
+		if !holders[transaction.UserID] {
+			holders[transaction.UserID] = true
+			matched, err := h.Matcher.Match(transaction.UserID)
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, "Imported the card statement but failed to match its transactions")
+				return
+			}
+			result.Matched += len(matched)
+		}
+	}
+
+	utils.WriteSuccess(w, result, fmt.Sprintf("Imported %d card transactions", result.Imported))
+}
+
+// GetUnreconciledCardTransactions lists the card transactions not yet
+// attached to a claim that are at least ?days old (30 by default), oldest
+// first, optionally for one ?user_id.
+func (h *CardHandler) GetUnreconciledCardTransactions(w http.ResponseWriter, r *http.Request) {
+	days := defaultUnreconciledDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid days")
+			return
+		}
+		days = parsed
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	query := h.DB.Preload("User").Where("claim_id IS NULL AND date <= ?", cutoff.Format("2006-01-02"))
+	if value := r.URL.Query().Get("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var transactions []models.CardTransaction
+	if err := query.Order("date, id").Find(&transactions).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve card transactions")
+		return
+	}
+
+	utils.WriteSuccess(w, transactions)
+}
+
+// DeleteCardTransaction removes an imported transaction that isn't
+// attached to a claim, e.g. one imported for the wrong cardholder.
+func (h *CardHandler) DeleteCardTransaction(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid card transaction ID")
+		return
+	}
+
+	var transaction models.CardTransaction
+	if err := h.DB.First(&transaction, transactionID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Card transaction not found")
+		return
+	}
+	if transaction.ClaimID != nil {
+		utils.WriteError(w, http.StatusConflict, "Card transaction is attached to a claim; detach it first")
+		return
+	}
+
+	// Removed outright so the statement can be imported again
+	if err := h.DB.Unscoped().Delete(&transaction).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete card transaction")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Card transaction deleted successfully")
+}
+
+// assign gives each statement entry its cardholder: the user named by its
+// email, or else holder.
+func (h *CardHandler) assign(entries []card.Entry, holder *models.User) ([]models.CardTransaction, error) {
+	emails := []string{}
+	for _, entry := range entries {
+		if entry.Email != "" {
+			emails = append(emails, entry.Email)
+		}
+	}
+	users := map[string]uint{}
+	if len(emails) > 0 {
+		var found []models.User
+		if err := h.DB.Where("LOWER(email) IN ?", emails).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range found {
+			users[strings.ToLower(user.Email)] = user.ID
+		}
+	}
+
+	transactions := make([]models.CardTransaction, 0, len(entries))
+	for i, entry := range entries {
+		transaction := entry.Transaction
+		switch {
+		case entry.Email != "":
+			userID, ok := users[entry.Email]
+			if !ok {
+				return nil, fmt.Errorf("Transaction %d: no user with email %s", i+1, entry.Email)
+			}
+			transaction.UserID = userID
+		case holder != nil:
+			transaction.UserID = holder.ID
+		default:
+			return nil, fmt.Errorf("Transaction %d: no cardholder; give a user_id or an email column", i+1)
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+// ownTransaction loads the card transaction in the URL, which must be the
+// user's.
+func (h *CardHandler) ownTransaction(w http.ResponseWriter, r *http.Request, user *models.User) (*models.CardTransaction, bool) {
+	transactionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid card transaction ID")
+		return nil, false
+	}
+
+	var transaction models.CardTransaction
+	if err := h.DB.Where("user_id = ? AND id = ?", user.ID, transactionID).First(&transaction).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Card transaction not found")
+		return nil, false
+	}
+	return &transaction, true
+}
@@ -2,47 +2,142 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
-
+	"strings"
+	"time"
+
+	"hrcs/backend/advance"
+	"hrcs/backend/calculator"
+	"hrcs/backend/card"
+	"hrcs/backend/currency"
+	"hrcs/backend/duplicate"
 	"hrcs/backend/middleware"
 	"hrcs/backend/models"
+	"hrcs/backend/money"
 	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
 
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ClaimHandler struct {
-	DB *gorm.DB
+	DB         *gorm.DB
+	Engine     *workflow.Engine
+	Calculator *calculator.Calculator
+	// BaseCurrency is the company currency claims are converted into
+	BaseCurrency string
 }
 
 type CreateClaimRequest struct {
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Amount      money.Decimal `json:"amount"`
+	// Currency defaults to the base currency
+	Currency    string  `json:"currency"`
 	ClaimTypeID uint    `json:"claim_type_id"`
+	// Calculation replaces Amount for mileage and per-diem claim types
+	Calculation *models.CalculationInput `json:"calculation"`
+	// ExpenseDate (YYYY-MM-DD) is required unless the claim is itemized;
+	// a per diem defaults to the trip's first day
+	ExpenseDate string `json:"expense_date"`
+	// Lines itemize the claim; when given, Amount is their total
+	Lines []ClaimLineRequest `json:"lines"`
+	// Allocations charge the claim to cost centers and projects
+	Allocations []AllocationRequest `json:"allocations"`
+	// AdvanceID files the claim against one of the claimant's cash
+	// advances, which it settles when approved
+	AdvanceID *uint `json:"advance_id"`
 }
 
 type UpdateClaimRequest struct {
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
-	Amount      float64 `json:"amount"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Amount      money.Decimal `json:"amount"`
+	// Currency is kept when omitted
+	Currency    string  `json:"currency"`
 	ClaimTypeID uint    `json:"claim_type_id"`
+	// Calculation replaces Amount for mileage and per-diem claim types;
+	// omit it to recalculate from the stored inputs
+	Calculation *models.CalculationInput `json:"calculation"`
+	// ExpenseDate is kept when omitted
+	ExpenseDate string `json:"expense_date"`
+	// Lines replaces the claim's lines when present; omit it to keep them.
+	// Lines left out are removed
+	Lines []ClaimLineRequest `json:"lines"`
+	// Allocations replaces the claim's allocations when present; omit it
+	// to keep them
+	Allocations []AllocationRequest `json:"allocations"`
+	// AdvanceID is the cash advance the claim settles; omit it to file the
+	// claim against none
+	AdvanceID *uint `json:"advance_id"`
+}
+
+type ClaimLineRequest struct {
+	// ID updates one of the claim's lines in place, keeping its
+	// attachments and card transactions; omit it to add a line
+	ID          uint          `json:"id"`
+	Date        string        `json:"date"`
+	ClaimTypeID uint          `json:"claim_type_id"`
+	Amount      money.Decimal `json:"amount"`
+	// Currency defaults to the claim's
+	Currency    string  `json:"currency"`
+	Merchant    string  `json:"merchant"`
+	Description string  `json:"description"`
+	ReceiptURL  string  `json:"receipt_url"`
+	// Calculation replaces Amount for mileage and per-diem claim types
+	Calculation *models.CalculationInput `json:"calculation"`
+	// Attributes are free-form details such as {"city": "London",
+	// "nights": "2"} that policy rules can check
+	Attributes map[string]string `json:"attributes"`
+	// Allocations charge the line elsewhere than the claim
+	Allocations []AllocationRequest `json:"allocations"`
+}
+
+// AllocationRequest charges a percentage of a claim or line to a cost
+// center and optionally a project. A single allocation may leave out the
+// percentage to take all of it.
+type AllocationRequest struct {
+	CostCenterID uint          `json:"cost_center_id"`
+	ProjectID    *uint         `json:"project_id"`
+	Percent      money.Decimal `json:"percent"`
+}
+
+// CalculateRequest previews the amount of a mileage or per-diem expense.
+type CalculateRequest struct {
+	ClaimTypeID uint `json:"claim_type_id"`
+	// Date is the day of the expense, YYYY-MM-DD; it defaults to today
+	Date        string                  `json:"date"`
+	Calculation models.CalculationInput `json:"calculation"`
+}
+
+// SubmitClaimRequest is optional; it explains the policy exceptions that
+// need a justification, keyed by policy rule ID.
+type SubmitClaimRequest struct {
+	Justifications map[uint]string `json:"justifications"`
 }
 
 type ApproveClaimRequest struct {
 	Status   models.ClaimStatus `json:"status"`
 	Comments string             `json:"comments"`
+	// ReasonCode is required when rejecting or returning
+	ReasonCode string `json:"reason_code"`
 }
 
-func NewClaimHandler(db *gorm.DB) *ClaimHandler {
-	return &ClaimHandler{DB: db}
+func NewClaimHandler(db *gorm.DB, baseCurrency string, duplicateWindowDays int, blockExactDuplicates bool) *ClaimHandler {
+	engine := workflow.NewEngine(db)
+	engine.Duplicates = duplicate.NewDetector(db, duplicateWindowDays, blockExactDuplicates)
+	return &ClaimHandler{DB: db, Engine: engine, Calculator: calculator.NewCalculator(db), BaseCurrency: baseCurrency}
 }
 
 func (h *ClaimHandler) GetClaimTypes(w http.ResponseWriter, r *http.Request) {
 	var claimTypes []models.ClaimType
-	if err := h.DB.Find(&claimTypes).Error; err != nil {
+	if err := h.DB.Where("active = ?", true).Find(&claimTypes).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim types")
 		return
 	}
@@ -50,6 +145,39 @@ func (h *ClaimHandler) GetClaimTypes(w http.ResponseWriter, r *http.Request) {
 	utils.WriteSuccess(w, claimTypes)
 }
 
+// CalculateAmount previews what a mileage or per-diem expense comes to,
+// without saving anything.
+func (h *ClaimHandler) CalculateAmount(w http.ResponseWriter, r *http.Request) {
+	var req CalculateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var claimType models.ClaimType
+	if err := h.DB.First(&claimType, req.ClaimTypeID).Error; err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid claim type")
+		return
+	}
+	on := time.Now()
+	if req.Date != "" {
+		date, err := time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		on = date
+	}
+
+	calculation, err := h.calculate(&claimType, &req.Calculation, on)
+	if err != nil {
+		writeClaimInputError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, calculation)
+}
+
 func (h *ClaimHandler) CreateClaim(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUserFromContext(r.Context())
 	
@@ -59,21 +187,89 @@ func (h *ClaimHandler) CreateClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	lines, err := h.buildLines(req.Lines, user)
+	if err != nil {
+		writeClaimInputError(w, err)
+		return
+	}
+	allocations, err := h.allocate(req.Allocations, user)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	date, err := expenseDate(req.ExpenseDate, req.Calculation)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	claimCurrency := h.BaseCurrency
+	if req.Currency != "" {
+		if claimCurrency, err = currency.Normalize(req.Currency); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid currency code")
+			return
+		}
+	}
+
 	claim := models.Claim{
-		Title:       req.Title,
-		Description: req.Description,
-		Amount:      req.Amount,
-		UserID:      user.ID,
-		ClaimTypeID: req.ClaimTypeID,
-		Status:      models.StatusDraft,
+		Title:        req.Title,
+		Description:  req.Description,
+		Amount:       req.Amount,
+		Currency:     claimCurrency,
+		BaseCurrency: h.BaseCurrency,
+		UserID:       user.ID,
+		ClaimTypeID:  req.ClaimTypeID,
+		ExpenseDate:  date,
+		Status:       models.StatusDraft,
+		Lines:        lines,
+		Allocations:  allocations,
+	}
+	if err := h.calculateClaim(&claim, req.Calculation, nil, req.Currency != ""); err != nil {
+		writeClaimInputError(w, err)
+		return
+	}
+	if err := h.linkAdvance(&claim, req.AdvanceID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Drafts follow the latest exchange rates; submitting fixes them
+	if err := h.Engine.Rates.Price(&claim, time.Now()); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	itemize(&claim)
+
+	if err := h.DB.First(&claim.ClaimType, claim.ClaimTypeID).Error; err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid claim type")
+		return
+	}
+	if err := workflow.CheckClaimTypes(&claim, false, time.Now()); err != nil {
+		writeWorkflowError(w, err)
+		return
 	}
 
-	if err := h.DB.Create(&claim).Error; err != nil {
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&claim).Error; err != nil {
+			return err
+		}
+		if len(claim.Lines) > 0 {
+			for i := range claim.Lines {
+				claim.Lines[i].ClaimID = claim.ID
+			}
+			if err := tx.Omit(clause.Associations).Create(&claim.Lines).Error; err != nil {
+				return err
+			}
+		}
+		return saveAllocations(tx, &claim)
+	})
+	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to create claim")
 		return
 	}
 
-	if err := h.DB.Preload("User").Preload("ClaimType").First(&claim, claim.ID).Error; err != nil {
+	if err := preloadAllocations(h.DB.Preload("User").Preload("ClaimType").Preload("Lines.ClaimType")).First(&claim, claim.ID).Error; err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim")
 		return
 	}
@@ -85,7 +281,7 @@ func (h *ClaimHandler) GetClaims(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUserFromContext(r.Context())
 	
 	var claims []models.Claim
-	query := h.DB.Preload("User").Preload("ClaimType").Preload("Approvals")
+	query := h.DB.Preload("User").Preload("ClaimType").Preload("Lines").Preload("Approvals")
 
 	if user.Role == models.RoleAdmin {
 		query = query.Find(&claims)
@@ -110,15 +306,9 @@ func (h *ClaimHandler) GetClaim(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var claim models.Claim
-	query := h.DB.Preload("User").Preload("ClaimType").Preload("Approvals.Approver").Preload("Approvals.ApprovalLevel")
-
-	if user.Role == models.RoleAdmin {
-		query = query.First(&claim, claimID)
-	} else {
-		query = query.Where("user_id = ?", user.ID).First(&claim, claimID)
-	}
+	query := preloadAllocations(h.DB.Preload("User").Preload("ClaimType").Preload("Lines.ClaimType")).Preload("Attachments").Preload("Violations").Preload("Duplicates.MatchedClaim").Preload("CardTransactions").Preload("Advance").Preload("Approvals.Approver").Preload("Approvals.ApprovalLevel")
 
-	if err := query.Error; err != nil {
+	if err := query.First(&claim, claimID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.WriteError(w, http.StatusNotFound, "Claim not found")
 		} else {
@@ -127,6 +317,20 @@ func (h *ClaimHandler) GetClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Besides the claimant and admins, the claim's approvers can see it so
+	// they can review it, policy violations included
+	if user.Role != models.RoleAdmin && claim.UserID != user.ID {
+		involved, err := h.Engine.Involved(&claim, user)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim")
+			return
+		}
+		if !involved {
+			utils.WriteError(w, http.StatusNotFound, "Claim not found")
+			return
+		}
+	}
+
 	utils.WriteSuccess(w, claim)
 }
 
@@ -144,8 +348,9 @@ func (h *ClaimHandler) UpdateClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if claim.Status != models.StatusDraft {
-		utils.WriteError(w, http.StatusBadRequest, "Can only update draft claims")
+	// Returned claims are reopened for the claimant to fix
+	if claim.Status != models.StatusDraft && claim.Status != models.StatusReturned {
+		utils.WriteError(w, http.StatusBadRequest, "Can only update draft or returned claims")
 		return
 	}
 
@@ -159,8 +364,104 @@ func (h *ClaimHandler) UpdateClaim(w http.ResponseWriter, r *http.Request) {
 	claim.Description = req.Description
 	claim.Amount = req.Amount
 	claim.ClaimTypeID = req.ClaimTypeID
+	if req.Currency != "" {
+		if claim.Currency, err = currency.Normalize(req.Currency); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid currency code")
+			return
+		}
+	}
+	claim.BaseCurrency = h.BaseCurrency
+	date, err := expenseDate(req.ExpenseDate, req.Calculation)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if date != nil {
+		claim.ExpenseDate = date
+	}
 
-	if err := h.DB.Save(&claim).Error; err != nil {
+	if req.Lines != nil {
+		if claim.Lines, err = h.buildLines(req.Lines, user); err != nil {
+			writeClaimInputError(w, err)
+			return
+		}
+		var stored []models.ClaimLineItem
+		if err := h.DB.Where("claim_id = ?", claim.ID).Find(&stored).Error; err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim lines")
+			return
+		}
+		if err := keepLines(&claim, req.Lines, stored); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if err := h.DB.Preload("ClaimType").Preload("Allocations").Where("claim_id = ?", claim.ID).Find(&claim.Lines).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim lines")
+		return
+	}
+	if req.Allocations != nil {
+		if claim.Allocations, err = h.allocate(req.Allocations, user); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if err := h.DB.Where("claim_id = ? AND line_item_id IS NULL", claim.ID).Find(&claim.Allocations).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claim allocations")
+		return
+	}
+	if err := h.calculateClaim(&claim, req.Calculation, claim.Calculation, req.Currency != ""); err != nil {
+		writeClaimInputError(w, err)
+		return
+	}
+	if err := h.linkAdvance(&claim, req.AdvanceID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Card transactions follow the lines once a claim is itemized
+	if len(claim.Lines) > 0 {
+		claim.PaidByCard = false
+	}
+
+	if err := h.Engine.Rates.Price(&claim, time.Now()); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+	itemize(&claim)
+
+	if err := h.DB.First(&claim.ClaimType, claim.ClaimTypeID).Error; err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid claim type")
+		return
+	}
+	if err := workflow.CheckClaimTypes(&claim, false, time.Now()); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&claim).Error; err != nil {
+			return err
+		}
+		if len(claim.Lines) > 0 {
+			if err := card.Release(tx, "claim_id = ? AND line_item_id IS NULL", claim.ID); err != nil {
+				return err
+			}
+		}
+		if req.Lines == nil {
+			if err := currency.SaveLines(tx, claim.Lines); err != nil {
+				return err
+			}
+			return saveAllocations(tx, &claim)
+		}
+		if err := removeLines(tx, &claim); err != nil {
+			return err
+		}
+		for i := range claim.Lines {
+			claim.Lines[i].ClaimID = claim.ID
+			if err := tx.Omit(clause.Associations).Save(&claim.Lines[i]).Error; err != nil {
+				return err
+			}
+		}
+		return saveAllocations(tx, &claim)
+	})
+	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, "Failed to update claim")
 		return
 	}
@@ -182,21 +483,21 @@ func (h *ClaimHandler) SubmitClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if claim.Status != models.StatusDraft {
-		utils.WriteError(w, http.StatusBadRequest, "Can only submit draft claims")
+	var req SubmitClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	claim.Status = models.StatusSubmitted
-	if err := h.DB.Save(&claim).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to submit claim")
+	if _, err := h.Engine.Transition(&claim, models.ActionSubmit, user, workflow.Note{Justifications: req.Justifications}); err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
 	utils.WriteSuccess(w, claim, "Claim submitted successfully")
 }
 
-func (h *ClaimHandler) CancelClaim(w http.ResponseWriter, r *http.Request) {
+func (h *ClaimHandler) WithdrawClaim(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUserFromContext(r.Context())
 	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -210,13 +511,40 @@ func (h *ClaimHandler) CancelClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if claim.Status == models.StatusApproved || claim.Status == models.StatusPaid || claim.Status == models.StatusPaymentInProgress {
-		utils.WriteError(w, http.StatusBadRequest, "Cannot cancel approved or processed claims")
+	if _, err := h.Engine.Transition(&claim, models.ActionWithdraw, user, workflow.Note{}); err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, claim, "Claim withdrawn successfully")
+}
+
+func (h *ClaimHandler) CancelClaim(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	claimID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
 		return
 	}
 
-	if err := h.DB.Delete(&claim).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to cancel claim")
+	var claim models.Claim
+	if err := h.DB.Where("user_id = ? AND id = ?", user.ID, claimID).First(&claim).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Claim not found")
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := h.Engine.WithDB(tx).Transition(&claim, models.ActionCancel, user, workflow.Note{}); err != nil {
+			return err
+		}
+		if err := card.Release(tx, "claim_id = ?", claim.ID); err != nil {
+			return err
+		}
+		// The cancelled claim and its audit trail are kept, out of sight
+		return tx.Delete(&claim).Error
+	})
+	if err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
@@ -237,34 +565,313 @@ func (h *ClaimHandler) ApproveClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if claim.UserID == user.ID {
-		utils.WriteError(w, http.StatusForbidden, "Cannot approve your own claim")
-		return
-	}
-
 	var req ApproveClaimRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	claim.Status = req.Status
-	if err := h.DB.Save(&claim).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to update claim status")
+	action, err := workflow.ActionFor(claim.Status, req.Status)
+	if err != nil {
+		writeWorkflowError(w, err)
 		return
 	}
 
-	approval := models.ClaimApproval{
-		ClaimID:    claim.ID,
-		ApproverID: user.ID,
-		Status:     req.Status,
-		Comments:   req.Comments,
+	approval, err := h.Engine.Transition(&claim, action, user, workflow.Note{Comments: req.Comments, ReasonCode: req.ReasonCode})
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, claim, withWarnings("Claim status updated successfully", approval))
+}
+
+// linkAdvance files a claim against one of the claimant's cash advances,
+// or against none when advanceID is nil. The claim's currency must be set.
+func (h *ClaimHandler) linkAdvance(claim *models.Claim, advanceID *uint) error {
+	claim.AdvanceID = nil
+	if advanceID == nil {
+		return nil
+	}
+
+	var cashAdvance models.CashAdvance
+	if err := h.DB.Where("user_id = ?", claim.UserID).First(&cashAdvance, *advanceID).Error; err != nil {
+		return errors.New("Cash advance not found")
+	}
+	if err := advance.Link(&cashAdvance, claim); err != nil {
+		return err
+	}
+	claim.AdvanceID = &cashAdvance.ID
+	return nil
+}
+
+// buildLines validates the lines of a claim request filed by claimant.
+func (h *ClaimHandler) buildLines(reqs []ClaimLineRequest, claimant *models.User) ([]models.ClaimLineItem, error) {
+	lines := []models.ClaimLineItem{}
+	for i, req := range reqs {
+		// A per diem's line is dated by the trip's first day unless given
+		if req.Date == "" && req.Calculation != nil {
+			req.Date = req.Calculation.StartDate
+		}
+		date, err := time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d has an invalid date, expected YYYY-MM-DD", i+1)
+		}
+
+		var claimType models.ClaimType
+		if err := h.DB.First(&claimType, req.ClaimTypeID).Error; err != nil {
+			return nil, fmt.Errorf("Line %d has an invalid claim type", i+1)
+		}
+
+		lineCurrency := ""
+		if req.Currency != "" {
+			if lineCurrency, err = currency.Normalize(req.Currency); err != nil {
+				return nil, fmt.Errorf("Line %d has an invalid currency code", i+1)
+			}
+		}
+
+		calculation, err := h.calculate(&claimType, req.Calculation, date)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %w", i+1, err)
+		}
+		if calculation != nil {
+			if lineCurrency != "" && lineCurrency != calculation.Currency {
+				return nil, fmt.Errorf("Line %d: %s rates are in %s", i+1, claimType.Name, calculation.Currency)
+			}
+			lineCurrency = calculation.Currency
+			req.Amount = calculation.Amount
+		} else if req.Amount.Sign() <= 0 {
+			return nil, fmt.Errorf("Line %d amount must be greater than zero", i+1)
+		}
+
+		allocations, err := h.allocate(req.Allocations, claimant)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %w", i+1, err)
+		}
+
+		// Attribute names are matched by policy rules in lower case
+		var attributes map[string]string
+		for name, value := range req.Attributes {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if attributes == nil {
+				attributes = map[string]string{}
+			}
+			attributes[name] = strings.TrimSpace(value)
+		}
+
+		lines = append(lines, models.ClaimLineItem{
+			Date:        date,
+			ClaimTypeID: claimType.ID,
+			ClaimType:   claimType,
+			Amount:      req.Amount,
+			Currency:    lineCurrency,
+			Calculation: calculation,
+			Merchant:    strings.TrimSpace(req.Merchant),
+			Description: req.Description,
+			ReceiptURL:  strings.TrimSpace(req.ReceiptURL),
+			Attributes:  attributes,
+			Allocations: allocations,
+		})
+	}
+	return lines, nil
+}
+
+// keepLines matches the lines of an update to the claim's stored lines by
+// ID, so that lines updated in place keep their card payments. Lines
+// without an ID are new.
+func keepLines(claim *models.Claim, reqs []ClaimLineRequest, stored []models.ClaimLineItem) error {
+	byID := map[uint]*models.ClaimLineItem{}
+	for i := range stored {
+		byID[stored[i].ID] = &stored[i]
+	}
+
+	seen := map[uint]bool{}
+	for i, req := range reqs {
+		if req.ID == 0 {
+			continue
+		}
+		line, ok := byID[req.ID]
+		if !ok || seen[req.ID] {
+			return fmt.Errorf("Line %d is not one of the claim's lines", i+1)
+		}
+		seen[req.ID] = true
+		claim.Lines[i].ID = line.ID
+		claim.Lines[i].CreatedAt = line.CreatedAt
+		claim.Lines[i].PaidByCard = line.PaidByCard
+	}
+	return nil
+}
+
+// removeLines deletes the stored lines of a claim that aren't among its
+// lines. Their card transactions are released, and their attachments move
+// to the claim so that no receipt is lost with them.
+func removeLines(tx *gorm.DB, claim *models.Claim) error {
+	kept := []uint{0}
+	for _, line := range claim.Lines {
+		if line.ID != 0 {
+			kept = append(kept, line.ID)
+		}
+	}
+
+	if err := card.Release(tx, "claim_id = ? AND line_item_id NOT IN ?", claim.ID, kept); err != nil {
+		return err
 	}
+	if err := tx.Model(&models.Attachment{}).Where("claim_id = ? AND line_item_id NOT IN ?", claim.ID, kept).Update("line_item_id", nil).Error; err != nil {
+		return err
+	}
+	return tx.Where("claim_id = ? AND id NOT IN ?", claim.ID, kept).Delete(&models.ClaimLineItem{}).Error
+}
+
+// calculate works out the amount of a mileage or per-diem expense from its
+// inputs. Other claim types take the amount as entered, and no inputs.
+func (h *ClaimHandler) calculate(claimType *models.ClaimType, input *models.CalculationInput, on time.Time) (*models.Calculation, error) {
+	if !claimType.Kind.Calculated() {
+		if input != nil {
+			return nil, fmt.Errorf("%s amounts are entered, not calculated", claimType.Name)
+		}
+		return nil, nil
+	}
+	if input == nil {
+		return nil, fmt.Errorf("%s amounts are calculated; give the calculation inputs instead of an amount", claimType.Name)
+	}
+	return h.Calculator.Calculate(claimType.Kind, *input, on)
+}
 
-	if err := h.DB.Create(&approval).Error; err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to create approval record")
+// calculateClaim works out the amount of a claim that isn't itemized when
+// its type is calculated, as of today and in the currency of the rate.
+// Without new inputs, the previous calculation's inputs are used again
+// while the claim's type is still of the same kind.
+func (h *ClaimHandler) calculateClaim(claim *models.Claim, input *models.CalculationInput, previous *models.Calculation, currencyGiven bool) error {
+	claim.Calculation = nil
+	if len(claim.Lines) > 0 {
+		if input != nil {
+			return errors.New("Calculation inputs go on the lines of an itemized claim")
+		}
+		return nil
+	}
+
+	var claimType models.ClaimType
+	if err := h.DB.First(&claimType, claim.ClaimTypeID).Error; err != nil {
+		return errors.New("Invalid claim type")
+	}
+	if input == nil && previous != nil && previous.Kind == claimType.Kind {
+		input = &previous.Input
+	}
+	calculation, err := h.calculate(&claimType, input, time.Now())
+	if err != nil || calculation == nil {
+		return err
+	}
+	if currencyGiven && claim.Currency != calculation.Currency {
+		return fmt.Errorf("%s rates are in %s; file the claim in %s", claimType.Name, calculation.Currency, calculation.Currency)
+	}
+	claim.Currency = calculation.Currency
+	claim.Amount = calculation.Amount
+	claim.Calculation = calculation
+	return nil
+}
+
+// expenseDate reads the expense date of a claim, if given. Like a line, a
+// per diem is dated by the trip's first day unless given.
+func expenseDate(value string, calculation *models.CalculationInput) (*time.Time, error) {
+	if value == "" && calculation != nil {
+		value = calculation.StartDate
+	}
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, errors.New("Invalid expense date, expected YYYY-MM-DD")
+	}
+	return &date, nil
+}
+
+// writeClaimInputError reports a mistake in a claim's details, or a missing
+// rate for a calculated amount.
+func writeClaimInputError(w http.ResponseWriter, err error) {
+	var rateErr *calculator.RateError
+	if errors.As(err, &rateErr) {
+		writeWorkflowError(w, err)
 		return
 	}
+	utils.WriteError(w, http.StatusBadRequest, err.Error())
+}
+
+// itemize derives an itemized claim's amount from its lines, which must
+// have been priced. The claim's own type defaults to that of its first
+// line.
+func itemize(claim *models.Claim) {
+	if len(claim.Lines) == 0 {
+		return
+	}
+	claim.Amount = claim.LinesTotal()
+	if claim.ClaimTypeID == 0 {
+		claim.ClaimTypeID = claim.Lines[0].ClaimTypeID
+	}
+}
+
+// allocate validates the allocations of a claim or line filed by claimant.
+func (h *ClaimHandler) allocate(reqs []AllocationRequest, claimant *models.User) ([]models.Allocation, error) {
+	allocations := []models.Allocation{}
+	for _, req := range reqs {
+		var costCenter models.CostCenter
+		if err := h.DB.Preload("UserGroups").First(&costCenter, req.CostCenterID).Error; err != nil {
+			return nil, errors.New("Invalid cost center")
+		}
+		allocation := models.Allocation{CostCenterID: costCenter.ID, CostCenter: &costCenter, Percent: req.Percent}
+		if req.ProjectID != nil {
+			var project models.Project
+			if err := h.DB.Preload("UserGroups").First(&project, *req.ProjectID).Error; err != nil {
+				return nil, errors.New("Invalid project")
+			}
+			allocation.ProjectID, allocation.Project = &project.ID, &project
+		}
+		if len(reqs) == 1 && allocation.Percent.IsZero() {
+			allocation.Percent = money.FromInt(100)
+		}
+		allocations = append(allocations, allocation)
+	}
+	if err := workflow.CheckAllocationSet(allocations, claimant); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+// saveAllocations replaces the stored allocations of a claim and its lines
+// with the ones on them. The claim and its lines must have been saved.
+func saveAllocations(tx *gorm.DB, claim *models.Claim) error {
+	if err := tx.Where("claim_id = ?", claim.ID).Delete(&models.Allocation{}).Error; err != nil {
+		return err
+	}
+	save := func(allocations []models.Allocation, lineID *uint) error {
+		if len(allocations) == 0 {
+			return nil
+		}
+		for i := range allocations {
+			allocations[i].ID = 0
+			allocations[i].ClaimID = claim.ID
+			allocations[i].LineItemID = lineID
+		}
+		return tx.Omit(clause.Associations).Create(&allocations).Error
+	}
 
-	utils.WriteSuccess(w, claim, "Claim status updated successfully")
-}
\ No newline at end of file
+	if err := save(claim.Allocations, nil); err != nil {
+		return err
+	}
+	for i := range claim.Lines {
+		if err := save(claim.Lines[i].Allocations, &claim.Lines[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadAllocations loads the allocations of a claim and its lines with
+// their cost centers and projects.
+func preloadAllocations(query *gorm.DB) *gorm.DB {
+	return query.Preload("Allocations", "line_item_id IS NULL").Preload("Allocations.CostCenter").Preload("Allocations.Project").
+		Preload("Lines.Allocations.CostCenter").Preload("Lines.Allocations.Project")
+}
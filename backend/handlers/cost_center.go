@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// CostCenterHandler manages the cost centers and projects claims are
+// charged to.
+type CostCenterHandler struct {
+	DB *gorm.DB
+}
+
+// ChargeCodeRequest creates or updates a cost center or project.
+type ChargeCodeRequest struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Active      *bool  `json:"active"`
+	// UserGroupIDs limits who can charge it; empty means anyone
+	UserGroupIDs []uint `json:"user_group_ids"`
+}
+
+func NewCostCenterHandler(db *gorm.DB) *CostCenterHandler {
+	return &CostCenterHandler{DB: db}
+}
+
+// GetCostCenters lists the active cost centers the user's group can
+// charge.
+func (h *CostCenterHandler) GetCostCenters(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var costCenters []models.CostCenter
+	if err := h.DB.Preload("UserGroups").Where("active = ?", true).Order("code").Find(&costCenters).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cost centers")
+		return
+	}
+
+	allowed := []models.CostCenter{}
+	for i := range costCenters {
+		if costCenters[i].AllowsGroup(user.UserGroupID) {
+			allowed = append(allowed, costCenters[i])
+		}
+	}
+
+	utils.WriteSuccess(w, allowed)
+}
+
+// GetAllCostCenters lists every cost center, inactive ones included.
+func (h *CostCenterHandler) GetAllCostCenters(w http.ResponseWriter, r *http.Request) {
+	var costCenters []models.CostCenter
+	if err := h.DB.Preload("UserGroups").Order("code").Find(&costCenters).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve cost centers")
+		return
+	}
+
+	utils.WriteSuccess(w, costCenters)
+}
+
+func (h *CostCenterHandler) CreateCostCenter(w http.ResponseWriter, r *http.Request) {
+	var req ChargeCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	costCenter := models.CostCenter{ChargeCode: models.ChargeCode{Active: true}}
+	groups, err := h.apply(&models.CostCenter{}, costCenter.ID, &costCenter.ChargeCode, &req)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	costCenter.UserGroups = groups
+
+	if err := h.DB.Create(&costCenter).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create cost center")
+		return
+	}
+
+	utils.WriteSuccess(w, costCenter, "Cost center created successfully")
+}
+
+func (h *CostCenterHandler) UpdateCostCenter(w http.ResponseWriter, r *http.Request) {
+	costCenterID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cost center ID")
+		return
+	}
+
+	var costCenter models.CostCenter
+	if err := h.DB.First(&costCenter, costCenterID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Cost center not found")
+		return
+	}
+
+	var req ChargeCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	groups, err := h.apply(&models.CostCenter{}, costCenter.ID, &costCenter.ChargeCode, &req)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&costCenter).Error; err != nil {
+			return err
+		}
+		return tx.Model(&costCenter).Association("UserGroups").Replace(groups)
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update cost center")
+		return
+	}
+	costCenter.UserGroups = groups
+
+	utils.WriteSuccess(w, costCenter, "Cost center updated successfully")
+}
+
+// DeleteCostCenter removes a cost center nothing was charged to. Ones
+// claims were charged to are deactivated instead so the claims keep them.
+func (h *CostCenterHandler) DeleteCostCenter(w http.ResponseWriter, r *http.Request) {
+	h.deleteChargeCode(w, r, &models.CostCenter{}, "cost_center_id", "Cost center")
+}
+
+// GetProjects lists the active projects the user's group can charge.
+func (h *CostCenterHandler) GetProjects(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var projects []models.Project
+	if err := h.DB.Preload("UserGroups").Where("active = ?", true).Order("code").Find(&projects).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve projects")
+		return
+	}
+
+	allowed := []models.Project{}
+	for i := range projects {
+		if projects[i].AllowsGroup(user.UserGroupID) {
+			allowed = append(allowed, projects[i])
+		}
+	}
+
+	utils.WriteSuccess(w, allowed)
+}
+
+// GetAllProjects lists every project, inactive ones included.
+func (h *CostCenterHandler) GetAllProjects(w http.ResponseWriter, r *http.Request) {
+	var projects []models.Project
+	if err := h.DB.Preload("UserGroups").Order("code").Find(&projects).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve projects")
+		return
+	}
+
+	utils.WriteSuccess(w, projects)
+}
+
+func (h *CostCenterHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
+	var req ChargeCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	project := models.Project{ChargeCode: models.ChargeCode{Active: true}}
+	groups, err := h.apply(&models.Project{}, project.ID, &project.ChargeCode, &req)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	project.UserGroups = groups
+
+	if err := h.DB.Create(&project).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create project")
+		return
+	}
+
+	utils.WriteSuccess(w, project, "Project created successfully")
+}
+
+func (h *CostCenterHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var project models.Project
+	if err := h.DB.First(&project, projectID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	var req ChargeCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	groups, err := h.apply(&models.Project{}, project.ID, &project.ChargeCode, &req)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&project).Error; err != nil {
+			return err
+		}
+		return tx.Model(&project).Association("UserGroups").Replace(groups)
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update project")
+		return
+	}
+	project.UserGroups = groups
+
+	utils.WriteSuccess(w, project, "Project updated successfully")
+}
+
+// DeleteProject removes a project nothing was charged to. Ones claims were
+// charged to are deactivated instead so the claims keep them.
+func (h *CostCenterHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	h.deleteChargeCode(w, r, &models.Project{}, "project_id", "Project")
+}
+
+// apply validates a cost center or project request onto its stored
+// fields, checking the code against the others of model, and returns the
+// user groups it is limited to.
+func (h *CostCenterHandler) apply(model interface{}, id uint, chargeCode *models.ChargeCode, req *ChargeCodeRequest) ([]models.UserGroup, error) {
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+	if code == "" || strings.TrimSpace(req.Name) == "" {
+		return nil, errors.New("Code and name are required")
+	}
+
+	var clashes int64
+	h.DB.Model(model).Where("UPPER(code) = ? AND id <> ?", code, id).Count(&clashes)
+	if clashes > 0 {
+		return nil, fmt.Errorf("Code %s is already in use", code)
+	}
+
+	groups := []models.UserGroup{}
+	if len(req.UserGroupIDs) > 0 {
+		if err := h.DB.Find(&groups, req.UserGroupIDs).Error; err != nil || len(groups) != len(req.UserGroupIDs) {
+			return nil, errors.New("Invalid user group")
+		}
+	}
+
+	chargeCode.Code = code
+	chargeCode.Name = strings.TrimSpace(req.Name)
+	chargeCode.Description = req.Description
+	if req.Active != nil {
+		chargeCode.Active = *req.Active
+	}
+	return groups, nil
+}
+
+func (h *CostCenterHandler) deleteChargeCode(w http.ResponseWriter, r *http.Request, model interface{}, column, name string) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s ID", strings.ToLower(name)))
+		return
+	}
+
+	if err := h.DB.First(model, id).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, name+" not found")
+		return
+	}
+
+	var used int64
+	h.DB.Model(&models.Allocation{}).Where(column+" = ?", id).Count(&used)
+	if used > 0 {
+		if err := h.DB.Model(model).Update("active", false).Error; err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to deactivate %s", strings.ToLower(name)))
+			return
+		}
+		utils.WriteSuccess(w, model, name+" is in use and has been deactivated")
+		return
+	}
+
+	// Removed outright so the code can be reused
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Association("UserGroups").Clear(); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(model).Error
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete %s", strings.ToLower(name)))
+		return
+	}
+
+	utils.WriteSuccess(w, nil, name+" deleted successfully")
+}
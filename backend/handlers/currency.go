@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/currency"
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxRateFileSize is large enough for the ECB's full rate history.
+const maxRateFileSize = 32 << 20
+
+type CurrencyHandler struct {
+	DB           *gorm.DB
+	BaseCurrency string
+}
+
+// ExchangeRateRequest sets a rate by hand: 1 base = rate quote on date.
+type ExchangeRateRequest struct {
+	Base  string  `json:"base"` // defaults to the base currency
+	Quote string  `json:"quote"`
+	Rate  float64 `json:"rate"`
+	Date  string  `json:"date"` // YYYY-MM-DD, defaults to today
+}
+
+type ImportResult struct {
+	Imported int    `json:"imported"`
+	Format   string `json:"format"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+}
+
+func NewCurrencyHandler(db *gorm.DB, baseCurrency string) *CurrencyHandler {
+	return &CurrencyHandler{DB: db, BaseCurrency: baseCurrency}
+}
+
+// GetCurrencies lists the base currency and every currency exchange rates
+// are loaded for, which are the ones claims can be filed in.
+func (h *CurrencyHandler) GetCurrencies(w http.ResponseWriter, r *http.Request) {
+	var bases, quotes []string
+	if err := h.DB.Model(&models.ExchangeRate{}).Distinct().Pluck("base", &bases).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve currencies")
+		return
+	}
+	if err := h.DB.Model(&models.ExchangeRate{}).Distinct().Pluck("quote", &quotes).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve currencies")
+		return
+	}
+
+	seen := map[string]bool{h.BaseCurrency: true}
+	currencies := []string{h.BaseCurrency}
+	for _, code := range append(bases, quotes...) {
+		if !seen[code] {
+			seen[code] = true
+			currencies = append(currencies, code)
+		}
+	}
+	sort.Strings(currencies[1:])
+
+	utils.WriteSuccess(w, map[string]interface{}{
+		"base":       h.BaseCurrency,
+		"currencies": currencies,
+	})
+}
+
+// GetExchangeRates lists rates, newest first, optionally for one currency
+// and between from and to dates.
+func (h *CurrencyHandler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Model(&models.ExchangeRate{})
+	if code := r.URL.Query().Get("currency"); code != "" {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		query = query.Where("base = ? OR quote = ?", code, code)
+	}
+	for param, condition := range map[string]string{"from": "date >= ?", "to": "date <= ?"} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s date, expected YYYY-MM-DD", param))
+			return
+		}
+		query = query.Where(condition, date)
+	}
+
+	limit := 500
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	var rates []models.ExchangeRate
+	if err := query.Order("date DESC, base, quote").Limit(limit).Find(&rates).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve exchange rates")
+		return
+	}
+
+	utils.WriteSuccess(w, rates)
+}
+
+// SetExchangeRate records a rate by hand, replacing any rate already held
+// for the pair on that day.
+func (h *CurrencyHandler) SetExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var req ExchangeRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Base == "" {
+		req.Base = h.BaseCurrency
+	}
+	if req.Date == "" {
+		req.Date = time.Now().Format("2006-01-02")
+	}
+	rate, err := currency.NewRate(req.Date, req.Base, req.Quote, strconv.FormatFloat(req.Rate, 'f', -1, 64), "manual")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid exchange rate: %v", err))
+		return
+	}
+
+	if err := h.save([]models.ExchangeRate{rate}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to save exchange rate")
+		return
+	}
+	if err := h.DB.Where("base = ? AND quote = ? AND date = ?", rate.Base, rate.Quote, rate.Date).First(&rate).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve exchange rate")
+		return
+	}
+
+	utils.WriteSuccess(w, rate, "Exchange rate saved successfully")
+}
+
+// ImportExchangeRates loads a CSV or ECB XML rate file, uploaded in the
+// file field of a form or sent as the request body. The format is
+// detected from the contents unless given as ?format=csv or ?format=ecb;
+// CSV files without a base column are quoted against ?base, which defaults
+// to the base currency.
+func (h *CurrencyHandler) ImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRateFileSize)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				utils.WriteError(w, http.StatusRequestEntityTooLarge, "Rate file is too large")
+				return
+			}
+			utils.WriteError(w, http.StatusBadRequest, "A rate file is required in the file field")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	reader := bufio.NewReader(body)
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+		if start, _ := reader.Peek(64); strings.HasPrefix(strings.TrimSpace(string(start)), "<") {
+			format = "ecb"
+		}
+	}
+
+	var rates []models.ExchangeRate
+	var err error
+	switch format {
+	case "csv":
+		base := r.URL.Query().Get("base")
+		if base == "" {
+			base = h.BaseCurrency
+		}
+		rates, err = currency.ParseCSV(reader, base)
+	case "ecb":
+		rates, err = currency.ParseECB(reader)
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Format must be csv or ecb")
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, "Rate file is too large")
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid rate file: %v", err))
+		return
+	}
+	if len(rates) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "The rate file holds no rates")
+		return
+	}
+
+	if err := h.save(rates); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to import exchange rates")
+		return
+	}
+
+	result := ImportResult{Format: format}
+	first, last := rates[0].Date, rates[0].Date
+	for _, rate := range rates {
+		if rate.Date.Before(first) {
+			first = rate.Date
+		}
+		if rate.Date.After(last) {
+			last = rate.Date
+		}
+	}
+	result.Imported = len(rates)
+	result.From = first.Format("2006-01-02")
+	result.To = last.Format("2006-01-02")
+
+	utils.WriteSuccess(w, result, fmt.Sprintf("Imported %d exchange rates", result.Imported))
+}
+
+func (h *CurrencyHandler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	rateID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid exchange rate ID")
+		return
+	}
+
+	result := h.DB.Delete(&models.ExchangeRate{}, rateID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete exchange rate")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Exchange rate not found")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Exchange rate deleted successfully")
+}
+
+// save upserts rates, a later rate in the list winning over an earlier one
+// for the same pair and day. Claims already submitted keep the rate they
+// were converted at.
+func (h *CurrencyHandler) save(rates []models.ExchangeRate) error {
+	type key struct {
+		base, quote string
+		date        time.Time
+	}
+	index := map[key]int{}
+	unique := []models.ExchangeRate{}
+	for _, rate := range rates {
+		k := key{rate.Base, rate.Quote, rate.Date}
+		if i, ok := index[k]; ok {
+			unique[i] = rate
+			continue
+		}
+		index[k] = len(unique)
+		unique = append(unique, rate)
+	}
+
+	return h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "quote"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).CreateInBatches(&unique, 500).Error
+}
@@ -1,44 +1,88 @@
 package handlers
 
 import (
+	"fmt"
+	"hrcs/backend/budget"
+	"hrcs/backend/calendar"
 	"hrcs/backend/middleware"
 	"hrcs/backend/models"
+	"hrcs/backend/money"
 	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
 	"net/http"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type DashboardHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	engine       *workflow.Engine
+	baseCurrency string
 }
 
-func NewDashboardHandler(db *gorm.DB) *DashboardHandler {
-	return &DashboardHandler{db: db}
+func NewDashboardHandler(db *gorm.DB, baseCurrency string) *DashboardHandler {
+	return &DashboardHandler{db: db, engine: workflow.NewEngine(db), baseCurrency: baseCurrency}
 }
 
 type DashboardStats struct {
-	TotalClaims    int64              `json:"totalClaims"`
-	PendingClaims  int64              `json:"pendingClaims"`
-	ApprovedClaims int64              `json:"approvedClaims"`
-	RejectedClaims int64              `json:"rejectedClaims"`
-	TotalAmount    float64            `json:"totalAmount"`
-	ApprovedAmount float64            `json:"approvedAmount"`
+	TotalClaims    int64 `json:"totalClaims"`
+	PendingClaims  int64 `json:"pendingClaims"`
+	ApprovedClaims int64 `json:"approvedClaims"`
+	RejectedClaims int64 `json:"rejectedClaims"`
+	// Amounts are in the base currency
+	Currency       string             `json:"currency"`
+	TotalAmount    money.Decimal      `json:"totalAmount"`
+	ApprovedAmount money.Decimal      `json:"approvedAmount"`
 	RecentClaims   []models.Claim     `json:"recentClaims"`
 	ClaimsByStatus []ClaimStatusCount `json:"claimsByStatus"`
 	ClaimsByType   []ClaimTypeStats   `json:"claimsByType"`
 	TotalUsers     int64              `json:"totalUsers"` // Admin only
+	ApprovalAge    ApprovalAgeStats   `json:"approvalAge"`
+	// Rejections and returns by reason code
+	DecisionsByReason []ReasonCount `json:"decisionsByReason"`
+	// Amounts charged to each cost center and project, admin only
+	ClaimsByCostCenter []AllocationStats `json:"claimsByCostCenter,omitempty"`
+	ClaimsByProject    []AllocationStats `json:"claimsByProject,omitempty"`
 }
 
+type ReasonCount struct {
+	Action string `json:"action"` // "reject" or "return"
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Count  int64  `json:"count"`
+}
+
+// ApprovalAgeStats describes how long pending claims have been waiting on
+// their current approval level, in business days of the claimant's
+// calendar.
+type ApprovalAgeStats struct {
+	Pending     int     `json:"pending"`
+	AverageDays float64 `json:"averageDays"`
+	OldestDays  int     `json:"oldestDays"`
+}
+
+// pendingStatuses are the statuses of claims still waiting on approvers
+var pendingStatuses = []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview}
+
 type ClaimStatusCount struct {
 	Status string `json:"status"`
 	Count  int64  `json:"count"`
 }
 
 type ClaimTypeStats struct {
-	Type   string  `json:"type"`
-	Count  int64   `json:"count"`
-	Amount float64 `json:"amount"`
+	Type   string        `json:"type"`
+	Count  int64         `json:"count"`
+	Amount money.Decimal `json:"amount"`
+}
+
+// AllocationStats is the share of claims charged to a cost center or
+// project. Code is empty for the share charged to none.
+type AllocationStats struct {
+	Code   string        `json:"code"`
+	Name   string        `json:"name"`
+	Count  int64         `json:"count"`
+	Amount money.Decimal `json:"amount"`
 }
 
 func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
@@ -49,13 +93,13 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := user.ID
 
-	var stats DashboardStats
+	stats := DashboardStats{Currency: h.baseCurrency}
 
 	// Get total claims for user
 	h.db.Model(&models.Claim{}).Where("user_id = ?", userID).Count(&stats.TotalClaims)
 
-	// Get pending claims (submitted status)
-	h.db.Model(&models.Claim{}).Where("user_id = ? AND status = ?", userID, "submitted").Count(&stats.PendingClaims)
+	// Get pending claims (submitted or part-way through the approval chain)
+	h.db.Model(&models.Claim{}).Where("user_id = ? AND status IN ?", userID, pendingStatuses).Count(&stats.PendingClaims)
 
 	// Get approved claims
 	h.db.Model(&models.Claim{}).Where("user_id = ? AND status = ?", userID, "approved").Count(&stats.ApprovedClaims)
@@ -64,10 +108,10 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	h.db.Model(&models.Claim{}).Where("user_id = ? AND status = ?", userID, "rejected").Count(&stats.RejectedClaims)
 
 	// Get total amount
-	h.db.Model(&models.Claim{}).Where("user_id = ?", userID).Select("COALESCE(SUM(amount), 0)").Scan(&stats.TotalAmount)
+	h.db.Model(&models.Claim{}).Where("user_id = ?", userID).Select("COALESCE(SUM(base_amount), 0)").Scan(&stats.TotalAmount)
 
 	// Get approved amount
-	h.db.Model(&models.Claim{}).Where("user_id = ? AND status = ?", userID, "approved").Select("COALESCE(SUM(amount), 0)").Scan(&stats.ApprovedAmount)
+	h.db.Model(&models.Claim{}).Where("user_id = ? AND status = ?", userID, "approved").Select("COALESCE(SUM(base_amount), 0)").Scan(&stats.ApprovedAmount)
 
 	// Get recent claims
 	var recentClaims []models.Claim
@@ -84,14 +128,18 @@ func (h *DashboardHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	stats.ClaimsByStatus = claimsByStatus
 
 	// Get claims by type
-	var claimsByType []ClaimTypeStats
-	h.db.Table("claims").
-		Select("claim_types.name as type, COUNT(claims.id) as count, COALESCE(SUM(claims.amount), 0) as amount").
-		Joins("JOIN claim_types ON claim_types.id = claims.claim_type_id").
-		Where("claims.user_id = ?", userID).
-		Group("claim_types.id, claim_types.name").
-		Scan(&claimsByType)
-	stats.ClaimsByType = claimsByType
+	stats.ClaimsByType = h.claimsByType(h.db.Where("claims.user_id = ?", userID))
+
+	// Get approval age of pending claims
+	approvalAge, err := h.approvalAge(h.db.Where("user_id = ?", userID))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to calculate approval age")
+		return
+	}
+	stats.ApprovalAge = approvalAge
+
+	// Get rejections and returns by reason code
+	stats.DecisionsByReason = h.decisionsByReason(h.db.Where("claims.user_id = ?", userID))
 
 	utils.WriteSuccess(w, stats, "Dashboard stats retrieved successfully")
 }
@@ -104,13 +152,13 @@ func (h *DashboardHandler) GetAdminStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var stats DashboardStats
+	stats := DashboardStats{Currency: h.baseCurrency}
 
 	// Get total claims (all users)
 	h.db.Model(&models.Claim{}).Count(&stats.TotalClaims)
 
 	// Get pending claims
-	h.db.Model(&models.Claim{}).Where("status = ?", "submitted").Count(&stats.PendingClaims)
+	h.db.Model(&models.Claim{}).Where("status IN ?", pendingStatuses).Count(&stats.PendingClaims)
 
 	// Get approved claims
 	h.db.Model(&models.Claim{}).Where("status = ?", "approved").Count(&stats.ApprovedClaims)
@@ -119,10 +167,10 @@ func (h *DashboardHandler) GetAdminStats(w http.ResponseWriter, r *http.Request)
 	h.db.Model(&models.Claim{}).Where("status = ?", "rejected").Count(&stats.RejectedClaims)
 
 	// Get total amount
-	h.db.Model(&models.Claim{}).Select("COALESCE(SUM(amount), 0)").Scan(&stats.TotalAmount)
+	h.db.Model(&models.Claim{}).Select("COALESCE(SUM(base_amount), 0)").Scan(&stats.TotalAmount)
 
 	// Get approved amount
-	h.db.Model(&models.Claim{}).Where("status = ?", "approved").Select("COALESCE(SUM(amount), 0)").Scan(&stats.ApprovedAmount)
+	h.db.Model(&models.Claim{}).Where("status = ?", "approved").Select("COALESCE(SUM(base_amount), 0)").Scan(&stats.ApprovedAmount)
 
 	// Get recent claims
 	var recentClaims []models.Claim
@@ -138,16 +186,111 @@ func (h *DashboardHandler) GetAdminStats(w http.ResponseWriter, r *http.Request)
 	stats.ClaimsByStatus = claimsByStatus
 
 	// Get claims by type
-	var claimsByType []ClaimTypeStats
-	h.db.Table("claims").
-		Select("claim_types.name as type, COUNT(claims.id) as count, COALESCE(SUM(claims.amount), 0) as amount").
-		Joins("JOIN claim_types ON claim_types.id = claims.claim_type_id").
-		Group("claim_types.id, claim_types.name").
-		Scan(&claimsByType)
-	stats.ClaimsByType = claimsByType
+	stats.ClaimsByType = h.claimsByType(h.db)
 
 	// Get total users count
 	h.db.Model(&models.User{}).Count(&stats.TotalUsers)
 
+	// Get approval age of pending claims
+	approvalAge, err := h.approvalAge(h.db)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to calculate approval age")
+		return
+	}
+	stats.ApprovalAge = approvalAge
+
+	// Get rejections and returns by reason code
+	stats.DecisionsByReason = h.decisionsByReason(h.db)
+
+	// Get amounts by cost center and project
+	stats.ClaimsByCostCenter = h.claimsByAllocation(h.db, "cost_centers", "cost_center_id", "Unallocated")
+	stats.ClaimsByProject = h.claimsByAllocation(h.db, "projects", "project_id", "No project")
+
 	utils.WriteSuccess(w, stats, "Admin dashboard stats retrieved successfully")
 }
+
+// claimsByAllocation totals the claims matched by query per cost center or
+// project, given its table and the allocation column referencing it, with
+// what isn't charged to one under unassigned.
+func (h *DashboardHandler) claimsByAllocation(query *gorm.DB, table, column, unassigned string) []AllocationStats {
+	stats := []AllocationStats{}
+	query.Table("("+budget.AllocatedItems+") AS items").
+		Select(fmt.Sprintf("COALESCE(%s.code, '') as code, COALESCE(%s.name, ?) as name, COUNT(DISTINCT items.claim_id) as count, COALESCE(SUM(items.amount), 0) as amount", table, table), unassigned).
+		Joins("JOIN claims ON claims.id = items.claim_id").
+		Joins(fmt.Sprintf("LEFT JOIN %s ON %s.id = items.%s", table, table, column)).
+		Group(fmt.Sprintf("%s.id, %s.code, %s.name", table, table, table)).
+		Order("amount DESC").
+		Scan(&stats)
+	return stats
+}
+
+// claimsByType totals the claims matched by query per claim type, line by
+// line, so an itemized trip counts towards each type it contains.
+func (h *DashboardHandler) claimsByType(query *gorm.DB) []ClaimTypeStats {
+	claimsByType := []ClaimTypeStats{}
+	query.Table("(" + budget.ClaimItems + ") AS items").
+		Select("claim_types.name as type, COUNT(DISTINCT items.claim_id) as count, COALESCE(SUM(items.amount), 0) as amount").
+		Joins("JOIN claims ON claims.id = items.claim_id").
+		Joins("JOIN claim_types ON claim_types.id = items.claim_type_id").
+		Group("claim_types.id, claim_types.name").
+		Scan(&claimsByType)
+	return claimsByType
+}
+
+// decisionsByReason counts the rejections and returns recorded against the
+// claims matched by query, by reason code.
+func (h *DashboardHandler) decisionsByReason(query *gorm.DB) []ReasonCount {
+	counts := []ReasonCount{}
+	query.Table("claim_approvals").
+		Select("claim_approvals.action as action, reason_codes.code as code, reason_codes.name as name, COUNT(claim_approvals.id) as count").
+		Joins("JOIN reason_codes ON reason_codes.id = claim_approvals.reason_code_id").
+		Joins("JOIN claims ON claims.id = claim_approvals.claim_id AND claims.deleted_at IS NULL").
+		Where("claim_approvals.deleted_at IS NULL AND claim_approvals.action IN ?", []models.ClaimAction{models.ActionReject, models.ActionReturn}).
+		Group("claim_approvals.action, reason_codes.code, reason_codes.name").
+		Order("count DESC").
+		Scan(&counts)
+	return counts
+}
+
+// approvalAge measures how long the pending claims matched by query have
+// been waiting on their current level.
+func (h *DashboardHandler) approvalAge(query *gorm.DB) (ApprovalAgeStats, error) {
+	var stats ApprovalAgeStats
+
+	var claims []models.Claim
+	if err := query.Preload("User").Where("status IN ?", pendingStatuses).Find(&claims).Error; err != nil {
+		return stats, err
+	}
+
+	progresses, err := h.engine.Progresses(claims)
+	if err != nil {
+		return stats, err
+	}
+
+	calendars := calendar.NewService(h.db)
+	now := time.Now()
+	total := 0
+	for i := range claims {
+		progress := progresses[claims[i].ID]
+		if progress.Since.IsZero() {
+			continue
+		}
+
+		cal, err := calendars.ForUser(&claims[i].User)
+		if err != nil {
+			return stats, err
+		}
+		days := cal.BusinessDaysBetween(progress.Since, now)
+
+		stats.Pending++
+		total += days
+		if days > stats.OldestDays {
+			stats.OldestDays = days
+		}
+	}
+
+	if stats.Pending > 0 {
+		stats.AverageDays = float64(total) / float64(stats.Pending)
+	}
+	return stats, nil
+}
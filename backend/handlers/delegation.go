@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type DelegationHandler struct {
+	DB     *gorm.DB
+	Engine *workflow.Engine
+}
+
+type CreateDelegationRequest struct {
+	// DelegatorID lets an admin register a delegation for someone who is
+	// already away; everyone else delegates their own approvals
+	DelegatorID uint   `json:"delegator_id"`
+	DelegateID  uint   `json:"delegate_id"`
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Reason      string `json:"reason"`
+}
+
+// PendingApproval is a claim waiting on a step the current user can act on,
+// either directly or on behalf of an approver who delegated to them.
+type PendingApproval struct {
+	Claim      models.Claim         `json:"claim"`
+	Level      models.ApprovalLevel `json:"level"`
+	OnBehalfOf *models.User         `json:"on_behalf_of,omitempty"`
+}
+
+const delegationDateLayout = "2006-01-02"
+
+func NewDelegationHandler(db *gorm.DB) *DelegationHandler {
+	return &DelegationHandler{DB: db, Engine: workflow.NewEngine(db)}
+}
+
+func (h *DelegationHandler) GetDelegations(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var delegations []models.ApproverDelegation
+	if err := h.DB.Preload("Delegator").Preload("Delegate").
+		Where("delegator_id = ? OR delegate_id = ?", user.ID, user.ID).
+		Order("start_date DESC").
+		Find(&delegations).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve delegations")
+		return
+	}
+
+	utils.WriteSuccess(w, delegations)
+}
+
+func (h *DelegationHandler) CreateDelegation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var req CreateDelegationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	delegatorID := user.ID
+	if req.DelegatorID != 0 && req.DelegatorID != user.ID {
+		if user.Role != models.RoleAdmin {
+			utils.WriteError(w, http.StatusForbidden, "Only admins can delegate on behalf of another approver")
+			return
+		}
+		delegatorID = req.DelegatorID
+	}
+
+	if req.DelegateID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Delegate is required")
+		return
+	}
+	if req.DelegateID == delegatorID {
+		utils.WriteError(w, http.StatusBadRequest, "Cannot delegate to yourself")
+		return
+	}
+
+	start, err := time.Parse(delegationDateLayout, req.StartDate)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD")
+		return
+	}
+	end, err := time.Parse(delegationDateLayout, req.EndDate)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid end date, expected YYYY-MM-DD")
+		return
+	}
+	if end.Before(start) {
+		utils.WriteError(w, http.StatusBadRequest, "End date cannot be before start date")
+		return
+	}
+
+	var delegator, delegate models.User
+	if err := h.DB.First(&delegator, delegatorID).Error; err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Delegator not found")
+		return
+	}
+	if err := h.DB.First(&delegate, req.DelegateID).Error; err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Delegate not found")
+		return
+	}
+
+	delegation := models.ApproverDelegation{
+		DelegatorID: delegator.ID,
+		DelegateID:  delegate.ID,
+		StartDate:   start,
+		// The end date is inclusive, so the delegation runs to the end of it
+		EndDate: end.Add(24*time.Hour - time.Nanosecond),
+		Reason:  req.Reason,
+	}
+
+	if err := h.DB.Create(&delegation).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create delegation")
+		return
+	}
+
+	delegation.Delegator = delegator
+	delegation.Delegate = delegate
+	utils.WriteSuccess(w, delegation, "Delegation created successfully")
+}
+
+func (h *DelegationHandler) DeleteDelegation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	delegationID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid delegation ID")
+		return
+	}
+
+	var delegation models.ApproverDelegation
+	if err := h.DB.First(&delegation, delegationID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Delegation not found")
+		return
+	}
+
+	if delegation.DelegatorID != user.ID && user.Role != models.RoleAdmin {
+		utils.WriteError(w, http.StatusForbidden, "Only the delegating approver can remove this delegation")
+		return
+	}
+
+	if err := h.DB.Delete(&delegation).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete delegation")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Delegation deleted successfully")
+}
+
+// GetPendingApprovals lists the claims whose current approval step the user
+// can act on, including steps of approvers who have delegated to them.
+func (h *DelegationHandler) GetPendingApprovals(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	delegators, err := h.Engine.Delegators(user)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve delegations")
+		return
+	}
+
+	var claims []models.Claim
+	if err := h.DB.Preload("User").Preload("ClaimType").Preload("Violations").Preload("Duplicates").
+		Where("status IN ? AND user_id <> ?", pendingStatuses, user.ID).
+		Order("created_at ASC").
+		Find(&claims).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claims")
+		return
+	}
+
+	progresses, err := h.Engine.Progresses(claims)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to build approval workflow")
+		return
+	}
+
+	pending := []PendingApproval{}
+	for i := range claims {
+		progress := progresses[claims[i].ID]
+		if progress.Current == nil {
+			continue
+		}
+
+		onBehalfOf, ok := h.Engine.ActingFor(progress.Current, user, delegators)
+		if !ok || (onBehalfOf != nil && onBehalfOf.ID == claims[i].UserID) {
+			continue
+		}
+
+		pending = append(pending, PendingApproval{
+			Claim:      claims[i],
+			Level:      *progress.Current,
+			OnBehalfOf: onBehalfOf,
+		})
+	}
+
+	utils.WriteSuccess(w, pending)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"hrcs/backend/journal"
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// JournalHandler exports paid claims to accounting systems as general
+// ledger journal entries, by fiscal period.
+type JournalHandler struct {
+	DB       *gorm.DB
+	Exporter *journal.Exporter
+}
+
+type CreateJournalExportRequest struct {
+	FiscalPeriodID uint `json:"fiscal_period_id"`
+}
+
+func NewJournalHandler(db *gorm.DB, settings journal.Settings, baseCurrency string) *JournalHandler {
+	return &JournalHandler{DB: db, Exporter: journal.NewExporter(db, settings, baseCurrency)}
+}
+
+// GetJournalExports lists journal exports, newest first, optionally of one
+// ?fiscal_period_id.
+func (h *JournalHandler) GetJournalExports(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Preload("FiscalPeriod").Preload("CreatedBy")
+	if value := r.URL.Query().Get("fiscal_period_id"); value != "" {
+		periodID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid fiscal_period_id")
+			return
+		}
+		query = query.Where("fiscal_period_id = ?", periodID)
+	}
+
+	var exports []models.JournalExport
+	if err := query.Order("created_at DESC").Find(&exports).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve journal exports")
+		return
+	}
+
+	utils.WriteSuccess(w, exports)
+}
+
+// GetPendingJournal previews the entries of the claims paid in a
+// ?fiscal_period_id that haven't been exported yet.
+func (h *JournalHandler) GetPendingJournal(w http.ResponseWriter, r *http.Request) {
+	periodID, err := strconv.Atoi(r.URL.Query().Get("fiscal_period_id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "fiscal_period_id is required")
+		return
+	}
+	period, ok := h.period(w, uint(periodID))
+	if !ok {
+		return
+	}
+
+	entries, err := h.Exporter.Pending(period)
+	if err != nil {
+		writeJournalError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, entries)
+}
+
+// CreateJournalExport books the claims paid in a fiscal period that
+// haven't been exported, marking them exported.
+func (h *JournalHandler) CreateJournalExport(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var req CreateJournalExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	period, ok := h.period(w, req.FiscalPeriodID)
+	if !ok {
+		return
+	}
+
+	export, err := h.Exporter.Export(period, user)
+	if err != nil {
+		writeJournalError(w, err)
+		return
+	}
+	export.FiscalPeriod = period
+
+	utils.WriteSuccess(w, export, "Journal export created successfully")
+}
+
+// DownloadJournalExport downloads an export's entries in the
+// ?format=csv, iif or xero.
+func (h *JournalHandler) DownloadJournalExport(w http.ResponseWriter, r *http.Request) {
+	format, err := journal.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	exportID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid journal export ID")
+		return
+	}
+
+	var export models.JournalExport
+	if err := h.DB.Preload("FiscalPeriod").First(&export, exportID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Journal export not found")
+		return
+	}
+
+	entries, err := h.Exporter.Entries(&export)
+	if err != nil {
+		writeJournalError(w, err)
+		return
+	}
+
+	var file bytes.Buffer
+	if err := journal.Write(&file, format, entries, h.Exporter.Settings); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to write journal export")
+		return
+	}
+
+	name := fmt.Sprintf("journal-%d", export.ID)
+	if export.FiscalPeriod != nil {
+		name = fmt.Sprintf("journal-%s-%d", export.FiscalPeriod.Name, export.ID)
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(file.Len()))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format.Extension()}))
+	w.Write(file.Bytes())
+}
+
+// period loads a fiscal period, writing the error response if it can't.
+func (h *JournalHandler) period(w http.ResponseWriter, periodID uint) (*models.FiscalPeriod, bool) {
+	var period models.FiscalPeriod
+	if err := h.DB.First(&period, periodID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Fiscal period not found")
+		return nil, false
+	}
+	return &period, true
+}
+
+// writeJournalError maps journal export errors to responses.
+func writeJournalError(w http.ResponseWriter, err error) {
+	var missingErr *journal.MissingAccountError
+	switch {
+	case errors.As(err, &missingErr):
+		utils.WriteErrorDetails(w, http.StatusUnprocessableEntity, "MISSING_GL_ACCOUNT", missingErr.Error(), missingErr.ClaimTypes)
+	case errors.Is(err, journal.ErrNothingToExport):
+		utils.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to build journal entries")
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/config"
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+	"hrcs/backend/payment"
+	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentHandler lets finance pay approved claims in batches: moving them
+// to payment-in-progress together, exporting the bank file that pays
+// them, and marking them paid once the bank has.
+type PaymentHandler struct {
+	DB     *gorm.DB
+	Engine *workflow.Engine
+	// Payees resolves the accounts employees are paid into
+	Payees     payment.PayeeResolver
+	Originator payment.Originator
+}
+
+type CreatePaymentBatchRequest struct {
+	ClaimIDs      []uint `json:"claim_ids"`
+	ExecutionDate string `json:"execution_date"` // YYYY-MM-DD, defaults to today
+	Notes         string `json:"notes"`
+}
+
+// SettlePaymentBatchRequest confirms the bank paid a batch, optionally
+// with the bank's reference for the payment run.
+type SettlePaymentBatchRequest struct {
+	Reference string `json:"reference"`
+	Comments  string `json:"comments"`
+}
+
+func NewPaymentHandler(db *gorm.DB, cfg *config.Config, payees payment.PayeeResolver) *PaymentHandler {
+	return &PaymentHandler{
+		DB:     db,
+		Engine: workflow.NewEngine(db),
+		Payees: payees,
+		Originator: payment.Originator{
+			Name:          cfg.PaymentCompanyName,
+			CompanyID:     cfg.PaymentCompanyID,
+			BankName:      cfg.PaymentBankName,
+			RoutingNumber: cfg.PaymentRoutingNumber,
+			IBAN:          cfg.PaymentIBAN,
+			BIC:           cfg.PaymentBIC,
+		},
+	}
+}
+
+// GetPaymentBatches lists payment batches, newest first, optionally in one
+// ?status.
+func (h *PaymentHandler) GetPaymentBatches(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Preload("CreatedBy")
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var batches []models.PaymentBatch
+	if err := query.Order("created_at DESC").Find(&batches).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve payment batches")
+		return
+	}
+
+	utils.WriteSuccess(w, batches)
+}
+
+// GetPaymentBatch returns a payment batch with its claims and claimants.
+func (h *PaymentHandler) GetPaymentBatch(w http.ResponseWriter, r *http.Request) {
+	batch, ok := h.loadBatch(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteSuccess(w, batch)
+}
+
+// CreatePaymentBatch puts approved claims in one currency into a new
+// payment batch, moving all of them to payment-in-progress or none.
+func (h *PaymentHandler) CreatePaymentBatch(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var req CreatePaymentBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ids := []uint{}
+	seen := map[uint]bool{}
+	for _, id := range req.ClaimIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "At least one claim is required")
+		return
+	}
+
+	executionDate := time.Now().Truncate(24 * time.Hour)
+	if req.ExecutionDate != "" {
+		var err error
+		if executionDate, err = time.Parse("2006-01-02", req.ExecutionDate); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid execution_date, expected YYYY-MM-DD")
+			return
+		}
+	}
+
+	var claims []models.Claim
+	if err := h.DB.Where("id IN ?", ids).Order("id").Find(&claims).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve claims")
+		return
+	}
+	if len(claims) != len(ids) {
+		utils.WriteError(w, http.StatusNotFound, "Some claims were not found")
+		return
+	}
+	for _, claim := range claims {
+		if claim.Status != models.StatusApproved || claim.PaymentBatchID != nil {
+			utils.WriteError(w, http.StatusConflict, fmt.Sprintf("Claim %d is not approved and awaiting payment", claim.ID))
+			return
+		}
+		if claim.Currency != claims[0].Currency {
+			utils.WriteError(w, http.StatusBadRequest, "Claims in a payment batch must all be reimbursed in the same currency")
+			return
+		}
+	}
+
+	batch := models.PaymentBatch{
+		Currency:      claims[0].Currency,
+		ExecutionDate: executionDate,
+		Status:        models.BatchInProgress,
+		Notes:         strings.TrimSpace(req.Notes),
+		CreatedByID:   user.ID,
+	}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		batch.Reference = fmt.Sprintf("PB-%06d", batch.ID)
+
+		// Lock the claims so that another batch can't take them meanwhile;
+		// the transition refuses any no longer approved
+		var locked []models.Claim
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&locked).Error; err != nil {
+			return err
+		}
+		engine := h.Engine.WithDB(tx)
+		total := money.Zero
+		for i := range locked {
+			claim := &locked[i]
+			claim.PaymentBatchID = &batch.ID
+			if _, err := engine.Transition(claim, models.ActionStartPayment, user, workflow.Note{Comments: "Payment batch " + batch.Reference}); err != nil {
+				return err
+			}
+			total = total.Add(claim.ReimbursableAmount)
+		}
+		batch.Total = total
+		batch.ClaimCount = len(locked)
+		return tx.Save(&batch).Error
+	})
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, batch, "Payment batch created successfully")
+}
+
+// ExportPaymentBatch downloads the bank file paying a batch, in the
+// ?format=nacha or sepa.
+func (h *PaymentHandler) ExportPaymentBatch(w http.ResponseWriter, r *http.Request) {
+	format, err := payment.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	batch, ok := h.loadBatch(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := payment.Items(batch, format, h.Payees)
+	var missingErr *payment.MissingPayeeError
+	if errors.As(err, &missingErr) {
+		utils.WriteErrorDetails(w, http.StatusUnprocessableEntity, "MISSING_PAYOUT_DETAILS", "Some employees in the batch have no payout account on file", missingErr.Payees)
+		return
+	}
+	if err != nil {
+		writePayoutError(w, err, "Failed to resolve payout accounts")
+		return
+	}
+	if len(items) == 0 {
+		utils.WriteError(w, http.StatusUnprocessableEntity, "Payment batch has nothing to pay")
+		return
+	}
+
+	now := time.Now()
+	var file bytes.Buffer
+	if err := payment.Write(&file, format, h.Originator, batch, items, now); err != nil {
+		utils.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err := h.DB.Model(batch).Update("exported_at", now).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to export payment batch")
+		return
+	}
+
+	contentType := "text/plain; charset=us-ascii"
+	if format == payment.FormatSEPA {
+		contentType = "application/xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(file.Len()))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": batch.Reference + "." + format.Extension()}))
+	w.Write(file.Bytes())
+}
+
+// SettlePaymentBatch records that the bank paid a batch, moving every
+// claim in it to paid under its payment reference.
+func (h *PaymentHandler) SettlePaymentBatch(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	batchID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payment batch ID")
+		return
+	}
+
+	var req SettlePaymentBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var batch models.PaymentBatch
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&batch, batchID).Error; err != nil {
+			return err
+		}
+		if batch.Status == models.BatchSettled {
+			return errBatchSettled
+		}
+
+		var claims []models.Claim
+		if err := tx.Where("payment_batch_id = ?", batch.ID).Order("id").Find(&claims).Error; err != nil {
+			return err
+		}
+		engine := h.Engine.WithDB(tx)
+		for i := range claims {
+			claim := &claims[i]
+			// A claim already marked paid on its own keeps its reference
+			if claim.Status == models.StatusPaid {
+				continue
+			}
+			claim.PaymentReference = payment.Reference(&batch, claim)
+			if _, err := engine.Transition(claim, models.ActionMarkPaid, user, workflow.Note{Comments: req.Comments}); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		batch.Status = models.BatchSettled
+		batch.BankReference = strings.TrimSpace(req.Reference)
+		batch.SettledAt = &now
+		batch.SettledByID = &user.ID
+		return tx.Save(&batch).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		utils.WriteError(w, http.StatusNotFound, "Payment batch not found")
+		return
+	}
+	if err == errBatchSettled {
+		utils.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeWorkflowError(w, err)
+		return
+	}
+
+	utils.WriteSuccess(w, batch, "Payment batch settled successfully")
+}
+
+var errBatchSettled = errors.New("Payment batch is already settled")
+
+// loadBatch loads the batch in the URL with its claims and claimants,
+// writing the error response if it can't.
+func (h *PaymentHandler) loadBatch(w http.ResponseWriter, r *http.Request) (*models.PaymentBatch, bool) {
+	batchID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid payment batch ID")
+		return nil, false
+	}
+
+	var batch models.PaymentBatch
+	if err := h.DB.Preload("CreatedBy").Preload("Claims", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Claims.User").First(&batch, batchID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.WriteError(w, http.StatusNotFound, "Payment batch not found")
+		} else {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve payment batch")
+		}
+		return nil, false
+	}
+	return &batch, true
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"hrcs/backend/middleware"
+	"hrcs/backend/models"
+	"hrcs/backend/payout"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// PayoutHandler manages the bank accounts employees are reimbursed into.
+// Employees keep their own; admins can set them for employees and, when
+// verification is required, verify changed ones before they are paid into.
+// Account identifiers are only ever returned masked.
+type PayoutHandler struct {
+	DB       *gorm.DB
+	Accounts *payout.Accounts
+}
+
+func NewPayoutHandler(db *gorm.DB, accounts *payout.Accounts) *PayoutHandler {
+	return &PayoutHandler{DB: db, Accounts: accounts}
+}
+
+// GetPayoutAccount returns the user's payout account.
+func (h *PayoutHandler) GetPayoutAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	h.get(w, user.ID)
+}
+
+// UpdatePayoutAccount sets the user's payout account.
+func (h *PayoutHandler) UpdatePayoutAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	h.save(w, r, user.ID)
+}
+
+// DeletePayoutAccount removes the user's payout account.
+func (h *PayoutHandler) DeletePayoutAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	h.remove(w, user.ID, user)
+}
+
+// GetPayoutAccountChanges returns the audit trail of the user's payout
+// account.
+func (h *PayoutHandler) GetPayoutAccountChanges(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	h.changes(w, user.ID)
+}
+
+// GetPayoutAccounts lists every employee's payout account for admins, or
+// only those awaiting verification with ?pending=true.
+func (h *PayoutHandler) GetPayoutAccounts(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.Preload("User").Preload("VerifiedBy")
+	if pending, err := strconv.ParseBool(r.URL.Query().Get("pending")); err == nil {
+		query = query.Where("pending_verification = ?", pending)
+	}
+
+	var accounts []models.PayoutAccount
+	if err := query.Order("updated_at DESC").Find(&accounts).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve payout accounts")
+		return
+	}
+
+	utils.WriteSuccess(w, accounts)
+}
+
+// GetUserPayoutAccount returns an employee's payout account.
+func (h *PayoutHandler) GetUserPayoutAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userParam(w, r)
+	if !ok {
+		return
+	}
+	h.get(w, userID)
+}
+
+// UpdateUserPayoutAccount sets an employee's payout account on their
+// behalf.
+func (h *PayoutHandler) UpdateUserPayoutAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userParam(w, r)
+	if !ok {
+		return
+	}
+	h.save(w, r, userID)
+}
+
+// DeleteUserPayoutAccount removes an employee's payout account.
+func (h *PayoutHandler) DeleteUserPayoutAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userParam(w, r)
+	if !ok {
+		return
+	}
+	h.remove(w, userID, middleware.GetUserFromContext(r.Context()))
+}
+
+// GetUserPayoutAccountChanges returns the audit trail of an employee's
+// payout account.
+func (h *PayoutHandler) GetUserPayoutAccountChanges(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.userParam(w, r)
+	if !ok {
+		return
+	}
+	h.changes(w, userID)
+}
+
+// VerifyPayoutAccount confirms an employee's changed payout account so that
+// payment files can pay into it.
+func (h *PayoutHandler) VerifyPayoutAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+	userID, ok := h.userParam(w, r)
+	if !ok {
+		return
+	}
+
+	account, err := h.Accounts.Verify(userID, user)
+	if err != nil {
+		writePayoutError(w, err, "Failed to verify payout account")
+		return
+	}
+
+	utils.WriteSuccess(w, account, "Payout account verified successfully")
+}
+
+func (h *PayoutHandler) get(w http.ResponseWriter, userID uint) {
+	account, err := h.Accounts.Get(userID)
+	if err != nil {
+		writePayoutError(w, err, "Failed to retrieve payout account")
+		return
+	}
+
+	utils.WriteSuccess(w, account)
+}
+
+func (h *PayoutHandler) save(w http.ResponseWriter, r *http.Request, userID uint) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	var details payout.Details
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := details.Normalize(); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	account, err := h.Accounts.Save(userID, details, user)
+	if err != nil {
+		writePayoutError(w, err, "Failed to save payout account")
+		return
+	}
+
+	message := "Payout account saved successfully"
+	if account.PendingVerification {
+		message += "; it will be paid into once an admin verifies it"
+	}
+	utils.WriteSuccess(w, account, message)
+}
+
+func (h *PayoutHandler) remove(w http.ResponseWriter, userID uint, actor *models.User) {
+	if err := h.Accounts.Remove(userID, actor); err != nil {
+		writePayoutError(w, err, "Failed to remove payout account")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Payout account removed successfully")
+}
+
+func (h *PayoutHandler) changes(w http.ResponseWriter, userID uint) {
+	changes, err := h.Accounts.Changes(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve payout account changes")
+		return
+	}
+
+	utils.WriteSuccess(w, changes)
+}
+
+// userParam reads the employee in the URL, writing the error response if
+// there is none.
+func (h *PayoutHandler) userParam(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "User not found")
+		return 0, false
+	}
+	return user.ID, true
+}
+
+// writePayoutError maps payout account errors to responses, falling back
+// to a 500 with message.
+func writePayoutError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.WriteError(w, http.StatusNotFound, "No payout account on file")
+	case errors.Is(err, payout.ErrSelfVerification):
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, payout.ErrNoKey):
+		utils.WriteError(w, http.StatusServiceUnavailable, "Payout accounts are unavailable until an encryption key is configured")
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, message)
+	}
+}
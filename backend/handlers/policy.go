@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hrcs/backend/models"
+	"hrcs/backend/policy"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type PolicyRuleHandler struct {
+	DB *gorm.DB
+}
+
+// PolicyRuleRequest defines an expense policy rule. When and Assert are
+// either an expression string or a JSON condition such as
+// {"field": "line.amount", "op": "<=", "value": 250}.
+type PolicyRuleRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Scope       string          `json:"scope"`    // "line" (default), "day" or "claim"
+	When        json.RawMessage `json:"when"`     // optional
+	Assert      json.RawMessage `json:"assert"`   // required
+	Severity    string          `json:"severity"` // "block" (default), "warn" or "justify"
+	Message     string          `json:"message"`
+	Active      *bool           `json:"active"`
+}
+
+func NewPolicyRuleHandler(db *gorm.DB) *PolicyRuleHandler {
+	return &PolicyRuleHandler{DB: db}
+}
+
+func (h *PolicyRuleHandler) GetPolicyRules(w http.ResponseWriter, r *http.Request) {
+	var rules []models.PolicyRule
+	if err := h.DB.Order("id").Find(&rules).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve policy rules")
+		return
+	}
+
+	utils.WriteSuccess(w, rules)
+}
+
+func (h *PolicyRuleHandler) CreatePolicyRule(w http.ResponseWriter, r *http.Request) {
+	var req PolicyRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rule := models.PolicyRule{Active: true}
+	if err := h.apply(&rule, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create policy rule")
+		return
+	}
+
+	utils.WriteSuccess(w, rule, "Policy rule created successfully")
+}
+
+func (h *PolicyRuleHandler) UpdatePolicyRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid policy rule ID")
+		return
+	}
+
+	var rule models.PolicyRule
+	if err := h.DB.First(&rule, ruleID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Policy rule not found")
+		return
+	}
+
+	var req PolicyRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.apply(&rule, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Save(&rule).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update policy rule")
+		return
+	}
+
+	utils.WriteSuccess(w, rule, "Policy rule updated successfully")
+}
+
+// DeletePolicyRule removes a rule. Violations already recorded keep the
+// rule's name.
+func (h *PolicyRuleHandler) DeletePolicyRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid policy rule ID")
+		return
+	}
+
+	result := h.DB.Delete(&models.PolicyRule{}, ruleID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete policy rule")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, "Policy rule not found")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Policy rule deleted successfully")
+}
+
+// apply validates a policy rule request onto the stored rule.
+func (h *PolicyRuleHandler) apply(rule *models.PolicyRule, req *PolicyRuleRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("Policy rule name is required")
+	}
+
+	when, err := expression(req.When)
+	if err != nil {
+		return fmt.Errorf("Invalid when condition: %v", err)
+	}
+	assert, err := expression(req.Assert)
+	if err != nil {
+		return fmt.Errorf("Invalid assert condition: %v", err)
+	}
+
+	candidate := *rule
+	candidate.Name = strings.TrimSpace(req.Name)
+	candidate.Description = req.Description
+	candidate.Scope = models.PolicyScope(req.Scope)
+	if candidate.Scope == "" {
+		candidate.Scope = models.PolicyScopeLine
+	}
+	candidate.When = when
+	candidate.Assert = assert
+	candidate.Severity = models.PolicySeverity(req.Severity)
+	if candidate.Severity == "" {
+		candidate.Severity = models.SeverityBlock
+	}
+	candidate.Message = strings.TrimSpace(req.Message)
+	if req.Active != nil {
+		candidate.Active = *req.Active
+	}
+
+	if err := policy.Validate(&candidate); err != nil {
+		return fmt.Errorf("Invalid policy rule: %v", err)
+	}
+	*rule = candidate
+	return nil
+}
+
+// expression reads a condition given either in the expression language or
+// as a JSON condition, and returns it as an expression.
+func expression(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(text), nil
+	}
+
+	var condition policy.Condition
+	if err := json.Unmarshal(raw, &condition); err != nil {
+		return "", fmt.Errorf("expected an expression or a JSON condition")
+	}
+	return condition.Expression()
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/calculator"
+	"hrcs/backend/currency"
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// RateTableHandler manages the mileage and per-diem rates calculated claim
+// types are priced from. Rates are versioned by their effective date and
+// never edited: a new rate is a new version, and claims keep a copy of the
+// version they were calculated with.
+type RateTableHandler struct {
+	DB *gorm.DB
+}
+
+type MileageRateRequest struct {
+	VehicleClass  string        `json:"vehicle_class"`
+	Unit          string        `json:"unit"` // "km" (default) or "mi"
+	Currency      string        `json:"currency"`
+	Rate          money.Decimal `json:"rate"`
+	EffectiveFrom string        `json:"effective_from"` // YYYY-MM-DD
+}
+
+type PerDiemRateRequest struct {
+	Destination        string        `json:"destination"`
+	Currency           string        `json:"currency"`
+	DailyRate          money.Decimal `json:"daily_rate"`
+	BreakfastDeduction money.Decimal `json:"breakfast_deduction"`
+	LunchDeduction     money.Decimal `json:"lunch_deduction"`
+	DinnerDeduction    money.Decimal `json:"dinner_deduction"`
+	EffectiveFrom      string        `json:"effective_from"` // YYYY-MM-DD
+}
+
+func NewRateTableHandler(db *gorm.DB) *RateTableHandler {
+	return &RateTableHandler{DB: db}
+}
+
+// GetMileageRates lists mileage rates by vehicle class, newest version
+// first. With ?on=YYYY-MM-DD only the version in effect that day is listed
+// for each class.
+func (h *RateTableHandler) GetMileageRates(w http.ResponseWriter, r *http.Request) {
+	on, ok := effectiveOn(w, r)
+	if !ok {
+		return
+	}
+
+	var rates []models.MileageRate
+	if err := h.DB.Order("vehicle_class, effective_from DESC").Find(&rates).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve mileage rates")
+		return
+	}
+
+	if on != nil {
+		current := []models.MileageRate{}
+		for _, rate := range rates {
+			if !rate.EffectiveFrom.After(*on) && (len(current) == 0 || current[len(current)-1].VehicleClass != rate.VehicleClass) {
+				current = append(current, rate)
+			}
+		}
+		rates = current
+	}
+
+	utils.WriteSuccess(w, rates)
+}
+
+// CreateMileageRate adds a version of a vehicle class's rate.
+func (h *RateTableHandler) CreateMileageRate(w http.ResponseWriter, r *http.Request) {
+	var req MileageRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rate := models.MileageRate{
+		VehicleClass: strings.ToLower(strings.TrimSpace(req.VehicleClass)),
+		Unit:         strings.ToLower(strings.TrimSpace(req.Unit)),
+		Rate:         req.Rate,
+	}
+	if rate.Unit == "" {
+		rate.Unit = "km"
+	}
+	var err error
+	switch {
+	case rate.VehicleClass == "":
+		err = errors.New("Vehicle class is required")
+	case rate.Unit != "km" && rate.Unit != "mi":
+		err = errors.New("Unit must be km or mi")
+	case rate.Rate.Sign() <= 0:
+		err = errors.New("Rate must be greater than zero")
+	}
+	if err == nil {
+		rate.Currency, rate.EffectiveFrom, err = rateVersion(req.Currency, req.EffectiveFrom)
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var existing int64
+	h.DB.Model(&models.MileageRate{}).Where("vehicle_class = ? AND effective_from = ?", rate.VehicleClass, rate.EffectiveFrom).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("A %s rate already takes effect on %s", rate.VehicleClass, req.EffectiveFrom))
+		return
+	}
+
+	if err := h.DB.Create(&rate).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create mileage rate")
+		return
+	}
+
+	utils.WriteSuccess(w, rate, "Mileage rate created successfully")
+}
+
+// DeleteMileageRate removes a rate version. Claims calculated with it keep
+// their copy.
+func (h *RateTableHandler) DeleteMileageRate(w http.ResponseWriter, r *http.Request) {
+	h.deleteRate(w, r, &models.MileageRate{}, "Mileage rate")
+}
+
+// GetPerDiemRates lists per-diem rates by destination, newest version
+// first. With ?on=YYYY-MM-DD only the version in effect that day is listed
+// for each destination.
+func (h *RateTableHandler) GetPerDiemRates(w http.ResponseWriter, r *http.Request) {
+	on, ok := effectiveOn(w, r)
+	if !ok {
+		return
+	}
+
+	var rates []models.PerDiemRate
+	if err := h.DB.Order("destination, effective_from DESC").Find(&rates).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve per-diem rates")
+		return
+	}
+
+	if on != nil {
+		current := []models.PerDiemRate{}
+		for _, rate := range rates {
+			if !rate.EffectiveFrom.After(*on) && (len(current) == 0 || current[len(current)-1].Destination != rate.Destination) {
+				current = append(current, rate)
+			}
+		}
+		rates = current
+	}
+
+	utils.WriteSuccess(w, rates)
+}
+
+// CreatePerDiemRate adds a version of a destination's rate; destination
+// "*" is the rate for destinations without one of their own.
+func (h *RateTableHandler) CreatePerDiemRate(w http.ResponseWriter, r *http.Request) {
+	var req PerDiemRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rate := models.PerDiemRate{
+		Destination:        strings.ToUpper(strings.TrimSpace(req.Destination)),
+		DailyRate:          req.DailyRate,
+		BreakfastDeduction: req.BreakfastDeduction,
+		LunchDeduction:     req.LunchDeduction,
+		DinnerDeduction:    req.DinnerDeduction,
+	}
+	var err error
+	switch {
+	case rate.Destination == "":
+		err = fmt.Errorf("Destination is required; use %s for the default rate", calculator.AnyDestination)
+	case rate.DailyRate.Sign() <= 0:
+		err = errors.New("Daily rate must be greater than zero")
+	case rate.BreakfastDeduction.Sign() < 0 || rate.LunchDeduction.Sign() < 0 || rate.DinnerDeduction.Sign() < 0:
+		err = errors.New("Meal deductions cannot be negative")
+	}
+	if err == nil {
+		rate.Currency, rate.EffectiveFrom, err = rateVersion(req.Currency, req.EffectiveFrom)
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var existing int64
+	h.DB.Model(&models.PerDiemRate{}).Where("destination = ? AND effective_from = ?", rate.Destination, rate.EffectiveFrom).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("A %s rate already takes effect on %s", rate.Destination, req.EffectiveFrom))
+		return
+	}
+
+	if err := h.DB.Create(&rate).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create per-diem rate")
+		return
+	}
+
+	utils.WriteSuccess(w, rate, "Per-diem rate created successfully")
+}
+
+// DeletePerDiemRate removes a rate version. Claims calculated with it keep
+// their copy.
+func (h *RateTableHandler) DeletePerDiemRate(w http.ResponseWriter, r *http.Request) {
+	h.deleteRate(w, r, &models.PerDiemRate{}, "Per-diem rate")
+}
+
+func (h *RateTableHandler) deleteRate(w http.ResponseWriter, r *http.Request, model interface{}, name string) {
+	rateID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s ID", strings.ToLower(name)))
+		return
+	}
+
+	result := h.DB.Delete(model, rateID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete %s", strings.ToLower(name)))
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, name+" not found")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, name+" deleted successfully")
+}
+
+// rateVersion validates the currency and effective date of a new rate.
+func rateVersion(code, effectiveFrom string) (string, time.Time, error) {
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return "", time.Time{}, errors.New("Invalid currency code")
+	}
+	date, err := time.Parse("2006-01-02", effectiveFrom)
+	if err != nil {
+		return "", time.Time{}, errors.New("Invalid effective date, expected YYYY-MM-DD")
+	}
+	return code, date, nil
+}
+
+// effectiveOn reads the optional ?on date of a rate listing.
+func effectiveOn(w http.ResponseWriter, r *http.Request) (*time.Time, bool) {
+	value := r.URL.Query().Get("on")
+	if value == "" {
+		return nil, true
+	}
+	on, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid on date, expected YYYY-MM-DD")
+		return nil, false
+	}
+	return &on, true
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hrcs/backend/models"
+	"hrcs/backend/utils"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type ReasonCodeHandler struct {
+	DB *gorm.DB
+}
+
+type ReasonCodeRequest struct {
+	Code             string `json:"code"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	Kind             string `json:"kind"` // "reject", "return" or "both"
+	RequiresComments bool   `json:"requiresComments"`
+	Active           *bool  `json:"active"`
+}
+
+func NewReasonCodeHandler(db *gorm.DB) *ReasonCodeHandler {
+	return &ReasonCodeHandler{DB: db}
+}
+
+// GetReasonCodes lists the active codes approvers can choose from,
+// optionally only those for ?action=reject or ?action=return.
+func (h *ReasonCodeHandler) GetReasonCodes(w http.ResponseWriter, r *http.Request) {
+	var reasonCodes []models.ReasonCode
+	if err := h.DB.Where("active = ?", true).Order("name").Find(&reasonCodes).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve reason codes")
+		return
+	}
+
+	if action := models.ClaimAction(r.URL.Query().Get("action")); action != "" {
+		applicable := []models.ReasonCode{}
+		for _, reasonCode := range reasonCodes {
+			if reasonCode.AppliesTo(action) {
+				applicable = append(applicable, reasonCode)
+			}
+		}
+		reasonCodes = applicable
+	}
+
+	utils.WriteSuccess(w, reasonCodes)
+}
+
+// GetAllReasonCodes lists the whole catalogue, inactive codes included.
+func (h *ReasonCodeHandler) GetAllReasonCodes(w http.ResponseWriter, r *http.Request) {
+	var reasonCodes []models.ReasonCode
+	if err := h.DB.Order("code").Find(&reasonCodes).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve reason codes")
+		return
+	}
+
+	utils.WriteSuccess(w, reasonCodes)
+}
+
+func (h *ReasonCodeHandler) CreateReasonCode(w http.ResponseWriter, r *http.Request) {
+	var req ReasonCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	reasonCode := models.ReasonCode{Active: true}
+	if err := h.apply(&reasonCode, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Create(&reasonCode).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create reason code")
+		return
+	}
+
+	utils.WriteSuccess(w, reasonCode, "Reason code created successfully")
+}
+
+func (h *ReasonCodeHandler) UpdateReasonCode(w http.ResponseWriter, r *http.Request) {
+	reasonCodeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid reason code ID")
+		return
+	}
+
+	var reasonCode models.ReasonCode
+	if err := h.DB.First(&reasonCode, reasonCodeID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Reason code not found")
+		return
+	}
+
+	var req ReasonCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.apply(&reasonCode, &req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.DB.Save(&reasonCode).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update reason code")
+		return
+	}
+
+	utils.WriteSuccess(w, reasonCode, "Reason code updated successfully")
+}
+
+// DeleteReasonCode removes a code that was never used. Codes already
+// recorded against claims are deactivated instead so history keeps them.
+func (h *ReasonCodeHandler) DeleteReasonCode(w http.ResponseWriter, r *http.Request) {
+	reasonCodeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid reason code ID")
+		return
+	}
+
+	var reasonCode models.ReasonCode
+	if err := h.DB.First(&reasonCode, reasonCodeID).Error; err != nil {
+		utils.WriteError(w, http.StatusNotFound, "Reason code not found")
+		return
+	}
+
+	var used int64
+	h.DB.Model(&models.ClaimApproval{}).Where("reason_code_id = ?", reasonCode.ID).Count(&used)
+	if used > 0 {
+		if err := h.DB.Model(&reasonCode).Update("active", false).Error; err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to deactivate reason code")
+			return
+		}
+		utils.WriteSuccess(w, reasonCode, "Reason code is in use and has been deactivated")
+		return
+	}
+
+	// Removed outright so the code can be reused
+	if err := h.DB.Unscoped().Delete(&reasonCode).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to delete reason code")
+		return
+	}
+
+	utils.WriteSuccess(w, nil, "Reason code deleted successfully")
+}
+
+// apply validates a reason code request onto the stored code.
+func (h *ReasonCodeHandler) apply(reasonCode *models.ReasonCode, req *ReasonCodeRequest) error {
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+	if code == "" || strings.TrimSpace(req.Name) == "" {
+		return fmt.Errorf("Code and name are required")
+	}
+
+	kind := models.ReasonKind(req.Kind)
+	switch kind {
+	case "":
+		kind = models.ReasonKindBoth
+	case models.ReasonKindReject, models.ReasonKindReturn, models.ReasonKindBoth:
+	default:
+		return fmt.Errorf("Invalid reason kind: %s", req.Kind)
+	}
+
+	var clashes int64
+	h.DB.Model(&models.ReasonCode{}).Where("UPPER(code) = ? AND id <> ?", code, reasonCode.ID).Count(&clashes)
+	if clashes > 0 {
+		return fmt.Errorf("Reason code %s already exists", code)
+	}
+
+	reasonCode.Code = code
+	reasonCode.Name = strings.TrimSpace(req.Name)
+	reasonCode.Description = req.Description
+	reasonCode.Kind = kind
+	reasonCode.RequiresComments = req.RequiresComments
+	if req.Active != nil {
+		reasonCode.Active = *req.Active
+	}
+	return nil
+}
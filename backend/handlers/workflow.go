@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"hrcs/backend/budget"
+	"hrcs/backend/calculator"
+	"hrcs/backend/currency"
+	"hrcs/backend/duplicate"
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+	"hrcs/backend/utils"
+	"hrcs/backend/workflow"
+)
+
+// writeWorkflowError maps workflow errors onto HTTP responses: illegal and
+// out-of-order transitions, of claims or cash advances, are a 409 with
+// details, a missing or invalid reason code a 400, policy violations and
+// missing exchange, mileage or per-diem rates a 422, blocked duplicates a
+// 409 listing the claims they repeat, approvals over a blocking budget a
+// 422 listing the overruns, amounts too large to work with a 400, refused
+// guards a 403.
+func writeWorkflowError(w http.ResponseWriter, err error) {
+	var transitionErr *workflow.TransitionError
+	if errors.As(err, &transitionErr) {
+		utils.WriteErrorDetails(w, http.StatusConflict, "INVALID_TRANSITION", transitionErr.Error(), transitionErr)
+		return
+	}
+
+	var advanceErr *workflow.AdvanceTransitionError
+	if errors.As(err, &advanceErr) {
+		utils.WriteErrorDetails(w, http.StatusConflict, "INVALID_TRANSITION", advanceErr.Error(), advanceErr)
+		return
+	}
+
+	var orderErr *workflow.OutOfOrderError
+	if errors.As(err, &orderErr) {
+		utils.WriteErrorDetails(w, http.StatusConflict, "OUT_OF_ORDER", orderErr.Error(), orderErr)
+		return
+	}
+
+	var reasonErr *workflow.ReasonError
+	if errors.As(err, &reasonErr) {
+		utils.WriteErrorDetails(w, http.StatusBadRequest, "INVALID_REASON", reasonErr.Error(), reasonErr)
+		return
+	}
+
+	var policyErr *workflow.PolicyError
+	if errors.As(err, &policyErr) {
+		utils.WriteErrorDetails(w, http.StatusUnprocessableEntity, "POLICY_VIOLATION", policyErr.Error(), policyErr.Violations)
+		return
+	}
+
+	var rateErr *currency.RateError
+	if errors.As(err, &rateErr) {
+		utils.WriteErrorDetails(w, http.StatusUnprocessableEntity, "NO_EXCHANGE_RATE", rateErr.Error(), rateErr)
+		return
+	}
+
+	var calculationErr *calculator.RateError
+	if errors.As(err, &calculationErr) {
+		utils.WriteErrorDetails(w, http.StatusUnprocessableEntity, "NO_CALCULATION_RATE", err.Error(), calculationErr)
+		return
+	}
+
+	var duplicateErr *duplicate.DuplicateError
+	if errors.As(err, &duplicateErr) {
+		utils.WriteErrorDetails(w, http.StatusConflict, "DUPLICATE_CLAIM", duplicateErr.Error(), duplicateErr.Matches)
+		return
+	}
+
+	var budgetErr *budget.BudgetError
+	if errors.As(err, &budgetErr) {
+		utils.WriteErrorDetails(w, http.StatusUnprocessableEntity, "BUDGET_EXCEEDED", budgetErr.Error(), budgetErr.Overruns)
+		return
+	}
+
+	if errors.Is(err, money.ErrRange) {
+		utils.WriteError(w, http.StatusBadRequest, "Amount is too large")
+		return
+	}
+
+	var guardErr *workflow.GuardError
+	if errors.As(err, &guardErr) {
+		utils.WriteError(w, http.StatusForbidden, guardErr.Reason)
+		return
+	}
+
+	utils.WriteError(w, http.StatusInternalServerError, "Failed to update claim status")
+}
+
+// withWarnings appends the budget warnings an approval was let through with
+// to a success message.
+func withWarnings(message string, approval *models.ClaimApproval) string {
+	if approval == nil || len(approval.Warnings) == 0 {
+		return message
+	}
+	return message + ". " + strings.Join(approval.Warnings, ". ")
+}
@@ -0,0 +1,164 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"hrcs/backend/money"
+)
+
+// Format is a journal file format.
+type Format string
+
+const (
+	// FormatCSV is a generic CSV, one row per debit or credit
+	FormatCSV Format = "csv"
+	// FormatIIF is a QuickBooks Desktop import file of general journals
+	FormatIIF Format = "iif"
+	// FormatXero is Xero's manual journal CSV import
+	FormatXero Format = "xero"
+)
+
+// ParseFormat reads a format name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatCSV, FormatIIF, FormatXero:
+		return format, nil
+	}
+	return "", fmt.Errorf("Format must be %s, %s or %s", FormatCSV, FormatIIF, FormatXero)
+}
+
+// Extension returns the file extension of the format.
+func (f Format) Extension() string {
+	if f == FormatIIF {
+		return "iif"
+	}
+	return "csv"
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	if f == FormatIIF {
+		return "text/plain; charset=utf-8"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Write writes entries in a format.
+func Write(w io.Writer, format Format, entries []Entry, settings Settings) error {
+	switch format {
+	case FormatIIF:
+		return WriteIIF(w, entries)
+	case FormatXero:
+		return WriteXero(w, entries, settings.XeroTaxRate)
+	default:
+		return WriteCSV(w, entries)
+	}
+}
+
+// WriteCSV writes entries as a generic CSV with a header row.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "reference", "claim_id", "employee", "account", "description", "cost_center", "project", "debit", "credit", "currency"})
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			out.Write([]string{
+				entry.Date.Format("2006-01-02"),
+				entry.Reference,
+				fmt.Sprint(entry.ClaimID),
+				entry.Employee,
+				line.Account,
+				line.Description,
+				line.CostCenter,
+				line.Project,
+				amount(line.Debit, entry.Currency),
+				amount(line.Credit, entry.Currency),
+				entry.Currency,
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteIIF writes entries as QuickBooks general journal transactions, one
+// per entry, with debits positive and credits negative. Cost centers are
+// written as QuickBooks classes.
+func WriteIIF(w io.Writer, entries []Entry) error {
+	out := bufio.NewWriter(w)
+	row := func(fields ...string) {
+		out.WriteString(strings.Join(fields, "\t"))
+		out.WriteString("\r\n")
+	}
+	row("!TRNS", "TRNSID", "TRNSTYPE", "DATE", "ACCNT", "CLASS", "AMOUNT", "DOCNUM", "MEMO")
+	row("!SPL", "SPLID", "TRNSTYPE", "DATE", "ACCNT", "CLASS", "AMOUNT", "DOCNUM", "MEMO")
+	row("!ENDTRNS")
+	for _, entry := range entries {
+		if len(entry.Lines) == 0 {
+			continue
+		}
+		for i, line := range entry.Lines {
+			kind := "SPL"
+			if i == 0 {
+				kind = "TRNS"
+			}
+			row(kind, "", "GENERAL JOURNAL",
+				entry.Date.Format("01/02/2006"),
+				iifText(line.Account),
+				iifText(line.CostCenter),
+				amount(line.Debit.Sub(line.Credit), entry.Currency),
+				iifText(entry.Reference),
+				iifText(line.Description))
+		}
+		row("ENDTRNS")
+	}
+	return out.Flush()
+}
+
+// WriteXero writes entries in Xero's manual journal import template, one
+// journal per entry, with debits positive and credits negative. Cost
+// centers and projects are written as the tracking categories "Cost
+// Center" and "Project".
+func WriteXero(w io.Writer, entries []Entry, taxRate string) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"*Narration", "*Date", "Description", "*AccountCode", "*TaxRate", "*Amount", "TrackingName1", "TrackingOption1", "TrackingName2", "TrackingOption2"})
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			record := []string{
+				entry.Narration,
+				entry.Date.Format("02/01/2006"),
+				line.Description,
+				line.Account,
+				taxRate,
+				amount(line.Debit.Sub(line.Credit), entry.Currency),
+				"", "", "", "",
+			}
+			if line.CostCenter != "" {
+				record[6], record[7] = "Cost Center", line.CostCenter
+			}
+			if line.Project != "" {
+				record[8], record[9] = "Project", line.Project
+			}
+			out.Write(record)
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// amount writes an amount to the minor unit of its currency, leaving
+// zero blank.
+func amount(value money.Decimal, currency string) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.StringFixed(money.MinorUnits(currency))
+}
+
+// iifText keeps a field from breaking the tab-separated rows.
+func iifText(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ", `"`, "'").Replace(s)
+}
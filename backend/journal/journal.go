@@ -0,0 +1,331 @@
+// Package journal books paid claims to the general ledger as double-entry
+// journal entries, and writes them in the formats accounting systems
+// import.
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+	"hrcs/backend/workflow"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Settings are the ledger accounts claims are credited to.
+type Settings struct {
+	// ReimbursementAccount is the payables or clearing account what is
+	// reimbursed to employees is credited to
+	ReimbursementAccount string
+	// CardAccount is credited with expenses paid by corporate card
+	CardAccount string
+	// AdvanceAccount is credited with what claims settle of cash advances
+	AdvanceAccount string
+	// XeroTaxRate is the tax rate Xero journals are imported with
+	XeroTaxRate string
+}
+
+// Line is one debit or credit of an entry.
+type Line struct {
+	Account     string        `json:"account"`
+	Description string        `json:"description"`
+	Debit       money.Decimal `json:"debit"`
+	Credit      money.Decimal `json:"credit"`
+	// CostCenter and Project are the codes an expense is charged to
+	CostCenter string `json:"cost_center,omitempty"`
+	Project    string `json:"project,omitempty"`
+}
+
+// Entry is the journal entry of a paid claim, in the base currency: its
+// expenses debited to their claim types' accounts and split by the cost
+// centers they were charged to, against credits for what was reimbursed,
+// paid by card and settled from an advance.
+type Entry struct {
+	ClaimID   uint   `json:"claim_id"`
+	Reference string `json:"reference"`
+	// Date is when the claim was paid
+	Date      time.Time `json:"date"`
+	Currency  string    `json:"currency"`
+	Employee  string    `json:"employee"`
+	Narration string    `json:"narration"`
+	Lines     []Line    `json:"lines"`
+}
+
+// Total returns the entry's debits, which equal its credits.
+func (e *Entry) Total() money.Decimal {
+	total := money.Zero
+	for _, line := range e.Lines {
+		total = total.Add(line.Debit)
+	}
+	return total
+}
+
+// MissingAccountError is returned when claims to export have claim types
+// with no GL account.
+type MissingAccountError struct {
+	ClaimTypes []string `json:"claim_types"`
+}
+
+func (e *MissingAccountError) Error() string {
+	return fmt.Sprintf("Claim types without a GL account: %s", strings.Join(e.ClaimTypes, ", "))
+}
+
+// ErrNothingToExport is returned when a fiscal period has no paid claims
+// left to export.
+var ErrNothingToExport = errors.New("No paid claims left to export in this fiscal period")
+
+// Exporter finds paid claims to book and records their export.
+type Exporter struct {
+	DB       *gorm.DB
+	Settings Settings
+	// BaseCurrency is what claims from before base currencies are in
+	BaseCurrency string
+}
+
+func NewExporter(db *gorm.DB, settings Settings, baseCurrency string) *Exporter {
+	return &Exporter{DB: db, Settings: settings, BaseCurrency: baseCurrency}
+}
+
+// paidClaim is a claim with the time it was marked paid.
+type paidClaim struct {
+	ID     uint
+	PaidAt time.Time
+}
+
+// paidAt is when each claim was last marked paid, or last updated for
+// claims paid without an audit record.
+const paidAt = "COALESCE((SELECT MAX(claim_approvals.created_at) FROM claim_approvals WHERE claim_approvals.claim_id = claims.id AND claim_approvals.action = 'mark-paid'), claims.updated_at)"
+
+// Pending returns the entries of the claims paid in a fiscal period that
+// haven't been exported.
+func (x *Exporter) Pending(period *models.FiscalPeriod) ([]Entry, error) {
+	paid, err := x.pending(x.DB, period, false)
+	if err != nil {
+		return nil, err
+	}
+	return x.entries(x.DB, paid)
+}
+
+// Export books the claims paid in a fiscal period that haven't been
+// exported, marking each as exported so that no later export books it
+// again.
+func (x *Exporter) Export(period *models.FiscalPeriod, actor *models.User) (*models.JournalExport, error) {
+	export := models.JournalExport{FiscalPeriodID: period.ID, Currency: x.BaseCurrency, CreatedByID: actor.ID}
+	err := x.DB.Transaction(func(tx *gorm.DB) error {
+		paid, err := x.pending(tx, period, true)
+		if err != nil {
+			return err
+		}
+		if len(paid) == 0 {
+			return ErrNothingToExport
+		}
+		entries, err := x.entries(tx, paid)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]uint, len(paid))
+		for i, claim := range paid {
+			ids[i] = claim.ID
+		}
+		total := money.Zero
+		for i := range entries {
+			total = total.Add(entries[i].Total())
+		}
+		export.ClaimCount = len(entries)
+		export.Total = total
+		if err := tx.Create(&export).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Claim{}).Where("id IN ?", ids).Update("journal_export_id", export.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Entries returns the entries of an earlier export.
+func (x *Exporter) Entries(export *models.JournalExport) ([]Entry, error) {
+	var paid []paidClaim
+	if err := x.DB.Model(&models.Claim{}).Select("claims.id, "+paidAt+" AS paid_at").
+		Where("journal_export_id = ?", export.ID).
+		Order("paid_at, claims.id").
+		Scan(&paid).Error; err != nil {
+		return nil, err
+	}
+	return x.entries(x.DB, paid)
+}
+
+// pending finds the paid claims of a period not yet exported, locking them
+// when they are about to be.
+func (x *Exporter) pending(db *gorm.DB, period *models.FiscalPeriod, lock bool) ([]paidClaim, error) {
+	query := db.Model(&models.Claim{}).Select("claims.id, "+paidAt+" AS paid_at").
+		Where("status = ? AND journal_export_id IS NULL", models.StatusPaid).
+		Where(paidAt+" >= ? AND "+paidAt+" < ?", period.StartDate, period.EndDate.AddDate(0, 0, 1)).
+		Order("paid_at, claims.id")
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "claims"}})
+	}
+	var paid []paidClaim
+	err := query.Scan(&paid).Error
+	return paid, err
+}
+
+// entries loads paid claims and builds their entries, in the order given.
+func (x *Exporter) entries(db *gorm.DB, paid []paidClaim) ([]Entry, error) {
+	if len(paid) == 0 {
+		return []Entry{}, nil
+	}
+	ids := make([]uint, len(paid))
+	for i, claim := range paid {
+		ids[i] = claim.ID
+	}
+	var claims []models.Claim
+	if err := workflow.PreloadAllocations(db.Preload("User").Preload("ClaimType").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("date, id")
+	}).Preload("Lines.ClaimType")).Where("id IN ?", ids).Find(&claims).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]*models.Claim{}
+	for i := range claims {
+		byID[claims[i].ID] = &claims[i]
+	}
+
+	entries := make([]Entry, 0, len(paid))
+	missing := map[string]bool{}
+	for _, p := range paid {
+		claim, ok := byID[p.ID]
+		if !ok {
+			continue
+		}
+		entry, unmapped := x.build(claim, p.PaidAt)
+		for _, name := range unmapped {
+			missing[name] = true
+		}
+		entries = append(entries, entry)
+	}
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &MissingAccountError{ClaimTypes: names}
+	}
+	return entries, nil
+}
+
+// build books a claim: each expense is debited at its base amount, and
+// the card-paid expenses and advance offset are credited to their
+// accounts, leaving the rest, what was reimbursed, to the reimbursement
+// account. It returns the names of claim types with no GL account.
+func (x *Exporter) build(claim *models.Claim, paidAt time.Time) (Entry, []string) {
+	currency := claim.BaseCurrency
+	if currency == "" {
+		currency = x.BaseCurrency
+	}
+	employee := strings.TrimSpace(claim.User.FirstName + " " + claim.User.LastName)
+	entry := Entry{
+		ClaimID:   claim.ID,
+		Reference: fmt.Sprintf("CLM-%d", claim.ID),
+		Date:      paidAt,
+		Currency:  currency,
+		Employee:  employee,
+		Narration: fmt.Sprintf("Expense claim #%d %s - %s", claim.ID, claim.Title, employee),
+	}
+	if claim.PaymentReference != "" {
+		entry.Reference = claim.PaymentReference
+	}
+
+	var unmapped []string
+	debits, card := money.Zero, money.Zero
+	for _, item := range claim.Items() {
+		if item.ClaimType.GLAccount == "" {
+			unmapped = append(unmapped, item.ClaimType.Name)
+			continue
+		}
+		description := item.Description
+		if description == "" {
+			description = item.Merchant
+		}
+		if description == "" {
+			description = item.ClaimType.Name
+		}
+		allocations := item.Allocations
+		if len(allocations) == 0 {
+			allocations = claim.Allocations
+		}
+		for _, share := range split(item.BaseAmount, allocations, currency) {
+			entry.Lines = append(entry.Lines, Line{
+				Account:     item.ClaimType.GLAccount,
+				Description: description,
+				Debit:       share.amount,
+				CostCenter:  share.costCenter,
+				Project:     share.project,
+			})
+		}
+		debits = debits.Add(item.BaseAmount)
+		if claim.PaidByCard || item.PaidByCard {
+			card = card.Add(item.BaseAmount)
+		}
+	}
+
+	advance := claim.AdvanceOffset.MulRate(claim.ExchangeRate).RoundTo(currency)
+	reimbursed := debits.Sub(card).Sub(advance)
+	for _, credit := range []struct {
+		account, description string
+		amount               money.Decimal
+	}{
+		{x.Settings.CardAccount, "Paid by corporate card", card},
+		{x.Settings.AdvanceAccount, "Settled from cash advance", advance},
+		{x.Settings.ReimbursementAccount, "Reimbursement to " + employee, reimbursed},
+	} {
+		if credit.amount.Sign() > 0 {
+			entry.Lines = append(entry.Lines, Line{Account: credit.account, Description: credit.description, Credit: credit.amount})
+		}
+	}
+	return entry, unmapped
+}
+
+// share is the part of an expense charged to a cost center and project.
+type share struct {
+	amount              money.Decimal
+	costCenter, project string
+}
+
+// split divides an amount by its allocations' percentages, rounding each
+// part to the currency and leaving the remainder to the last.
+func split(amount money.Decimal, allocations []models.Allocation, currency string) []share {
+	if amount.IsZero() {
+		return nil
+	}
+	if len(allocations) == 0 {
+		return []share{{amount: amount}}
+	}
+	hundredth := money.MustParse("0.01")
+	shares := make([]share, 0, len(allocations))
+	remaining := amount
+	for i, allocation := range allocations {
+		part := remaining
+		if i < len(allocations)-1 {
+			part = amount.Mul(allocation.Percent).Mul(hundredth).RoundTo(currency)
+		}
+		remaining = remaining.Sub(part)
+		s := share{amount: part}
+		if allocation.CostCenter != nil {
+			s.costCenter = allocation.CostCenter.Code
+		}
+		if allocation.Project != nil {
+			s.project = allocation.Project.Code
+		}
+		shares = append(shares, s)
+	}
+	return shares
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
 	"hrcs/backend/config"
 	"hrcs/backend/database"
+	"hrcs/backend/payout"
 	"hrcs/backend/routes"
+	"hrcs/backend/scheduler"
+	"hrcs/backend/storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,10 +25,28 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	if err := database.Migrate(db); err != nil {
+	if err := database.Migrate(db, cfg.BaseCurrency); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to set up attachment storage:", err)
+	}
+
+	payouts, err := payout.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to set up payout account encryption:", err)
+	}
+	if payouts == nil {
+		log.Printf("Warning: PAYOUT_ENCRYPTION_KEY is not set; payout accounts can't be saved or paid into")
+	}
+
+	if cfg.SchedulerEnabled {
+		scheduler.New(db, cfg).Start(context.Background())
+		log.Printf("Approval scheduler running every %s", cfg.SchedulerInterval)
+	}
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
@@ -38,7 +60,7 @@ func main() {
 		MaxAge:           300,
 	}))
 
-	routes.SetupRoutes(r, db, cfg)
+	routes.SetupRoutes(r, db, cfg, store, payouts)
 
 	// port := os.Getenv("PORT")
 	// if port == "" {
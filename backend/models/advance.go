@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// AdvanceStatus is where a cash advance is in its lifecycle.
+type AdvanceStatus string
+
+const (
+	AdvanceRequested AdvanceStatus = "requested"
+	AdvanceInReview  AdvanceStatus = "in-review"
+	AdvanceApproved  AdvanceStatus = "approved"
+	AdvanceRejected  AdvanceStatus = "rejected"
+	AdvanceCancelled AdvanceStatus = "cancelled"
+	// AdvanceDisbursed advances have been paid out and are waiting to be
+	// settled by claims or repaid
+	AdvanceDisbursed AdvanceStatus = "disbursed"
+	AdvanceSettled   AdvanceStatus = "settled"
+)
+
+// Actions only cash advances go through; approving and rejecting them use
+// the claim actions, and claims are cancelled like advances.
+const (
+	ActionDisburse ClaimAction = "disburse"
+	ActionCancel   ClaimAction = "cancel"
+)
+
+// SettlementKind says how part of an advance was accounted for.
+type SettlementKind string
+
+const (
+	// SettlementClaim offsets the advance against a claim's reimbursement
+	SettlementClaim SettlementKind = "claim"
+	// SettlementRepayment is cash the employee paid back
+	SettlementRepayment SettlementKind = "repayment"
+)
+
+// CashAdvance is money paid to an employee ahead of their expenses, e.g.
+// for a trip abroad. It goes through the default approval chain of the
+// employee's user group, and once disbursed the claims filed against it
+// are offset against what is outstanding.
+type CashAdvance struct {
+	ID      uint          `json:"id" gorm:"primaryKey"`
+	UserID  uint          `json:"user_id" gorm:"not null;index"`
+	User    *User         `json:"user,omitempty"`
+	Purpose string        `json:"purpose" gorm:"not null"`
+	Amount  money.Decimal `json:"amount" gorm:"not null"`
+	// Currency is the one the advance is paid in; only claims in the same
+	// currency can settle it
+	Currency string `json:"currency" gorm:"size:3;not null"`
+	// BaseAmount is Amount in the base currency at the rate of the day the
+	// advance was requested, which the approval chain is routed on
+	BaseCurrency string        `json:"base_currency" gorm:"size:3"`
+	BaseAmount   money.Decimal `json:"base_amount" gorm:"not null;default:0"`
+	ExchangeRate float64       `json:"exchange_rate" gorm:"not null;default:1"`
+	// Outstanding is what is left to settle once the advance is disbursed
+	Outstanding money.Decimal `json:"outstanding" gorm:"not null;default:0"`
+	Status      AdvanceStatus `json:"status" gorm:"size:20;not null;default:requested;index"`
+	NeededBy    *time.Time    `json:"needed_by" gorm:"type:date"`
+	DisbursedAt *time.Time    `json:"disbursed_at"`
+	SettledAt   *time.Time    `json:"settled_at"`
+	// Approvals hold the advance's audit trail
+	Approvals   []AdvanceApproval   `json:"approvals,omitempty" gorm:"foreignKey:AdvanceID"`
+	Settlements []AdvanceSettlement `json:"settlements,omitempty" gorm:"foreignKey:AdvanceID"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt      `json:"-" gorm:"index"`
+}
+
+// AdvanceApproval records an action on a cash advance, like ClaimApproval
+// does for claims.
+type AdvanceApproval struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	AdvanceID       uint           `json:"advance_id" gorm:"not null;index"`
+	ApprovalLevelID *uint          `json:"approval_level_id"`
+	ApprovalLevel   *ApprovalLevel `json:"approval_level,omitempty"`
+	// OnBehalfOfID is set when the approver acted as a delegate
+	ApproverID   *uint         `json:"approver_id"`
+	Approver     *User         `json:"approver,omitempty"`
+	OnBehalfOfID *uint         `json:"on_behalf_of_id"`
+	OnBehalfOf   *User         `json:"on_behalf_of,omitempty"`
+	Status       AdvanceStatus `json:"status" gorm:"size:20;not null"`
+	Action       ClaimAction   `json:"action"`
+	// ReasonCodeID is required when rejecting
+	ReasonCodeID *uint          `json:"reason_code_id"`
+	ReasonCode   *ReasonCode    `json:"reason_code,omitempty"`
+	Comments     string         `json:"comments"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AdvanceSettlement accounts for part of a disbursed advance, either
+// against an approved claim or as a repayment, in the advance's currency.
+type AdvanceSettlement struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	AdvanceID    uint           `json:"advance_id" gorm:"not null;index"`
+	Kind         SettlementKind `json:"kind" gorm:"size:20;not null"`
+	ClaimID      *uint          `json:"claim_id" gorm:"index"`
+	Claim        *Claim         `json:"claim,omitempty"`
+	Amount       money.Decimal  `json:"amount" gorm:"not null"`
+	RecordedByID *uint          `json:"recorded_by_id"`
+	Comments     string         `json:"comments"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// ChargeCode holds what cost centers and projects have in common. Codes
+// are unique among those that haven't been deleted, so a deleted code can
+// be created again.
+type ChargeCode struct {
+	Code        string `json:"code" gorm:"size:50;not null;uniqueIndex:,where:deleted_at IS NULL"`
+	Name        string `json:"name" gorm:"not null"`
+	Description string `json:"description"`
+	// Inactive codes stay on existing claims but can't be charged
+	Active bool `json:"active" gorm:"not null"`
+}
+
+// CostCenter is a budget owner in finance's chart of accounts that claims
+// are charged to.
+type CostCenter struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	ChargeCode
+	// UserGroups limits who can charge the cost center; none means anyone
+	UserGroups []UserGroup    `json:"user_groups,omitempty" gorm:"many2many:cost_center_user_groups;"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Project is a piece of work claims can optionally be charged to on top
+// of their cost center, such as a client engagement.
+type Project struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	ChargeCode
+	// UserGroups limits who can charge the project; none means anyone
+	UserGroups []UserGroup    `json:"user_groups,omitempty" gorm:"many2many:project_user_groups;"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AllowsGroup reports whether members of a user group, or users without
+// one when groupID is nil, can charge the cost center.
+func (c *CostCenter) AllowsGroup(groupID *uint) bool {
+	return allowsGroup(c.UserGroups, groupID)
+}
+
+// AllowsGroup reports whether members of a user group, or users without
+// one when groupID is nil, can charge the project.
+func (p *Project) AllowsGroup(groupID *uint) bool {
+	return allowsGroup(p.UserGroups, groupID)
+}
+
+func allowsGroup(groups []UserGroup, groupID *uint) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		if groupID != nil && group.ID == *groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// Allocation charges a percentage of a claim, or of one of its lines, to
+// a cost center and optionally a project. A claim's allocations cover the
+// lines without allocations of their own; the percentages of each set add
+// up to 100.
+type Allocation struct {
+	ID      uint `json:"id" gorm:"primaryKey"`
+	ClaimID uint `json:"claim_id" gorm:"not null;index"`
+	// LineItemID is nil for the claim's own allocations
+	LineItemID   *uint         `json:"line_item_id" gorm:"index"`
+	CostCenterID uint          `json:"cost_center_id" gorm:"not null;index"`
+	CostCenter   *CostCenter   `json:"cost_center,omitempty"`
+	ProjectID    *uint         `json:"project_id" gorm:"index"`
+	Project      *Project      `json:"project,omitempty"`
+	Percent      money.Decimal `json:"percent" gorm:"not null"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
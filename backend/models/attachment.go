@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Attachment is a file uploaded to a claim, such as a receipt. It can be
+// tied to one of the claim's lines. The file itself lives in the
+// attachment store under StorageKey.
+type Attachment struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	ClaimID      uint   `json:"claim_id" gorm:"not null;index"`
+	LineItemID   *uint  `json:"line_item_id" gorm:"index"`
+	UploadedByID uint   `json:"uploaded_by_id" gorm:"not null"`
+	UploadedBy   User   `json:"uploaded_by"`
+	FileName     string `json:"file_name" gorm:"not null"`
+	ContentType  string `json:"content_type" gorm:"not null"`
+	Size         int64  `json:"size" gorm:"not null"`
+	// Checksum is the hex SHA-256 of the file's contents
+	Checksum   string         `json:"checksum" gorm:"not null;size:64"`
+	StorageKey string         `json:"-" gorm:"not null"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// FiscalPeriod is a stretch of the financial year budgets are set for,
+// such as "FY2025" or "2025-Q1". Periods may overlap, so a year's budget
+// can sit alongside quarterly ones.
+type FiscalPeriod struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name" gorm:"size:50;not null;uniqueIndex"`
+	StartDate time.Time      `json:"start_date" gorm:"type:date;not null"`
+	EndDate   time.Time      `json:"end_date" gorm:"type:date;not null"` // inclusive
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// BudgetEnforcement says what happens when approving a claim would take a
+// budget past its amount.
+type BudgetEnforcement string
+
+const (
+	// EnforceNone only tracks the budget
+	EnforceNone BudgetEnforcement = "none"
+	// EnforceWarn lets the approval through, recording the overrun
+	EnforceWarn BudgetEnforcement = "warn"
+	// EnforceBlock refuses the approval
+	EnforceBlock BudgetEnforcement = "block"
+)
+
+// Budget is what a user group or a cost center may spend in a fiscal
+// period, on one claim type or on all of them. Amount is in the base
+// currency; approved and paid claims consume it.
+type Budget struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	FiscalPeriodID uint          `json:"fiscal_period_id" gorm:"not null;index"`
+	FiscalPeriod   *FiscalPeriod `json:"fiscal_period,omitempty"`
+	// A budget belongs to either a user group, covering its members'
+	// claims, or a cost center, covering what is charged to it
+	UserGroupID  *uint       `json:"user_group_id" gorm:"index"`
+	UserGroup    *UserGroup  `json:"user_group,omitempty"`
+	CostCenterID *uint       `json:"cost_center_id" gorm:"index"`
+	CostCenter   *CostCenter `json:"cost_center,omitempty"`
+	// ClaimTypeID limits the budget to one claim type; nil covers all
+	ClaimTypeID *uint             `json:"claim_type_id"`
+	ClaimType   *ClaimType        `json:"claim_type,omitempty"`
+	Amount      money.Decimal     `json:"amount" gorm:"not null"`
+	Enforcement BudgetEnforcement `json:"enforcement" gorm:"size:10;not null;default:warn"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt    `json:"-" gorm:"index"`
+}
+
+// Label names the budget for messages, e.g. "Engineering Travel Expenses
+// budget for FY2025". The owner, claim type and period must be loaded.
+func (b *Budget) Label() string {
+	owner := "Unknown"
+	switch {
+	case b.UserGroup != nil:
+		owner = b.UserGroup.Name
+	case b.CostCenter != nil:
+		owner = b.CostCenter.Code + " " + b.CostCenter.Name
+	}
+	if b.ClaimType != nil {
+		owner += " " + b.ClaimType.Name
+	}
+	label := owner + " budget"
+	if b.FiscalPeriod != nil {
+		label += " for " + b.FiscalPeriod.Name
+	}
+	return label
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+)
+
+// ClaimKind says how the amounts of a claim type come about: typed in by
+// the claimant, or calculated from a rate table.
+type ClaimKind string
+
+const (
+	KindStandard ClaimKind = "standard"
+	KindMileage  ClaimKind = "mileage"
+	KindPerDiem  ClaimKind = "per-diem"
+)
+
+// Valid reports whether the kind is one of the known ones.
+func (k ClaimKind) Valid() bool {
+	switch k {
+	case KindStandard, KindMileage, KindPerDiem:
+		return true
+	}
+	return false
+}
+
+// Calculated reports whether amounts of this kind are computed by the
+// server rather than entered.
+func (k ClaimKind) Calculated() bool {
+	return k == KindMileage || k == KindPerDiem
+}
+
+// MileageRate is what a unit of distance driven in a vehicle class is
+// reimbursed at. A rate applies from EffectiveFrom until the class's next
+// rate takes effect; rates are never edited, a change is a new version.
+type MileageRate struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// VehicleClass is a lower-case name such as "car" or "motorcycle"
+	VehicleClass  string        `json:"vehicle_class" gorm:"size:50;not null;uniqueIndex:idx_mileage_rates_class_from"`
+	EffectiveFrom time.Time     `json:"effective_from" gorm:"type:date;not null;uniqueIndex:idx_mileage_rates_class_from"`
+	Unit          string        `json:"unit" gorm:"size:2;not null;default:km"` // "km" or "mi"
+	Currency      string        `json:"currency" gorm:"size:3;not null"`
+	Rate          money.Decimal `json:"rate" gorm:"not null"` // per unit
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// PerDiemRate is the daily allowance for a destination, less a deduction
+// for each meal provided. Destination "*" covers destinations without a
+// rate of their own. Like mileage rates, per-diem rates are versioned by
+// EffectiveFrom.
+type PerDiemRate struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// Destination is an upper-case country or city name such as "SG" or
+	// "LONDON", matched against claims case-insensitively
+	Destination        string        `json:"destination" gorm:"size:100;not null;uniqueIndex:idx_per_diem_rates_destination_from"`
+	EffectiveFrom      time.Time     `json:"effective_from" gorm:"type:date;not null;uniqueIndex:idx_per_diem_rates_destination_from"`
+	Currency           string        `json:"currency" gorm:"size:3;not null"`
+	DailyRate          money.Decimal `json:"daily_rate" gorm:"not null"`
+	BreakfastDeduction money.Decimal `json:"breakfast_deduction" gorm:"not null;default:0"`
+	LunchDeduction     money.Decimal `json:"lunch_deduction" gorm:"not null;default:0"`
+	DinnerDeduction    money.Decimal `json:"dinner_deduction" gorm:"not null;default:0"`
+	CreatedAt          time.Time     `json:"created_at"`
+}
+
+// CalculationInput is what a claimant enters for a calculated claim type
+// instead of an amount.
+type CalculationInput struct {
+	// Mileage: the distance, in the unit of the vehicle class's rate
+	Distance     *money.Decimal `json:"distance,omitempty"`
+	VehicleClass string         `json:"vehicle_class,omitempty"`
+	// Per diem: the trip's first and last days, YYYY-MM-DD, and how many
+	// meals were provided over it
+	Destination string `json:"destination,omitempty"`
+	StartDate   string `json:"start_date,omitempty"`
+	EndDate     string `json:"end_date,omitempty"`
+	Breakfasts  int    `json:"breakfasts,omitempty"`
+	Lunches     int    `json:"lunches,omitempty"`
+	Dinners     int    `json:"dinners,omitempty"`
+}
+
+// Calculation records how a calculated amount was arrived at: the inputs
+// and a copy of the rate version used, so the amount can be recomputed
+// exactly even after the rate table moves on.
+type Calculation struct {
+	Kind        ClaimKind        `json:"kind"`
+	Input       CalculationInput `json:"input"`
+	MileageRate *MileageRate     `json:"mileage_rate,omitempty"`
+	PerDiemRate *PerDiemRate     `json:"per_diem_rate,omitempty"`
+	// Days is the number of per-diem days
+	Days     int           `json:"days,omitempty"`
+	Amount   money.Decimal `json:"amount"`
+	Currency string        `json:"currency"`
+}
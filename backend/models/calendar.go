@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BusinessCalendar defines the working week and public holidays of a user
+// group or an office location. A calendar with neither is the company
+// default.
+type BusinessCalendar struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"not null"`
+	UserGroupID *uint      `json:"user_group_id" gorm:"index"`
+	UserGroup   *UserGroup `json:"user_group,omitempty"`
+	Location    string     `json:"location" gorm:"index"`
+	// Weekend lists the non-working weekdays, e.g. "saturday,sunday"
+	Weekend   string         `json:"weekend" gorm:"not null"`
+	Holidays  []Holiday      `json:"holidays,omitempty" gorm:"foreignKey:CalendarID"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Holiday is a public holiday on a business calendar.
+type Holiday struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	CalendarID uint           `json:"calendar_id" gorm:"not null;index"`
+	Date       time.Time      `json:"date" gorm:"type:date;not null"`
+	Name       string         `json:"name" gorm:"not null"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// CardMatch records how a card transaction came to be attached to a claim.
+type CardMatch string
+
+const (
+	CardMatchManual CardMatch = "manual"
+	CardMatchAuto   CardMatch = "auto"
+)
+
+// CardTransaction is a charge on a corporate card, imported from the
+// cardholder's statement. Attaching it to a claim, or to one of its lines,
+// reconciles it and marks that expense as paid by card, so it isn't
+// reimbursed.
+type CardTransaction struct {
+	ID     uint  `json:"id" gorm:"primaryKey"`
+	UserID uint  `json:"user_id" gorm:"not null;uniqueIndex:idx_card_transactions_user_external"`
+	User   *User `json:"user,omitempty"`
+	// ExternalID is the bank's reference for the transaction, so importing
+	// the same statement twice doesn't duplicate it
+	ExternalID string `json:"external_id" gorm:"size:100;not null;uniqueIndex:idx_card_transactions_user_external"`
+	// CardNumber holds the last four digits of the card only
+	CardNumber string    `json:"card_number" gorm:"size:4"`
+	Date       time.Time `json:"date" gorm:"type:date;not null;index"`
+	// Amount is positive for charges and negative for refunds
+	Amount      money.Decimal `json:"amount" gorm:"not null"`
+	Currency    string        `json:"currency" gorm:"size:3;not null"`
+	Merchant    string        `json:"merchant"`
+	Description string        `json:"description"`
+	Source      string        `json:"source" gorm:"size:10"` // csv or ofx
+	// ClaimID is set once the transaction is attached to a claim, and
+	// LineItemID when it is attached to one of the claim's lines
+	ClaimID      *uint          `json:"claim_id" gorm:"index"`
+	Claim        *Claim         `json:"claim,omitempty"`
+	LineItemID   *uint          `json:"line_item_id" gorm:"index"`
+	MatchedBy    CardMatch      `json:"matched_by,omitempty" gorm:"size:10"`
+	ReconciledAt *time.Time     `json:"reconciled_at"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// ReimbursableTotal is what the claimant is owed in the claim's currency:
+// the claim's amount less its lines paid by card, or nothing when the
+// claim as a whole was. Lines must be loaded.
+func (c *Claim) ReimbursableTotal() money.Decimal {
+	if c.PaidByCard {
+		return money.Zero
+	}
+	if len(c.Lines) == 0 {
+		return c.Amount
+	}
+	total := money.Zero
+	for i := range c.Lines {
+		if !c.Lines[i].PaidByCard {
+			total = total.Add(c.Lines[i].ClaimAmount(c.Currency))
+		}
+	}
+	return total
+}
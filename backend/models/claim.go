@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"hrcs/backend/money"
+
 	"gorm.io/gorm"
 )
 
@@ -11,16 +13,80 @@ type ClaimStatus string
 const (
 	StatusDraft              ClaimStatus = "draft"
 	StatusSubmitted          ClaimStatus = "submitted"
+	StatusInReview           ClaimStatus = "in-review"
 	StatusApproved           ClaimStatus = "approved"
 	StatusRejected           ClaimStatus = "rejected"
+	StatusReturned           ClaimStatus = "returned"
 	StatusPaymentInProgress  ClaimStatus = "payment-in-progress"
 	StatusPaid               ClaimStatus = "paid"
+	// StatusCancelled claims were called off by their claimant before
+	// approval; they are kept for the audit trail but no longer listed
+	StatusCancelled          ClaimStatus = "cancelled"
+)
+
+// ClaimAction names a transition in the claim lifecycle. The legal
+// transitions for each action live in the workflow package.
+type ClaimAction string
+
+const (
+	ActionSubmit       ClaimAction = "submit"
+	ActionApprove      ClaimAction = "approve"
+	ActionApproveLevel ClaimAction = "approve-level"
+	ActionReject       ClaimAction = "reject"
+	ActionStartPayment ClaimAction = "start-payment"
+	ActionMarkPaid     ClaimAction = "mark-paid"
+	ActionWithdraw     ClaimAction = "withdraw"
+	ActionReturn       ClaimAction = "return"
+	// Recorded by the scheduler; they don't change the claim's status
+	ActionRemind   ClaimAction = "remind"
+	ActionEscalate ClaimAction = "escalate"
+)
+
+// ClaimCategory groups claim types for reporting.
+type ClaimCategory string
+
+const (
+	CategoryTravel        ClaimCategory = "travel"
+	CategoryMedical       ClaimCategory = "medical"
+	CategoryEquipment     ClaimCategory = "equipment"
+	CategoryTraining      ClaimCategory = "training"
+	CategoryEntertainment ClaimCategory = "entertainment"
+	CategoryOther         ClaimCategory = "other"
 )
 
+// Valid reports whether the category is one of the known ones.
+func (c ClaimCategory) Valid() bool {
+	switch c {
+	case CategoryTravel, CategoryMedical, CategoryEquipment, CategoryTraining, CategoryEntertainment, CategoryOther:
+		return true
+	}
+	return false
+}
+
+// ClaimType is an expense category together with the policy every expense
+// of that type is held to.
 type ClaimType struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name" gorm:"not null"`
+	Code        string         `json:"code" gorm:"index"`
 	Description string         `json:"description"`
+	Category    ClaimCategory  `json:"category" gorm:"not null;default:other"`
+	// Kind is "standard" for amounts the claimant enters, or "mileage" or
+	// "per-diem" for amounts calculated from the rate tables
+	Kind        ClaimKind      `json:"kind" gorm:"size:20;not null;default:standard"`
+	// MaxAmount caps a single expense of this type; nil means no limit
+	MaxAmount             *money.Decimal `json:"max_amount"`
+	RequiresReceipt       bool           `json:"requires_receipt" gorm:"not null;default:false"`
+	RequiresJustification bool           `json:"requires_justification" gorm:"not null;default:false"`
+	// ValidityPeriod is how many days after an expense it can still be
+	// claimed; 0 means no limit
+	ValidityPeriod int            `json:"validity_period" gorm:"not null;default:0"`
+	// GLAccount is the general ledger expense account the type is booked
+	// to in journal exports
+	GLAccount   string         `json:"gl_account" gorm:"size:50"`
+	// Inactive types are kept for existing claims but can't be used on new
+	// ones
+	Active      bool           `json:"active" gorm:"not null;default:true"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -30,12 +96,69 @@ type Claim struct {
 	ID          uint          `json:"id" gorm:"primaryKey"`
 	Title       string        `json:"title" gorm:"not null"`
 	Description string        `json:"description"`
-	Amount      float64       `json:"amount" gorm:"not null"`
+	Amount      money.Decimal `json:"amount" gorm:"not null"`
+	// Currency is the one the claimant is reimbursed in
+	Currency    string        `json:"currency" gorm:"size:3;not null;default:USD"`
+	// BaseAmount is Amount in the company's base currency, converted at
+	// ExchangeRate as published on RateDate. Drafts follow the latest rate;
+	// submitting the claim fixes it. Approval thresholds, claim type limits
+	// and dashboards all work on the base amount.
+	BaseCurrency string       `json:"base_currency" gorm:"size:3"`
+	BaseAmount   money.Decimal `json:"base_amount" gorm:"not null;default:0"`
+	ExchangeRate float64      `json:"exchange_rate" gorm:"not null;default:1"`
+	RateDate     *time.Time   `json:"rate_date" gorm:"type:date"`
+	// PaidByCard is set when a card transaction covers the whole claim;
+	// ReimbursableAmount is what is owed to the claimant, in Currency,
+	// once card-paid expenses and any advance it settled are left out
+	PaidByCard         bool          `json:"paid_by_card" gorm:"not null;default:false"`
+	ReimbursableAmount money.Decimal `json:"reimbursable_amount" gorm:"not null;default:0"`
+	// AdvanceID is the cash advance the claim settles; AdvanceOffset is how
+	// much of it the claim took up when it was approved
+	AdvanceID     *uint         `json:"advance_id" gorm:"index"`
+	Advance       *CashAdvance  `json:"advance,omitempty"`
+	AdvanceOffset money.Decimal `json:"advance_offset" gorm:"not null;default:0"`
+	// PaymentBatchID is the payment run reimbursing the claim, and
+	// PaymentReference the reference the payment was made under once the
+	// batch is settled
+	PaymentBatchID   *uint  `json:"payment_batch_id" gorm:"index"`
+	PaymentReference string `json:"payment_reference,omitempty" gorm:"size:35"`
+	// JournalExportID is the accounting export the paid claim was booked
+	// in, so that it is never booked twice
+	JournalExportID *uint `json:"journal_export_id" gorm:"index"`
 	Status      ClaimStatus   `json:"status" gorm:"default:draft"`
+	// Round counts submissions; approvals only count towards the round they
+	// were given in
+	Round       int           `json:"round" gorm:"default:0"`
+	// ResumeLevelID is the level a resubmitted claim picks up from when its
+	// group resumes returned claims at the returning level; the levels
+	// before it keep their approvals from the earlier round
+	ResumeLevelID *uint       `json:"resume_level_id"`
 	UserID      uint          `json:"user_id" gorm:"not null"`
 	User        User          `json:"user"`
 	ClaimTypeID uint          `json:"claim_type_id" gorm:"not null"`
 	ClaimType   ClaimType     `json:"claim_type"`
+	// Calculation is how the amount of a mileage or per-diem claim was
+	// worked out; nil when the amount was entered or the claim is itemized
+	Calculation *Calculation  `json:"calculation,omitempty" gorm:"type:text;serializer:json"`
+	// ExpenseDate is when the expense of a claim that isn't itemized was
+	// incurred; itemized claims date each line instead
+	ExpenseDate *time.Time    `json:"expense_date" gorm:"type:date"`
+	// Lines itemize the claim; when present Amount is their total
+	Lines       []ClaimLineItem `json:"lines,omitempty" gorm:"foreignKey:ClaimID"`
+	// Allocations charge the claim to cost centers and projects. The
+	// allocations of its lines share the claim ID, so preload these with
+	// "line_item_id IS NULL"
+	Allocations []Allocation    `json:"allocations,omitempty" gorm:"foreignKey:ClaimID"`
+	Attachments []Attachment    `json:"attachments,omitempty" gorm:"foreignKey:ClaimID"`
+	// Violations are the policy warnings and justified exceptions found
+	// when the claim was last submitted
+	Violations  []PolicyViolation `json:"violations,omitempty" gorm:"foreignKey:ClaimID"`
+	// Duplicates are the earlier claims the claim looked like it repeated
+	// when it was last submitted
+	Duplicates  []DuplicateMatch `json:"duplicates,omitempty" gorm:"foreignKey:ClaimID"`
+	// CardTransactions are the corporate card charges attached to the
+	// claim or its lines
+	CardTransactions []CardTransaction `json:"card_transactions,omitempty" gorm:"foreignKey:ClaimID"`
 	Approvals   []ClaimApproval `json:"approvals,omitempty"`
 	CreatedAt   time.Time     `json:"created_at"`
 	UpdatedAt   time.Time     `json:"updated_at"`
@@ -47,8 +170,29 @@ type ApprovalLevel struct {
 	Level       int            `json:"level" gorm:"not null"`
 	UserGroupID uint           `json:"user_group_id" gorm:"not null"`
 	UserGroup   UserGroup      `json:"user_group"`
-	ApproverID  uint           `json:"approver_id" gorm:"not null"`
-	Approver    User           `json:"approver"`
+	// ApproverID is the level's primary approver. Levels can instead (or
+	// additionally) be assigned approvers through Approvers.
+	ApproverID  *uint          `json:"approver_id"`
+	Approver    *User          `json:"approver,omitempty"`
+	Approvers   []ApprovalLevelApprover `json:"approvers,omitempty"`
+	// RequiresAllApprovers makes the level wait for every assignment
+	// instead of any one of them
+	RequiresAllApprovers bool  `json:"requires_all_approvers" gorm:"default:false"`
+	// Amount band - the level applies to claims of at least MinAmount and
+	// can give final approval up to MaxAmount (nil means no upper limit)
+	MinAmount   money.Decimal  `json:"min_amount" gorm:"default:0"`
+	MaxAmount   *money.Decimal `json:"max_amount"`
+	// ClaimTypes limits the level to a claim-type specific chain; levels
+	// without claim types form the group's default chain
+	ClaimTypes  []ClaimType    `json:"claim_types,omitempty" gorm:"many2many:approval_level_claim_types;"`
+	// Timeouts in business days before approvers are reminded and the step
+	// is escalated; nil uses the configured defaults, 0 disables them
+	ReminderDays   *int        `json:"reminder_days"`
+	EscalationDays *int        `json:"escalation_days"`
+	// FallbackApproverID takes over an overdue step instead of it passing to
+	// the next level
+	FallbackApproverID *uint   `json:"fallback_approver_id"`
+	FallbackApprover   *User   `json:"fallback_approver,omitempty"`
 	// Status permissions - what statuses this level can set
 	CanDraft             bool           `json:"can_draft" gorm:"default:false"`
 	CanSubmit            bool           `json:"can_submit" gorm:"default:false"`
@@ -61,16 +205,69 @@ type ApprovalLevel struct {
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+type ApproverType string
+
+const (
+	ApproverTypeUser  ApproverType = "user"
+	ApproverTypeGroup ApproverType = "group"
+	ApproverTypeRole  ApproverType = "role"
+)
+
+// ApprovalLevelApprover assigns an approver to an approval level: a named
+// user, every member of a user group, or every user holding a role.
+type ApprovalLevelApprover struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	ApprovalLevelID uint           `json:"approval_level_id" gorm:"not null;index"`
+	Type            ApproverType   `json:"type" gorm:"not null"`
+	UserID          *uint          `json:"user_id"`
+	User            *User          `json:"user,omitempty"`
+	UserGroupID     *uint          `json:"user_group_id"`
+	UserGroup       *UserGroup     `json:"user_group,omitempty"`
+	Role            UserRole       `json:"role"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Matches reports whether a user is covered by the assignment.
+func (a ApprovalLevelApprover) Matches(user *User) bool {
+	switch a.Type {
+	case ApproverTypeUser:
+		return a.UserID != nil && *a.UserID == user.ID
+	case ApproverTypeGroup:
+		return a.UserGroupID != nil && user.UserGroupID != nil && *a.UserGroupID == *user.UserGroupID
+	case ApproverTypeRole:
+		return a.Role != "" && a.Role == user.Role
+	}
+	return false
+}
+
 type ClaimApproval struct {
 	ID              uint           `json:"id" gorm:"primaryKey"`
 	ClaimID         uint           `json:"claim_id" gorm:"not null"`
 	Claim           Claim          `json:"claim"`
-	ApprovalLevelID uint           `json:"approval_level_id" gorm:"not null"`
-	ApprovalLevel   ApprovalLevel  `json:"approval_level"`
-	ApproverID      uint           `json:"approver_id" gorm:"not null"`
-	Approver        User           `json:"approver"`
+	ApprovalLevelID *uint          `json:"approval_level_id"`
+	ApprovalLevel   *ApprovalLevel `json:"approval_level,omitempty"`
+	// ApproverID is the user who acted (nil for reminders and escalations
+	// recorded by the scheduler); OnBehalfOfID is set when they acted as a
+	// delegate for an absent approver
+	ApproverID      *uint          `json:"approver_id"`
+	Approver        *User          `json:"approver,omitempty"`
+	OnBehalfOfID    *uint          `json:"on_behalf_of_id"`
+	OnBehalfOf      *User          `json:"on_behalf_of,omitempty"`
+	// EscalatedToID is the user an overdue step was escalated to; an
+	// escalation without one passes the step to the next level
+	EscalatedToID   *uint          `json:"escalated_to_id"`
+	EscalatedTo     *User          `json:"escalated_to,omitempty"`
 	Status          ClaimStatus    `json:"status" gorm:"not null"`
+	Action          ClaimAction    `json:"action"`
+	Round           int            `json:"round" gorm:"default:0"`
+	// ReasonCodeID is required when rejecting or returning a claim
+	ReasonCodeID    *uint          `json:"reason_code_id"`
+	ReasonCode      *ReasonCode    `json:"reason_code,omitempty"`
 	Comments        string         `json:"comments"`
+	// Warnings are the budget overruns an approval was let through with
+	Warnings        []string       `json:"warnings,omitempty" gorm:"type:text;serializer:json"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// ExchangeRate is the price of one unit of Base in Quote on a day, e.g.
+// 1 EUR = 1.4521 SGD. Rates can be quoted against any currency; claims are
+// converted through whichever rates connect their currency to the base
+// currency.
+type ExchangeRate struct {
+	ID    uint      `json:"id" gorm:"primaryKey"`
+	Base  string    `json:"base" gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair_date"`
+	Quote string    `json:"quote" gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_pair_date"`
+	Rate  float64   `json:"rate" gorm:"not null"`
+	Date  time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_exchange_rates_pair_date"`
+	// Source is "manual", "csv" or "ecb"
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
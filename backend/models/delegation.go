@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ApproverDelegation lets a delegate see and act on an approver's pending
+// approval steps between StartDate and EndDate, e.g. while they are on
+// leave.
+type ApproverDelegation struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	DelegatorID uint           `json:"delegator_id" gorm:"not null;index"`
+	Delegator   User           `json:"delegator"`
+	DelegateID  uint           `json:"delegate_id" gorm:"not null;index"`
+	Delegate    User           `json:"delegate"`
+	StartDate   time.Time      `json:"start_date" gorm:"not null"`
+	EndDate     time.Time      `json:"end_date" gorm:"not null"`
+	Reason      string         `json:"reason"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// ActiveAt reports whether the delegation covers the given time.
+func (d ApproverDelegation) ActiveAt(t time.Time) bool {
+	return !t.Before(d.StartDate) && !t.After(d.EndDate)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// DuplicateMatch is an expense of a claim that looks like one claimed
+// before, found when the claim was last submitted. It links to the claim
+// it matches so approvers can compare the two; a claim can also match
+// itself when the same expense appears on two of its lines.
+type DuplicateMatch struct {
+	ID      uint `json:"id" gorm:"primaryKey"`
+	ClaimID uint `json:"claim_id" gorm:"not null;index"`
+	// Line is the 1-based line number, or 0 for the claim as a whole
+	Line       int   `json:"line,omitempty"`
+	LineItemID *uint `json:"line_item_id"`
+	// MatchedClaim is the claim holding the other copy, and MatchedLine its
+	// line in the same way as Line
+	MatchedClaimID    uint   `json:"matched_claim_id" gorm:"not null;index"`
+	MatchedClaim      *Claim `json:"matched_claim,omitempty" gorm:"foreignKey:MatchedClaimID"`
+	MatchedLine       int    `json:"matched_line,omitempty"`
+	MatchedLineItemID *uint  `json:"matched_line_item_id"`
+	// MatchedOn lists what the two have in common: "amount", "date",
+	// "merchant" and "receipt"
+	MatchedOn []string `json:"matched_on" gorm:"type:text;serializer:json"`
+	// Exact is set when the two are the same receipt, or the same amount
+	// spent at the same merchant on the same day
+	Exact     bool      `json:"exact"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+)
+
+// JournalExport is a batch of paid claims booked to the general ledger as
+// journal entries, for the claims paid in a fiscal period. Each claim is
+// exported once; the export can be downloaded again in any format.
+type JournalExport struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	FiscalPeriodID uint          `json:"fiscal_period_id" gorm:"not null;index"`
+	FiscalPeriod   *FiscalPeriod `json:"fiscal_period,omitempty"`
+	ClaimCount     int           `json:"claim_count" gorm:"not null;default:0"`
+	// Total is the debits of the export's entries, in Currency, the base
+	// currency
+	Total       money.Decimal `json:"total" gorm:"not null;default:0"`
+	Currency    string        `json:"currency" gorm:"size:3"`
+	CreatedByID uint          `json:"created_by_id" gorm:"not null"`
+	CreatedBy   *User         `json:"created_by,omitempty"`
+	Claims      []Claim       `json:"claims,omitempty" gorm:"foreignKey:JournalExportID"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// ClaimLineItem is one expense on an itemized claim, such as the flight or
+// the hotel of a business trip. An itemized claim's Amount is the sum of
+// its lines.
+type ClaimLineItem struct {
+	ID          uint          `json:"id" gorm:"primaryKey"`
+	ClaimID     uint          `json:"claim_id" gorm:"not null;index"`
+	Date        time.Time     `json:"date" gorm:"type:date;not null"`
+	ClaimTypeID uint          `json:"claim_type_id" gorm:"not null"`
+	ClaimType   ClaimType     `json:"claim_type"`
+	Amount      money.Decimal `json:"amount" gorm:"not null"`
+	// Currency is what was spent, which may differ from the claim's;
+	// ExchangeRate converts it into the claim's currency
+	Currency     string        `json:"currency" gorm:"size:3;not null;default:USD"`
+	ExchangeRate float64       `json:"exchange_rate" gorm:"not null;default:1"`
+	BaseAmount   money.Decimal `json:"base_amount" gorm:"not null;default:0"`
+	Merchant     string        `json:"merchant"`
+	Description  string        `json:"description"`
+	ReceiptURL   string        `json:"receipt_url"`
+	// Calculation is how the amount of a mileage or per-diem line was
+	// worked out
+	Calculation *Calculation `json:"calculation,omitempty" gorm:"type:text;serializer:json"`
+	// Attributes hold details policy rules can look at, such as the city
+	// or number of nights of a hotel stay
+	Attributes map[string]string `json:"attributes,omitempty" gorm:"type:text;serializer:json"`
+	// PaidByCard is set when a card transaction is attached to the line,
+	// which then isn't reimbursed
+	PaidByCard bool `json:"paid_by_card" gorm:"not null;default:false"`
+	// Allocations charge the line to cost centers and projects other than
+	// the claim's
+	Allocations []Allocation   `json:"allocations,omitempty" gorm:"foreignKey:LineItemID"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Items returns the claim's lines, or a single line standing in for the
+// whole claim when it isn't itemized, so per-line checks cover both. The
+// stand-in is dated by the claim's expense date, or by when the claim was
+// created for claims filed before expense dates were recorded. Lines must
+// be loaded.
+func (c *Claim) Items() []ClaimLineItem {
+	if len(c.Lines) > 0 {
+		return c.Lines
+	}
+	date := c.CreatedAt
+	if c.ExpenseDate != nil {
+		date = *c.ExpenseDate
+	}
+	return []ClaimLineItem{{
+		ClaimID:      c.ID,
+		Date:         date,
+		ClaimTypeID:  c.ClaimTypeID,
+		ClaimType:    c.ClaimType,
+		Amount:       c.Amount,
+		Currency:     c.Currency,
+		ExchangeRate: 1,
+		BaseAmount:   c.BaseAmount,
+		Description:  c.Description,
+	}}
+}
+
+// ClaimAmount is the line's amount in the claim's currency, rounded to
+// that currency's minor unit.
+func (l *ClaimLineItem) ClaimAmount(currency string) money.Decimal {
+	if l.ExchangeRate == 0 || l.ExchangeRate == 1 {
+		return l.Amount
+	}
+	return l.Amount.MulRate(l.ExchangeRate).RoundTo(currency)
+}
+
+// LinesTotal sums the amounts of the claim's lines in the claim's
+// currency.
+func (c *Claim) LinesTotal() money.Decimal {
+	total := money.Zero
+	for i := range c.Lines {
+		total = total.Add(c.Lines[i].ClaimAmount(c.Currency))
+	}
+	return total
+}
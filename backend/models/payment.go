@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// PaymentBatchStatus is where a payment run is: sent to the bank, or
+// confirmed paid.
+type PaymentBatchStatus string
+
+const (
+	BatchInProgress PaymentBatchStatus = "in-progress"
+	BatchSettled    PaymentBatchStatus = "settled"
+)
+
+// PaymentBatch is a payment run reimbursing a set of approved claims in one
+// currency. Creating it moves its claims to payment-in-progress; settling
+// it, once the bank has paid, moves them to paid.
+type PaymentBatch struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// Reference identifies the batch to the bank, e.g. PB-000012
+	Reference string `json:"reference" gorm:"size:35;uniqueIndex"`
+	Currency  string `json:"currency" gorm:"size:3;not null"`
+	// Total is what the batch pays out: the reimbursable amounts of its
+	// claims
+	Total         money.Decimal      `json:"total" gorm:"not null;default:0"`
+	ClaimCount    int                `json:"claim_count" gorm:"not null;default:0"`
+	ExecutionDate time.Time          `json:"execution_date" gorm:"type:date;not null"`
+	Status        PaymentBatchStatus `json:"status" gorm:"size:20;not null;default:in-progress;index"`
+	Notes         string             `json:"notes"`
+	CreatedByID   uint               `json:"created_by_id" gorm:"not null"`
+	CreatedBy     *User              `json:"created_by,omitempty"`
+	// ExportedAt is when a bank file was last generated for the batch
+	ExportedAt *time.Time `json:"exported_at"`
+	// BankReference is the bank's confirmation of the payment run, given
+	// when the batch is settled
+	BankReference string         `json:"bank_reference"`
+	SettledAt     *time.Time     `json:"settled_at"`
+	SettledByID   *uint          `json:"settled_by_id"`
+	Claims        []Claim        `json:"claims,omitempty" gorm:"foreignKey:PaymentBatchID"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// PayoutAccountType is the kind of US bank account an employee is paid
+// into.
+type PayoutAccountType string
+
+const (
+	PayoutChecking PayoutAccountType = "checking"
+	PayoutSavings  PayoutAccountType = "savings"
+)
+
+// PayoutAccount is the bank account an employee's reimbursements are paid
+// into: an IBAN, or a US account and routing number, or both. The account
+// identifiers are encrypted at rest and only ever returned masked.
+type PayoutAccount struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	UserID        uint   `json:"user_id" gorm:"uniqueIndex;not null"`
+	User          *User  `json:"user,omitempty"`
+	AccountHolder string `json:"account_holder" gorm:"not null"`
+	// The encrypted identifiers
+	IBANCipher          string `json:"-" gorm:"column:iban_cipher"`
+	AccountNumberCipher string `json:"-"`
+	RoutingNumberCipher string `json:"-"`
+	// Their masked forms, e.g. DE******************3000
+	IBAN          string            `json:"iban" gorm:"column:iban_masked"`
+	AccountNumber string            `json:"account_number" gorm:"column:account_number_masked"`
+	RoutingNumber string            `json:"routing_number" gorm:"column:routing_number_masked"`
+	BIC           string            `json:"bic" gorm:"size:11"`
+	AccountType   PayoutAccountType `json:"account_type" gorm:"size:20"`
+	// PendingVerification holds a changed account back from payment files
+	// until an admin verifies it, when verification is required
+	PendingVerification bool       `json:"pending_verification" gorm:"not null;default:false;index"`
+	VerifiedAt          *time.Time `json:"verified_at"`
+	VerifiedByID        *uint      `json:"verified_by_id"`
+	VerifiedBy          *User      `json:"verified_by,omitempty"`
+	// UpdatedByID is who last changed the account, who can't also verify it
+	UpdatedByID uint      `json:"updated_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PayoutChangeAction is what was done to a payout account.
+type PayoutChangeAction string
+
+const (
+	PayoutCreated  PayoutChangeAction = "created"
+	PayoutUpdated  PayoutChangeAction = "updated"
+	PayoutRemoved  PayoutChangeAction = "removed"
+	PayoutVerified PayoutChangeAction = "verified"
+)
+
+// PayoutAccountChange is the audit trail of an employee's payout account.
+// It names the fields that changed, never their values.
+type PayoutAccountChange struct {
+	ID      uint               `json:"id" gorm:"primaryKey"`
+	UserID  uint               `json:"user_id" gorm:"not null;index"`
+	ActorID uint               `json:"actor_id" gorm:"not null"`
+	Actor   *User              `json:"actor,omitempty"`
+	Action  PayoutChangeAction `json:"action" gorm:"size:20;not null"`
+	Fields  []string           `json:"fields,omitempty" gorm:"type:text;serializer:json"`
+	// IBAN and AccountNumber are the masked identifiers after the change
+	IBAN          string    `json:"iban,omitempty"`
+	AccountNumber string    `json:"account_number,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
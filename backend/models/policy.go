@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PolicySeverity says what happens when a claim breaks a policy rule.
+type PolicySeverity string
+
+const (
+	// SeverityBlock stops the claim from being submitted
+	SeverityBlock PolicySeverity = "block"
+	// SeverityWarn lets the claim through, flagged for approvers
+	SeverityWarn PolicySeverity = "warn"
+	// SeverityJustify lets the claim through once the claimant explains
+	// the exception
+	SeverityJustify PolicySeverity = "justify"
+)
+
+// PolicyScope says what a rule is checked against.
+type PolicyScope string
+
+const (
+	// PolicyScopeLine checks every expense on its own
+	PolicyScopeLine PolicyScope = "line"
+	// PolicyScopeDay checks the total of the matching expenses of each day
+	PolicyScopeDay PolicyScope = "day"
+	// PolicyScopeClaim checks the claim as a whole
+	PolicyScopeClaim PolicyScope = "claim"
+)
+
+// PolicyRule is an admin-defined expense policy. When picks the expenses
+// the rule covers (empty for all of them) and Assert must hold for each of
+// them, both written in the policy expression language.
+type PolicyRule struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"not null"`
+	Description string         `json:"description"`
+	Scope       PolicyScope    `json:"scope" gorm:"not null;default:line"`
+	When        string         `json:"when" gorm:"type:text"`
+	Assert      string         `json:"assert" gorm:"type:text;not null"`
+	Severity    PolicySeverity `json:"severity" gorm:"not null;default:block"`
+	// Message is shown for each violation; {name} inserts a variable, e.g.
+	// {day.total}
+	Message   string         `json:"message"`
+	Active    bool           `json:"active" gorm:"not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// PolicyViolation is a policy rule a claim broke when it was last
+// submitted. Blocking violations never get this far, so these are the
+// warnings and the justified exceptions approvers should look at.
+type PolicyViolation struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	ClaimID      uint           `json:"claim_id" gorm:"not null;index"`
+	PolicyRuleID uint           `json:"policy_rule_id" gorm:"not null"`
+	RuleName     string         `json:"rule_name" gorm:"not null"`
+	Severity     PolicySeverity `json:"severity" gorm:"not null"`
+	// Line is the 1-based line number, or 0 for the claim as a whole
+	Line       int    `json:"line,omitempty"`
+	LineItemID *uint  `json:"line_item_id"`
+	Date       string `json:"date,omitempty"`
+	Message    string `json:"message"`
+	// Justification is the claimant's explanation for a justify violation
+	Justification string    `json:"justification,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
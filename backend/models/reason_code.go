@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReasonKind says which decisions a reason code can be given for.
+type ReasonKind string
+
+const (
+	ReasonKindReject ReasonKind = "reject"
+	ReasonKindReturn ReasonKind = "return"
+	ReasonKindBoth   ReasonKind = "both"
+)
+
+// ReasonCode is an entry in the admin-managed catalogue of reasons for
+// rejecting a claim or returning it for revision. Codes are unique among
+// those that haven't been deleted, so a deleted code can be created again.
+type ReasonCode struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Code        string     `json:"code" gorm:"not null;uniqueIndex:,where:deleted_at IS NULL"`
+	Name        string     `json:"name" gorm:"not null"`
+	Description string     `json:"description"`
+	Kind        ReasonKind `json:"kind" gorm:"not null;default:both"`
+	// RequiresComments makes free text mandatory, e.g. for "other"
+	RequiresComments bool           `json:"requires_comments" gorm:"default:false"`
+	Active           bool           `json:"active" gorm:"not null"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AppliesTo reports whether the code can be given for an action.
+func (r ReasonCode) AppliesTo(action ClaimAction) bool {
+	switch r.Kind {
+	case ReasonKindBoth:
+		return action == ActionReject || action == ActionReturn
+	case ReasonKindReject:
+		return action == ActionReject
+	case ReasonKindReturn:
+		return action == ActionReturn
+	}
+	return false
+}
@@ -27,10 +27,27 @@ type User struct {
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// ResubmitPolicy is a group's choice of where the approval chain of a
+// returned claim starts again.
+type ResubmitPolicy string
+
+const (
+	// ResubmitRestart sends a resubmitted claim back through every level
+	ResubmitRestart ResubmitPolicy = "restart"
+	// ResubmitResume picks up at the level that returned the claim
+	ResubmitResume ResubmitPolicy = "resume"
+)
+
 type UserGroup struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
+	// Location is the office the group works from; it picks the business
+	// calendar when the group has none of its own
+	Location    string         `json:"location"`
+	// ResubmitPolicy decides where a returned claim's approval chain
+	// restarts once the claimant resubmits it
+	ResubmitPolicy ResubmitPolicy `json:"resubmit_policy" gorm:"default:restart"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
@@ -0,0 +1,25 @@
+package money
+
+import "strings"
+
+// minorUnits lists the ISO 4217 currencies whose minor unit isn't the
+// cent.
+var minorUnits = map[string]int{
+	// No minor unit
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	// Thousandths
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	// Ten-thousandths
+	"CLF": 4, "UYW": 4,
+}
+
+// MinorUnits returns how many decimal places amounts in a currency are
+// settled to: 2 for most, 0 for the yen or won, 3 for the dinars.
+func MinorUnits(currency string) int {
+	if places, ok := minorUnits[strings.ToUpper(currency)]; ok {
+		return places
+	}
+	return 2
+}
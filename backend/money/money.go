@@ -0,0 +1,351 @@
+// Package money holds amounts as exact fixed-point decimals, so totals add
+// up to the cent however many amounts go into them.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places a Decimal keeps: enough for every
+// currency's minor unit, with room for sub-cent rates such as mileage.
+const Scale = 4
+
+const unit = 10000 // 10^Scale
+
+// Decimal is an exact amount with Scale decimal places. The zero value is
+// zero. In the database it is a numeric(19,4) and in JSON a number written
+// out in full, e.g. 1250.50; strings such as "1250.50" are accepted too.
+type Decimal struct {
+	units int64 // in 10^-Scale
+}
+
+// Zero is the zero amount.
+var Zero = Decimal{}
+
+// Max and Min bound a Decimal. Arithmetic that would go beyond them stops
+// at them rather than wrap around, and InRange tells such results apart so
+// that they can be refused.
+var (
+	Max = Decimal{units: math.MaxInt64}
+	Min = Decimal{units: -math.MaxInt64}
+)
+
+// ErrRange is returned for amounts beyond Max or Min.
+var ErrRange = errors.New("amount out of range")
+
+// FromInt returns a whole amount.
+func FromInt(n int64) Decimal {
+	return Decimal{units: n * unit}
+}
+
+// Parse reads a decimal number such as "1250.50", "-3" or "1.2e3". Digits
+// beyond Scale places are rounded half away from zero.
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s, "/_") {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	d, err := fromRat(r)
+	if err != nil {
+		return Zero, fmt.Errorf("invalid amount %q: %v", s, err)
+	}
+	return d, nil
+}
+
+// MustParse is Parse for amounts known to be valid, such as constants.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// FromFloat converts a float by its shortest decimal form, so 0.1 becomes
+// exactly 0.1. It is for values that only exist as floats; amounts should
+// be parsed from text.
+func FromFloat(f float64) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Zero
+	}
+	d, _ := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	return d
+}
+
+// fromRat rounds r half away from zero to Scale places.
+func fromRat(r *big.Rat) (Decimal, error) {
+	num := new(big.Int).Mul(r.Num(), big.NewInt(unit))
+	q, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+		if twice.Cmp(r.Denom()) >= 0 {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+	if !q.IsInt64() || q.Int64() == math.MinInt64 {
+		return saturate(q.Sign()), ErrRange
+	}
+	return Decimal{units: q.Int64()}, nil
+}
+
+// saturate returns Max, or Min for a negative sign.
+func saturate(sign int) Decimal {
+	if sign < 0 {
+		return Min
+	}
+	return Max
+}
+
+func (d Decimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(d.units), big.NewInt(unit))
+}
+
+// Add returns d + o, saturating at Max and Min.
+func (d Decimal) Add(o Decimal) Decimal {
+	sum := d.units + o.units
+	switch {
+	case o.units > 0 && (sum < d.units || sum == math.MinInt64):
+		return Max
+	case o.units < 0 && (sum > d.units || sum == math.MinInt64):
+		return Min
+	}
+	return Decimal{units: sum}
+}
+
+// Sub returns d - o, saturating at Max and Min.
+func (d Decimal) Sub(o Decimal) Decimal {
+	return d.Add(o.Neg())
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{units: -d.units}
+}
+
+// Mul returns d * o rounded half away from zero to Scale places,
+// saturating at Max and Min.
+func (d Decimal) Mul(o Decimal) Decimal {
+	result, _ := fromRat(new(big.Rat).Mul(d.rat(), o.rat()))
+	return result
+}
+
+// Div returns d / o rounded half away from zero to Scale places,
+// saturating at Max and Min. Dividing by zero is an error.
+func (d Decimal) Div(o Decimal) (Decimal, error) {
+	if o.IsZero() {
+		return Zero, errors.New("division by zero")
+	}
+	result, _ := fromRat(new(big.Rat).Quo(d.rat(), o.rat()))
+	return result, nil
+}
+
+// MulInt returns d * n, saturating at Max and Min.
+func (d Decimal) MulInt(n int64) Decimal {
+	product := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(n))
+	if !product.IsInt64() || product.Int64() == math.MinInt64 {
+		return saturate(product.Sign())
+	}
+	return Decimal{units: product.Int64()}
+}
+
+// MulRate multiplies d by a rate such as an exchange rate, taking the rate
+// by its shortest decimal form so 1.345 multiplies as exactly 1.345. The
+// result is rounded half away from zero to Scale places, saturating at Max
+// and Min; a rate that isn't a finite number saturates too.
+func (d Decimal) MulRate(rate float64) Decimal {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'g', -1, 64))
+	if !ok {
+		sign := d.Sign()
+		if rate < 0 {
+			sign = -sign
+		}
+		return saturate(sign)
+	}
+	result, _ := fromRat(r.Mul(r, d.rat()))
+	return result
+}
+
+// InRange reports whether d lies strictly between Min and Max, that is
+// whether no arithmetic that gave it saturated.
+func (d Decimal) InRange() bool {
+	return d.units > Min.units && d.units < Max.units
+}
+
+// Cmp compares d and o, returning -1, 0 or +1.
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	}
+	return 0
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int {
+	return d.Cmp(Zero)
+}
+
+// IsZero reports whether d is zero.
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+// LessThan reports whether d < o.
+func (d Decimal) LessThan(o Decimal) bool {
+	return d.units < o.units
+}
+
+// GreaterThan reports whether d > o.
+func (d Decimal) GreaterThan(o Decimal) bool {
+	return d.units > o.units
+}
+
+// Round rounds d half away from zero to the given number of places,
+// saturating at Max and Min.
+func (d Decimal) Round(places int) Decimal {
+	if places >= Scale || !d.InRange() {
+		return d
+	}
+	if places < Scale-18 {
+		places = Scale - 18
+	}
+	step := int64(math.Pow10(Scale - places))
+	q, rem := d.units/step, d.units%step
+	if rem < 0 {
+		rem = -rem
+	}
+	if rem*2 >= step {
+		if d.units < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	if q > Max.units/step || q < Min.units/step {
+		return saturate(int(q))
+	}
+	return Decimal{units: q * step}
+}
+
+// RoundTo rounds d to the minor unit of a currency.
+func (d Decimal) RoundTo(currency string) Decimal {
+	return d.Round(MinorUnits(currency))
+}
+
+// Float64 returns d as the nearest float, for display; don't do arithmetic
+// on it.
+func (d Decimal) Float64() float64 {
+	f, _ := d.rat().Float64()
+	return f
+}
+
+// String writes d with at least two and at most Scale decimal places,
+// e.g. 1250.50 or 0.5875.
+func (d Decimal) String() string {
+	s := d.StringFixed(Scale)
+	trimmed := strings.TrimRight(s, "0")
+	if dot := strings.IndexByte(s, '.'); len(trimmed) < dot+3 {
+		return s[:dot+3]
+	}
+	return trimmed
+}
+
+// StringFixed writes d with exactly the given number of decimal places,
+// rounding half away from zero.
+func (d Decimal) StringFixed(places int) string {
+	if places > Scale {
+		places = Scale
+	}
+	rounded := d.Round(places)
+	sign := ""
+	units := rounded.units
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	whole := strconv.FormatInt(units/unit, 10)
+	if places <= 0 {
+		return sign + whole
+	}
+	frac := fmt.Sprintf("%04d", units%unit)
+	return sign + whole + "." + frac[:places]
+}
+
+// Sum adds amounts up.
+func Sum(amounts ...Decimal) Decimal {
+	total := Zero
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// MarshalJSON writes d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or numeric string; null is zero.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "null" {
+		*d = Zero
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Scan reads a numeric column.
+func (d *Decimal) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		*d = Zero
+	case []byte:
+		*d, err = Parse(string(v))
+	case string:
+		*d, err = Parse(v)
+	case int64:
+		*d = FromInt(v)
+	case float64:
+		*d = FromFloat(v)
+	default:
+		err = fmt.Errorf("money: cannot scan %T", value)
+	}
+	return err
+}
+
+// Value writes d as exact decimal text.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.StringFixed(Scale), nil
+}
+
+// GormDataType makes every Decimal column a numeric(19,4).
+func (Decimal) GormDataType() string {
+	return "numeric(19,4)"
+}
+
+// Ptr returns a pointer to d, for optional amounts.
+func Ptr(d Decimal) *Decimal {
+	return &d
+}
@@ -0,0 +1,228 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"1250.50", "1250.50"},
+		{"-3", "-3.00"},
+		{"1.2e3", "1200.00"},
+		{"0.5875", "0.5875"},
+		// Digits beyond Scale places round half away from zero
+		{"0.12345", "0.1235"},
+		{"-0.12345", "-0.1235"},
+		{"0.12344", "0.1234"},
+		{"100.10", "100.10"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "1/3", "1_000", "1e30", "-922337203685477.5808"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int
+		want   string
+	}{
+		{"1.005", 2, "1.01"},
+		{"1.0049", 2, "1.00"},
+		{"-1.005", 2, "-1.01"},
+		{"2.5", 0, "3.00"},
+		{"-2.5", 0, "-3.00"},
+		{"0.1235", 3, "0.124"},
+		{"1234.5678", 4, "1234.5678"},
+		{"1234.5678", -2, "1200.00"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.in).Round(tt.places)
+		if got.String() != tt.want {
+			t.Errorf("%s.Round(%d) = %s, want %s", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTo(t *testing.T) {
+	tests := []struct {
+		in, currency, want string
+	}{
+		{"1234.565", "USD", "1234.57"},
+		{"1234.5", "JPY", "1235"},
+		{"12.3455", "BHD", "12.346"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.in).RoundTo(tt.currency)
+		if s := got.StringFixed(MinorUnits(tt.currency)); s != tt.want {
+			t.Errorf("%s.RoundTo(%s) = %s, want %s", tt.in, tt.currency, s, tt.want)
+		}
+	}
+}
+
+func TestStringFixed(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int
+		want   string
+	}{
+		{"0.5875", 4, "0.5875"},
+		{"0.5875", 2, "0.59"},
+		{"-0.005", 2, "-0.01"},
+		{"12", 0, "12"},
+		{"12.5", 6, "12.5000"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).StringFixed(tt.places); got != tt.want {
+			t.Errorf("%s.StringFixed(%d) = %s, want %s", tt.in, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"12.5", "0.585", "7.3125"},
+		// 0.0001 * 0.5 = 0.00005, half away from zero
+		{"0.0001", "0.5", "0.0001"},
+		{"-0.0001", "0.5", "-0.0001"},
+		{"0.0001", "0.4999", "0.00"},
+		{"100", "-1.5", "-150.00"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.a).Mul(MustParse(tt.b))
+		if got.String() != tt.want {
+			t.Errorf("%s * %s = %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"1", "3", "0.3333"},
+		{"2", "3", "0.6667"},
+		{"-2", "3", "-0.6667"},
+		{"100.10", "0.5", "200.20"},
+	}
+	for _, tt := range tests {
+		got, err := MustParse(tt.a).Div(MustParse(tt.b))
+		if err != nil {
+			t.Errorf("%s / %s: %v", tt.a, tt.b, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s / %s = %s, want %s", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if _, err := FromInt(1).Div(Zero); err == nil {
+		t.Error("1 / 0 succeeded, want an error")
+	}
+	if got, _ := Max.Div(MustParse("0.5")); got != Max {
+		t.Errorf("Max / 0.5 = %s, want Max", got)
+	}
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		amount string
+		rate   float64
+		want   string
+	}{
+		// 1.345 is taken as exactly 1.345, not its nearest float
+		{"100", 1.345, "134.50"},
+		{"0.1", 0.1, "0.01"},
+		{"33.33", 1.0 / 3, "11.11"},
+		{"10", 0, "0.00"},
+	}
+	for _, tt := range tests {
+		got := MustParse(tt.amount).MulRate(tt.rate)
+		if got.String() != tt.want {
+			t.Errorf("%s.MulRate(%v) = %s, want %s", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestOverflowSaturates(t *testing.T) {
+	big := MustParse("900000000000000")
+	tests := []struct {
+		name string
+		got  Decimal
+		want Decimal
+	}{
+		{"Add", Max.Add(FromInt(1)), Max},
+		{"Add negative", Min.Add(FromInt(-1)), Min},
+		{"Sub", Min.Sub(FromInt(1)), Min},
+		{"Sub negative", Max.Sub(FromInt(-1)), Max},
+		{"Mul", big.Mul(FromInt(100)), Max},
+		{"Mul negative", big.Mul(FromInt(-100)), Min},
+		{"MulInt", big.MulInt(100), Max},
+		{"MulInt negative", big.MulInt(-100), Min},
+		{"MulInt MinInt64", FromInt(1).MulInt(math.MinInt64), Min},
+		{"MulRate", big.MulRate(1e6), Max},
+		{"MulRate negative", big.MulRate(-1e6), Min},
+		{"MulRate infinite", FromInt(1).MulRate(math.Inf(1)), Max},
+		{"MulRate negative infinite", FromInt(1).MulRate(math.Inf(-1)), Min},
+		{"MulRate NaN", FromInt(1).MulRate(math.NaN()), Max},
+		{"Round", Max.Round(0), Max},
+		{"Neg", Min.Neg(), Max},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+		if tt.got.InRange() {
+			t.Errorf("%s is in range, want out of range", tt.name)
+		}
+	}
+}
+
+func TestInRange(t *testing.T) {
+	near := Max.Sub(MustParse("0.0001"))
+	if !near.InRange() {
+		t.Errorf("%s is out of range, want in range", near)
+	}
+	if sum := near.Add(MustParse("0.0001")); sum.InRange() {
+		t.Errorf("%s is in range, want out of range", sum)
+	}
+	if !Zero.InRange() || !MustParse("-1250.50").InRange() {
+		t.Error("ordinary amounts are out of range")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var d Decimal
+	for in, want := range map[string]string{`1250.5`: "1250.50", `"0.5875"`: "0.5875", `null`: "0.00"} {
+		if err := d.UnmarshalJSON([]byte(in)); err != nil {
+			t.Errorf("UnmarshalJSON(%s): %v", in, err)
+			continue
+		}
+		if d.String() != want {
+			t.Errorf("UnmarshalJSON(%s) = %s, want %s", in, d, want)
+		}
+	}
+	if err := d.UnmarshalJSON([]byte(`1e30`)); err == nil {
+		t.Error("UnmarshalJSON(1e30) succeeded, want an error")
+	}
+}
@@ -0,0 +1,170 @@
+package payment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// NACHA record layout constants.
+const (
+	nachaRecordSize = 94
+	nachaBlocking   = 10
+	// serviceCredits marks a batch holding only credits
+	serviceCredits = "220"
+	// Transaction codes crediting a checking or savings account
+	creditChecking = "22"
+	creditSavings  = "32"
+	// nachaIDSize is the room an entry has for the payment's reference
+	nachaIDSize = 15
+)
+
+// WriteNACHA writes a batch as a NACHA ACH file with a single PPD batch of
+// credits, one entry per item, padded to full blocks of ten records.
+func WriteNACHA(w io.Writer, originator Originator, batch *models.PaymentBatch, items []Item, now time.Time) error {
+	out := bufio.NewWriter(w)
+	records := 0
+	write := func(fields ...string) {
+		record := strings.Join(fields, "")
+		out.WriteString(record)
+		out.WriteString("\n")
+		records++
+	}
+
+	odfi := originator.RoutingNumber[:8]
+	// File header
+	write("1", "01",
+		right(" "+originator.RoutingNumber, 10),
+		right(" "+digitsOf(originator.CompanyID), 10),
+		now.Format("060102"), now.Format("1504"),
+		"A", "094", "10", "1",
+		left(nachaText(originator.BankName), 23),
+		left(nachaText(originator.Name), 23),
+		left(nachaText(batch.Reference), 8))
+	// Batch header
+	write("5", serviceCredits,
+		left(nachaText(originator.Name), 16),
+		left(nachaText(batch.Reference), 20),
+		left(nachaText(originator.CompanyID), 10),
+		"PPD",
+		left("EXPENSES", 10),
+		now.Format("060102"),
+		batch.ExecutionDate.Format("060102"),
+		"   ", "1", odfi,
+		zeros(1, 7))
+
+	hash := int64(0)
+	total := money.Zero
+	for i, item := range items {
+		code := creditChecking
+		if item.Payee.AccountType == models.PayoutSavings {
+			code = creditSavings
+		}
+		amount, err := cents(item.Amount)
+		if err != nil {
+			return err
+		}
+		// A cut short reference wouldn't identify the payment any more
+		reference := nachaText(item.Reference)
+		if len(reference) > nachaIDSize {
+			return fmt.Errorf("reference %s is longer than the %d characters a NACHA file has for it", item.Reference, nachaIDSize)
+		}
+		routing, _ := strconv.ParseInt(item.Payee.RoutingNumber[:8], 10, 64)
+		hash += routing
+		total = total.Add(item.Amount)
+
+		write("6", code,
+			item.Payee.RoutingNumber,
+			left(nachaText(strings.ReplaceAll(item.Payee.AccountNumber, " ", "")), 17),
+			zeros(amount, 10),
+			left(reference, nachaIDSize),
+			left(nachaText(item.Payee.Name), 22),
+			"  ", "0",
+			odfi+zeros(int64(i+1), 7))
+	}
+	totalCents, err := cents(total)
+	if err != nil {
+		return err
+	}
+	entryHash := zeros(hash%10000000000, 10)
+
+	// Batch control
+	write("8", serviceCredits,
+		zeros(int64(len(items)), 6),
+		entryHash,
+		zeros(0, 12), zeros(totalCents, 12),
+		left(nachaText(originator.CompanyID), 10),
+		strings.Repeat(" ", 19), strings.Repeat(" ", 6),
+		odfi, zeros(1, 7))
+
+	// File control, counting the padding that follows in the blocks
+	blocks := (records + 1 + nachaBlocking - 1) / nachaBlocking
+	write("9",
+		zeros(1, 6), zeros(int64(blocks), 6),
+		zeros(int64(len(items)), 8),
+		entryHash,
+		zeros(0, 12), zeros(totalCents, 12),
+		strings.Repeat(" ", 39))
+	for records%nachaBlocking != 0 {
+		write(strings.Repeat("9", nachaRecordSize))
+	}
+	return out.Flush()
+}
+
+// cents converts a dollar amount into whole cents.
+func cents(amount money.Decimal) (int64, error) {
+	value, err := strconv.ParseInt(strings.Replace(amount.StringFixed(2), ".", "", 1), 10, 64)
+	if err != nil || value < 0 || value > 9999999999 {
+		return 0, fmt.Errorf("amount %s cannot be paid in a NACHA file", amount.StringFixed(2))
+	}
+	return value, nil
+}
+
+// nachaText keeps the characters NACHA files accept, in upper case.
+func nachaText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune(" -.,/&'()", r):
+			return r
+		}
+		return ' '
+	}, unaccent(s))
+}
+
+func digitsOf(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// left pads or truncates s to n characters, aligned left.
+func left(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+// right pads or truncates s to n characters, aligned right.
+func right(s string, n int) string {
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return strings.Repeat(" ", n-len(s)) + s
+}
+
+// zeros writes n zero-padded to width digits.
+func zeros(n int64, width int) string {
+	return fmt.Sprintf("%0*d", width, n)
+}
@@ -0,0 +1,284 @@
+// Package payment writes the bank files that pay out a payment batch:
+// NACHA ACH files for US dollar batches and SEPA pain.001 credit transfers
+// for euro ones.
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// Format is a bank file format.
+type Format string
+
+const (
+	FormatNACHA Format = "nacha"
+	FormatSEPA  Format = "sepa"
+)
+
+// Currency returns the only currency a format can pay.
+func (f Format) Currency() string {
+	if f == FormatSEPA {
+		return "EUR"
+	}
+	return "USD"
+}
+
+// Extension returns the usual file extension of the format.
+func (f Format) Extension() string {
+	if f == FormatSEPA {
+		return "xml"
+	}
+	return "ach"
+}
+
+// ParseFormat reads a format name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatNACHA, FormatSEPA:
+		return format, nil
+	}
+	return "", fmt.Errorf("Format must be %s or %s", FormatNACHA, FormatSEPA)
+}
+
+// Originator is the company paying the batch, and its bank.
+type Originator struct {
+	Name string
+	// CompanyID identifies the company to its bank in NACHA files,
+	// usually its tax ID
+	CompanyID     string
+	BankName      string
+	RoutingNumber string
+	IBAN          string
+	BIC           string
+}
+
+// Validate checks the originator has what a format needs.
+func (o Originator) Validate(format Format) error {
+	switch format {
+	case FormatNACHA:
+		if o.CompanyID == "" || !ValidRoutingNumber(o.RoutingNumber) {
+			return fmt.Errorf("NACHA files need the company ID and a valid routing number of the company's bank to be configured")
+		}
+	case FormatSEPA:
+		if o.IBAN == "" {
+			return fmt.Errorf("SEPA files need the company's IBAN to be configured")
+		}
+	}
+	return nil
+}
+
+// Payee is where an employee is paid: an IBAN for SEPA, or a US account
+// and routing number for NACHA.
+type Payee struct {
+	Name          string
+	IBAN          string
+	BIC           string
+	AccountNumber string
+	RoutingNumber string
+	AccountType   models.PayoutAccountType
+}
+
+// PayeeResolver looks up the account an employee is paid into. It returns
+// nil when the employee has none on file, and a *PayeeError when the
+// account can't be paid into yet.
+type PayeeResolver interface {
+	Payee(user *models.User) (*Payee, error)
+}
+
+// PayeeError is returned by a resolver for an employee whose account is on
+// file but can't be paid into.
+type PayeeError struct {
+	Reason string
+}
+
+func (e *PayeeError) Error() string {
+	return e.Reason
+}
+
+// MissingPayee is an employee a bank file can't pay.
+type MissingPayee struct {
+	UserID uint   `json:"user_id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// MissingPayeeError is returned when employees in a batch have no usable
+// payout account for the file's format.
+type MissingPayeeError struct {
+	Payees []MissingPayee
+}
+
+func (e *MissingPayeeError) Error() string {
+	return fmt.Sprintf("%d employees in the batch have no usable payout account", len(e.Payees))
+}
+
+// Item is one payment in a bank file.
+type Item struct {
+	ClaimID uint
+	Payee   Payee
+	Amount  money.Decimal
+	// Reference identifies the payment end to end, and is what the
+	// employee sees on their statement
+	Reference string
+	// Description is the remittance information
+	Description string
+}
+
+// Reference returns the reference a claim is paid under in a batch, e.g.
+// PB12-101. It fits the 15 characters NACHA leaves for it as long as the
+// batch and claim IDs have no more than 12 digits between them.
+func Reference(batch *models.PaymentBatch, claim *models.Claim) string {
+	return fmt.Sprintf("PB%d-%d", batch.ID, claim.ID)
+}
+
+// Items builds the payments of a batch, one per claim with something to
+// reimburse, paying each claimant into the account resolved for them. The
+// batch's claims and their users must be loaded.
+func Items(batch *models.PaymentBatch, format Format, payees PayeeResolver) ([]Item, error) {
+	items := []Item{}
+	missing := []MissingPayee{}
+	resolved := map[uint]*Payee{}
+	unusable := map[uint]string{}
+	reported := map[uint]bool{}
+	for i := range batch.Claims {
+		claim := &batch.Claims[i]
+		if claim.ReimbursableAmount.Sign() <= 0 {
+			continue
+		}
+
+		payee, ok := resolved[claim.UserID]
+		reason := unusable[claim.UserID]
+		if !ok {
+			var err error
+			payee, err = payees.Payee(&claim.User)
+			var payeeErr *PayeeError
+			if errors.As(err, &payeeErr) {
+				reason = payeeErr.Reason
+				unusable[claim.UserID] = reason
+			} else if err != nil {
+				return nil, err
+			}
+			resolved[claim.UserID] = payee
+		}
+		switch {
+		case reason != "":
+		case payee == nil:
+			reason = "No payout account on file"
+		case format == FormatSEPA && payee.IBAN == "":
+			reason = "No IBAN on file"
+		case format == FormatNACHA && (payee.AccountNumber == "" || !ValidRoutingNumber(payee.RoutingNumber)):
+			reason = "No US account and routing number on file"
+		}
+		if reason != "" {
+			if !reported[claim.UserID] {
+				reported[claim.UserID] = true
+				missing = append(missing, MissingPayee{UserID: claim.UserID, Name: strings.TrimSpace(claim.User.FirstName + " " + claim.User.LastName), Reason: reason})
+			}
+			continue
+		}
+
+		name := payee.Name
+		if name == "" {
+			name = claim.User.FirstName + " " + claim.User.LastName
+		}
+		item := Item{
+			ClaimID:     claim.ID,
+			Payee:       *payee,
+			Amount:      claim.ReimbursableAmount,
+			Reference:   Reference(batch, claim),
+			Description: "Expense claim " + claim.Title,
+		}
+		item.Payee.Name = name
+		items = append(items, item)
+	}
+	if len(missing) > 0 {
+		return nil, &MissingPayeeError{Payees: missing}
+	}
+	return items, nil
+}
+
+// Write writes the bank file of a batch in a format.
+func Write(w io.Writer, format Format, originator Originator, batch *models.PaymentBatch, items []Item, now time.Time) error {
+	if batch.Currency != format.Currency() {
+		return fmt.Errorf("%s files can only pay %s batches", strings.ToUpper(string(format)), format.Currency())
+	}
+	if err := originator.Validate(format); err != nil {
+		return err
+	}
+	if format == FormatSEPA {
+		return WriteSEPA(w, originator, batch, items, now)
+	}
+	return WriteNACHA(w, originator, batch, items, now)
+}
+
+// ValidRoutingNumber checks an ABA routing number: nine digits whose
+// weighted sum is a multiple of ten.
+func ValidRoutingNumber(number string) bool {
+	if len(number) != 9 {
+		return false
+	}
+	weights := []int{3, 7, 1, 3, 7, 1, 3, 7, 1}
+	sum := 0
+	for i, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+		sum += int(r-'0') * weights[i]
+	}
+	return sum%10 == 0
+}
+
+// accents spells accented Latin letters without their accents, as bank
+// files only take plain ASCII letters.
+var accents = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Æ", "AE",
+	"Ç", "C", "È", "E", "É", "E", "Ê", "E", "Ë", "E",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I", "Ñ", "N",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O", "Œ", "OE",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U", "Ý", "Y",
+)
+
+func unaccent(s string) string {
+	return accents.Replace(s)
+}
+
+// ValidIBAN checks an IBAN, without spaces: a country code, two check
+// digits and up to 30 letters and digits, whose mod-97 checksum is 1.
+func ValidIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 || !isLetters(iban[:2]) || digitsOf(iban[2:4]) != iban[2:4] {
+		return false
+	}
+	remainder := 0
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
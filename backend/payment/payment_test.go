@@ -0,0 +1,226 @@
+package payment
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares a written file with testdata/name, or rewrites it with
+// -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
+
+var now = time.Date(2026, 3, 9, 14, 30, 5, 0, time.UTC)
+
+func batch(currency string) *models.PaymentBatch {
+	return &models.PaymentBatch{
+		ID:            12,
+		Reference:     "PB-000012",
+		Currency:      currency,
+		ExecutionDate: time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWriteNACHA(t *testing.T) {
+	originator := Originator{
+		Name:          "Acme Widgets Inc",
+		CompanyID:     "12-3456789",
+		BankName:      "First National Bank",
+		RoutingNumber: "021000021",
+	}
+	items := []Item{
+		{ClaimID: 101, Amount: money.MustParse("1250.50"), Reference: "PB12-101", Description: "Expense claim Client visit",
+			Payee: Payee{Name: "José Müller", AccountNumber: "1234 5678 9", RoutingNumber: "011000015", AccountType: models.PayoutChecking}},
+		{ClaimID: 102, Amount: money.MustParse("89.99"), Reference: "PB12-102", Description: "Expense claim Taxi",
+			Payee: Payee{Name: "jane smith", AccountNumber: "000123456789", RoutingNumber: "121000358", AccountType: models.PayoutSavings}},
+		{ClaimID: 103, Amount: money.MustParse("0.01"), Reference: "PB12-103", Description: "Expense claim Stamps",
+			Payee: Payee{Name: "A very long payee name that is cut short", AccountNumber: "42", RoutingNumber: "026009593"}},
+	}
+
+	var out bytes.Buffer
+	if err := Write(&out, FormatNACHA, originator, batch("USD"), items, now); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "nacha.golden", out.Bytes())
+
+	records := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(records)%nachaBlocking != 0 {
+		t.Errorf("%d records, want whole blocks of %d", len(records), nachaBlocking)
+	}
+	for i, record := range records {
+		if len(record) != nachaRecordSize {
+			t.Errorf("record %d is %d characters, want %d", i+1, len(record), nachaRecordSize)
+		}
+	}
+	// 01100001 + 12100035 + 02600959
+	if hash := records[5][10:20]; hash != "0015800995" {
+		t.Errorf("entry hash %s, want 0015800995", hash)
+	}
+	if total := records[5][32:44]; total != "000000134050" {
+		t.Errorf("batch credit total %s, want 000000134050", total)
+	}
+}
+
+func TestWriteNACHARejects(t *testing.T) {
+	originator := Originator{Name: "Acme", CompanyID: "123456789", RoutingNumber: "021000021"}
+	payee := Payee{Name: "Jane", AccountNumber: "42", RoutingNumber: "011000015"}
+	tests := []struct {
+		name       string
+		originator Originator
+		currency   string
+		amount     string
+		reference  string
+	}{
+		{"euro batch", originator, "EUR", "10", "PB1-1"},
+		{"invalid routing number", Originator{Name: "Acme", CompanyID: "123456789", RoutingNumber: "021000022"}, "USD", "10", "PB1-1"},
+		{"no company ID", Originator{Name: "Acme", RoutingNumber: "021000021"}, "USD", "10", "PB1-1"},
+		{"negative amount", originator, "USD", "-1", "PB1-1"},
+		{"amount over ten digits", originator, "USD", "100000000.00", "PB1-1"},
+		{"reference over 15 characters", originator, "USD", "10", "PB1234567-123456"},
+	}
+	for _, tt := range tests {
+		items := []Item{{Payee: payee, Amount: money.MustParse(tt.amount), Reference: tt.reference}}
+		if err := Write(&bytes.Buffer{}, FormatNACHA, tt.originator, batch(tt.currency), items, now); err == nil {
+			t.Errorf("%s: Write succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestReference(t *testing.T) {
+	tests := []struct {
+		batchID, claimID uint
+		want             string
+	}{
+		{12, 101, "PB12-101"},
+		{1, 1, "PB1-1"},
+		// The most digits that fit NACHA's individual ID
+		{999999, 999999, "PB999999-999999"},
+	}
+	for _, tt := range tests {
+		got := Reference(&models.PaymentBatch{ID: tt.batchID, Reference: "PB-000012"}, &models.Claim{ID: tt.claimID})
+		if got != tt.want {
+			t.Errorf("Reference(%d, %d) = %s, want %s", tt.batchID, tt.claimID, got, tt.want)
+		}
+		if len(got) > nachaIDSize {
+			t.Errorf("Reference(%d, %d) = %s is longer than %d characters", tt.batchID, tt.claimID, got, nachaIDSize)
+		}
+	}
+}
+
+func TestWriteSEPA(t *testing.T) {
+	originator := Originator{
+		Name: "Acme Widgets GmbH",
+		IBAN: "DE89 3704 0044 0532 0130 00",
+		BIC:  "COBADEFFXXX",
+	}
+	items := []Item{
+		{ClaimID: 101, Amount: money.MustParse("1250.50"), Reference: "PB12-101", Description: "Expense claim Kundenbesuch in Köln & Bonn",
+			Payee: Payee{Name: "Zoë Lefèvre", IBAN: "fr14 2004 1010 0505 0001 3m02 606", BIC: "psstfrppxxx"}},
+		{ClaimID: 102, Amount: money.MustParse("0.10"), Reference: "PB12-102", Description: "Expense claim Parking",
+			Payee: Payee{Name: "Jan de Vries", IBAN: "NL91ABNA0417164300"}},
+	}
+
+	var out bytes.Buffer
+	if err := Write(&out, FormatSEPA, originator, batch("EUR"), items, now); err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "sepa.golden", out.Bytes())
+}
+
+func TestWriteSEPAWithoutBIC(t *testing.T) {
+	originator := Originator{Name: "Acme", IBAN: "NL91ABNA0417164300"}
+	var out bytes.Buffer
+	if err := Write(&out, FormatSEPA, originator, batch("EUR"), nil, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<Othr>", "<Id>NOTPROVIDED</Id>", "<NbOfTxs>0</NbOfTxs>", "<CtrlSum>0.00</CtrlSum>"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("file lacks %s:\n%s", want, out.String())
+		}
+	}
+	if err := Write(&out, FormatSEPA, Originator{Name: "Acme"}, batch("EUR"), nil, now); err == nil {
+		t.Error("Write without the company's IBAN succeeded, want an error")
+	}
+	if err := Write(&out, FormatSEPA, originator, batch("USD"), nil, now); err == nil {
+		t.Error("Write of a dollar batch succeeded, want an error")
+	}
+}
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		iban string
+		want bool
+	}{
+		{"DE89370400440532013000", true},
+		{"GB82WEST12345698765432", true},
+		{"FR1420041010050500013M02606", true},
+		{"NL91ABNA0417164300", true},
+		{"NO9386011117947", true},
+		{"MT84MALT011000012345MTLCAST001S", true},
+		{"DE89370400440532013001", false},
+		{"GB28WEST12345698765432", false},
+		{"DE8937040044053201300", false},
+		{"NO938601111794", false},
+		{"MT84MALT011000012345MTLCAST001S0000", false},
+		{"de89370400440532013000", false},
+		{"DE89 3704 0044 0532 0130 00", false},
+		{"D189370400440532013000", false},
+		{"DEXX370400440532013000", false},
+		{"DE89370400440532013-00", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidIBAN(tt.iban); got != tt.want {
+			t.Errorf("ValidIBAN(%q) = %v, want %v", tt.iban, got, tt.want)
+		}
+	}
+}
+
+func TestValidRoutingNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"021000021", true},
+		{"011000015", true},
+		{"121000358", true},
+		{"026009593", true},
+		{"021000022", false},
+		{"120000358", false},
+		{"02100002", false},
+		{"0210000210", false},
+		{"02100002A", false},
+		{"02100 021", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRoutingNumber(tt.number); got != tt.want {
+			t.Errorf("ValidRoutingNumber(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package payment
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// sepaNamespace is that of the pain.001.001.03 credit transfer initiation
+// every SEPA bank accepts.
+const sepaNamespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+
+type sepaDocument struct {
+	XMLName  xml.Name     `xml:"Document"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Transfer sepaTransfer `xml:"CstmrCdtTrfInitn"`
+}
+
+type sepaTransfer struct {
+	GroupHeader sepaGroupHeader `xml:"GrpHdr"`
+	Payment     sepaPayment     `xml:"PmtInf"`
+}
+
+type sepaGroupHeader struct {
+	MessageID       string    `xml:"MsgId"`
+	Created         string    `xml:"CreDtTm"`
+	Transactions    int       `xml:"NbOfTxs"`
+	ControlSum      string    `xml:"CtrlSum"`
+	InitiatingParty sepaParty `xml:"InitgPty"`
+}
+
+type sepaPayment struct {
+	ID            string            `xml:"PmtInfId"`
+	Method        string            `xml:"PmtMtd"`
+	BatchBooking  bool              `xml:"BtchBookg"`
+	Transactions  int               `xml:"NbOfTxs"`
+	ControlSum    string            `xml:"CtrlSum"`
+	ServiceLevel  string            `xml:"PmtTpInf>SvcLvl>Cd"`
+	ExecutionDate string            `xml:"ReqdExctnDt"`
+	Debtor        sepaParty         `xml:"Dbtr"`
+	DebtorIBAN    string            `xml:"DbtrAcct>Id>IBAN"`
+	DebtorAgent   sepaAgent         `xml:"DbtrAgt"`
+	ChargeBearer  string            `xml:"ChrgBr"`
+	Transfers     []sepaTransaction `xml:"CdtTrfTxInf"`
+}
+
+type sepaParty struct {
+	Name string `xml:"Nm"`
+}
+
+// sepaAgent names a bank by its BIC, or as not provided when the IBAN is
+// enough to route the payment.
+type sepaAgent struct {
+	BIC   string     `xml:"FinInstnId>BIC,omitempty"`
+	Other *sepaOther `xml:"FinInstnId>Othr,omitempty"`
+}
+
+type sepaOther struct {
+	ID string `xml:"Id"`
+}
+
+type sepaTransaction struct {
+	EndToEndID   string     `xml:"PmtId>EndToEndId"`
+	Amount       sepaAmount `xml:"Amt>InstdAmt"`
+	CreditorBank *sepaAgent `xml:"CdtrAgt,omitempty"`
+	Creditor     sepaParty  `xml:"Cdtr"`
+	CreditorIBAN string     `xml:"CdtrAcct>Id>IBAN"`
+	Remittance   string     `xml:"RmtInf>Ustrd"`
+}
+
+type sepaAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// WriteSEPA writes a batch as a SEPA credit transfer initiation in
+// pain.001.001.03, one transfer per item.
+func WriteSEPA(w io.Writer, originator Originator, batch *models.PaymentBatch, items []Item, now time.Time) error {
+	total := money.Zero
+	transfers := make([]sepaTransaction, 0, len(items))
+	for _, item := range items {
+		total = total.Add(item.Amount)
+		transfer := sepaTransaction{
+			EndToEndID:   sepaText(item.Reference, 35),
+			Amount:       sepaAmount{Currency: batch.Currency, Value: item.Amount.StringFixed(2)},
+			Creditor:     sepaParty{Name: sepaText(item.Payee.Name, 70)},
+			CreditorIBAN: compact(item.Payee.IBAN),
+			Remittance:   sepaText(item.Description, 140),
+		}
+		if item.Payee.BIC != "" {
+			transfer.CreditorBank = &sepaAgent{BIC: compact(item.Payee.BIC)}
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	debtorAgent := sepaAgent{BIC: originator.BIC}
+	if debtorAgent.BIC == "" {
+		debtorAgent.Other = &sepaOther{ID: "NOTPROVIDED"}
+	}
+	document := sepaDocument{
+		Xmlns: sepaNamespace,
+		Transfer: sepaTransfer{
+			GroupHeader: sepaGroupHeader{
+				MessageID:       sepaText(batch.Reference+"-"+now.Format("20060102150405"), 35),
+				Created:         now.Format("2006-01-02T15:04:05"),
+				Transactions:    len(transfers),
+				ControlSum:      total.StringFixed(2),
+				InitiatingParty: sepaParty{Name: sepaText(originator.Name, 70)},
+			},
+			Payment: sepaPayment{
+				ID:            sepaText(batch.Reference, 35),
+				Method:        "TRF",
+				BatchBooking:  true,
+				Transactions:  len(transfers),
+				ControlSum:    total.StringFixed(2),
+				ServiceLevel:  "SEPA",
+				ExecutionDate: batch.ExecutionDate.Format("2006-01-02"),
+				Debtor:        sepaParty{Name: sepaText(originator.Name, 70)},
+				DebtorIBAN:    compact(originator.IBAN),
+				DebtorAgent:   debtorAgent,
+				ChargeBearer:  "SLEV",
+				Transfers:     transfers,
+			},
+		},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// sepaText keeps the Latin characters SEPA allows, truncated to n.
+func sepaText(s string, n int) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune(" /-?:().,'+", r):
+			return r
+		}
+		return ' '
+	}, unaccent(s))
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		s = strings.TrimSpace(s[:n])
+	}
+	return s
+}
+
+// compact removes the spaces IBANs and BICs are often written with.
+func compact(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+}
@@ -0,0 +1,86 @@
+package payout
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"hrcs/backend/config"
+)
+
+// ErrNoKey is returned when payout details are used without an
+// encryption key configured.
+var ErrNoKey = errors.New("payout: PAYOUT_ENCRYPTION_KEY is not configured")
+
+// Cipher encrypts payout account identifiers with AES-256-GCM. Each value
+// is bound to the field and employee it belongs to, so an encrypted value
+// copied to another row fails to decrypt.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// New returns the cipher keyed by PAYOUT_ENCRYPTION_KEY, or nil when no
+// key is configured.
+func New(cfg *config.Config) (*Cipher, error) {
+	if cfg.PayoutEncryptionKey == "" {
+		return nil, nil
+	}
+	return NewCipher(cfg.PayoutEncryptionKey)
+}
+
+// NewCipher returns a cipher for a base64-encoded 32-byte key, such as
+// one made with `openssl rand -base64 32`.
+func NewCipher(key string) (*Cipher, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("payout: the encryption key must be 32 bytes, base64-encoded")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt seals a value for a field of an employee's account. Empty
+// values stay empty.
+func (c *Cipher) Encrypt(value string, userID uint, field string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), associated(userID, field))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt for the same field and employee.
+func (c *Cipher) Decrypt(sealed string, userID uint, field string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < c.aead.NonceSize() {
+		return "", fmt.Errorf("payout: malformed %s of user %d", field, userID)
+	}
+	nonce, ciphertext := raw[:c.aead.NonceSize()], raw[c.aead.NonceSize():]
+	value, err := c.aead.Open(nil, nonce, ciphertext, associated(userID, field))
+	if err != nil {
+		return "", fmt.Errorf("payout: cannot decrypt %s of user %d: %w", field, userID, err)
+	}
+	return string(value), nil
+}
+
+func associated(userID uint, field string) []byte {
+	return []byte(fmt.Sprintf("payout:%d:%s", userID, field))
+}
@@ -0,0 +1,310 @@
+// Package payout keeps the bank accounts employees are reimbursed into,
+// with the account identifiers encrypted at rest, every change audited,
+// and changed accounts optionally held back from payment files until an
+// admin verifies them.
+package payout
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/payment"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Encrypted fields, as bound into their ciphertexts.
+const (
+	fieldIBAN          = "iban"
+	fieldAccountNumber = "account_number"
+	fieldRoutingNumber = "routing_number"
+)
+
+// ErrSelfVerification is returned when an admin tries to verify an account
+// they changed, or their own.
+var ErrSelfVerification = errors.New("A payout account must be verified by an admin other than the one who changed it or owns it")
+
+// Details are a payout account in the clear, as entered.
+type Details struct {
+	AccountHolder string                   `json:"account_holder"`
+	IBAN          string                   `json:"iban"`
+	BIC           string                   `json:"bic"`
+	AccountNumber string                   `json:"account_number"`
+	RoutingNumber string                   `json:"routing_number"`
+	AccountType   models.PayoutAccountType `json:"account_type"`
+}
+
+// Normalize removes the spaces account identifiers are often written with
+// and checks the details name a holder and an account that can be paid
+// into: a valid IBAN, a US account with a valid routing number, or both.
+func (d *Details) Normalize() error {
+	d.AccountHolder = strings.TrimSpace(d.AccountHolder)
+	d.IBAN = strings.ToUpper(strings.Join(strings.Fields(d.IBAN), ""))
+	d.BIC = strings.ToUpper(strings.TrimSpace(d.BIC))
+	d.AccountNumber = strings.Join(strings.Fields(d.AccountNumber), "")
+	d.RoutingNumber = strings.TrimSpace(d.RoutingNumber)
+
+	if d.AccountHolder == "" {
+		return errors.New("Account holder is required")
+	}
+	if d.IBAN == "" && d.AccountNumber == "" {
+		return errors.New("An IBAN or an account and routing number is required")
+	}
+	if d.IBAN != "" && !payment.ValidIBAN(d.IBAN) {
+		return errors.New("Invalid IBAN")
+	}
+	if d.BIC != "" && len(d.BIC) != 8 && len(d.BIC) != 11 {
+		return errors.New("BIC must be 8 or 11 characters")
+	}
+	if d.AccountNumber != "" {
+		if len(d.AccountNumber) > 17 || strings.Trim(d.AccountNumber, "0123456789") != "" {
+			return errors.New("Account number must be up to 17 digits")
+		}
+		if !payment.ValidRoutingNumber(d.RoutingNumber) {
+			return errors.New("Invalid routing number")
+		}
+		switch d.AccountType {
+		case "":
+			d.AccountType = models.PayoutChecking
+		case models.PayoutChecking, models.PayoutSavings:
+		default:
+			return fmt.Errorf("Account type must be %s or %s", models.PayoutChecking, models.PayoutSavings)
+		}
+	} else {
+		d.RoutingNumber = ""
+		d.AccountType = ""
+	}
+	return nil
+}
+
+// Accounts reads and writes payout accounts.
+type Accounts struct {
+	DB     *gorm.DB
+	Cipher *Cipher
+	// RequireVerification holds every changed account back from payment
+	// files until an admin verifies it
+	RequireVerification bool
+}
+
+func NewAccounts(db *gorm.DB, cipher *Cipher, requireVerification bool) *Accounts {
+	return &Accounts{DB: db, Cipher: cipher, RequireVerification: requireVerification}
+}
+
+// Get returns an employee's account, masked, or gorm.ErrRecordNotFound.
+func (a *Accounts) Get(userID uint) (*models.PayoutAccount, error) {
+	var account models.PayoutAccount
+	if err := a.DB.Preload("VerifiedBy").Where("user_id = ?", userID).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Save sets an employee's account to normalized details, auditing which
+// fields changed. Saving unchanged details records nothing.
+func (a *Accounts) Save(userID uint, details Details, actor *models.User) (*models.PayoutAccount, error) {
+	if a.Cipher == nil {
+		return nil, ErrNoKey
+	}
+
+	var account models.PayoutAccount
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		action := models.PayoutUpdated
+		current := Details{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&account).Error
+		if err == gorm.ErrRecordNotFound {
+			action = models.PayoutCreated
+			account = models.PayoutAccount{UserID: userID}
+		} else if err != nil {
+			return err
+		} else if current, err = a.open(&account); err != nil {
+			return err
+		}
+
+		fields := changed(current, details)
+		if len(fields) == 0 {
+			return nil
+		}
+		if err := a.seal(&account, details); err != nil {
+			return err
+		}
+		account.UpdatedByID = actor.ID
+		if a.RequireVerification {
+			account.PendingVerification = true
+			account.VerifiedAt = nil
+			account.VerifiedByID = nil
+		}
+		if err := tx.Omit(clause.Associations).Save(&account).Error; err != nil {
+			return err
+		}
+		return audit(tx, &account, action, fields, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// Remove deletes an employee's account.
+func (a *Accounts) Remove(userID uint, actor *models.User) error {
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		var account models.PayoutAccount
+		if err := tx.Where("user_id = ?", userID).First(&account).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&account).Error; err != nil {
+			return err
+		}
+		return audit(tx, &account, models.PayoutRemoved, nil, actor)
+	})
+}
+
+// Verify confirms an employee's account, releasing it for payment files.
+// The admin verifying it can't be the one who last changed it, nor the
+// employee it belongs to.
+func (a *Accounts) Verify(userID uint, actor *models.User) (*models.PayoutAccount, error) {
+	var account models.PayoutAccount
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&account).Error; err != nil {
+			return err
+		}
+		if actor.ID == account.UpdatedByID || actor.ID == account.UserID {
+			return ErrSelfVerification
+		}
+		now := time.Now()
+		account.PendingVerification = false
+		account.VerifiedAt = &now
+		account.VerifiedByID = &actor.ID
+		if err := tx.Omit(clause.Associations).Save(&account).Error; err != nil {
+			return err
+		}
+		return audit(tx, &account, models.PayoutVerified, nil, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	account.VerifiedBy = actor
+	return &account, nil
+}
+
+// Changes returns the audit trail of an employee's account, newest first.
+func (a *Accounts) Changes(userID uint) ([]models.PayoutAccountChange, error) {
+	var changes []models.PayoutAccountChange
+	err := a.DB.Preload("Actor").Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&changes).Error
+	return changes, err
+}
+
+// Payee resolves the account an employee is paid into, for payment files.
+func (a *Accounts) Payee(user *models.User) (*payment.Payee, error) {
+	var account models.PayoutAccount
+	err := a.DB.Where("user_id = ?", user.ID).First(&account).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.RequireVerification && account.PendingVerification {
+		return nil, &payment.PayeeError{Reason: "Payout account changed and awaiting verification"}
+	}
+	if a.Cipher == nil {
+		return nil, ErrNoKey
+	}
+
+	details, err := a.open(&account)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.Payee{
+		Name:          details.AccountHolder,
+		IBAN:          details.IBAN,
+		BIC:           details.BIC,
+		AccountNumber: details.AccountNumber,
+		RoutingNumber: details.RoutingNumber,
+		AccountType:   details.AccountType,
+	}, nil
+}
+
+// seal encrypts details into an account, with their masked forms.
+func (a *Accounts) seal(account *models.PayoutAccount, details Details) error {
+	var err error
+	if account.IBANCipher, err = a.Cipher.Encrypt(details.IBAN, account.UserID, fieldIBAN); err != nil {
+		return err
+	}
+	if account.AccountNumberCipher, err = a.Cipher.Encrypt(details.AccountNumber, account.UserID, fieldAccountNumber); err != nil {
+		return err
+	}
+	if account.RoutingNumberCipher, err = a.Cipher.Encrypt(details.RoutingNumber, account.UserID, fieldRoutingNumber); err != nil {
+		return err
+	}
+	account.AccountHolder = details.AccountHolder
+	account.IBAN = Mask(details.IBAN, 2)
+	account.AccountNumber = Mask(details.AccountNumber, 0)
+	account.RoutingNumber = Mask(details.RoutingNumber, 0)
+	account.BIC = details.BIC
+	account.AccountType = details.AccountType
+	return nil
+}
+
+// open decrypts an account's details.
+func (a *Accounts) open(account *models.PayoutAccount) (Details, error) {
+	details := Details{AccountHolder: account.AccountHolder, BIC: account.BIC, AccountType: account.AccountType}
+	var err error
+	if details.IBAN, err = a.Cipher.Decrypt(account.IBANCipher, account.UserID, fieldIBAN); err != nil {
+		return details, err
+	}
+	if details.AccountNumber, err = a.Cipher.Decrypt(account.AccountNumberCipher, account.UserID, fieldAccountNumber); err != nil {
+		return details, err
+	}
+	if details.RoutingNumber, err = a.Cipher.Decrypt(account.RoutingNumberCipher, account.UserID, fieldRoutingNumber); err != nil {
+		return details, err
+	}
+	return details, nil
+}
+
+// changed names the fields that differ between two sets of details.
+func changed(before, after Details) []string {
+	fields := []string{}
+	for _, field := range []struct {
+		name          string
+		before, after string
+	}{
+		{"account_holder", before.AccountHolder, after.AccountHolder},
+		{fieldIBAN, before.IBAN, after.IBAN},
+		{"bic", before.BIC, after.BIC},
+		{fieldAccountNumber, before.AccountNumber, after.AccountNumber},
+		{fieldRoutingNumber, before.RoutingNumber, after.RoutingNumber},
+		{"account_type", string(before.AccountType), string(after.AccountType)},
+	} {
+		if field.before != field.after {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
+
+func audit(tx *gorm.DB, account *models.PayoutAccount, action models.PayoutChangeAction, fields []string, actor *models.User) error {
+	return tx.Create(&models.PayoutAccountChange{
+		UserID:        account.UserID,
+		ActorID:       actor.ID,
+		Action:        action,
+		Fields:        fields,
+		IBAN:          account.IBAN,
+		AccountNumber: account.AccountNumber,
+	}).Error
+}
+
+// Mask hides all but the last four characters of an account identifier,
+// and the first keep, e.g. an IBAN's country code.
+func Mask(value string, keep int) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= keep+4 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:keep] + strings.Repeat("*", len(value)-keep-4) + value[len(value)-4:]
+}
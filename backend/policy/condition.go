@@ -0,0 +1,102 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition is the JSON form of an expression, for clients that would
+// rather build rules than write them. A condition is either a comparison
+// of a field with a value, or all, any or not of other conditions:
+//
+//	{"all": [
+//	  {"field": "line.type", "op": "==", "value": "TRAVEL"},
+//	  {"field": "line.amount", "op": ">", "value": 250}
+//	]}
+type Condition struct {
+	All   []Condition `json:"all,omitempty"`
+	Any   []Condition `json:"any,omitempty"`
+	Not   *Condition  `json:"not,omitempty"`
+	Field string      `json:"field,omitempty"`
+	// Op is one of == != < <= > >= in contains matches
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+var fieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// Expression converts the condition into the expression language, which
+// is how rules are stored.
+func (c *Condition) Expression() (string, error) {
+	switch {
+	case c.All != nil:
+		return c.join(c.All, " && ")
+	case c.Any != nil:
+		return c.join(c.Any, " || ")
+	case c.Not != nil:
+		inner, err := c.Not.Expression()
+		if err != nil {
+			return "", err
+		}
+		return "!(" + inner + ")", nil
+	}
+
+	if !fieldName.MatchString(c.Field) {
+		return "", fmt.Errorf("invalid field %q", c.Field)
+	}
+	value, err := literal(c.Value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", c.Field, err)
+	}
+
+	switch c.Op {
+	case "==", "!=", "<", "<=", ">", ">=", "in":
+		if c.Op == "in" && !strings.HasPrefix(value, "[") {
+			return "", fmt.Errorf("%s: in needs a list of values", c.Field)
+		}
+		return c.Field + " " + c.Op + " " + value, nil
+	case "contains", "matches":
+		return c.Op + "(" + c.Field + ", " + value + ")", nil
+	}
+	return "", fmt.Errorf("%s: unknown operator %q", c.Field, c.Op)
+}
+
+func (c *Condition) join(conditions []Condition, op string) (string, error) {
+	if len(conditions) == 0 {
+		return "", fmt.Errorf("all and any need at least one condition")
+	}
+	parts := make([]string, 0, len(conditions))
+	for i := range conditions {
+		part, err := conditions[i].Expression()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "("+part+")")
+	}
+	return strings.Join(parts, op), nil
+}
+
+// literal writes a JSON value as an expression literal.
+func literal(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			text, err := literal(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
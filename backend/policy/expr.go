@@ -0,0 +1,856 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"hrcs/backend/money"
+)
+
+// Env resolves the variables an expression refers to, such as line.amount.
+type Env func(name string) (interface{}, bool)
+
+// Program is a compiled expression. Values are numbers (money.Decimal),
+// strings, booleans and lists of those. Numbers are exact to money.Scale
+// places, so amount > 100.10 holds for 100.11 and not for 100.10, and
+// division rounds half away from zero to that many places.
+//
+// The language has the usual comparison (== != < <= > >=), boolean
+// (&& || ! or and, or, not) and arithmetic (+ - * /) operators, list
+// membership with in, string and number literals, lists such as
+// ["a", "b"], and a handful of functions: lower, upper, contains,
+// matches, number, len, min, max, abs and round. For example:
+//
+//	line.type == "TRAVEL" && lower(line.attributes.city) in ["london", "tokyo"]
+type Program struct {
+	Source string
+	root   node
+	vars   map[string]bool
+}
+
+// Compile parses an expression.
+func Compile(src string) (*Program, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vars: map[string]bool{}}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+	}
+	return &Program{Source: src, root: root, vars: p.vars}, nil
+}
+
+// Vars lists the variables the expression refers to.
+func (p *Program) Vars() []string {
+	vars := make([]string, 0, len(p.vars))
+	for name := range p.vars {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// Eval evaluates the expression against env.
+func (p *Program) Eval(env Env) (interface{}, error) {
+	return p.root.eval(env)
+}
+
+// Test evaluates an expression that must come out true or false.
+func (p *Program) Test(env Env) (bool, error) {
+	value, err := p.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression gives %s, not true or false", describe(value))
+	}
+	return result, nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  money.Decimal
+	pos  int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]", ","}
+
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1]))):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			num, err := money.Parse(src[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", src[start:i], start+1)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], num: num, pos: start})
+
+		case c == '"':
+			// Double-quoted strings take Go escapes
+			start := i
+			i++
+			for i < len(src) && src[i] != '"' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", start+1)
+			}
+			i++
+			text, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", start+1)
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: start})
+
+		case c == '\'':
+			// Single-quoted strings are taken literally, which suits
+			// regular expressions
+			start := i
+			end := strings.IndexByte(src[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", start+1)
+			}
+			tokens = append(tokens, token{kind: tokString, text: src[i+1 : i+1+end], pos: start})
+			i += end + 2
+
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at position %d", string(c), i+1)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of expression", pos: len(src)}), nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators or
+// keywords.
+func (p *parser) accept(texts ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp && tok.kind != tokIdent {
+		return "", false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			p.next()
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expect(text string) error {
+	if _, ok := p.accept(text); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q but found %q at position %d", text, tok.text, tok.pos+1)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithNode{op: "-", left: &literalNode{value: money.Zero}, right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return &literalNode{value: tok.num}, nil
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		if strings.HasSuffix(tok.text, ".") {
+			return nil, fmt.Errorf("invalid name %q at position %d", tok.text, tok.pos+1)
+		}
+		p.vars[tok.text] = true
+		return &varNode{name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			items := []node{}
+			if _, ok := p.accept("]"); ok {
+				return &listNode{items: items}, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if _, ok := p.accept("]"); ok {
+					return &listNode{items: items}, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos+1)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos+1)
+	}
+
+	args := []node{}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments to %s at position %d", name.text, name.pos+1)
+	}
+
+	call := &callNode{name: name.text, fn: fn, args: args}
+	// Constant patterns are compiled up front so mistakes show when the
+	// rule is saved
+	if name.text == "matches" {
+		if pattern, ok := args[1].(*literalNode); ok {
+			text, ok := pattern.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("matches needs a string pattern at position %d", name.pos+1)
+			}
+			re, err := regexp.Compile(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern at position %d: %v", name.pos+1, err)
+			}
+			call.pattern = re
+		}
+	}
+	return call, nil
+}
+
+// Evaluation
+
+type node interface {
+	eval(env Env) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env Env) (interface{}, error) {
+	return n.value, nil
+}
+
+type varNode struct {
+	name string
+}
+
+func (n *varNode) eval(env Env) (interface{}, error) {
+	value, ok := env(n.name)
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s", n.name)
+	}
+	return value, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env Env) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicalNode) eval(env Env) (interface{}, error) {
+	left, err := evalBool(n.left, env)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit, so guards such as x != "" && number(x) > 1 work
+	if left == n.or {
+		return left, nil
+	}
+	return evalBool(n.right, env)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(env Env) (interface{}, error) {
+	value, err := evalBool(n.operand, env)
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "in":
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in needs a list, not %s", describe(right))
+		}
+		for _, item := range list {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+
+	cmp, err := compare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+type arithNode struct {
+	op          string
+	left, right node
+}
+
+func (n *arithNode) eval(env Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// + joins strings too
+	if n.op == "+" {
+		ls, lok := left.(string)
+		rs, rok := right.(string)
+		if lok && rok {
+			return ls + rs, nil
+		}
+	}
+
+	a, aok := toNumber(left)
+	b, bok := toNumber(right)
+	if !aok || !bok {
+		return nil, fmt.Errorf("cannot apply %s to %s and %s", n.op, describe(left), describe(right))
+	}
+	var result money.Decimal
+	switch n.op {
+	case "+":
+		result = a.Add(b)
+	case "-":
+		result = a.Sub(b)
+	case "*":
+		result = a.Mul(b)
+	default:
+		if result, err = a.Div(b); err != nil {
+			return nil, err
+		}
+	}
+	if !result.InRange() {
+		return nil, fmt.Errorf("%s %s %s is too large", describe(left), n.op, describe(right))
+	}
+	return result, nil
+}
+
+type callNode struct {
+	name    string
+	fn      function
+	args    []node
+	pattern *regexp.Regexp
+}
+
+func (n *callNode) eval(env Env) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	if n.pattern != nil {
+		text, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("matches needs a string, not %s", describe(args[0]))
+		}
+		return n.pattern.MatchString(text), nil
+	}
+
+	value, err := n.fn.call(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.name, err)
+	}
+	return value, nil
+}
+
+func evalBool(n node, env Env) (bool, error) {
+	value, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false, not %s", describe(value))
+	}
+	return result, nil
+}
+
+// toNumber takes numbers as they are and numeric strings, such as line
+// attributes, at their value.
+func toNumber(value interface{}) (money.Decimal, bool) {
+	switch v := value.(type) {
+	case money.Decimal:
+		return v, true
+	case string:
+		num, err := money.Parse(v)
+		return num, err == nil
+	}
+	return money.Zero, false
+}
+
+// equal compares a number with a numeric string by value, so attribute
+// values can be compared with number literals.
+func equal(a, b interface{}) bool {
+	_, aNum := a.(money.Decimal)
+	_, bNum := b.(money.Decimal)
+	if aNum || bNum {
+		x, xok := toNumber(a)
+		y, yok := toNumber(b)
+		return xok && yok && x.Cmp(y) == 0
+	}
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+func compare(a, b interface{}) (int, error) {
+	_, aNum := a.(money.Decimal)
+	_, bNum := b.(money.Decimal)
+	if aNum || bNum {
+		x, xok := toNumber(a)
+		y, yok := toNumber(b)
+		if !xok || !yok {
+			return 0, fmt.Errorf("cannot compare %s with %s", describe(a), describe(b))
+		}
+		return x.Cmp(y), nil
+	}
+
+	// Strings compare alphabetically, which orders YYYY-MM-DD dates too
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if !aok || !bok {
+		return 0, fmt.Errorf("cannot compare %s with %s", describe(a), describe(b))
+	}
+	return strings.Compare(as, bs), nil
+}
+
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case money.Decimal:
+		return "the number " + formatNumber(v)
+	case string:
+		return "the string " + strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		return "a list"
+	case nil:
+		return "nothing"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// formatNumber writes a number without trailing zeros, e.g. 100.1 or 3.
+func formatNumber(num money.Decimal) string {
+	return strings.TrimSuffix(strings.TrimRight(num.StringFixed(money.Scale), "0"), ".")
+}
+
+// Functions
+
+type function struct {
+	minArgs, maxArgs int
+	call             func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"lower": {1, 1, func(args []interface{}) (interface{}, error) {
+		s, err := stringArg(args[0])
+		return strings.ToLower(s), err
+	}},
+	"upper": {1, 1, func(args []interface{}) (interface{}, error) {
+		s, err := stringArg(args[0])
+		return strings.ToUpper(s), err
+	}},
+	"contains": {2, 2, func(args []interface{}) (interface{}, error) {
+		if list, ok := args[0].([]interface{}); ok {
+			for _, item := range list {
+				if equal(item, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sub, err := stringArg(args[1])
+		return strings.Contains(s, sub), err
+	}},
+	"matches": {2, 2, func(args []interface{}) (interface{}, error) {
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}},
+	"number": {1, 1, func(args []interface{}) (interface{}, error) {
+		// Missing attributes count as zero
+		if s, ok := args[0].(string); ok && strings.TrimSpace(s) == "" {
+			return money.Zero, nil
+		}
+		num, ok := toNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%s is not a number", describe(args[0]))
+		}
+		return num, nil
+	}},
+	"len": {1, 1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return money.FromInt(int64(len([]rune(v)))), nil
+		case []interface{}:
+			return money.FromInt(int64(len(v))), nil
+		}
+		return nil, fmt.Errorf("needs a string or a list, not %s", describe(args[0]))
+	}},
+	"min": {1, -1, func(args []interface{}) (interface{}, error) {
+		return fold(args, func(a, b money.Decimal) money.Decimal {
+			if b.LessThan(a) {
+				return b
+			}
+			return a
+		})
+	}},
+	"max": {1, -1, func(args []interface{}) (interface{}, error) {
+		return fold(args, func(a, b money.Decimal) money.Decimal {
+			if b.GreaterThan(a) {
+				return b
+			}
+			return a
+		})
+	}},
+	"abs": {1, 1, func(args []interface{}) (interface{}, error) {
+		num, err := numberArg(args[0])
+		if num.Sign() < 0 {
+			num = num.Neg()
+		}
+		return num, err
+	}},
+	"round": {1, 2, func(args []interface{}) (interface{}, error) {
+		num, err := numberArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		places := money.Zero
+		if len(args) == 2 {
+			if places, err = numberArg(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		// Negative places round to tens, hundreds and so on
+		if places.Round(0).Cmp(places) != 0 {
+			return nil, fmt.Errorf("needs a whole number of places, not %s", formatNumber(places))
+		}
+		return num.Round(int(places.Float64())), nil
+	}},
+}
+
+func stringArg(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("needs a string, not %s", describe(value))
+	}
+	return s, nil
+}
+
+func numberArg(value interface{}) (money.Decimal, error) {
+	num, ok := toNumber(value)
+	if !ok {
+		return money.Zero, fmt.Errorf("needs a number, not %s", describe(value))
+	}
+	return num, nil
+}
+
+func fold(args []interface{}, f func(a, b money.Decimal) money.Decimal) (interface{}, error) {
+	result, err := numberArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args[1:] {
+		num, err := numberArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		result = f(result, num)
+	}
+	return result, nil
+}
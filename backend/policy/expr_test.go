@@ -0,0 +1,235 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"hrcs/backend/money"
+)
+
+func env(vars map[string]interface{}) Env {
+	return func(name string) (interface{}, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "unexpected \"end of expression\""},
+		{"1 +", "unexpected \"end of expression\""},
+		{"(1 + 2", "expected \")\""},
+		{"[1, 2", "expected \",\""},
+		{"1.2.3 > 0", "invalid number \"1.2.3\""},
+		{"99999999999999999999 > 0", "invalid number"},
+		{"\"open", "unterminated string"},
+		{"'open", "unterminated string"},
+		{"a # b", "unexpected \"#\""},
+		{"a b", "unexpected \"b\""},
+		{"line. == 1", "invalid name \"line.\""},
+		{"nope(1)", "unknown function \"nope\""},
+		{"lower()", "wrong number of arguments to lower"},
+		{"round(1, 2, 3)", "wrong number of arguments to round"},
+		{"matches(x, '(')", "invalid pattern"},
+		{"matches(x, 1)", "matches needs a string pattern"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) = %q, want it to mention %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	program, err := Compile(`line.amount > 10 && lower(line.attributes.city) in ["london"] || line.amount < claim.amount`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(program.Vars(), ",")
+	if want := "claim.amount,line.amount,line.attributes.city"; got != want {
+		t.Errorf("Vars() = %s, want %s", got, want)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"10 - 4 - 3 == 3", true},
+		{"12 / 2 / 3 == 2", true},
+		{"-2 * 3 == -6", true},
+		{"- -2 == 2", true},
+		{"2 - -2 == 4", true},
+		{"1 + 1 > 1 && 2 > 1", true},
+		{"!t && f", false},
+		{"!(t && f)", true},
+		{"not t or t", true},
+		{"t || t && f", true},
+		{"(t || t) && f", false},
+		{"f and t or t", true},
+		{"f || f || t", true},
+		{"!!t", true},
+		{"1 in [1, 2] && \"a\" in [\"a\"]", true},
+		{"1 + 1 in [2, 3]", true},
+	}
+	vars := env(map[string]interface{}{"t": true, "f": false})
+	for _, tt := range tests {
+		program, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := program.Test(vars)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestBoundaries(t *testing.T) {
+	tests := []struct {
+		src    string
+		amount string
+		want   bool
+	}{
+		{"amount > 100.10", "100.10", false},
+		{"amount > 100.10", "100.11", true},
+		{"amount > 100.10", "100.1001", true},
+		{"amount >= 100.10", "100.10", true},
+		{"amount >= 100.10", "100.0999", false},
+		{"amount < 100.10", "100.10", false},
+		{"amount <= 100.10", "100.10", true},
+		{"amount == 100.1", "100.10", true},
+		{"amount != 100.10", "100.10", false},
+		{"amount == 0.3", "0.3", true},
+		{"0.1 + 0.2 == 0.3", "0", true},
+		{"amount * 3 == 0.3", "0.1", true},
+		{"amount / 3 == 0.3333", "1", true},
+		{"amount / 3 * 3 == 1", "1", false},
+		{"amount - 0.01 < 0", "0.01", false},
+		{"amount <= 1000", "1000.00", true},
+		{"amount <= 1000", "1000.0001", false},
+		// Numeric strings, such as attributes, compare by value
+		{"attr == 100.1", "0", true},
+		{"attr > 100.09", "0", true},
+		{"number(attr) + 0.01 == 100.11", "0", true},
+	}
+	for _, tt := range tests {
+		program, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		vars := env(map[string]interface{}{"amount": money.MustParse(tt.amount), "attr": "100.10"})
+		got, err := program.Test(vars)
+		if err != nil {
+			t.Errorf("%s with amount %s: %v", tt.src, tt.amount, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s with amount %s = %v, want %v", tt.src, tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`lower("LoNdon") == "london"`, true},
+		{`upper(city) == "TOKYO"`, true},
+		{`contains("business class", "class")`, true},
+		{`contains(["a", "b"], "c")`, false},
+		{`matches(code, '^[A-Z]{3}-\d+$')`, true},
+		{`number("") == 0`, true},
+		{`number(" 12.50 ") == 12.5`, true},
+		{`len("café") == 4`, true},
+		{`len([1, 2, 3]) == 3`, true},
+		{`min(3, 1.5, 2) == 1.5`, true},
+		{`max(3, 1.5, "4") == 4`, true},
+		{`abs(-2.25) == 2.25`, true},
+		{`round(2.5) == 3`, true},
+		{`round(-2.5) == -3`, true},
+		{`round(1.005, 2) == 1.01`, true},
+		{`round(1250, -2) == 1300`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"2026-01-31" < "2026-02-01"`, true},
+	}
+	vars := env(map[string]interface{}{"city": "tokyo", "code": "ABC-12"})
+	for _, tt := range tests {
+		program, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := program.Test(vars)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"missing > 1", "unknown variable missing"},
+		{"1 / 0 > 1", "division by zero"},
+		{"word > 1", "cannot compare the string \"taxi\" with the number 1"},
+		{"word + 1 > 1", "cannot apply + to the string \"taxi\" and the number 1"},
+		{"1 in 1", "in needs a list, not the number 1"},
+		{"1 && true", "expected true or false, not the number 1"},
+		{"amount * 1000000 > 0", "is too large"},
+		{"number(word) > 1", "number: the string \"taxi\" is not a number"},
+		{"round(1.5, 0.5) > 1", "round: needs a whole number of places, not 0.5"},
+		{"1 + 1", "expression gives the number 2, not true or false"},
+	}
+	vars := env(map[string]interface{}{"word": "taxi", "amount": money.MustParse("900000000000000")})
+	for _, tt := range tests {
+		program, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		_, err = program.Test(vars)
+		if err == nil {
+			t.Errorf("%s succeeded, want an error", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s = %q, want it to mention %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	program, err := Compile(`word != "" && number(word) > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := program.Test(env(map[string]interface{}{"word": ""}))
+	if err != nil || got {
+		t.Errorf("Test = %v, %v, want false without an error", got, err)
+	}
+}
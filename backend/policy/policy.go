@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// Finding is a policy rule a claim breaks.
+type Finding struct {
+	Rule *models.PolicyRule
+	// Line is the 1-based line number, or 0 for day and claim rules and
+	// claims that aren't itemized
+	Line       int
+	LineItemID *uint
+	// Date is the day a day rule was broken on
+	Date    string
+	Message string
+	// Err is set when the rule could not be evaluated, e.g. because it
+	// compares a word with a number
+	Err error
+}
+
+// Variables available to rules, by scope. Lines also expose whatever
+// attributes the claimant recorded as line.attributes.<name>, which are
+// empty when missing. Amounts are in the claim's or line's own currency,
+// base amounts and day totals in the base currency.
+var (
+	lineVars = []string{"line.amount", "line.currency", "line.base_amount", "line.date", "line.merchant", "line.description", "line.type", "line.type_name", "line.category", "line.receipt_url"}
+	dayVars  = []string{"day.date", "day.total", "day.count"}
+	// Available in every scope
+	claimVars = []string{"claim.amount", "claim.currency", "claim.base_amount", "claim.title", "claim.description", "claim.type", "claim.lines", "claim.itemized", "user.role", "user.group", "user.location"}
+)
+
+const attributePrefix = "line.attributes."
+
+// Validate compiles a rule's expressions and checks they only use the
+// variables of its scope.
+func Validate(rule *models.PolicyRule) error {
+	switch rule.Scope {
+	case models.PolicyScopeLine, models.PolicyScopeDay, models.PolicyScopeClaim:
+	default:
+		return fmt.Errorf("invalid scope %q", rule.Scope)
+	}
+	switch rule.Severity {
+	case models.SeverityBlock, models.SeverityWarn, models.SeverityJustify:
+	default:
+		return fmt.Errorf("invalid severity %q", rule.Severity)
+	}
+
+	if strings.TrimSpace(rule.When) != "" {
+		when, err := Compile(rule.When)
+		if err != nil {
+			return fmt.Errorf("when: %v", err)
+		}
+		if err := checkVars(when, whenVars(rule.Scope), rule.Scope != models.PolicyScopeClaim); err != nil {
+			return fmt.Errorf("when: %v", err)
+		}
+	}
+
+	if strings.TrimSpace(rule.Assert) == "" {
+		return fmt.Errorf("assert is required")
+	}
+	assert, err := Compile(rule.Assert)
+	if err != nil {
+		return fmt.Errorf("assert: %v", err)
+	}
+	if err := checkVars(assert, assertVars(rule.Scope), rule.Scope == models.PolicyScopeLine); err != nil {
+		return fmt.Errorf("assert: %v", err)
+	}
+	return nil
+}
+
+// whenVars are the variables a rule's When sees: it picks lines for line
+// and day rules.
+func whenVars(scope models.PolicyScope) []string {
+	if scope == models.PolicyScopeClaim {
+		return claimVars
+	}
+	return append(append([]string{}, lineVars...), claimVars...)
+}
+
+func assertVars(scope models.PolicyScope) []string {
+	switch scope {
+	case models.PolicyScopeLine:
+		return append(append([]string{}, lineVars...), claimVars...)
+	case models.PolicyScopeDay:
+		return append(append([]string{}, dayVars...), claimVars...)
+	}
+	return claimVars
+}
+
+// checkVars rejects variables outside allowed. Line attributes can be
+// anything the claimant records, so any name under line.attributes is
+// accepted where lines are.
+func checkVars(program *Program, allowed []string, attributes bool) error {
+	known := map[string]bool{}
+	for _, name := range allowed {
+		known[name] = true
+	}
+	for _, name := range program.Vars() {
+		if known[name] || (attributes && strings.HasPrefix(name, attributePrefix) && len(name) > len(attributePrefix)) {
+			continue
+		}
+		return fmt.Errorf("unknown variable %s here; use one of %s", name, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// Evaluate checks a claim against the rules. The claim must be priced and
+// its lines loaded with their claim types, and the claimant with their
+// group.
+func Evaluate(rules []models.PolicyRule, claim *models.Claim, claimant *models.User) []Finding {
+	base := claimEnv(claim, claimant)
+	findings := []Finding{}
+	for i := range rules {
+		findings = append(findings, evaluate(&rules[i], claim, base)...)
+	}
+	return findings
+}
+
+func evaluate(rule *models.PolicyRule, claim *models.Claim, base map[string]interface{}) []Finding {
+	failed := func(err error) []Finding {
+		return []Finding{{Rule: rule, Message: fmt.Sprintf("%s could not be checked: %v", rule.Name, err), Err: err}}
+	}
+
+	var when *Program
+	if strings.TrimSpace(rule.When) != "" {
+		program, err := Compile(rule.When)
+		if err != nil {
+			return failed(err)
+		}
+		when = program
+	}
+	assert, err := Compile(rule.Assert)
+	if err != nil {
+		return failed(err)
+	}
+
+	applies := func(env Env) (bool, error) {
+		if when == nil {
+			return true, nil
+		}
+		return when.Test(env)
+	}
+
+	if rule.Scope == models.PolicyScopeClaim {
+		env := lookup(base, nil)
+		ok, err := applies(env)
+		if err != nil {
+			return failed(err)
+		}
+		if !ok {
+			return nil
+		}
+		holds, err := assert.Test(env)
+		if err != nil {
+			return failed(err)
+		}
+		if holds {
+			return nil
+		}
+		return []Finding{{Rule: rule, Message: render(rule, env)}}
+	}
+
+	itemized := len(claim.Lines) > 0
+	findings := []Finding{}
+	days := map[string]map[string]interface{}{}
+	totals := map[string]money.Decimal{}
+	for i, line := range claim.Items() {
+		env := lookup(base, lineEnv(&line))
+		ok, err := applies(env)
+		if err != nil {
+			return failed(err)
+		}
+		if !ok {
+			continue
+		}
+
+		if rule.Scope == models.PolicyScopeDay {
+			date := line.Date.Format("2006-01-02")
+			day, seen := days[date]
+			if !seen {
+				day = map[string]interface{}{"day.date": date, "day.count": money.Zero}
+				days[date] = day
+			}
+			totals[date] = totals[date].Add(line.BaseAmount)
+			day["day.count"] = day["day.count"].(money.Decimal).Add(money.FromInt(1))
+			continue
+		}
+
+		holds, err := assert.Test(env)
+		if err != nil {
+			return failed(err)
+		}
+		if holds {
+			continue
+		}
+		finding := Finding{Rule: rule, Message: render(rule, env)}
+		if itemized {
+			finding.Line = i + 1
+			id := line.ID
+			finding.LineItemID = &id
+		}
+		findings = append(findings, finding)
+	}
+
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		// Summed exactly, so the rule sees the same total as the dashboards
+		days[date]["day.total"] = totals[date]
+		env := lookup(base, days[date])
+		holds, err := assert.Test(env)
+		if err != nil {
+			return failed(err)
+		}
+		if !holds {
+			findings = append(findings, Finding{Rule: rule, Date: date, Message: render(rule, env)})
+		}
+	}
+	return findings
+}
+
+func claimEnv(claim *models.Claim, claimant *models.User) map[string]interface{} {
+	env := map[string]interface{}{
+		"claim.amount":      claim.Amount,
+		"claim.currency":    claim.Currency,
+		"claim.base_amount": claim.BaseAmount,
+		"claim.title":       claim.Title,
+		"claim.description": claim.Description,
+		"claim.type":        claim.ClaimType.Code,
+		"claim.lines":       money.FromInt(int64(len(claim.Lines))),
+		"claim.itemized":    len(claim.Lines) > 0,
+		"user.role":         string(claimant.Role),
+		"user.group":        "",
+		"user.location":     "",
+	}
+	if claimant.UserGroup != nil {
+		env["user.group"] = claimant.UserGroup.Name
+		env["user.location"] = claimant.UserGroup.Location
+	}
+	return env
+}
+
+func lineEnv(line *models.ClaimLineItem) map[string]interface{} {
+	env := map[string]interface{}{
+		"line.amount":      line.Amount,
+		"line.currency":    line.Currency,
+		"line.base_amount": line.BaseAmount,
+		"line.date":        line.Date.Format("2006-01-02"),
+		"line.merchant":    line.Merchant,
+		"line.description": line.Description,
+		"line.type":        line.ClaimType.Code,
+		"line.type_name":   line.ClaimType.Name,
+		"line.category":    string(line.ClaimType.Category),
+		"line.receipt_url": line.ReceiptURL,
+	}
+	for name, value := range line.Attributes {
+		env[attributePrefix+name] = value
+	}
+	return env
+}
+
+// lookup resolves names from the scope's own variables first, then the
+// claim's. Attributes a line doesn't have are empty.
+func lookup(base, scope map[string]interface{}) Env {
+	return func(name string) (interface{}, bool) {
+		if value, ok := scope[name]; ok {
+			return value, true
+		}
+		if value, ok := base[name]; ok {
+			return value, true
+		}
+		if strings.HasPrefix(name, attributePrefix) {
+			if _, isLine := scope["line.amount"]; isLine {
+				return "", true
+			}
+		}
+		return nil, false
+	}
+}
+
+var placeholder = regexp.MustCompile(`\{([A-Za-z0-9_.]+)\}`)
+
+// render fills in a rule's message, falling back to its name.
+func render(rule *models.PolicyRule, env Env) string {
+	if strings.TrimSpace(rule.Message) == "" {
+		return rule.Name
+	}
+	return placeholder.ReplaceAllStringFunc(rule.Message, func(match string) string {
+		value, ok := env(match[1 : len(match)-1])
+		if !ok {
+			return match
+		}
+		switch v := value.(type) {
+		case money.Decimal:
+			if v.Round(0).Cmp(v) == 0 {
+				return v.StringFixed(0)
+			}
+			return v.StringFixed(2)
+		}
+		return fmt.Sprint(value)
+	})
+}
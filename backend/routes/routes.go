@@ -3,20 +3,43 @@ package routes
 import (
 	"hrcs/backend/config"
 	"hrcs/backend/handlers"
+	"hrcs/backend/journal"
 	"hrcs/backend/middleware"
+	"hrcs/backend/payout"
+	"hrcs/backend/storage"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config) {
+func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config, store storage.Store, payouts *payout.Cipher) {
 	authHandler := handlers.NewAuthHandler(db, cfg)
 	userHandler := handlers.NewUserHandler(db)
-	claimHandler := handlers.NewClaimHandler(db)
+	claimHandler := handlers.NewClaimHandler(db, cfg.BaseCurrency, cfg.DuplicateWindowDays, cfg.DuplicateBlockExact)
 	adminHandler := handlers.NewAdminHandler(db)
 	adminEnhanced := handlers.NewAdminEnhancedHandler(db)
-	dashboardHandler := handlers.NewDashboardHandler(db)
+	dashboardHandler := handlers.NewDashboardHandler(db, cfg.BaseCurrency)
+	delegationHandler := handlers.NewDelegationHandler(db)
+	calendarHandler := handlers.NewCalendarHandler(db)
+	reasonCodeHandler := handlers.NewReasonCodeHandler(db)
+	attachmentHandler := handlers.NewAttachmentHandler(db, store, cfg.MaxUploadSize)
+	policyRuleHandler := handlers.NewPolicyRuleHandler(db)
+	currencyHandler := handlers.NewCurrencyHandler(db, cfg.BaseCurrency)
+	rateTableHandler := handlers.NewRateTableHandler(db)
+	costCenterHandler := handlers.NewCostCenterHandler(db)
+	budgetHandler := handlers.NewBudgetHandler(db)
+	cardHandler := handlers.NewCardHandler(db, cfg.BaseCurrency)
+	advanceHandler := handlers.NewAdvanceHandler(db, cfg.BaseCurrency)
+	payoutAccounts := payout.NewAccounts(db, payouts, cfg.PayoutRequireVerification)
+	payoutHandler := handlers.NewPayoutHandler(db, payoutAccounts)
+	paymentHandler := handlers.NewPaymentHandler(db, cfg, payoutAccounts)
+	journalHandler := handlers.NewJournalHandler(db, journal.Settings{
+		ReimbursementAccount: cfg.GLReimbursementAccount,
+		CardAccount:          cfg.GLCardAccount,
+		AdvanceAccount:       cfg.GLAdvanceAccount,
+		XeroTaxRate:          cfg.GLXeroTaxRate,
+	}, cfg.BaseCurrency)
 
 	authMiddleware := middleware.AuthMiddleware(db, cfg.JWTSecret)
 
@@ -35,6 +58,14 @@ func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config) {
 
 			r.Get("/profile", userHandler.GetProfile)
 
+			// The bank account the user is reimbursed into
+			r.Route("/payout-account", func(r chi.Router) {
+				r.Get("/", payoutHandler.GetPayoutAccount)
+				r.Put("/", payoutHandler.UpdatePayoutAccount)
+				r.Delete("/", payoutHandler.DeletePayoutAccount)
+				r.Get("/changes", payoutHandler.GetPayoutAccountChanges)
+			})
+
 			r.Route("/dashboard", func(r chi.Router) {
 				r.Get("/stats", dashboardHandler.GetStats)
 				r.Get("/admin-stats", dashboardHandler.GetAdminStats)
@@ -43,18 +74,71 @@ func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config) {
 			// Claim types for regular users (read-only)
 			r.Get("/claim-types", claimHandler.GetClaimTypes)
 
+			// Currencies claims can be filed in
+			r.Get("/currencies", currencyHandler.GetCurrencies)
+
+			// Rates mileage and per-diem claims are calculated from
+			r.Get("/mileage-rates", rateTableHandler.GetMileageRates)
+			r.Get("/per-diem-rates", rateTableHandler.GetPerDiemRates)
+
+			// Cost centers and projects the user's group can charge claims to
+			r.Get("/cost-centers", costCenterHandler.GetCostCenters)
+			r.Get("/projects", costCenterHandler.GetProjects)
+
+			// Reason codes approvers choose from when rejecting or returning
+			r.Get("/reason-codes", reasonCodeHandler.GetReasonCodes)
+
 			r.Route("/claims", func(r chi.Router) {
 				r.Get("/", claimHandler.GetClaims)
 				r.Post("/", claimHandler.CreateClaim)
+				r.Post("/calculate", claimHandler.CalculateAmount)
 				r.Route("/{id}", func(r chi.Router) {
 					r.Get("/", claimHandler.GetClaim)
 					r.Put("/", claimHandler.UpdateClaim)
 					r.Delete("/", claimHandler.CancelClaim)
 					r.Post("/submit", claimHandler.SubmitClaim)
+					r.Post("/withdraw", claimHandler.WithdrawClaim)
 					r.Post("/approve", claimHandler.ApproveClaim)
+
+					// Receipts and other files
+					r.Get("/attachments", attachmentHandler.GetAttachments)
+					r.Post("/attachments", attachmentHandler.UploadAttachment)
+					r.Get("/attachments/{attachmentId}", attachmentHandler.DownloadAttachment)
+					r.Delete("/attachments/{attachmentId}", attachmentHandler.DeleteAttachment)
+				})
+			})
+
+			// Corporate card transactions and their reconciliation with claims
+			r.Route("/card-transactions", func(r chi.Router) {
+				r.Get("/", cardHandler.GetCardTransactions)
+				r.Post("/match", cardHandler.MatchCardTransactions)
+				r.Post("/{id}/attach", cardHandler.AttachCardTransaction)
+				r.Post("/{id}/detach", cardHandler.DetachCardTransaction)
+			})
+
+			// Cash advances, their approval and settlement against claims
+			r.Route("/advances", func(r chi.Router) {
+				r.Get("/", advanceHandler.GetAdvances)
+				r.Post("/", advanceHandler.CreateAdvance)
+				r.Get("/pending", advanceHandler.GetPendingAdvances)
+				r.Get("/balance", advanceHandler.GetBalance)
+				r.Route("/{id}", func(r chi.Router) {
+					r.Get("/", advanceHandler.GetAdvance)
+					r.Post("/approve", advanceHandler.ApproveAdvance)
+					r.Post("/reject", advanceHandler.RejectAdvance)
+					r.Post("/cancel", advanceHandler.CancelAdvance)
+					r.Post("/disburse", advanceHandler.DisburseAdvance)
 				})
 			})
 
+			r.Route("/delegations", func(r chi.Router) {
+				r.Get("/", delegationHandler.GetDelegations)
+				r.Post("/", delegationHandler.CreateDelegation)
+				r.Delete("/{id}", delegationHandler.DeleteDelegation)
+			})
+
+			r.Get("/approvals/pending", delegationHandler.GetPendingApprovals)
+
 			// Admin routes with /admin prefix
 			r.Group(func(r chi.Router) {
 				r.Use(middleware.AdminRequired)
@@ -65,6 +149,7 @@ func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config) {
 						r.Get("/", adminEnhanced.GetAllClaims)
 						r.Post("/{id}/approve", adminEnhanced.AdminApproveClaim)
 						r.Post("/{id}/reject", adminEnhanced.AdminRejectClaim)
+						r.Post("/{id}/return", adminEnhanced.AdminReturnClaim)
 						r.Put("/{id}/status", adminEnhanced.UpdateClaimStatus)
 					})
 
@@ -74,6 +159,13 @@ func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config) {
 						r.Post("/", adminEnhanced.CreateAdminUser)
 						r.Put("/{id}", adminEnhanced.UpdateAdminUser)
 						r.Delete("/{id}", adminEnhanced.DeleteAdminUser)
+
+						// Employees' payout accounts and their verification
+						r.Get("/{id}/payout-account", payoutHandler.GetUserPayoutAccount)
+						r.Put("/{id}/payout-account", payoutHandler.UpdateUserPayoutAccount)
+						r.Delete("/{id}/payout-account", payoutHandler.DeleteUserPayoutAccount)
+						r.Post("/{id}/payout-account/verify", payoutHandler.VerifyPayoutAccount)
+						r.Get("/{id}/payout-account/changes", payoutHandler.GetUserPayoutAccountChanges)
 					})
 
 					// Groups management
@@ -101,6 +193,115 @@ func SetupRoutes(r *chi.Mux, db *gorm.DB, cfg *config.Config) {
 						r.Delete("/{id}", adminEnhanced.DeleteEnhancedApprovalLevel)
 						r.Put("/order", adminEnhanced.UpdateApprovalLevelOrder)
 					})
+
+					// Rejection and return reason codes
+					r.Route("/reason-codes", func(r chi.Router) {
+						r.Get("/", reasonCodeHandler.GetAllReasonCodes)
+						r.Post("/", reasonCodeHandler.CreateReasonCode)
+						r.Put("/{id}", reasonCodeHandler.UpdateReasonCode)
+						r.Delete("/{id}", reasonCodeHandler.DeleteReasonCode)
+					})
+
+					// Expense policy rules checked at submission
+					r.Route("/policy-rules", func(r chi.Router) {
+						r.Get("/", policyRuleHandler.GetPolicyRules)
+						r.Post("/", policyRuleHandler.CreatePolicyRule)
+						r.Put("/{id}", policyRuleHandler.UpdatePolicyRule)
+						r.Delete("/{id}", policyRuleHandler.DeletePolicyRule)
+					})
+
+					// Exchange rates claims are converted into the base currency at
+					r.Route("/exchange-rates", func(r chi.Router) {
+						r.Get("/", currencyHandler.GetExchangeRates)
+						r.Post("/", currencyHandler.SetExchangeRate)
+						r.Post("/import", currencyHandler.ImportExchangeRates)
+						r.Delete("/{id}", currencyHandler.DeleteExchangeRate)
+					})
+
+					// Mileage and per-diem rate tables, versioned by effective date
+					r.Route("/mileage-rates", func(r chi.Router) {
+						r.Get("/", rateTableHandler.GetMileageRates)
+						r.Post("/", rateTableHandler.CreateMileageRate)
+						r.Delete("/{id}", rateTableHandler.DeleteMileageRate)
+					})
+					r.Route("/per-diem-rates", func(r chi.Router) {
+						r.Get("/", rateTableHandler.GetPerDiemRates)
+						r.Post("/", rateTableHandler.CreatePerDiemRate)
+						r.Delete("/{id}", rateTableHandler.DeletePerDiemRate)
+					})
+
+					// Cost centers and projects claims are charged to
+					r.Route("/cost-centers", func(r chi.Router) {
+						r.Get("/", costCenterHandler.GetAllCostCenters)
+						r.Post("/", costCenterHandler.CreateCostCenter)
+						r.Put("/{id}", costCenterHandler.UpdateCostCenter)
+						r.Delete("/{id}", costCenterHandler.DeleteCostCenter)
+					})
+					r.Route("/projects", func(r chi.Router) {
+						r.Get("/", costCenterHandler.GetAllProjects)
+						r.Post("/", costCenterHandler.CreateProject)
+						r.Put("/{id}", costCenterHandler.UpdateProject)
+						r.Delete("/{id}", costCenterHandler.DeleteProject)
+					})
+
+					// Corporate card statements
+					r.Route("/card-transactions", func(r chi.Router) {
+						r.Post("/import", cardHandler.ImportCardStatement)
+						r.Get("/unreconciled", cardHandler.GetUnreconciledCardTransactions)
+						r.Delete("/{id}", cardHandler.DeleteCardTransaction)
+					})
+
+					// Cash advances and employee balances
+					r.Route("/advances", func(r chi.Router) {
+						r.Get("/", advanceHandler.GetAllAdvances)
+						r.Get("/balances", advanceHandler.GetBalances)
+						r.Post("/{id}/repay", advanceHandler.RepayAdvance)
+					})
+
+					r.Get("/payout-accounts", payoutHandler.GetPayoutAccounts)
+
+					// Payment batches and the bank files paying them
+					r.Route("/payment-batches", func(r chi.Router) {
+						r.Get("/", paymentHandler.GetPaymentBatches)
+						r.Post("/", paymentHandler.CreatePaymentBatch)
+						r.Get("/{id}", paymentHandler.GetPaymentBatch)
+						r.Get("/{id}/export", paymentHandler.ExportPaymentBatch)
+						r.Post("/{id}/settle", paymentHandler.SettlePaymentBatch)
+					})
+
+					// Journal entries of paid claims for the general ledger
+					r.Route("/journal-exports", func(r chi.Router) {
+						r.Get("/", journalHandler.GetJournalExports)
+						r.Post("/", journalHandler.CreateJournalExport)
+						r.Get("/pending", journalHandler.GetPendingJournal)
+						r.Get("/{id}/download", journalHandler.DownloadJournalExport)
+					})
+
+					// Fiscal periods, the budgets set for them and spend against them
+					r.Route("/fiscal-periods", func(r chi.Router) {
+						r.Get("/", budgetHandler.GetFiscalPeriods)
+						r.Post("/", budgetHandler.CreateFiscalPeriod)
+						r.Put("/{id}", budgetHandler.UpdateFiscalPeriod)
+						r.Delete("/{id}", budgetHandler.DeleteFiscalPeriod)
+					})
+					r.Route("/budgets", func(r chi.Router) {
+						r.Get("/", budgetHandler.GetBudgets)
+						r.Post("/", budgetHandler.CreateBudget)
+						r.Get("/actuals", budgetHandler.GetBudgetActuals)
+						r.Put("/{id}", budgetHandler.UpdateBudget)
+						r.Delete("/{id}", budgetHandler.DeleteBudget)
+					})
+
+					// Business calendars and public holidays
+					r.Route("/calendars", func(r chi.Router) {
+						r.Get("/", calendarHandler.GetCalendars)
+						r.Post("/", calendarHandler.CreateCalendar)
+						r.Get("/business-days", calendarHandler.GetBusinessDays)
+						r.Put("/{id}", calendarHandler.UpdateCalendar)
+						r.Delete("/{id}", calendarHandler.DeleteCalendar)
+						r.Post("/{id}/holidays", calendarHandler.CreateHoliday)
+						r.Delete("/{id}/holidays/{holidayId}", calendarHandler.DeleteHoliday)
+					})
 				})
 
 				// Legacy routes (keeping for backward compatibility)
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"log"
+
+	"hrcs/backend/models"
+)
+
+// Notifier delivers the scheduler's reminders and escalations to the
+// approvers concerned.
+type Notifier interface {
+	Remind(claim *models.Claim, level *models.ApprovalLevel, recipients []models.User) error
+	Escalate(claim *models.Claim, level *models.ApprovalLevel, recipients []models.User) error
+}
+
+// LogNotifier writes notifications to the server log until a mail or chat
+// integration is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Remind(claim *models.Claim, level *models.ApprovalLevel, recipients []models.User) error {
+	log.Printf("Reminder: claim %d awaiting level %d approval from %s", claim.ID, level.Level, emails(recipients))
+	return nil
+}
+
+func (LogNotifier) Escalate(claim *models.Claim, level *models.ApprovalLevel, recipients []models.User) error {
+	log.Printf("Escalation: claim %d overdue at level %d, escalated to %s", claim.ID, level.Level, emails(recipients))
+	return nil
+}
+
+func emails(users []models.User) []string {
+	addresses := []string{}
+	for _, user := range users {
+		addresses = append(addresses, user.Email)
+	}
+	return addresses
+}
@@ -0,0 +1,179 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"hrcs/backend/calendar"
+	"hrcs/backend/config"
+	"hrcs/backend/models"
+	"hrcs/backend/workflow"
+
+	"gorm.io/gorm"
+)
+
+// Scheduler periodically scans claims waiting on an approval level,
+// reminding approvers of steps that have been pending for a while and
+// escalating steps that are overdue.
+type Scheduler struct {
+	DB       *gorm.DB
+	Engine   *workflow.Engine
+	Notifier Notifier
+	Interval time.Duration
+	// Defaults for levels that don't set their own timeouts, in business
+	// days
+	ReminderDays   int
+	EscalationDays int
+}
+
+func New(db *gorm.DB, cfg *config.Config) *Scheduler {
+	return &Scheduler{
+		DB:             db,
+		Engine:         workflow.NewEngine(db),
+		Notifier:       LogNotifier{},
+		Interval:       cfg.SchedulerInterval,
+		ReminderDays:   cfg.ApprovalReminderDays,
+		EscalationDays: cfg.ApprovalEscalationDays,
+	}
+}
+
+// Start runs a scan straight away and then on every tick until ctx is
+// cancelled.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Run(time.Now()); err != nil {
+				log.Printf("scheduler: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run scans every pending claim once.
+func (s *Scheduler) Run(now time.Time) error {
+	var claims []models.Claim
+	if err := s.DB.Preload("User").Where("status IN ?", []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview}).
+		Find(&claims).Error; err != nil {
+		return err
+	}
+
+	// Loaded afresh each scan so holiday changes are picked up
+	calendars := calendar.NewService(s.DB)
+
+	for i := range claims {
+		cal, err := calendars.ForUser(&claims[i].User)
+		if err != nil {
+			log.Printf("scheduler: claim %d: %v", claims[i].ID, err)
+			continue
+		}
+		if err := s.check(&claims[i], cal, now); err != nil {
+			log.Printf("scheduler: claim %d: %v", claims[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// check escalates the claim's pending level once it is overdue, or reminds
+// its approvers when they have not been reminded recently. Ages are counted
+// in business days of the claimant's calendar.
+func (s *Scheduler) check(claim *models.Claim, cal *calendar.Calendar, now time.Time) error {
+	progress, err := s.Engine.Progress(claim)
+	if err != nil {
+		return err
+	}
+	level := progress.Current
+	if level == nil || progress.Since.IsZero() {
+		return nil
+	}
+
+	age := cal.BusinessDaysBetween(progress.Since, now)
+
+	escalationDays := days(level.EscalationDays, s.EscalationDays)
+	if escalationDays > 0 && age >= escalationDays && progress.Escalations[level.ID] == nil {
+		return s.escalate(claim, level, progress, age)
+	}
+
+	reminderDays := days(level.ReminderDays, s.ReminderDays)
+	if reminderDays <= 0 || age < reminderDays {
+		return nil
+	}
+
+	// Remind again every reminderDays until the step is decided
+	var last models.ClaimApproval
+	err = s.DB.Where("claim_id = ? AND round = ? AND approval_level_id = ? AND action = ?",
+		claim.ID, claim.Round, level.ID, models.ActionRemind).
+		Order("created_at DESC").First(&last).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	if err == nil && cal.BusinessDaysBetween(last.CreatedAt, now) < reminderDays {
+		return nil
+	}
+
+	return s.remind(claim, level, age)
+}
+
+func (s *Scheduler) remind(claim *models.Claim, level *models.ApprovalLevel, age int) error {
+	recipients, err := s.Engine.Recipients(level)
+	if err != nil {
+		return err
+	}
+
+	comments := fmt.Sprintf("Level %d approval pending for %d business days", level.Level, age)
+	if _, err := s.Engine.Remind(claim, level, comments); err != nil {
+		return err
+	}
+	return s.Notifier.Remind(claim, level, recipients)
+}
+
+// escalate hands an overdue level to its fallback approver when it has
+// one. Otherwise the step passes to the next level, or to the admins when
+// it is the last level of the chain.
+func (s *Scheduler) escalate(claim *models.Claim, level *models.ApprovalLevel, progress *workflow.Progress, age int) error {
+	comments := fmt.Sprintf("Level %d approval overdue after %d business days", level.Level, age)
+
+	var recipients []models.User
+	var to *models.User
+	switch {
+	case level.FallbackApprover != nil:
+		to = level.FallbackApprover
+		recipients = []models.User{*to}
+	case !progress.IsLast(level):
+		next := &progress.Chain[progress.Position(level.ID)+1]
+		comments += fmt.Sprintf(", escalated to level %d", next.Level)
+		users, err := s.Engine.Recipients(next)
+		if err != nil {
+			return err
+		}
+		recipients = users
+	default:
+		comments += ", escalated to admins"
+		if err := s.DB.Where("role = ?", models.RoleAdmin).Find(&recipients).Error; err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.Engine.Escalate(claim, level, to, comments); err != nil {
+		return err
+	}
+	return s.Notifier.Escalate(claim, level, recipients)
+}
+
+// days picks a level's own timeout over the configured default.
+func days(levelDays *int, defaultDays int) int {
+	if levelDays != nil {
+		return *levelDays
+	}
+	return defaultDays
+}
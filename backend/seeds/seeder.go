@@ -3,8 +3,10 @@ package seeds
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"hrcs/backend/models"
+	"hrcs/backend/money"
 	"hrcs/backend/utils"
 
 	"gorm.io/gorm"
@@ -37,6 +39,30 @@ func (s *Seeder) SeedAll() error {
 		return fmt.Errorf("failed to seed approval levels: %w", err)
 	}
 
+	if err := s.SeedCostCenters(); err != nil {
+		return fmt.Errorf("failed to seed cost centers: %w", err)
+	}
+
+	if err := s.SeedBudgets(); err != nil {
+		return fmt.Errorf("failed to seed budgets: %w", err)
+	}
+
+	if err := s.SeedReasonCodes(); err != nil {
+		return fmt.Errorf("failed to seed reason codes: %w", err)
+	}
+
+	if err := s.SeedPolicyRules(); err != nil {
+		return fmt.Errorf("failed to seed policy rules: %w", err)
+	}
+
+	if err := s.SeedExchangeRates(); err != nil {
+		return fmt.Errorf("failed to seed exchange rates: %w", err)
+	}
+
+	if err := s.SeedRateTables(); err != nil {
+		return fmt.Errorf("failed to seed rate tables: %w", err)
+	}
+
 	if err := s.SeedSampleClaims(); err != nil {
 		return fmt.Errorf("failed to seed sample claims: %w", err)
 	}
@@ -172,52 +198,417 @@ func (s *Seeder) SeedClaimTypes() error {
 
 	claimTypes := []models.ClaimType{
 		{
-			Name:        "Travel Expenses",
-			Description: "Business travel related expenses including flights, hotels, meals, and transportation",
+			Name:                  "Travel Expenses",
+			Description:           "Business travel related expenses including flights, hotels, meals, and transportation",
+			Code:                  "TRAVEL",
+			GLAccount:             "6100",
+			Category:              models.CategoryTravel,
+			MaxAmount:             money.Ptr(money.FromInt(5000)),
+			RequiresReceipt:       true,
+			RequiresJustification: true,
+			ValidityPeriod:        90,
+			Active:                true,
+		},
+		{
+			Name:                  "Medical Expenses",
+			Description:           "Health and medical related expenses covered by company policy",
+			Code:                  "MEDICAL",
+			GLAccount:             "6200",
+			Category:              models.CategoryMedical,
+			MaxAmount:             money.Ptr(money.FromInt(2000)),
+			RequiresReceipt:       true,
+			RequiresJustification: false,
+			ValidityPeriod:        90,
+			Active:                true,
+		},
+		{
+			Name:                  "Office Supplies",
+			Description:           "Office equipment, stationery, and supplies purchased for work",
+			Code:                  "OFFICE_SUPPLIES",
+			GLAccount:             "6300",
+			Category:              models.CategoryEquipment,
+			MaxAmount:             money.Ptr(money.FromInt(500)),
+			RequiresReceipt:       true,
+			RequiresJustification: false,
+			ValidityPeriod:        60,
+			Active:                true,
+		},
+		{
+			Name:                  "Training & Development",
+			Description:           "Professional development courses, conferences, and training materials",
+			Code:                  "TRAINING",
+			GLAccount:             "6400",
+			Category:              models.CategoryTraining,
+			MaxAmount:             money.Ptr(money.FromInt(3000)),
+			RequiresReceipt:       true,
+			RequiresJustification: true,
+			ValidityPeriod:        90,
+			Active:                true,
+		},
+		{
+			Name:                  "Entertainment",
+			Description:           "Client entertainment and business meal expenses",
+			Code:                  "ENTERTAINMENT",
+			GLAccount:             "6500",
+			Category:              models.CategoryEntertainment,
+			MaxAmount:             money.Ptr(money.FromInt(1000)),
+			RequiresReceipt:       true,
+			RequiresJustification: true,
+			ValidityPeriod:        30,
+			Active:                true,
+		},
+		{
+			Name:                  "Technology",
+			Description:           "Software licenses, hardware, and IT equipment",
+			Code:                  "TECHNOLOGY",
+			GLAccount:             "6600",
+			Category:              models.CategoryEquipment,
+			MaxAmount:             money.Ptr(money.FromInt(5000)),
+			RequiresReceipt:       true,
+			RequiresJustification: true,
+			ValidityPeriod:        60,
+			Active:                true,
+		},
+		{
+			Name:                  "Telecommunications",
+			Description:           "Phone bills, internet, and communication services",
+			Code:                  "TELECOM",
+			GLAccount:             "6610",
+			Category:              models.CategoryOther,
+			MaxAmount:             money.Ptr(money.FromInt(300)),
+			RequiresReceipt:       true,
+			RequiresJustification: false,
+			ValidityPeriod:        60,
+			Active:                true,
+		},
+		{
+			Name:                  "Vehicle Expenses",
+			Description:           "Fuel, maintenance, and vehicle-related business expenses",
+			Code:                  "VEHICLE",
+			GLAccount:             "6700",
+			Category:              models.CategoryTravel,
+			MaxAmount:             money.Ptr(money.FromInt(1500)),
+			RequiresReceipt:       true,
+			RequiresJustification: false,
+			ValidityPeriod:        60,
+			Active:                true,
+		},
+		{
+			Name:                  "Mileage",
+			Description:           "Business use of a private vehicle, reimbursed per distance driven",
+			Code:                  "MILEAGE",
+			GLAccount:             "6710",
+			Category:              models.CategoryTravel,
+			Kind:                  models.KindMileage,
+			RequiresReceipt:       false,
+			RequiresJustification: true,
+			ValidityPeriod:        60,
+			Active:                true,
+		},
+		{
+			Name:                  "Per Diem",
+			Description:           "Daily allowance for meals and incidentals on business trips",
+			Code:                  "PER_DIEM",
+			GLAccount:             "6120",
+			Category:              models.CategoryTravel,
+			Kind:                  models.KindPerDiem,
+			RequiresReceipt:       false,
+			RequiresJustification: false,
+			ValidityPeriod:        90,
+			Active:                true,
+		},
+		{
+			Name:                  "Professional Services",
+			Description:           "Consulting, legal, and other professional service fees",
+			Code:                  "PROFESSIONAL_SERVICES",
+			GLAccount:             "6800",
+			Category:              models.CategoryOther,
+			RequiresReceipt:       true,
+			RequiresJustification: true,
+			ValidityPeriod:        90,
+			Active:                true,
+		},
+		{
+			Name:                  "Miscellaneous",
+			Description:           "Other business-related expenses not covered by other categories",
+			Code:                  "MISC",
+			GLAccount:             "6900",
+			Category:              models.CategoryOther,
+			MaxAmount:             money.Ptr(money.FromInt(250)),
+			RequiresReceipt:       false,
+			RequiresJustification: true,
+			ValidityPeriod:        30,
+			Active:                true,
 		},
+	}
+
+	if err := s.DB.Create(&claimTypes).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ Created %d claim types", len(claimTypes))
+	return nil
+}
+
+func (s *Seeder) SeedReasonCodes() error {
+	log.Println("📝 Seeding reason codes...")
+
+	// Check if reason codes already exist
+	var count int64
+	s.DB.Model(&models.ReasonCode{}).Count(&count)
+	if count > 0 {
+		log.Println("Reason codes already exist, skipping...")
+		return nil
+	}
+
+	reasonCodes := []models.ReasonCode{
 		{
-			Name:        "Medical Expenses",
-			Description: "Health and medical related expenses covered by company policy",
+			Code:        "MISSING_RECEIPT",
+			Name:        "Missing receipt",
+			Description: "No receipt or an unreadable receipt was attached",
+			Kind:        models.ReasonKindBoth,
+			Active:      true,
 		},
 		{
-			Name:        "Office Supplies",
-			Description: "Office equipment, stationery, and supplies purchased for work",
+			Code:        "OVER_POLICY_LIMIT",
+			Name:        "Over policy limit",
+			Description: "The amount exceeds what company policy allows",
+			Kind:        models.ReasonKindBoth,
+			Active:      true,
 		},
 		{
-			Name:        "Training & Development",
-			Description: "Professional development courses, conferences, and training materials",
+			Code:        "INCORRECT_AMOUNT",
+			Name:        "Incorrect amount",
+			Description: "The claimed amount does not match the receipt",
+			Kind:        models.ReasonKindReturn,
+			Active:      true,
 		},
 		{
-			Name:        "Entertainment",
-			Description: "Client entertainment and business meal expenses",
+			Code:        "WRONG_CLAIM_TYPE",
+			Name:        "Wrong claim type",
+			Description: "The expense was filed under the wrong claim type",
+			Kind:        models.ReasonKindReturn,
+			Active:      true,
 		},
 		{
-			Name:        "Technology",
-			Description: "Software licenses, hardware, and IT equipment",
+			Code:        "DUPLICATE",
+			Name:        "Duplicate claim",
+			Description: "The expense has already been claimed",
+			Kind:        models.ReasonKindReject,
+			Active:      true,
 		},
 		{
-			Name:        "Telecommunications",
-			Description: "Phone bills, internet, and communication services",
+			Code:        "NOT_BUSINESS_EXPENSE",
+			Name:        "Not a business expense",
+			Description: "The expense is personal or not covered by company policy",
+			Kind:        models.ReasonKindReject,
+			Active:      true,
 		},
 		{
-			Name:        "Vehicle Expenses",
-			Description: "Fuel, maintenance, and vehicle-related business expenses",
+			Code:             "OTHER",
+			Name:             "Other",
+			Description:      "Any other reason, explained in the comments",
+			Kind:             models.ReasonKindBoth,
+			RequiresComments: true,
+			Active:           true,
 		},
+	}
+
+	if err := s.DB.Create(&reasonCodes).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ Created %d reason codes", len(reasonCodes))
+	return nil
+}
+
+func (s *Seeder) SeedPolicyRules() error {
+	log.Println("📏 Seeding policy rules...")
+
+	var count int64
+	s.DB.Model(&models.PolicyRule{}).Count(&count)
+	if count > 0 {
+		log.Println("Policy rules already exist, skipping...")
+		return nil
+	}
+
+	rules := []models.PolicyRule{
 		{
-			Name:        "Professional Services",
-			Description: "Consulting, legal, and other professional service fees",
+			Name:        "Daily meal allowance",
+			Description: "Meals on business travel are covered up to $75 a day",
+			Scope:       models.PolicyScopeDay,
+			When:        `line.type == "TRAVEL" && line.attributes.expense == "meal"`,
+			Assert:      `day.total <= 75`,
+			Severity:    models.SeverityJustify,
+			Message:     "Meals on {day.date} come to ${day.total}, over the $75 daily allowance",
+			Active:      true,
 		},
 		{
-			Name:        "Miscellaneous",
-			Description: "Other business-related expenses not covered by other categories",
+			Name:        "Tier-1 city hotel rate",
+			Description: "Hotels in tier-1 cities are covered up to $250 a night",
+			Scope:       models.PolicyScopeLine,
+			When:        `line.type == "TRAVEL" && line.attributes.expense == "hotel" && lower(line.attributes.city) in ["london", "new york", "san francisco", "tokyo", "singapore", "zurich"]`,
+			Assert:      `line.base_amount <= 250 * max(number(line.attributes.nights), 1)`,
+			Severity:    models.SeverityBlock,
+			Message:     "Hotel in {line.attributes.city} is over $250 a night",
+			Active:      true,
+		},
+		{
+			Name:        "No alcohol",
+			Description: "Alcohol is never reimbursed",
+			Scope:       models.PolicyScopeLine,
+			Assert:      `!matches(lower(line.description + " " + line.merchant), '\b(alcohol|beer|wine|spirits|liquor|cocktails?)\b') && line.attributes.alcohol != "true"`,
+			Severity:    models.SeverityBlock,
+			Message:     "Alcohol can't be claimed",
+			Active:      true,
 		},
 	}
 
-	if err := s.DB.Create(&claimTypes).Error; err != nil {
+	if err := s.DB.Create(&rules).Error; err != nil {
 		return err
 	}
 
-	log.Printf("✅ Created %d claim types", len(claimTypes))
+	log.Printf("✅ Created %d policy rules", len(rules))
+	return nil
+}
+
+func (s *Seeder) SeedExchangeRates() error {
+	log.Println("💱 Seeding exchange rates...")
+
+	var count int64
+	s.DB.Model(&models.ExchangeRate{}).Count(&count)
+	if count > 0 {
+		log.Println("Exchange rates already exist, skipping...")
+		return nil
+	}
+
+	// Indicative US dollar rates for the currencies staff file in; load
+	// real ones through the import endpoint
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	rates := []models.ExchangeRate{
+		{Base: "USD", Quote: "SGD", Rate: 1.3450, Date: today, Source: "manual"},
+		{Base: "USD", Quote: "MYR", Rate: 4.4700, Date: today, Source: "manual"},
+		{Base: "USD", Quote: "EUR", Rate: 0.9200, Date: today, Source: "manual"},
+		{Base: "USD", Quote: "GBP", Rate: 0.7900, Date: today, Source: "manual"},
+	}
+
+	if err := s.DB.Create(&rates).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ Created %d exchange rates", len(rates))
+	return nil
+}
+
+func (s *Seeder) SeedRateTables() error {
+	log.Println("🚗 Seeding mileage and per-diem rates...")
+
+	var count int64
+	s.DB.Model(&models.MileageRate{}).Count(&count)
+	if count > 0 {
+		log.Println("Rate tables already exist, skipping...")
+		return nil
+	}
+
+	effective := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	mileageRates := []models.MileageRate{
+		{VehicleClass: "car", Unit: "mi", Currency: "USD", Rate: money.MustParse("0.67"), EffectiveFrom: effective},
+		{VehicleClass: "motorcycle", Unit: "mi", Currency: "USD", Rate: money.MustParse("0.40"), EffectiveFrom: effective},
+		{VehicleClass: "bicycle", Unit: "mi", Currency: "USD", Rate: money.MustParse("0.20"), EffectiveFrom: effective},
+	}
+	if err := s.DB.Create(&mileageRates).Error; err != nil {
+		return err
+	}
+
+	perDiemRates := []models.PerDiemRate{
+		{Destination: "*", Currency: "USD", DailyRate: money.MustParse("75.00"), BreakfastDeduction: money.MustParse("15.00"), LunchDeduction: money.MustParse("20.00"), DinnerDeduction: money.MustParse("30.00"), EffectiveFrom: effective},
+		{Destination: "SG", Currency: "SGD", DailyRate: money.MustParse("120.00"), BreakfastDeduction: money.MustParse("20.00"), LunchDeduction: money.MustParse("35.00"), DinnerDeduction: money.MustParse("45.00"), EffectiveFrom: effective},
+		{Destination: "GB", Currency: "GBP", DailyRate: money.MustParse("85.00"), BreakfastDeduction: money.MustParse("15.00"), LunchDeduction: money.MustParse("25.00"), DinnerDeduction: money.MustParse("35.00"), EffectiveFrom: effective},
+	}
+	if err := s.DB.Create(&perDiemRates).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ Created %d mileage and %d per-diem rates", len(mileageRates), len(perDiemRates))
+	return nil
+}
+
+func (s *Seeder) SeedCostCenters() error {
+	log.Println("🏷️ Seeding cost centers and projects...")
+
+	var count int64
+	s.DB.Model(&models.CostCenter{}).Count(&count)
+	if count > 0 {
+		log.Println("Cost centers already exist, skipping...")
+		return nil
+	}
+
+	costCenters := []models.CostCenter{
+		{ChargeCode: models.ChargeCode{Code: "CC-100", Name: "Engineering", Description: "Product development and IT", Active: true}},
+		{ChargeCode: models.ChargeCode{Code: "CC-200", Name: "Sales & Marketing", Description: "Sales, marketing and client entertainment", Active: true}},
+		{ChargeCode: models.ChargeCode{Code: "CC-300", Name: "Operations", Description: "Facilities, fleet and office running costs", Active: true}},
+		{ChargeCode: models.ChargeCode{Code: "CC-900", Name: "Corporate", Description: "Company-wide benefits and overheads", Active: true}},
+	}
+	if err := s.DB.Create(&costCenters).Error; err != nil {
+		return err
+	}
+
+	projects := []models.Project{
+		{ChargeCode: models.ChargeCode{Code: "PRJ-ACME", Name: "Acme Rollout", Description: "Client implementation for Acme Corp", Active: true}},
+		{ChargeCode: models.ChargeCode{Code: "PRJ-CLOUD", Name: "Cloud Migration", Description: "Internal move to the cloud", Active: true}},
+	}
+	if err := s.DB.Create(&projects).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ Created %d cost centers and %d projects", len(costCenters), len(projects))
+	return nil
+}
+
+// SeedBudgets sets up the current financial year with budgets for the
+// Engineering group and the Sales & Marketing cost center's travel.
+func (s *Seeder) SeedBudgets() error {
+	log.Println("📊 Seeding budgets...")
+
+	var count int64
+	s.DB.Model(&models.FiscalPeriod{}).Count(&count)
+	if count > 0 {
+		log.Println("Fiscal periods already exist, skipping...")
+		return nil
+	}
+
+	year := time.Now().Year()
+	period := models.FiscalPeriod{
+		Name:      fmt.Sprintf("FY%d", year),
+		StartDate: time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC),
+	}
+	if err := s.DB.Create(&period).Error; err != nil {
+		return err
+	}
+
+	var engineering models.UserGroup
+	if err := s.DB.Where("name = ?", "Engineering").First(&engineering).Error; err != nil {
+		return err
+	}
+	var salesAndMarketing models.CostCenter
+	if err := s.DB.Where("code = ?", "CC-200").First(&salesAndMarketing).Error; err != nil {
+		return err
+	}
+	var travel models.ClaimType
+	if err := s.DB.Where("name = ?", "Travel Expenses").First(&travel).Error; err != nil {
+		return err
+	}
+
+	budgets := []models.Budget{
+		{FiscalPeriodID: period.ID, UserGroupID: &engineering.ID, Amount: money.FromInt(50000), Enforcement: models.EnforceWarn},
+		{FiscalPeriodID: period.ID, CostCenterID: &salesAndMarketing.ID, ClaimTypeID: &travel.ID, Amount: money.FromInt(20000), Enforcement: models.EnforceBlock},
+	}
+	if err := s.DB.Create(&budgets).Error; err != nil {
+		return err
+	}
+
+	log.Printf("✅ Created fiscal period %s with %d budgets", period.Name, len(budgets))
 	return nil
 }
 
@@ -339,7 +730,9 @@ func (s *Seeder) SeedApprovalLevels() error {
 		return nil
 	}
 
-	// Create approval levels for each user group
+	// Create approval levels for each user group. Level 1 gives final
+	// approval up to $5,000; anything above escalates to level 2.
+	level1Limit := money.FromInt(5000)
 	approvalLevels := []models.ApprovalLevel{}
 
 	for _, group := range userGroups {
@@ -348,7 +741,8 @@ func (s *Seeder) SeedApprovalLevels() error {
 			approvalLevels = append(approvalLevels, models.ApprovalLevel{
 				Level:                   1,
 				UserGroupID:             group.ID,
-				ApproverID:              adminUsers[1].ID, // HR Manager
+				ApproverID:              &adminUsers[1].ID, // HR Manager
+				MaxAmount:               &level1Limit,
 				CanDraft:                false,
 				CanSubmit:               true,
 				CanApprove:              true,
@@ -363,7 +757,7 @@ func (s *Seeder) SeedApprovalLevels() error {
 			approvalLevels = append(approvalLevels, models.ApprovalLevel{
 				Level:                   2,
 				UserGroupID:             group.ID,
-				ApproverID:              adminUsers[2].ID, // Finance Manager
+				ApproverID:              &adminUsers[2].ID, // Finance Manager
 				CanDraft:                false,
 				CanSubmit:               false,
 				CanApprove:              true,
@@ -415,7 +809,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Business Trip to New York",
 			Description: "Travel expenses for client meeting in NYC including flights, hotel, and meals",
-			Amount:      1250.00,
+			Amount:      money.MustParse("1250.00"),
 			Status:      models.StatusSubmitted,
 			UserID:      normalUsers[0].ID,
 			ClaimTypeID: claimTypes[0].ID, // Travel Expenses
@@ -423,7 +817,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Annual Health Checkup",
 			Description: "Medical expenses for annual health checkup and dental cleaning",
-			Amount:      450.00,
+			Amount:      money.MustParse("450.00"),
 			Status:      models.StatusApproved,
 			UserID:      normalUsers[1].ID,
 			ClaimTypeID: claimTypes[1].ID, // Medical Expenses
@@ -431,7 +825,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Laptop and Accessories",
 			Description: "New laptop, external monitor, and keyboard for remote work setup",
-			Amount:      2100.00,
+			Amount:      money.MustParse("2100.00"),
 			Status:      models.StatusSubmitted,
 			UserID:      normalUsers[2].ID,
 			ClaimTypeID: claimTypes[5].ID, // Technology
@@ -439,7 +833,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "AWS Conference 2024",
 			Description: "Registration fee and accommodation for AWS re:Invent conference",
-			Amount:      1800.00,
+			Amount:      money.MustParse("1800.00"),
 			Status:      models.StatusDraft,
 			UserID:      normalUsers[3].ID,
 			ClaimTypeID: claimTypes[3].ID, // Training & Development
@@ -447,7 +841,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Client Dinner Meeting",
 			Description: "Business dinner with potential client at upscale restaurant",
-			Amount:      320.00,
+			Amount:      money.MustParse("320.00"),
 			Status:      models.StatusPaid,
 			UserID:      normalUsers[4].ID,
 			ClaimTypeID: claimTypes[4].ID, // Entertainment
@@ -455,7 +849,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Office Furniture",
 			Description: "Ergonomic chair and standing desk for home office",
-			Amount:      750.00,
+			Amount:      money.MustParse("750.00"),
 			Status:      models.StatusRejected,
 			UserID:      normalUsers[0].ID,
 			ClaimTypeID: claimTypes[2].ID, // Office Supplies
@@ -463,7 +857,7 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Monthly Phone Bill",
 			Description: "Business mobile phone bill for October 2024",
-			Amount:      85.00,
+			Amount:      money.MustParse("85.00"),
 			Status:      models.StatusApproved,
 			UserID:      normalUsers[1].ID,
 			ClaimTypeID: claimTypes[6].ID, // Telecommunications
@@ -471,17 +865,56 @@ func (s *Seeder) SeedSampleClaims() error {
 		{
 			Title:       "Gas Receipts",
 			Description: "Fuel expenses for client visits during the month",
-			Amount:      180.00,
+			Amount:      money.MustParse("180.00"),
 			Status:      models.StatusSubmitted,
 			UserID:      normalUsers[2].ID,
 			ClaimTypeID: claimTypes[7].ID, // Vehicle Expenses
 		},
 	}
 
+	// Sample claims are filed in US dollars, the default base currency,
+	// for expenses of the past few weeks
+	today := time.Now().Truncate(24 * time.Hour)
+	for i := range sampleClaims {
+		expenseDate := today.AddDate(0, 0, -3*(i+1))
+		sampleClaims[i].ExpenseDate = &expenseDate
+		sampleClaims[i].Currency = "USD"
+		sampleClaims[i].BaseCurrency = "USD"
+		sampleClaims[i].BaseAmount = sampleClaims[i].Amount
+		sampleClaims[i].ReimbursableAmount = sampleClaims[i].Amount
+		sampleClaims[i].ExchangeRate = 1
+	}
+
 	if err := s.DB.Create(&sampleClaims).Error; err != nil {
 		return err
 	}
 
+	// Each sample claim is charged to the cost center of its kind of
+	// expense; the New York trip is split with a client project
+	costCenters := map[string]models.CostCenter{}
+	var allCostCenters []models.CostCenter
+	if err := s.DB.Find(&allCostCenters).Error; err != nil {
+		return err
+	}
+	for _, costCenter := range allCostCenters {
+		costCenters[costCenter.Code] = costCenter
+	}
+	var project models.Project
+	if err := s.DB.Where("code = ?", "PRJ-ACME").First(&project).Error; err != nil {
+		return err
+	}
+	charges := []string{"CC-200", "CC-900", "CC-100", "CC-100", "CC-200", "CC-300", "CC-900", "CC-300"}
+	allocations := []models.Allocation{}
+	for i, code := range charges {
+		allocations = append(allocations, models.Allocation{ClaimID: sampleClaims[i].ID, CostCenterID: costCenters[code].ID, Percent: money.FromInt(100)})
+	}
+	allocations[0].Percent = money.FromInt(60)
+	allocations[0].ProjectID = &project.ID
+	allocations = append(allocations, models.Allocation{ClaimID: sampleClaims[0].ID, CostCenterID: costCenters["CC-100"].ID, Percent: money.FromInt(40)})
+	if err := s.DB.Create(&allocations).Error; err != nil {
+		return err
+	}
+
 	log.Printf("✅ Created %d sample claims", len(sampleClaims))
 	return nil
 }
@@ -489,12 +922,45 @@ func (s *Seeder) SeedSampleClaims() error {
 func (s *Seeder) ClearAll() error {
 	log.Println("🧹 Clearing all data...")
 
+	// Join tables aren't models of their own
+	for _, table := range []string{"cost_center_user_groups", "project_user_groups"} {
+		if err := s.DB.Exec("DELETE FROM " + table).Error; err != nil {
+			return err
+		}
+	}
+
 	// Delete in reverse order due to foreign key constraints
 	tables := []interface{}{
 		&models.ClaimApproval{},
+		&models.AdvanceApproval{},
+		&models.AdvanceSettlement{},
+		&models.Budget{},
+		&models.FiscalPeriod{},
+		&models.PolicyViolation{},
+		&models.DuplicateMatch{},
+		&models.CardTransaction{},
+		&models.PolicyRule{},
+		&models.ReasonCode{},
+		&models.ApproverDelegation{},
+		&models.Holiday{},
+		&models.BusinessCalendar{},
+		&models.ApprovalLevelApprover{},
 		&models.ApprovalLevel{},
+		&models.Attachment{},
+		&models.Allocation{},
+		&models.ClaimLineItem{},
 		&models.Claim{},
+		&models.JournalExport{},
+		&models.PaymentBatch{},
+		&models.CashAdvance{},
+		&models.PayoutAccountChange{},
+		&models.PayoutAccount{},
+		&models.ExchangeRate{},
+		&models.MileageRate{},
+		&models.PerDiemRate{},
 		&models.ClaimType{},
+		&models.CostCenter{},
+		&models.Project{},
 		&models.User{},
 		&models.UserGroup{},
 	}
@@ -507,4 +973,4 @@ func (s *Seeder) ClearAll() error {
 
 	log.Println("✅ All data cleared")
 	return nil
-}
\ No newline at end of file
+}
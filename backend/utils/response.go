@@ -6,8 +6,10 @@ import (
 )
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	Error   string      `json:"error"`
+	Message string      `json:"message,omitempty"`
+	Code    string      `json:"code,omitempty"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 type SuccessResponse struct {
@@ -28,6 +30,17 @@ func WriteError(w http.ResponseWriter, status int, message string) {
 	})
 }
 
+// WriteErrorDetails writes an error with a machine-readable code and an
+// arbitrary details payload for clients that need more than a message.
+func WriteErrorDetails(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	WriteJSON(w, status, ErrorResponse{
+		Error:   http.StatusText(status),
+		Message: message,
+		Code:    code,
+		Details: details,
+	})
+}
+
 func WriteSuccess(w http.ResponseWriter, data interface{}, message ...string) {
 	response := SuccessResponse{Data: data}
 	if len(message) > 0 {
@@ -0,0 +1,372 @@
+package workflow
+
+import (
+	"fmt"
+	"time"
+
+	"hrcs/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// advanceTransition is a move in the cash advance lifecycle.
+type advanceTransition struct {
+	Action models.ClaimAction
+	From   []models.AdvanceStatus
+	To     models.AdvanceStatus
+}
+
+// advanceTransitions lists the legal moves of a cash advance. Settling
+// isn't an action: an advance is settled once claims and repayments
+// account for all of it.
+var advanceTransitions = []advanceTransition{
+	{
+		Action: models.ActionApproveLevel,
+		From:   []models.AdvanceStatus{models.AdvanceRequested, models.AdvanceInReview},
+		To:     models.AdvanceInReview,
+	},
+	{
+		Action: models.ActionApprove,
+		From:   []models.AdvanceStatus{models.AdvanceRequested, models.AdvanceInReview},
+		To:     models.AdvanceApproved,
+	},
+	{
+		Action: models.ActionReject,
+		From:   []models.AdvanceStatus{models.AdvanceRequested, models.AdvanceInReview},
+		To:     models.AdvanceRejected,
+	},
+	{
+		// Withdrawn by the employee, or by an admin, before it is paid out
+		Action: models.ActionCancel,
+		From:   []models.AdvanceStatus{models.AdvanceRequested, models.AdvanceInReview, models.AdvanceApproved},
+		To:     models.AdvanceCancelled,
+	},
+	{
+		Action: models.ActionDisburse,
+		From:   []models.AdvanceStatus{models.AdvanceApproved},
+		To:     models.AdvanceDisbursed,
+	},
+}
+
+// AdvanceTransitionError is returned when an action is not legal from a
+// cash advance's current status. Handlers surface it as a 409 Conflict.
+type AdvanceTransitionError struct {
+	Action         models.ClaimAction   `json:"action"`
+	From           models.AdvanceStatus `json:"from"`
+	AllowedActions []models.ClaimAction `json:"allowed_actions"`
+}
+
+func (e *AdvanceTransitionError) Error() string {
+	return fmt.Sprintf("cannot %s a cash advance that is %s", e.Action, e.From)
+}
+
+// AdvanceActions lists the actions that are legal from an advance status.
+func AdvanceActions(from models.AdvanceStatus) []models.ClaimAction {
+	actions := []models.ClaimAction{}
+	for _, t := range advanceTransitions {
+		if t.allows(from) {
+			actions = append(actions, t.Action)
+		}
+	}
+	return actions
+}
+
+func checkAdvance(advance *models.CashAdvance, action models.ClaimAction) (advanceTransition, error) {
+	for _, t := range advanceTransitions {
+		if t.Action == action && t.allows(advance.Status) {
+			return t, nil
+		}
+	}
+	return advanceTransition{}, &AdvanceTransitionError{Action: action, From: advance.Status, AllowedActions: AdvanceActions(advance.Status)}
+}
+
+func (t advanceTransition) allows(from models.AdvanceStatus) bool {
+	for _, s := range t.From {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+// AdvanceProgress is a cash advance's position in its approval chain.
+type AdvanceProgress struct {
+	Chain     []models.ApprovalLevel
+	Approvals map[uint][]models.AdvanceApproval // keyed by approval level ID
+	Current   *models.ApprovalLevel             // nil once every level has approved
+}
+
+// IsLast reports whether level is the final level of the chain.
+func (p *AdvanceProgress) IsLast(level *models.ApprovalLevel) bool {
+	return len(p.Chain) > 0 && p.Chain[len(p.Chain)-1].ID == level.ID
+}
+
+// Position returns the level's index in the chain, or -1.
+func (p *AdvanceProgress) Position(levelID uint) int {
+	for i, level := range p.Chain {
+		if level.ID == levelID {
+			return i
+		}
+	}
+	return -1
+}
+
+// AdvanceChain returns the levels a cash advance has to pass: the default
+// chain of the employee's user group, the levels limited to no claim type,
+// routed on the advance's base amount.
+func (e *Engine) AdvanceChain(advance *models.CashAdvance) ([]models.ApprovalLevel, error) {
+	levels, err := e.userLevels(advance.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return Route(SelectChain(levels, 0), advance.BaseAmount), nil
+}
+
+// AdvanceProgress loads an advance's chain and approvals and works out
+// which level is up next. Advances aren't reminded or escalated, so only
+// the levels' own approvers and their delegates can act on them.
+func (e *Engine) AdvanceProgress(advance *models.CashAdvance) (*AdvanceProgress, error) {
+	chain, err := e.AdvanceChain(advance)
+	if err != nil {
+		return nil, err
+	}
+
+	var approvals []models.AdvanceApproval
+	if err := e.DB.Preload("Approver").Preload("OnBehalfOf").
+		Where("advance_id = ? AND action IN ? AND approval_level_id IS NOT NULL", advance.ID, []models.ClaimAction{models.ActionApprove, models.ActionApproveLevel}).
+		Order("created_at").Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+
+	progress := &AdvanceProgress{Chain: chain, Approvals: map[uint][]models.AdvanceApproval{}}
+	for _, approval := range approvals {
+		levelID := *approval.ApprovalLevelID
+		progress.Approvals[levelID] = append(progress.Approvals[levelID], approval)
+	}
+	for i := range chain {
+		if !progress.satisfied(&chain[i], progress.Approvals[chain[i].ID]) {
+			progress.Current = &chain[i]
+			break
+		}
+	}
+	return progress, nil
+}
+
+func (p *AdvanceProgress) satisfied(level *models.ApprovalLevel, approvals []models.AdvanceApproval) bool {
+	approvers := make([]*models.User, len(approvals))
+	for i := range approvals {
+		approvers[i] = actedFor(approvals[i].Approver, approvals[i].OnBehalfOf)
+	}
+	return SatisfiedBy(level, approvers)
+}
+
+// TransitionAdvance applies an action to a cash advance on behalf of actor
+// and persists it together with an audit record. Approvals and rejections
+// come from the level that is up in the chain; the employee or an admin
+// may cancel an advance until it is paid out; disbursing it takes an
+// admin or a level of the group allowed to mark claims paid.
+func (e *Engine) TransitionAdvance(advance *models.CashAdvance, action models.ClaimAction, actor *models.User, note Note) (*models.AdvanceApproval, error) {
+	if action == models.ActionApproveLevel {
+		action = models.ActionApprove
+	}
+
+	// The advance is re-read under lock, so concurrent actions on it are
+	// checked against each other's outcome rather than a stale status
+	var approval *models.AdvanceApproval
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(advance, advance.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		approval, err = e.WithDB(tx).transitionAdvanceLocked(advance, action, actor, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// transitionAdvanceLocked applies an action to an advance TransitionAdvance
+// has locked.
+func (e *Engine) transitionAdvanceLocked(advance *models.CashAdvance, action models.ClaimAction, actor *models.User, note Note) (*models.AdvanceApproval, error) {
+	if _, err := checkAdvance(advance, action); err != nil {
+		return nil, err
+	}
+
+	switch action {
+	case models.ActionApprove, models.ActionReject:
+		return e.decideAdvance(advance, action, actor, note)
+	case models.ActionCancel:
+		if advance.UserID != actor.ID && actor.Role != models.RoleAdmin {
+			return nil, &GuardError{Action: action, Reason: "Only the employee or an admin can cancel this cash advance"}
+		}
+		return e.recordAdvance(advance, action, nil, actor, nil, nil, note.Comments)
+	}
+
+	if advance.UserID == actor.ID {
+		return nil, &GuardError{Action: action, Reason: "Cannot disburse your own cash advance"}
+	}
+	if actor.Role == models.RoleAdmin {
+		return e.recordAdvance(advance, action, nil, actor, nil, nil, note.Comments)
+	}
+	levels, err := e.userLevels(advance.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range levels {
+		if e.CanAct(&levels[i], actor) && Permits(&levels[i], action) {
+			return e.recordAdvance(advance, action, &levels[i], actor, nil, nil, note.Comments)
+		}
+	}
+	return nil, &GuardError{Action: action, Reason: "You don't have permission to set this status"}
+}
+
+// decideAdvance handles approve and reject, like decide does for claims.
+func (e *Engine) decideAdvance(advance *models.CashAdvance, action models.ClaimAction, actor *models.User, note Note) (*models.AdvanceApproval, error) {
+	if advance.UserID == actor.ID {
+		return nil, &GuardError{Action: action, Reason: "Cannot approve your own cash advance"}
+	}
+
+	var reason *models.ReasonCode
+	if action == models.ActionReject {
+		var err error
+		if reason, err = e.reason("cash advance", action, note); err != nil {
+			return nil, err
+		}
+	}
+
+	progress, err := e.AdvanceProgress(advance)
+	if err != nil {
+		return nil, err
+	}
+
+	// Employees outside any group have no chain; admins decide in one step
+	if len(progress.Chain) == 0 || progress.Current == nil {
+		if actor.Role != models.RoleAdmin {
+			return nil, &GuardError{Action: action, Reason: "No approval chain is configured for this cash advance"}
+		}
+		return e.recordAdvance(advance, action, nil, actor, nil, reason, note.Comments)
+	}
+
+	delegators, err := e.Delegators(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	level := progress.Current
+	onBehalfOf, ok := e.ActingFor(level, actor, delegators)
+	if !ok {
+		for i := progress.Position(level.ID) + 1; i < len(progress.Chain); i++ {
+			if _, later := e.ActingFor(&progress.Chain[i], actor, delegators); later {
+				return nil, &OutOfOrderError{PendingLevel: level.Level, ActorLevel: progress.Chain[i].Level}
+			}
+		}
+		return nil, &GuardError{Action: action, Reason: fmt.Sprintf("You are not an approver for level %d of this cash advance", level.Level)}
+	}
+	if onBehalfOf != nil && onBehalfOf.ID == advance.UserID {
+		return nil, &GuardError{Action: action, Reason: "Cannot act on a cash advance on behalf of the employee"}
+	}
+
+	if action == models.ActionApprove {
+		if !level.CanApprove {
+			return nil, &GuardError{Action: action, Reason: "You don't have permission to set this status"}
+		}
+
+		approver := actedFor(actor, onBehalfOf)
+		given := progress.Approvals[level.ID]
+		for i := range given {
+			if actedFor(given[i].Approver, given[i].OnBehalfOf).ID == approver.ID || (given[i].ApproverID != nil && *given[i].ApproverID == actor.ID) {
+				return nil, &GuardError{Action: action, Reason: "You have already approved this level"}
+			}
+		}
+
+		given = append(given, models.AdvanceApproval{ApproverID: &actor.ID, Approver: actor, OnBehalfOf: onBehalfOf})
+		if !progress.IsLast(level) || !progress.satisfied(level, given) {
+			action = models.ActionApproveLevel
+		}
+	} else if !level.CanReject {
+		return nil, &GuardError{Action: action, Reason: "You don't have permission to set this status"}
+	}
+
+	return e.recordAdvance(advance, action, level, actor, onBehalfOf, reason, note.Comments)
+}
+
+// recordAdvance moves the advance and writes the audit entry in one
+// transaction, updating only the columns a transition changes. Disbursing
+// an advance makes all of it outstanding.
+func (e *Engine) recordAdvance(advance *models.CashAdvance, action models.ClaimAction, level *models.ApprovalLevel, actor, onBehalfOf *models.User, reason *models.ReasonCode, comments string) (*models.AdvanceApproval, error) {
+	t, err := checkAdvance(advance, action)
+	if err != nil {
+		return nil, err
+	}
+	advance.Status = t.To
+	if action == models.ActionDisburse {
+		now := time.Now()
+		advance.Outstanding = advance.Amount
+		advance.DisbursedAt = &now
+	}
+
+	approval := &models.AdvanceApproval{
+		AdvanceID:  advance.ID,
+		ApproverID: &actor.ID,
+		Status:     advance.Status,
+		Action:     action,
+		Comments:   comments,
+	}
+	if level != nil {
+		approval.ApprovalLevelID = &level.ID
+	}
+	if onBehalfOf != nil {
+		approval.OnBehalfOfID = &onBehalfOf.ID
+	}
+	if reason != nil {
+		approval.ReasonCodeID = &reason.ID
+	}
+
+	err = e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(advance).Updates(map[string]interface{}{
+			"status":       advance.Status,
+			"outstanding":  advance.Outstanding,
+			"disbursed_at": advance.DisbursedAt,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Create(approval).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// AdvanceInvolved reports whether the user takes part in approving a cash
+// advance: as an approver of a level in its chain, directly or as a
+// delegate, or as someone who has already acted on it.
+func (e *Engine) AdvanceInvolved(advance *models.CashAdvance, user *models.User) (bool, error) {
+	var acted int64
+	if err := e.DB.Model(&models.AdvanceApproval{}).
+		Where("advance_id = ? AND (approver_id = ? OR on_behalf_of_id = ?)", advance.ID, user.ID, user.ID).
+		Count(&acted).Error; err != nil {
+		return false, err
+	}
+	if acted > 0 {
+		return true, nil
+	}
+
+	chain, err := e.AdvanceChain(advance)
+	if err != nil {
+		return false, err
+	}
+	delegators, err := e.Delegators(user)
+	if err != nil {
+		return false, err
+	}
+	for i := range chain {
+		if _, ok := e.ActingFor(&chain[i], user, delegators); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
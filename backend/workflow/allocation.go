@@ -0,0 +1,105 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+
+	"gorm.io/gorm"
+)
+
+// hundred is what the percentages of a set of allocations add up to.
+var hundred = money.FromInt(100)
+
+// CheckAllocationSet checks the allocations of a claim or line: each
+// charges an active cost center, and optionally an active project, that
+// the claimant's group may use, no pairing is given twice, and the
+// percentages add up to 100. Cost centers and projects must be loaded with
+// their user groups.
+func CheckAllocationSet(allocations []models.Allocation, claimant *models.User) error {
+	total := money.Zero
+	seen := map[[2]uint]bool{}
+	for _, allocation := range allocations {
+		costCenter := allocation.CostCenter
+		if costCenter == nil {
+			return errors.New("Invalid cost center")
+		}
+		if !costCenter.Active {
+			return fmt.Errorf("Cost center %s is no longer accepted", costCenter.Code)
+		}
+		if !costCenter.AllowsGroup(claimant.UserGroupID) {
+			return fmt.Errorf("Your group can't charge cost center %s", costCenter.Code)
+		}
+
+		key := [2]uint{costCenter.ID, 0}
+		if project := allocation.Project; project != nil {
+			if !project.Active {
+				return fmt.Errorf("Project %s is no longer accepted", project.Code)
+			}
+			if !project.AllowsGroup(claimant.UserGroupID) {
+				return fmt.Errorf("Your group can't charge project %s", project.Code)
+			}
+			key[1] = project.ID
+		}
+		if seen[key] {
+			return fmt.Errorf("Cost center %s is allocated twice; combine the percentages", costCenter.Code)
+		}
+		seen[key] = true
+
+		if allocation.Percent.Sign() <= 0 {
+			return errors.New("Allocation percentages must be greater than zero")
+		}
+		total = total.Add(allocation.Percent)
+	}
+	if len(allocations) > 0 && total.Cmp(hundred) != 0 {
+		return fmt.Errorf("Allocation percentages add up to %s, not 100", total)
+	}
+	return nil
+}
+
+// CheckAllocations makes sure a claim being submitted is fully charged:
+// every line has allocations of its own or falls back on the claim's, and
+// each set still holds. Allocations must be loaded with their cost
+// centers and projects, and those with their user groups.
+func CheckAllocations(claim *models.Claim, claimant *models.User) []Violation {
+	violations := []Violation{}
+	add := func(line int, message string) {
+		violations = append(violations, Violation{Line: line, Rule: "allocation", Severity: models.SeverityBlock, Message: message})
+	}
+
+	if len(claim.Allocations) > 0 {
+		if err := CheckAllocationSet(claim.Allocations, claimant); err != nil {
+			add(0, err.Error())
+		}
+	}
+	if len(claim.Lines) == 0 {
+		if len(claim.Allocations) == 0 {
+			add(0, "Charge the claim to a cost center")
+		}
+		return violations
+	}
+
+	for i, line := range claim.Lines {
+		prefix := fmt.Sprintf("Line %d: ", i+1)
+		if len(line.Allocations) == 0 {
+			if len(claim.Allocations) == 0 {
+				add(i+1, prefix+"Charge the line, or the claim, to a cost center")
+			}
+			continue
+		}
+		if err := CheckAllocationSet(line.Allocations, claimant); err != nil {
+			add(i+1, prefix+err.Error())
+		}
+	}
+	return violations
+}
+
+// PreloadAllocations loads a claim's allocations, and those of its lines,
+// with their cost centers and projects.
+func PreloadAllocations(query *gorm.DB) *gorm.DB {
+	return query.Preload("Allocations", "line_item_id IS NULL").
+		Preload("Allocations.CostCenter.UserGroups").Preload("Allocations.Project.UserGroups").
+		Preload("Lines.Allocations.CostCenter.UserGroups").Preload("Lines.Allocations.Project.UserGroups")
+}
@@ -0,0 +1,120 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// Violation is a claim-type or expense policy rule a claim breaks.
+type Violation struct {
+	// Line is the 1-based line number, or 0 when the claim isn't itemized
+	// or the rule covers a day or the whole claim
+	Line int `json:"line,omitempty"`
+	// Rule names the claim-type rule, or is "policy" for policy rules
+	Rule     string                `json:"rule"`
+	RuleID   uint                  `json:"rule_id,omitempty"`
+	Severity models.PolicySeverity `json:"severity"`
+	Date     string                `json:"date,omitempty"`
+	Message  string                `json:"message"`
+}
+
+// PolicyError is returned when a claim breaks the rules of its claim
+// types or a blocking policy rule. Handlers surface it as a 422 with the
+// violations as details.
+type PolicyError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *PolicyError) Error() string {
+	if len(e.Violations) == 1 {
+		return e.Violations[0].Message
+	}
+	return fmt.Sprintf("Claim breaks %d policy rules", len(e.Violations))
+}
+
+// CheckClaimTypes holds each line of the claim to the rules of its claim
+// type. Drafts may still lack receipts and justifications; those are only
+// required when submitting. Lines must be loaded with their claim types,
+// and for submission the claim's attachments too. Limits are in the base
+// currency, so the claim must have been priced. Claims that aren't
+// itemized need their expense date.
+func CheckClaimTypes(claim *models.Claim, submitting bool, now time.Time) error {
+	itemized := len(claim.Lines) > 0
+	today := day(now)
+
+	violations := []Violation{}
+	// Without a date the validity period couldn't be checked
+	if !itemized && claim.ExpenseDate == nil {
+		violations = append(violations, Violation{Rule: "expense_date", Severity: models.SeverityBlock, Message: "The date of the expense is required"})
+	}
+	for i, line := range claim.Items() {
+		number, prefix := 0, ""
+		if itemized {
+			number, prefix = i+1, fmt.Sprintf("Line %d: ", i+1)
+		}
+		add := func(rule, format string, args ...interface{}) {
+			violations = append(violations, Violation{Line: number, Rule: rule, Severity: models.SeverityBlock, Message: prefix + fmt.Sprintf(format, args...)})
+		}
+
+		claimType := line.ClaimType
+		if !claimType.Active {
+			add("inactive", "%s is no longer accepted", claimType.Name)
+			continue
+		}
+
+		if claimType.MaxAmount != nil && line.BaseAmount.GreaterThan(*claimType.MaxAmount) {
+			limit := claimType.MaxAmount.StringFixed(money.MinorUnits(claim.BaseCurrency))
+			add("max_amount", "%s is limited to %s %s per expense", claimType.Name, limit, claim.BaseCurrency)
+		}
+
+		date := line.Date
+		if date.IsZero() {
+			date = now
+		}
+		if claimType.ValidityPeriod > 0 && today.After(day(date).AddDate(0, 0, claimType.ValidityPeriod)) {
+			add("validity_period", "%s must be claimed within %d days of the expense", claimType.Name, claimType.ValidityPeriod)
+		}
+
+		if !submitting {
+			continue
+		}
+		if claimType.RequiresReceipt && !hasReceipt(claim, &line, itemized) {
+			add("receipt", "A receipt is required for %s", claimType.Name)
+		}
+		if claimType.RequiresJustification && strings.TrimSpace(line.Description) == "" && strings.TrimSpace(claim.Description) == "" {
+			add("justification", "A justification is required for %s; add it to the description", claimType.Name)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// hasReceipt reports whether a receipt backs the line: a receipt URL, or an
+// attachment on the line. Attachments not tied to a line count for claims
+// that aren't itemized.
+func hasReceipt(claim *models.Claim, line *models.ClaimLineItem, itemized bool) bool {
+	if strings.TrimSpace(line.ReceiptURL) != "" {
+		return true
+	}
+	for _, attachment := range claim.Attachments {
+		if attachment.LineItemID == nil && !itemized {
+			return true
+		}
+		if attachment.LineItemID != nil && *attachment.LineItemID == line.ID && itemized {
+			return true
+		}
+	}
+	return false
+}
+
+// day truncates a time to its calendar date.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,1008 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hrcs/backend/advance"
+	"hrcs/backend/budget"
+	"hrcs/backend/currency"
+	"hrcs/backend/duplicate"
+	"hrcs/backend/models"
+	"hrcs/backend/policy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Engine drives claims through the approval chain of the claimant's user
+// group, one level at a time.
+type Engine struct {
+	DB         *gorm.DB
+	Rates      *currency.Rates
+	Duplicates *duplicate.Detector
+	Budgets    *budget.Tracker
+}
+
+func NewEngine(db *gorm.DB) *Engine {
+	return &Engine{DB: db, Rates: currency.NewRates(db), Duplicates: duplicate.NewDetector(db, duplicate.DefaultWindowDays, false), Budgets: budget.NewTracker(db)}
+}
+
+// WithDB returns a copy of the engine working in db, so that several
+// transitions can be made in one transaction.
+func (e *Engine) WithDB(db *gorm.DB) *Engine {
+	duplicates := *e.Duplicates
+	duplicates.DB = db
+	return &Engine{DB: db, Rates: currency.NewRates(db), Duplicates: &duplicates, Budgets: budget.NewTracker(db)}
+}
+
+// Progress is a claim's position in its approval chain for the current
+// submission round.
+type Progress struct {
+	Levels    []models.ApprovalLevel          // the group's levels for the claim's type
+	Chain     []models.ApprovalLevel          // the levels this claim is routed through
+	Approvals map[uint][]models.ClaimApproval // keyed by approval level ID
+	Complete  map[uint]bool                   // levels whose approvers are satisfied
+	Rejection *models.ClaimApproval           // set when a level rejected this round
+	Return    *models.ClaimApproval           // set when a level returned the claim this round
+	Carried   map[uint]bool                   // levels a resumed claim passed in an earlier round
+	Current   *models.ApprovalLevel           // nil once every level has approved
+	// Escalations holds the scheduler's escalation of overdue levels, keyed
+	// by approval level ID
+	Escalations map[uint]*models.ClaimApproval
+	// Since is when the current level became pending
+	Since time.Time
+}
+
+// IsLast reports whether level is the final level of the chain.
+func (p *Progress) IsLast(level *models.ApprovalLevel) bool {
+	return len(p.Chain) > 0 && p.Chain[len(p.Chain)-1].ID == level.ID
+}
+
+// Position returns the level's index in the chain, or -1.
+func (p *Progress) Position(levelID uint) int {
+	for i, level := range p.Chain {
+		if level.ID == levelID {
+			return i
+		}
+	}
+	return -1
+}
+
+// OutOfOrderError is returned when an approver of a later level tries to
+// act while an earlier level is still pending.
+type OutOfOrderError struct {
+	PendingLevel int `json:"pending_level"`
+	ActorLevel   int `json:"actor_level"`
+}
+
+func (e *OutOfOrderError) Error() string {
+	return fmt.Sprintf("level %d approval is still pending; level %d cannot act yet", e.PendingLevel, e.ActorLevel)
+}
+
+// IsComplete reports whether a level has all the approvals it needs.
+func (p *Progress) IsComplete(levelID uint) bool {
+	return p.Complete[levelID]
+}
+
+// InChain reports whether a level is part of the routed chain.
+func (p *Progress) InChain(levelID uint) bool {
+	return p.Position(levelID) >= 0
+}
+
+// Levels returns the approval levels of the claimant's user group that
+// make up the chain for the claim's type, in order.
+func (e *Engine) Levels(claim *models.Claim) ([]models.ApprovalLevel, error) {
+	levels, err := e.groupLevels(claim)
+	if err != nil {
+		return nil, err
+	}
+	return SelectChain(levels, claim.ClaimTypeID), nil
+}
+
+// groupLevels returns every approval level of the claimant's user group,
+// whatever claim types they are limited to.
+func (e *Engine) groupLevels(claim *models.Claim) ([]models.ApprovalLevel, error) {
+	return e.userLevels(claim.UserID)
+}
+
+// userLevels returns every approval level of a user's group.
+func (e *Engine) userLevels(userID uint) ([]models.ApprovalLevel, error) {
+	var user models.User
+	if err := e.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	levels := []models.ApprovalLevel{}
+	if user.UserGroupID == nil {
+		return levels, nil
+	}
+
+	err := e.levelQuery().Where("user_group_id = ?", *user.UserGroupID).Find(&levels).Error
+	return levels, err
+}
+
+// levelQuery loads approval levels in order with what routing and
+// progress need of them.
+func (e *Engine) levelQuery() *gorm.DB {
+	return e.DB.Preload("Approver").Preload("UserGroup").Preload("ClaimTypes").
+		Preload("Approvers.User").Preload("Approvers.UserGroup").Preload("FallbackApprover").
+		Order("level")
+}
+
+// Chain returns the ordered approval levels a claim has to pass, routed on
+// its amount in the base currency.
+func (e *Engine) Chain(claim *models.Claim) ([]models.ApprovalLevel, error) {
+	levels, err := e.Levels(claim)
+	if err != nil {
+		return nil, err
+	}
+	return Route(levels, claim.BaseAmount), nil
+}
+
+// progressActions are the actions that move a claim along its chain.
+var progressActions = []models.ClaimAction{models.ActionSubmit, models.ActionApprove, models.ActionApproveLevel, models.ActionReject, models.ActionReturn, models.ActionEscalate}
+
+// approvalQuery loads approvals in order with who gave them.
+func (e *Engine) approvalQuery() *gorm.DB {
+	return e.DB.Preload("Approver").Preload("OnBehalfOf").Preload("EscalatedTo").
+		Where("action IN ?", progressActions).Order("created_at")
+}
+
+// Progress loads the chain and the approvals given in the claim's current
+// round, and works out which level is up next.
+func (e *Engine) Progress(claim *models.Claim) (*Progress, error) {
+	levels, err := e.groupLevels(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	var approvals []models.ClaimApproval
+	if err := e.approvalQuery().Where("claim_id = ? AND round = ?", claim.ID, claim.Round).Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+	return newProgress(claim, levels, approvals), nil
+}
+
+// Progresses is Progress for a list of claims, keyed by claim ID. It loads
+// the levels of the claimants' groups and the approvals of the claims'
+// current rounds in a few queries for the whole list rather than claim by
+// claim.
+func (e *Engine) Progresses(claims []models.Claim) (map[uint]*Progress, error) {
+	progresses := map[uint]*Progress{}
+	if len(claims) == 0 {
+		return progresses, nil
+	}
+
+	userIDs := []uint{}
+	rounds := [][]interface{}{}
+	for i := range claims {
+		userIDs = append(userIDs, claims[i].UserID)
+		rounds = append(rounds, []interface{}{claims[i].ID, claims[i].Round})
+	}
+
+	var users []models.User
+	if err := e.DB.Select("id", "user_group_id").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	groupOf := map[uint]uint{}
+	groupIDs := []uint{}
+	for _, user := range users {
+		if user.UserGroupID != nil {
+			groupOf[user.ID] = *user.UserGroupID
+			groupIDs = append(groupIDs, *user.UserGroupID)
+		}
+	}
+
+	levelsOf := map[uint][]models.ApprovalLevel{}
+	if len(groupIDs) > 0 {
+		var levels []models.ApprovalLevel
+		if err := e.levelQuery().Where("user_group_id IN ?", groupIDs).Find(&levels).Error; err != nil {
+			return nil, err
+		}
+		for _, level := range levels {
+			levelsOf[level.UserGroupID] = append(levelsOf[level.UserGroupID], level)
+		}
+	}
+
+	var approvals []models.ClaimApproval
+	if err := e.approvalQuery().Where("(claim_id, round) IN ?", rounds).Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+	approvalsOf := map[uint][]models.ClaimApproval{}
+	for _, approval := range approvals {
+		approvalsOf[approval.ClaimID] = append(approvalsOf[approval.ClaimID], approval)
+	}
+
+	for i := range claims {
+		levels := []models.ApprovalLevel{}
+		if groupID, ok := groupOf[claims[i].UserID]; ok {
+			levels = levelsOf[groupID]
+		}
+		progresses[claims[i].ID] = newProgress(&claims[i], levels, approvalsOf[claims[i].ID])
+	}
+	return progresses, nil
+}
+
+// newProgress works out a claim's progress from every level of the
+// claimant's group and the approvals of the claim's current round, in the
+// order they were given.
+func newProgress(claim *models.Claim, groupLevels []models.ApprovalLevel, approvals []models.ClaimApproval) *Progress {
+	levels := SelectChain(groupLevels, claim.ClaimTypeID)
+	chain := Route(levels, claim.BaseAmount)
+
+	progress := &Progress{
+		Levels:      levels,
+		Chain:       chain,
+		Approvals:   map[uint][]models.ClaimApproval{},
+		Complete:    map[uint]bool{},
+		Escalations: map[uint]*models.ClaimApproval{},
+		Carried:     map[uint]bool{},
+	}
+	for i, approval := range approvals {
+		switch {
+		case approval.Action == models.ActionSubmit:
+			progress.Since = approval.CreatedAt
+		case approval.Action == models.ActionReject:
+			progress.Rejection = &approvals[i]
+		case approval.Action == models.ActionReturn:
+			progress.Return = &approvals[i]
+		case approval.ApprovalLevelID == nil:
+		case approval.Action == models.ActionEscalate:
+			progress.Escalations[*approval.ApprovalLevelID] = &approvals[i]
+		default:
+			levelID := *approval.ApprovalLevelID
+			progress.Approvals[levelID] = append(progress.Approvals[levelID], approval)
+		}
+	}
+
+	for i := range levels {
+		progress.Complete[levels[i].ID] = Satisfied(&levels[i], progress.Approvals[levels[i].ID])
+	}
+
+	// A resubmitted claim that resumes at the level which returned it
+	// keeps the levels before that one
+	resumeAt := 0
+	if claim.ResumeLevelID != nil && progress.Position(*claim.ResumeLevelID) > 0 {
+		resumeAt = progress.Position(*claim.ResumeLevelID)
+	}
+
+	for i := range chain {
+		level := &chain[i]
+		if i < resumeAt {
+			progress.Complete[level.ID] = true
+			progress.Carried[level.ID] = true
+			continue
+		}
+
+		// Whoever an overdue level was escalated to can act on it alongside
+		// its own approvers
+		// The levels may be shared with other claims' progress, so the
+		// approvers are copied rather than appended to in place
+		if target := progress.escalationTarget(level); target != nil {
+			level.Approvers = append(level.Approvers[:len(level.Approvers):len(level.Approvers)], *target)
+		}
+		progress.Complete[level.ID] = progress.Satisfied(level, progress.Approvals[level.ID])
+
+		if !progress.IsComplete(level.ID) {
+			progress.Current = level
+			break
+		}
+
+		// The next level became pending when this one was completed or
+		// escalated past
+		for _, approval := range progress.Approvals[level.ID] {
+			if approval.CreatedAt.After(progress.Since) {
+				progress.Since = approval.CreatedAt
+			}
+		}
+		if escalation := progress.Escalations[level.ID]; escalation != nil && escalation.CreatedAt.After(progress.Since) {
+			progress.Since = escalation.CreatedAt
+		}
+	}
+
+	return progress
+}
+
+// Satisfied reports whether approvals complete a chain level, taking an
+// escalation of the level into account: a level escalated to a user is
+// complete once that user approves, and a level escalated without one
+// passes straight to the next level.
+func (p *Progress) Satisfied(level *models.ApprovalLevel, approvals []models.ClaimApproval) bool {
+	if Satisfied(level, approvals) {
+		return true
+	}
+
+	escalation := p.Escalations[level.ID]
+	if escalation == nil {
+		return false
+	}
+	if escalation.EscalatedToID == nil && !p.IsLast(level) {
+		return true
+	}
+
+	target := p.escalationTarget(level)
+	for i := range approvals {
+		if target.Matches(approvedBy(&approvals[i])) {
+			return true
+		}
+	}
+	return false
+}
+
+// escalationTarget returns the assignment an escalated level was handed
+// to: the user it was escalated to, or the admins when the last level of
+// the chain is overdue. It is nil when the level was not escalated or was
+// passed on to the next level.
+func (p *Progress) escalationTarget(level *models.ApprovalLevel) *models.ApprovalLevelApprover {
+	escalation := p.Escalations[level.ID]
+	switch {
+	case escalation == nil:
+		return nil
+	case escalation.EscalatedToID != nil:
+		return &models.ApprovalLevelApprover{
+			ApprovalLevelID: level.ID,
+			Type:            models.ApproverTypeUser,
+			UserID:          escalation.EscalatedToID,
+			User:            escalation.EscalatedTo,
+		}
+	case p.IsLast(level):
+		return &models.ApprovalLevelApprover{
+			ApprovalLevelID: level.ID,
+			Type:            models.ApproverTypeRole,
+			Role:            models.RoleAdmin,
+		}
+	}
+	return nil
+}
+
+// Assignments returns who may act on a level: its approver assignments
+// plus its primary approver.
+func Assignments(level *models.ApprovalLevel) []models.ApprovalLevelApprover {
+	assignments := append([]models.ApprovalLevelApprover{}, level.Approvers...)
+	if level.ApproverID == nil {
+		return assignments
+	}
+
+	for _, a := range assignments {
+		if a.Type == models.ApproverTypeUser && a.UserID != nil && *a.UserID == *level.ApproverID {
+			return assignments
+		}
+	}
+	return append(assignments, models.ApprovalLevelApprover{
+		ApprovalLevelID: level.ID,
+		Type:            models.ApproverTypeUser,
+		UserID:          level.ApproverID,
+		User:            level.Approver,
+	})
+}
+
+// Satisfied reports whether the approvals given on a level complete it. Any
+// single approval completes an any-of level; an all-of level needs an
+// approval covering each of its assignments.
+func Satisfied(level *models.ApprovalLevel, approvals []models.ClaimApproval) bool {
+	approvers := make([]*models.User, len(approvals))
+	for i := range approvals {
+		approvers[i] = approvedBy(&approvals[i])
+	}
+	return SatisfiedBy(level, approvers)
+}
+
+// SatisfiedBy reports whether approvals given for the approvers complete a
+// level.
+func SatisfiedBy(level *models.ApprovalLevel, approvers []*models.User) bool {
+	if len(approvers) == 0 {
+		return false
+	}
+	if !level.RequiresAllApprovers {
+		return true
+	}
+
+	for _, assignment := range Assignments(level) {
+		covered := false
+		for _, approver := range approvers {
+			if assignment.Matches(approver) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// approvedBy returns the approver an approval counts for: the absent
+// approver when a delegate acted, otherwise the user who acted.
+func approvedBy(approval *models.ClaimApproval) *models.User {
+	return actedFor(approval.Approver, approval.OnBehalfOf)
+}
+
+// actedFor returns who an action counts for: the absent approver when a
+// delegate acted on their behalf, otherwise the approver.
+func actedFor(approver, onBehalfOf *models.User) *models.User {
+	if onBehalfOf != nil {
+		return onBehalfOf
+	}
+	if approver != nil {
+		return approver
+	}
+	return &models.User{}
+}
+
+// CanAct reports whether the user may act on the given level in their own
+// right.
+func (e *Engine) CanAct(level *models.ApprovalLevel, user *models.User) bool {
+	for _, assignment := range Assignments(level) {
+		if assignment.Matches(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delegators returns the approvers whose delegation the user holds right
+// now.
+func (e *Engine) Delegators(user *models.User) ([]models.User, error) {
+	now := time.Now()
+	var delegations []models.ApproverDelegation
+	if err := e.DB.Preload("Delegator").
+		Where("delegate_id = ? AND start_date <= ? AND end_date >= ?", user.ID, now, now).
+		Find(&delegations).Error; err != nil {
+		return nil, err
+	}
+
+	delegators := []models.User{}
+	for _, d := range delegations {
+		delegators = append(delegators, d.Delegator)
+	}
+	return delegators, nil
+}
+
+// ActingFor works out whether the user can act on a level, either as one
+// of its approvers or as the delegate of one. onBehalfOf is nil when they
+// act in their own right.
+func (e *Engine) ActingFor(level *models.ApprovalLevel, user *models.User, delegators []models.User) (onBehalfOf *models.User, ok bool) {
+	if e.CanAct(level, user) {
+		return nil, true
+	}
+	for i := range delegators {
+		if e.CanAct(level, &delegators[i]) {
+			return &delegators[i], true
+		}
+	}
+	return nil, false
+}
+
+// Involved reports whether the user takes part in approving the claim: as
+// an approver of a level in its chain, directly or as a delegate, or as
+// someone who has already acted on it.
+func (e *Engine) Involved(claim *models.Claim, user *models.User) (bool, error) {
+	var acted int64
+	if err := e.DB.Model(&models.ClaimApproval{}).
+		Where("claim_id = ? AND (approver_id = ? OR on_behalf_of_id = ? OR escalated_to_id = ?)", claim.ID, user.ID, user.ID, user.ID).
+		Count(&acted).Error; err != nil {
+		return false, err
+	}
+	if acted > 0 {
+		return true, nil
+	}
+
+	chain, err := e.Chain(claim)
+	if err != nil {
+		return false, err
+	}
+	delegators, err := e.Delegators(user)
+	if err != nil {
+		return false, err
+	}
+	for i := range chain {
+		if _, ok := e.ActingFor(&chain[i], user, delegators); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Note is what the actor records with a transition. Rejections and
+// returns need a ReasonCode from the catalogue. Submissions carry the
+// claimant's Justifications for policy exceptions, by policy rule ID.
+type Note struct {
+	Comments       string
+	ReasonCode     string
+	Justifications map[uint]string
+}
+
+// Transition applies an action to a claim on behalf of actor, enforcing the
+// state machine and the approval chain, and persists the claim together
+// with an audit record.
+func (e *Engine) Transition(claim *models.Claim, action models.ClaimAction, actor *models.User, note Note) (*models.ClaimApproval, error) {
+	// Submission checks run per line against the claim types' rules and
+	// the allocations, so load what they look at
+	if action == models.ActionSubmit {
+		if err := PreloadAllocations(e.DB.Preload("ClaimType").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("date, id")
+		}).Preload("Lines.ClaimType").Preload("Attachments")).First(claim, claim.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	switch action {
+	case models.ActionApprove, models.ActionApproveLevel:
+		return e.decide(claim, models.ActionApprove, actor, note)
+	case models.ActionReject, models.ActionReturn:
+		return e.decide(claim, action, actor, note)
+	default:
+		return e.process(claim, action, actor, note)
+	}
+}
+
+// reason validates the reason code given for a rejection or return of a
+// claim, or of another subject such as a cash advance.
+func (e *Engine) reason(subject string, action models.ClaimAction, note Note) (*models.ReasonCode, error) {
+	code := strings.TrimSpace(note.ReasonCode)
+	if code == "" {
+		return nil, &ReasonError{Action: action, Reason: fmt.Sprintf("A reason code is required to %s a %s", action, subject)}
+	}
+
+	var reason models.ReasonCode
+	err := e.DB.Where("UPPER(code) = UPPER(?) AND active = ?", code, true).First(&reason).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && !reason.AppliesTo(action)) {
+		return nil, &ReasonError{Action: action, Code: code, Reason: fmt.Sprintf("Reason code %s cannot be used to %s a %s", code, action, subject)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reason.RequiresComments && strings.TrimSpace(note.Comments) == "" {
+		return nil, &ReasonError{Action: action, Code: reason.Code, Reason: fmt.Sprintf("Comments are required with reason code %s", reason.Code)}
+	}
+	return &reason, nil
+}
+
+// decide handles approve, reject and return, which may only come from the
+// level that is currently up in the chain. The claim is locked while the
+// decision is made, so that concurrent decisions are taken one after the
+// other, each on the progress the earlier ones left.
+func (e *Engine) decide(claim *models.Claim, action models.ClaimAction, actor *models.User, note Note) (*models.ClaimApproval, error) {
+	var approval *models.ClaimApproval
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(claim, claim.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		approval, err = e.WithDB(tx).decideLocked(claim, action, actor, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// decideLocked makes a decision on a claim decide has locked.
+func (e *Engine) decideLocked(claim *models.Claim, action models.ClaimAction, actor *models.User, note Note) (*models.ClaimApproval, error) {
+	if _, err := Check(claim, action, actor); err != nil {
+		return nil, err
+	}
+
+	var reason *models.ReasonCode
+	if action != models.ActionApprove {
+		var err error
+		if reason, err = e.reason("claim", action, note); err != nil {
+			return nil, err
+		}
+	}
+
+	progress, err := e.Progress(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claims from users outside any group have no chain; admins decide them
+	// in one step
+	if len(progress.Chain) == 0 || progress.Current == nil {
+		if actor.Role != models.RoleAdmin {
+			return nil, &GuardError{Action: action, Reason: "No approval chain is configured for this claim"}
+		}
+		warnings, err := e.holdToBudgets(claim, action)
+		if err != nil {
+			return nil, err
+		}
+		return e.record(claim, action, nil, actor, nil, reason, note.Comments, warnings)
+	}
+
+	delegators, err := e.Delegators(actor)
+	if err != nil {
+		return nil, err
+	}
+
+	level := progress.Current
+	onBehalfOf, ok := e.ActingFor(level, actor, delegators)
+	if !ok {
+		for i := progress.Position(level.ID) + 1; i < len(progress.Chain); i++ {
+			if _, later := e.ActingFor(&progress.Chain[i], actor, delegators); later {
+				return nil, &OutOfOrderError{PendingLevel: level.Level, ActorLevel: progress.Chain[i].Level}
+			}
+		}
+		return nil, &GuardError{Action: action, Reason: fmt.Sprintf("You are not an approver for level %d of this claim", level.Level)}
+	}
+	if onBehalfOf != nil && onBehalfOf.ID == claim.UserID {
+		return nil, &GuardError{Action: action, Reason: "Cannot act on a claim on behalf of its claimant"}
+	}
+
+	// approver is who the decision counts for
+	approver := actor
+	if onBehalfOf != nil {
+		approver = onBehalfOf
+	}
+
+	if action == models.ActionApprove {
+		if !level.CanApprove {
+			return nil, &GuardError{Action: action, Reason: "You don't have permission to set this status"}
+		}
+
+		given := progress.Approvals[level.ID]
+		for i := range given {
+			if approvedBy(&given[i]).ID == approver.ID || (given[i].ApproverID != nil && *given[i].ApproverID == actor.ID) {
+				return nil, &GuardError{Action: action, Reason: "You have already approved this level"}
+			}
+		}
+
+		// The claim only leaves review once this approval completes the last
+		// level of the chain
+		given = append(given, models.ClaimApproval{ApproverID: &actor.ID, Approver: actor, OnBehalfOf: onBehalfOf})
+		if !progress.IsLast(level) || !progress.Satisfied(level, given) {
+			action = models.ActionApproveLevel
+		}
+	} else if !level.CanReject {
+		return nil, &GuardError{Action: action, Reason: "You don't have permission to set this status"}
+	}
+
+	warnings, err := e.holdToBudgets(claim, action)
+	if err != nil {
+		return nil, err
+	}
+	return e.record(claim, action, level, actor, onBehalfOf, reason, note.Comments, warnings)
+}
+
+// holdToBudgets checks the budgets a claim draws on when it is finally
+// approved. Overrunning a blocking budget stops the approval; the messages
+// for overrun warning budgets are returned to be kept on the approval.
+func (e *Engine) holdToBudgets(claim *models.Claim, action models.ClaimAction) ([]string, error) {
+	if action != models.ActionApprove {
+		return nil, nil
+	}
+	overruns, err := e.Budgets.Check(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	blocked := []budget.Overrun{}
+	for _, overrun := range overruns {
+		if overrun.Enforcement == models.EnforceBlock {
+			blocked = append(blocked, overrun)
+		} else {
+			warnings = append(warnings, overrun.Message)
+		}
+	}
+	if len(blocked) > 0 {
+		return nil, &budget.BudgetError{Overruns: blocked}
+	}
+	return warnings, nil
+}
+
+// process handles the remaining actions. The claimant may submit and
+// withdraw their own claim; everyone else needs a level of the group that
+// carries the matching permission.
+func (e *Engine) process(claim *models.Claim, action models.ClaimAction, actor *models.User, note Note) (*models.ClaimApproval, error) {
+	if _, err := Check(claim, action, actor); err != nil {
+		return nil, err
+	}
+	if action == models.ActionSubmit {
+		// Submitting fixes the claim's conversion into the base currency,
+		// which the policy checks and routing then work on
+		if claim.BaseCurrency == "" {
+			claim.BaseCurrency = claim.Currency
+		}
+		if err := e.Rates.Price(claim, time.Now()); err != nil {
+			return nil, err
+		}
+		if err := e.screen(claim, note); err != nil {
+			return nil, err
+		}
+		duplicates, err := e.Duplicates.Detect(claim)
+		if err != nil {
+			return nil, err
+		}
+		claim.Duplicates = duplicates
+	}
+
+	claimantAction := action == models.ActionSubmit || action == models.ActionWithdraw || action == models.ActionCancel
+	if claimantAction && claim.UserID == actor.ID {
+		if action == models.ActionSubmit {
+			resume, err := e.resumeLevel(claim)
+			if err != nil {
+				return nil, err
+			}
+			claim.ResumeLevelID = resume
+		}
+		return e.record(claim, action, nil, actor, nil, nil, note.Comments, nil)
+	}
+
+	// Payment and other housekeeping permissions are not tied to the
+	// claim's route, so any level of the group may carry them
+	chain, err := e.groupLevels(claim)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chain) == 0 && actor.Role == models.RoleAdmin {
+		return e.record(claim, action, nil, actor, nil, nil, note.Comments, nil)
+	}
+
+	for i := range chain {
+		if e.CanAct(&chain[i], actor) && Permits(&chain[i], action) {
+			return e.record(claim, action, &chain[i], actor, nil, nil, note.Comments, nil)
+		}
+	}
+
+	return nil, &GuardError{Action: action, Reason: "You don't have permission to set this status"}
+}
+
+// screen holds a claim being submitted to its claim types' rules, its
+// allocations and the active expense policy rules. Blocking violations, and exceptions the
+// claimant hasn't justified, stop the submission; warnings and justified
+// exceptions are kept on the claim for its approvers.
+func (e *Engine) screen(claim *models.Claim, note Note) error {
+	violations := []Violation{}
+	var typeErr *PolicyError
+	if err := CheckClaimTypes(claim, true, time.Now()); errors.As(err, &typeErr) {
+		violations = append(violations, typeErr.Violations...)
+	}
+
+	var claimant models.User
+	if err := e.DB.Preload("UserGroup").First(&claimant, claim.UserID).Error; err != nil {
+		return err
+	}
+	violations = append(violations, CheckAllocations(claim, &claimant)...)
+
+	var rules []models.PolicyRule
+	if err := e.DB.Where("active = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	claim.Violations = []models.PolicyViolation{}
+	for _, finding := range policy.Evaluate(rules, claim, &claimant) {
+		severity := finding.Rule.Severity
+		if finding.Err != nil {
+			// A rule that can't be evaluated shouldn't hold up every claim;
+			// approvers see it instead
+			severity = models.SeverityWarn
+		}
+
+		justification := strings.TrimSpace(note.Justifications[finding.Rule.ID])
+		if severity == models.SeverityBlock || (severity == models.SeverityJustify && justification == "") {
+			violations = append(violations, Violation{
+				Line:     finding.Line,
+				Rule:     "policy",
+				RuleID:   finding.Rule.ID,
+				Severity: severity,
+				Date:     finding.Date,
+				Message:  finding.Message,
+			})
+			continue
+		}
+
+		claim.Violations = append(claim.Violations, models.PolicyViolation{
+			ClaimID:       claim.ID,
+			PolicyRuleID:  finding.Rule.ID,
+			RuleName:      finding.Rule.Name,
+			Severity:      severity,
+			Line:          finding.Line,
+			LineItemID:    finding.LineItemID,
+			Date:          finding.Date,
+			Message:       finding.Message,
+			Justification: justification,
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Permits reports whether a level's status permissions cover an action.
+func Permits(level *models.ApprovalLevel, action models.ClaimAction) bool {
+	switch action {
+	case models.ActionWithdraw:
+		return level.CanDraft
+	case models.ActionSubmit:
+		return level.CanSubmit
+	case models.ActionApprove, models.ActionApproveLevel:
+		return level.CanApprove
+	case models.ActionReject, models.ActionReturn:
+		// Returning a claim for revision is a softer rejection
+		return level.CanReject
+	case models.ActionStartPayment:
+		return level.CanSetPaymentInProgress
+	case models.ActionMarkPaid, models.ActionDisburse:
+		// Paying out a cash advance takes the same permission as paying a
+		// claim
+		return level.CanSetPaid
+	}
+	return false
+}
+
+// resumeLevel returns the level a returned claim picks up from when it is
+// resubmitted: the level that returned it if the claimant's group resumes
+// returned claims, otherwise nil to restart the chain.
+func (e *Engine) resumeLevel(claim *models.Claim) (*uint, error) {
+	if claim.Status != models.StatusReturned {
+		return nil, nil
+	}
+
+	var claimant models.User
+	if err := e.DB.Preload("UserGroup").First(&claimant, claim.UserID).Error; err != nil {
+		return nil, err
+	}
+	if claimant.UserGroup == nil || claimant.UserGroup.ResubmitPolicy != models.ResubmitResume {
+		return nil, nil
+	}
+
+	var returned models.ClaimApproval
+	err := e.DB.Where("claim_id = ? AND round = ? AND action = ?", claim.ID, claim.Round, models.ActionReturn).
+		Order("created_at DESC").First(&returned).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return returned.ApprovalLevelID, nil
+}
+
+// record moves the claim and writes the audit entry in one transaction.
+func (e *Engine) record(claim *models.Claim, action models.ClaimAction, level *models.ApprovalLevel, actor, onBehalfOf *models.User, reason *models.ReasonCode, comments string, warnings []string) (*models.ClaimApproval, error) {
+	if err := Apply(claim, action, actor); err != nil {
+		return nil, err
+	}
+	if action == models.ActionSubmit {
+		claim.Round++
+	}
+
+	approval := &models.ClaimApproval{
+		ClaimID:    claim.ID,
+		ApproverID: &actor.ID,
+		Status:     claim.Status,
+		Action:     action,
+		Round:      claim.Round,
+		Comments:   comments,
+		Warnings:   warnings,
+	}
+	if level != nil {
+		approval.ApprovalLevelID = &level.ID
+	}
+	if onBehalfOf != nil {
+		approval.OnBehalfOfID = &onBehalfOf.ID
+	}
+	if reason != nil {
+		approval.ReasonCodeID = &reason.ID
+	}
+
+	err := e.DB.Transaction(func(tx *gorm.DB) error {
+		// The final approval offsets the claim against the cash advance it
+		// was filed for
+		if action == models.ActionApprove {
+			if err := advance.Settle(tx, claim); err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(claim).Error; err != nil {
+			return err
+		}
+		// Each submission fixes the conversion of the claim's lines and
+		// replaces the policy violations and duplicates of the last one
+		if action == models.ActionSubmit {
+			if err := currency.SaveLines(tx, claim.Lines); err != nil {
+				return err
+			}
+			if err := tx.Where("claim_id = ?", claim.ID).Delete(&models.PolicyViolation{}).Error; err != nil {
+				return err
+			}
+			if len(claim.Violations) > 0 {
+				if err := tx.Create(&claim.Violations).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("claim_id = ?", claim.ID).Delete(&models.DuplicateMatch{}).Error; err != nil {
+				return err
+			}
+			if len(claim.Duplicates) > 0 {
+				if err := tx.Omit(clause.Associations).Create(&claim.Duplicates).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Omit(clause.Associations).Create(approval).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+// Recipients resolves who a level's assignments cover into users, e.g. to
+// notify them.
+func (e *Engine) Recipients(level *models.ApprovalLevel) ([]models.User, error) {
+	users := []models.User{}
+	seen := map[uint]bool{}
+	for _, assignment := range Assignments(level) {
+		query := e.DB.Model(&models.User{})
+		switch assignment.Type {
+		case models.ApproverTypeUser:
+			if assignment.UserID == nil {
+				continue
+			}
+			query = query.Where("id = ?", *assignment.UserID)
+		case models.ApproverTypeGroup:
+			if assignment.UserGroupID == nil {
+				continue
+			}
+			query = query.Where("user_group_id = ?", *assignment.UserGroupID)
+		case models.ApproverTypeRole:
+			query = query.Where("role = ?", assignment.Role)
+		default:
+			continue
+		}
+
+		var matched []models.User
+		if err := query.Find(&matched).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range matched {
+			if !seen[user.ID] {
+				seen[user.ID] = true
+				users = append(users, user)
+			}
+		}
+	}
+	return users, nil
+}
+
+// Remind records that the approvers of a pending level were reminded.
+func (e *Engine) Remind(claim *models.Claim, level *models.ApprovalLevel, comments string) (*models.ClaimApproval, error) {
+	return e.note(claim, models.ActionRemind, level, nil, comments)
+}
+
+// Escalate records that a pending level is overdue and hands it to another
+// user, or on to the next level when to is nil.
+func (e *Engine) Escalate(claim *models.Claim, level *models.ApprovalLevel, to *models.User, comments string) (*models.ClaimApproval, error) {
+	return e.note(claim, models.ActionEscalate, level, to, comments)
+}
+
+// note writes an audit entry that leaves the claim's status unchanged.
+func (e *Engine) note(claim *models.Claim, action models.ClaimAction, level *models.ApprovalLevel, escalatedTo *models.User, comments string) (*models.ClaimApproval, error) {
+	approval := &models.ClaimApproval{
+		ClaimID:         claim.ID,
+		ApprovalLevelID: &level.ID,
+		Status:          claim.Status,
+		Action:          action,
+		Round:           claim.Round,
+		Comments:        comments,
+	}
+	if escalatedTo != nil {
+		approval.EscalatedToID = &escalatedTo.ID
+	}
+
+	if err := e.DB.Omit(clause.Associations).Create(approval).Error; err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
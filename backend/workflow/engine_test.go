@@ -0,0 +1,93 @@
+package workflow
+
+import (
+	"testing"
+	"time"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+func TestNewProgress(t *testing.T) {
+	manager, director := uint(3), uint(4)
+	limit := money.FromInt(1000)
+	levels := []models.ApprovalLevel{
+		{ID: 10, Level: 1, ApproverID: &manager, MaxAmount: &limit},
+		{ID: 20, Level: 2, ApproverID: &director},
+	}
+	start := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+	levelID := func(id uint) *uint { return &id }
+
+	tests := []struct {
+		name      string
+		amount    string
+		approvals []models.ClaimApproval
+		chain     int
+		current   uint // 0 once every level has approved
+		since     time.Time
+	}{
+		{"just submitted", "500", []models.ClaimApproval{
+			{Action: models.ActionSubmit, CreatedAt: at(0)},
+		}, 1, 10, at(0)},
+		{"approved", "500", []models.ClaimApproval{
+			{Action: models.ActionSubmit, CreatedAt: at(0)},
+			{Action: models.ActionApproveLevel, ApprovalLevelID: levelID(10), CreatedAt: at(2)},
+		}, 1, 0, at(2)},
+		{"over the first level's authority", "1500", []models.ClaimApproval{
+			{Action: models.ActionSubmit, CreatedAt: at(0)},
+			{Action: models.ActionApproveLevel, ApprovalLevelID: levelID(10), CreatedAt: at(2)},
+		}, 2, 20, at(2)},
+		{"escalated past the first level", "1500", []models.ClaimApproval{
+			{Action: models.ActionSubmit, CreatedAt: at(0)},
+			{Action: models.ActionEscalate, ApprovalLevelID: levelID(10), CreatedAt: at(5)},
+		}, 2, 20, at(5)},
+	}
+	for _, tt := range tests {
+		claim := &models.Claim{ID: 1, BaseAmount: money.MustParse(tt.amount)}
+		progress := newProgress(claim, levels, tt.approvals)
+		if len(progress.Chain) != tt.chain {
+			t.Errorf("%s: chain of %d levels, want %d", tt.name, len(progress.Chain), tt.chain)
+		}
+		switch {
+		case progress.Current == nil && tt.current != 0:
+			t.Errorf("%s: no current level, want level %d", tt.name, tt.current)
+		case progress.Current != nil && progress.Current.ID != tt.current:
+			t.Errorf("%s: current level %d, want %d", tt.name, progress.Current.ID, tt.current)
+		}
+		if !progress.Since.Equal(tt.since) {
+			t.Errorf("%s: pending since %s, want %s", tt.name, progress.Since, tt.since)
+		}
+	}
+}
+
+// TestNewProgressSharesLevels checks that an escalation of one claim's
+// level doesn't leak into other claims routed over the same levels, as
+// they are when Progresses loads a whole list.
+func TestNewProgressSharesLevels(t *testing.T) {
+	manager, deputy := uint(3), uint(7)
+	approvers := make([]models.ApprovalLevelApprover, 1, 4)
+	approvers[0] = models.ApprovalLevelApprover{ApprovalLevelID: 10, Type: models.ApproverTypeUser, UserID: &manager}
+	levels := []models.ApprovalLevel{{ID: 10, Level: 1, Approvers: approvers}}
+	levelID := uint(10)
+
+	escalated := newProgress(&models.Claim{ID: 1}, levels, []models.ClaimApproval{
+		{Action: models.ActionEscalate, ApprovalLevelID: &levelID, EscalatedToID: &deputy, EscalatedTo: &models.User{ID: deputy}},
+	})
+	plain := newProgress(&models.Claim{ID: 2}, levels, nil)
+
+	if n := len(escalated.Current.Approvers); n != 2 {
+		t.Errorf("escalated level has %d approvers, want 2", n)
+	}
+	if n := len(plain.Current.Approvers); n != 1 {
+		t.Errorf("other claim's level has %d approvers, want 1", n)
+	}
+	if n := len(levels[0].Approvers); n != 1 {
+		t.Errorf("loaded level has %d approvers, want 1", n)
+	}
+	if again := newProgress(&models.Claim{ID: 3}, levels, []models.ClaimApproval{
+		{Action: models.ActionEscalate, ApprovalLevelID: &levelID, EscalatedToID: &manager, EscalatedTo: &models.User{ID: manager}},
+	}); *escalated.Current.Approvers[1].UserID != deputy || *again.Current.Approvers[1].UserID != manager {
+		t.Error("escalations of different claims overwrote each other")
+	}
+}
@@ -0,0 +1,64 @@
+package workflow
+
+import (
+	"errors"
+
+	"hrcs/backend/models"
+	"hrcs/backend/money"
+)
+
+// SelectChain picks the chain that applies to a claim type out of a group's
+// levels. Levels limited to the claim's type are the most specific match
+// and win; otherwise the group's default levels, which carry no claim type,
+// are used.
+func SelectChain(levels []models.ApprovalLevel, claimTypeID uint) []models.ApprovalLevel {
+	specific := []models.ApprovalLevel{}
+	defaults := []models.ApprovalLevel{}
+	for _, level := range levels {
+		if len(level.ClaimTypes) == 0 {
+			defaults = append(defaults, level)
+			continue
+		}
+		for _, ct := range level.ClaimTypes {
+			if ct.ID == claimTypeID {
+				specific = append(specific, level)
+				break
+			}
+		}
+	}
+
+	if len(specific) > 0 {
+		return specific
+	}
+	return defaults
+}
+
+// Route trims a group's ordered levels to the chain a claim of the given
+// amount has to pass. Levels whose minimum is above the amount are skipped,
+// and the chain stops at the first level whose authority covers the amount,
+// so small claims finish early and large ones escalate. If no level covers
+// the amount, every applicable level is required.
+func Route(levels []models.ApprovalLevel, amount money.Decimal) []models.ApprovalLevel {
+	chain := []models.ApprovalLevel{}
+	for _, level := range levels {
+		if amount.LessThan(level.MinAmount) {
+			continue
+		}
+		chain = append(chain, level)
+		if level.MaxAmount == nil || !amount.GreaterThan(*level.MaxAmount) {
+			break
+		}
+	}
+	return chain
+}
+
+// ValidateAmountBand checks an approval level's amount band.
+func ValidateAmountBand(minAmount money.Decimal, maxAmount *money.Decimal) error {
+	if minAmount.Sign() < 0 {
+		return errors.New("Minimum amount cannot be negative")
+	}
+	if maxAmount != nil && maxAmount.LessThan(minAmount) {
+		return errors.New("Maximum amount must not be below the minimum amount")
+	}
+	return nil
+}
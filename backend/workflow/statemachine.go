@@ -0,0 +1,236 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"hrcs/backend/models"
+)
+
+// Guard is evaluated before a transition is applied. Returning an error
+// blocks the transition.
+type Guard func(claim *models.Claim, actor *models.User) error
+
+// Transition describes a single named move in the claim lifecycle.
+type Transition struct {
+	Action models.ClaimAction
+	From   []models.ClaimStatus
+	To     models.ClaimStatus
+	Guards []Guard
+}
+
+// transitions is the central table every status-changing handler goes
+// through. Anything not listed here is an illegal transition.
+var transitions = []Transition{
+	{
+		Action: models.ActionSubmit,
+		From:   []models.ClaimStatus{models.StatusDraft, models.StatusReturned},
+		To:     models.StatusSubmitted,
+		Guards: []Guard{isComplete},
+	},
+	{
+		Action: models.ActionWithdraw,
+		From:   []models.ClaimStatus{models.StatusSubmitted},
+		To:     models.StatusDraft,
+	},
+	{
+		// Called off by the claimant at any point before approval
+		Action: models.ActionCancel,
+		From:   []models.ClaimStatus{models.StatusDraft, models.StatusSubmitted, models.StatusInReview, models.StatusReturned, models.StatusRejected},
+		To:     models.StatusCancelled,
+		Guards: []Guard{isClaimant},
+	},
+	{
+		// Approval by a level that is not the last in the chain
+		Action: models.ActionApproveLevel,
+		From:   []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview},
+		To:     models.StatusInReview,
+		Guards: []Guard{notClaimant},
+	},
+	{
+		// Approval by the last level in the chain
+		Action: models.ActionApprove,
+		From:   []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview},
+		To:     models.StatusApproved,
+		Guards: []Guard{notClaimant},
+	},
+	{
+		Action: models.ActionReject,
+		From:   []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview},
+		To:     models.StatusRejected,
+		Guards: []Guard{notClaimant},
+	},
+	{
+		// Sent back to the claimant for changes; resubmitting starts a new
+		// round
+		Action: models.ActionReturn,
+		From:   []models.ClaimStatus{models.StatusSubmitted, models.StatusInReview},
+		To:     models.StatusReturned,
+		Guards: []Guard{notClaimant},
+	},
+	{
+		Action: models.ActionStartPayment,
+		From:   []models.ClaimStatus{models.StatusApproved},
+		To:     models.StatusPaymentInProgress,
+		Guards: []Guard{notClaimant},
+	},
+	{
+		Action: models.ActionMarkPaid,
+		From:   []models.ClaimStatus{models.StatusPaymentInProgress},
+		To:     models.StatusPaid,
+		Guards: []Guard{notClaimant},
+	},
+}
+
+// TransitionError is returned when an action is not legal from the claim's
+// current status. Handlers surface it as a 409 Conflict.
+type TransitionError struct {
+	Action         models.ClaimAction   `json:"action,omitempty"`
+	From           models.ClaimStatus   `json:"from"`
+	To             models.ClaimStatus   `json:"to,omitempty"`
+	AllowedActions []models.ClaimAction `json:"allowed_actions"`
+}
+
+func (e *TransitionError) Error() string {
+	if e.Action != "" {
+		return fmt.Sprintf("cannot %s a claim that is %s", e.Action, e.From)
+	}
+	return fmt.Sprintf("cannot move a claim from %s to %s", e.From, e.To)
+}
+
+// GuardError is returned when the transition is legal but a guard refused
+// it, typically because of who is acting.
+type GuardError struct {
+	Action models.ClaimAction
+	Reason string
+}
+
+func (e *GuardError) Error() string {
+	return e.Reason
+}
+
+// ReasonError is returned when a rejection or return lacks a valid reason
+// code, or the code's mandatory comments.
+type ReasonError struct {
+	Action models.ClaimAction `json:"action"`
+	Code   string             `json:"reason_code,omitempty"`
+	Reason string             `json:"-"`
+}
+
+func (e *ReasonError) Error() string {
+	return e.Reason
+}
+
+// Lookup returns the transition registered for an action.
+func Lookup(action models.ClaimAction) (Transition, bool) {
+	for _, t := range transitions {
+		if t.Action == action {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// ActionFor resolves the action that moves a claim from one status to
+// another, for handlers that still accept a target status in the body.
+func ActionFor(from, to models.ClaimStatus) (models.ClaimAction, error) {
+	for _, t := range transitions {
+		if t.To == to && t.allows(from) {
+			return t.Action, nil
+		}
+	}
+	return "", &TransitionError{From: from, To: to, AllowedActions: AllowedActions(from)}
+}
+
+// CanTransition reports whether any action moves a claim from one status to
+// another.
+func CanTransition(from, to models.ClaimStatus) bool {
+	_, err := ActionFor(from, to)
+	return err == nil
+}
+
+// AllowedActions lists the actions that are legal from a status.
+func AllowedActions(from models.ClaimStatus) []models.ClaimAction {
+	actions := []models.ClaimAction{}
+	for _, t := range transitions {
+		if t.allows(from) {
+			actions = append(actions, t.Action)
+		}
+	}
+	return actions
+}
+
+// Check validates an action against the claim's current status and the
+// transition's guards without changing the claim.
+func Check(claim *models.Claim, action models.ClaimAction, actor *models.User) (Transition, error) {
+	t, ok := Lookup(action)
+	if !ok || !t.allows(claim.Status) {
+		return Transition{}, &TransitionError{Action: action, From: claim.Status, AllowedActions: AllowedActions(claim.Status)}
+	}
+
+	for _, guard := range t.Guards {
+		if err := guard(claim, actor); err != nil {
+			return Transition{}, &GuardError{Action: action, Reason: err.Error()}
+		}
+	}
+
+	return t, nil
+}
+
+// Apply runs Check and moves the claim to the transition's target status.
+// The caller is responsible for persisting the claim.
+func Apply(claim *models.Claim, action models.ClaimAction, actor *models.User) error {
+	t, err := Check(claim, action, actor)
+	if err != nil {
+		return err
+	}
+	claim.Status = t.To
+	return nil
+}
+
+func (t Transition) allows(from models.ClaimStatus) bool {
+	for _, s := range t.From {
+		if s == from {
+			return true
+		}
+	}
+	return false
+}
+
+func notClaimant(claim *models.Claim, actor *models.User) error {
+	if actor != nil && claim.UserID == actor.ID {
+		return errors.New("Cannot approve your own claim")
+	}
+	return nil
+}
+
+func isClaimant(claim *models.Claim, actor *models.User) error {
+	if actor == nil || claim.UserID != actor.ID {
+		return errors.New("Only the claimant can cancel a claim")
+	}
+	return nil
+}
+
+func isComplete(claim *models.Claim, actor *models.User) error {
+	if strings.TrimSpace(claim.Title) == "" {
+		return errors.New("Claim title is required")
+	}
+	if claim.Amount.Sign() <= 0 {
+		return errors.New("Claim amount must be greater than zero")
+	}
+
+	// Itemized claims are checked line by line
+	for i, line := range claim.Lines {
+		if line.ClaimTypeID == 0 {
+			return fmt.Errorf("Line %d needs a claim type", i+1)
+		}
+		if line.Amount.Sign() <= 0 {
+			return fmt.Errorf("Line %d amount must be greater than zero", i+1)
+		}
+		if line.Date.IsZero() {
+			return fmt.Errorf("Line %d needs a date", i+1)
+		}
+	}
+	return nil
+}
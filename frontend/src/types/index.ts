@@ -22,8 +22,354 @@ export interface UserGroup {
 export interface ClaimType {
   id: number
   name: string
+  code: string
   description?: string
-  is_active: boolean
+  category: 'travel' | 'medical' | 'equipment' | 'training' | 'entertainment' | 'other'
+  kind: ClaimKind
+  max_amount?: number
+  requires_receipt: boolean
+  requires_justification: boolean
+  validity_period: number
+  gl_account: string
+  active: boolean
+  created_at: string
+  updated_at: string
+}
+
+export type ClaimKind = 'standard' | 'mileage' | 'per-diem'
+
+export interface MileageRate {
+  id: number
+  vehicle_class: string
+  effective_from: string
+  unit: 'km' | 'mi'
+  currency: string
+  rate: number
+  created_at: string
+}
+
+export interface PerDiemRate {
+  id: number
+  destination: string
+  effective_from: string
+  currency: string
+  daily_rate: number
+  breakfast_deduction: number
+  lunch_deduction: number
+  dinner_deduction: number
+  created_at: string
+}
+
+export interface CalculationInput {
+  distance?: number
+  vehicle_class?: string
+  destination?: string
+  start_date?: string
+  end_date?: string
+  breakfasts?: number
+  lunches?: number
+  dinners?: number
+}
+
+export interface Calculation {
+  kind: ClaimKind
+  input: CalculationInput
+  mileage_rate?: MileageRate
+  per_diem_rate?: PerDiemRate
+  days?: number
+  amount: number
+  currency: string
+}
+
+export interface ClaimLineItem {
+  id: number
+  claim_id: number
+  date: string
+  claim_type_id: number
+  claim_type?: ClaimType
+  amount: number
+  currency: string
+  exchange_rate: number
+  base_amount: number
+  calculation?: Calculation
+  merchant?: string
+  description?: string
+  receipt_url?: string
+  attributes?: Record<string, string>
+  paid_by_card: boolean
+  allocations?: Allocation[]
+}
+
+export interface CostCenter {
+  id: number
+  code: string
+  name: string
+  description?: string
+  active: boolean
+  user_groups?: UserGroup[]
+  created_at: string
+  updated_at: string
+}
+
+export type Project = CostCenter
+
+export interface FiscalPeriod {
+  id: number
+  name: string
+  start_date: string
+  end_date: string
+  created_at: string
+  updated_at: string
+}
+
+export interface Budget {
+  id: number
+  fiscal_period_id: number
+  fiscal_period?: FiscalPeriod
+  user_group_id?: number
+  user_group?: UserGroup
+  cost_center_id?: number
+  cost_center?: CostCenter
+  claim_type_id?: number
+  claim_type?: ClaimType
+  amount: number
+  enforcement: 'none' | 'warn' | 'block'
+  created_at: string
+  updated_at: string
+}
+
+export interface BudgetActual {
+  budget: Budget
+  committed: number
+  approved: number
+  paid: number
+  remaining: number
+}
+
+export interface Allocation {
+  id: number
+  claim_id: number
+  line_item_id?: number
+  cost_center_id: number
+  cost_center?: CostCenter
+  project_id?: number
+  project?: Project
+  percent: number
+  created_at: string
+}
+
+export interface Attachment {
+  id: number
+  claim_id: number
+  line_item_id?: number
+  uploaded_by_id: number
+  uploaded_by?: User
+  file_name: string
+  content_type: string
+  size: number
+  checksum: string
+  created_at: string
+}
+
+export interface PolicyViolation {
+  id: number
+  claim_id: number
+  policy_rule_id: number
+  rule_name: string
+  severity: 'block' | 'warn' | 'justify'
+  line?: number
+  line_item_id?: number
+  date?: string
+  message: string
+  justification?: string
+  created_at: string
+}
+
+export interface DuplicateMatch {
+  id: number
+  claim_id: number
+  line?: number
+  line_item_id?: number
+  matched_claim_id: number
+  matched_claim?: Claim
+  matched_line?: number
+  matched_line_item_id?: number
+  matched_on: ('amount' | 'date' | 'merchant' | 'receipt')[]
+  exact: boolean
+  message: string
+  created_at: string
+}
+
+export interface CardTransaction {
+  id: number
+  user_id: number
+  user?: User
+  external_id: string
+  card_number?: string
+  date: string
+  amount: number
+  currency: string
+  merchant?: string
+  description?: string
+  source: 'csv' | 'ofx'
+  claim_id?: number
+  claim?: Claim
+  line_item_id?: number
+  matched_by?: 'manual' | 'auto'
+  reconciled_at?: string
+  created_at: string
+  updated_at: string
+}
+
+export type AdvanceStatus =
+  | 'requested'
+  | 'in-review'
+  | 'approved'
+  | 'rejected'
+  | 'cancelled'
+  | 'disbursed'
+  | 'settled'
+
+export interface CashAdvance {
+  id: number
+  user_id: number
+  user?: User
+  purpose: string
+  amount: number
+  currency: string
+  base_currency: string
+  base_amount: number
+  exchange_rate: number
+  outstanding: number
+  status: AdvanceStatus
+  needed_by?: string
+  disbursed_at?: string
+  settled_at?: string
+  approvals?: AdvanceApproval[]
+  settlements?: AdvanceSettlement[]
+  created_at: string
+  updated_at: string
+}
+
+export interface AdvanceApproval {
+  id: number
+  advance_id: number
+  approval_level_id?: number
+  approval_level?: ApprovalLevel
+  approver_id?: number
+  approver?: User
+  on_behalf_of_id?: number
+  on_behalf_of?: User
+  status: AdvanceStatus
+  action: 'approve' | 'approve-level' | 'reject' | 'cancel' | 'disburse'
+  comments?: string
+  created_at: string
+}
+
+export interface AdvanceSettlement {
+  id: number
+  advance_id: number
+  kind: 'claim' | 'repayment'
+  claim_id?: number
+  claim?: Claim
+  amount: number
+  comments?: string
+  created_at: string
+}
+
+export interface AdvanceBalance {
+  user_id: number
+  user?: User
+  currency: string
+  reimbursable: number
+  outstanding: number
+  // Positive when owed to the employee, negative when to be recovered
+  net: number
+}
+
+export type PayoutAccountType = 'checking' | 'savings'
+
+// Account identifiers are always masked, e.g. DE****************3000
+export interface PayoutAccount {
+  id: number
+  user_id: number
+  user?: User
+  account_holder: string
+  iban: string
+  account_number: string
+  routing_number: string
+  bic: string
+  account_type: PayoutAccountType | ''
+  pending_verification: boolean
+  verified_at?: string
+  verified_by_id?: number
+  verified_by?: User
+  updated_by_id: number
+  created_at: string
+  updated_at: string
+}
+
+export interface PayoutAccountChange {
+  id: number
+  user_id: number
+  actor_id: number
+  actor?: User
+  action: 'created' | 'updated' | 'removed' | 'verified'
+  fields?: string[]
+  iban?: string
+  account_number?: string
+  created_at: string
+}
+
+export interface JournalExport {
+  id: number
+  fiscal_period_id: number
+  fiscal_period?: FiscalPeriod
+  claim_count: number
+  total: number
+  currency: string
+  created_by_id: number
+  created_by?: User
+  created_at: string
+}
+
+export interface JournalLine {
+  account: string
+  description: string
+  debit: number
+  credit: number
+  cost_center?: string
+  project?: string
+}
+
+export interface JournalEntry {
+  claim_id: number
+  reference: string
+  date: string
+  currency: string
+  employee: string
+  narration: string
+  lines: JournalLine[]
+}
+
+export type PaymentBatchStatus = 'in-progress' | 'settled'
+
+export interface PaymentBatch {
+  id: number
+  reference: string
+  currency: string
+  total: number
+  claim_count: number
+  execution_date: string
+  status: PaymentBatchStatus
+  notes: string
+  created_by_id: number
+  created_by?: User
+  exported_at?: string
+  bank_reference: string
+  settled_at?: string
+  settled_by_id?: number
+  claims?: Claim[]
   created_at: string
   updated_at: string
 }
@@ -37,11 +383,32 @@ export interface Claim {
   title: string
   description: string
   amount: number
+  currency: string
+  base_currency: string
+  base_amount: number
+  exchange_rate: number
+  rate_date?: string
+  paid_by_card: boolean
+  reimbursable_amount: number
+  advance_id?: number
+  advance?: CashAdvance
+  advance_offset: number
+  payment_batch_id?: number
+  payment_reference?: string
+  journal_export_id?: number
+  calculation?: Calculation
+  expense_date?: string
   status: ClaimStatus
   submitted_at?: string
   approved_at?: string
   rejected_at?: string
   paid_at?: string
+  lines?: ClaimLineItem[]
+  allocations?: Allocation[]
+  attachments?: Attachment[]
+  violations?: PolicyViolation[]
+  duplicates?: DuplicateMatch[]
+  card_transactions?: CardTransaction[]
   approvals?: Approval[]
   created_at: string
   updated_at: string
@@ -86,10 +453,13 @@ export interface ApprovalPermissions {
 export type ClaimStatus = 
   | 'draft'
   | 'submitted'
+  | 'in-review'
+  | 'returned'
   | 'approved'
   | 'rejected'
   | 'payment-in-progress'
   | 'paid'
+  | 'cancelled'
 
 export interface Approval {
   id: number
@@ -100,6 +470,7 @@ export interface Approval {
   level?: ApprovalLevel
   action: 'approve' | 'reject'
   comments?: string
+  warnings?: string[]
   created_at: string
 }
 
@@ -139,7 +510,19 @@ export interface ApiResponse<T = any> {
   error?: string
 }
 
+export interface ExchangeRate {
+  id: number
+  base: string
+  quote: string
+  rate: number
+  date: string
+  source: 'manual' | 'csv' | 'ecb'
+  created_at: string
+  updated_at: string
+}
+
 export interface DashboardStats {
+  currency: string
   totalClaims: number
   pendingClaims: number
   approvedClaims: number
@@ -149,4 +532,6 @@ export interface DashboardStats {
   recentClaims: Claim[]
   claimsByStatus: { status: string; count: number }[]
   claimsByType: { type: string; count: number; amount: number }[]
+  claimsByCostCenter?: { code: string; name: string; count: number; amount: number }[]
+  claimsByProject?: { code: string; name: string; count: number; amount: number }[]
 }
\ No newline at end of file